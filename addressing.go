@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Addressing methods a level's subnets can be marked with.
+const (
+	addressingSLAAC  = "slaac"
+	addressingDHCPv6 = "dhcpv6"
+	addressingStatic = "static"
+)
+
+// parseAddressing reads "64=slaac,127=static" into a map from prefix length
+// to addressing method.
+func parseAddressing(s string) (map[int]string, error) {
+	return parseLevelMap(s, "addressing method", []string{addressingSLAAC, addressingDHCPv6, addressingStatic})
+}
+
+// checkAddressing validates the addressing method chosen for each level.
+// Combinations that cannot work are returned as infeasibilities; workable but
+// noteworthy ones come back as advisory notes.
+func checkAddressing(methods map[int]string, levels []int) ([]infeasibility, []string) {
+	var problems []infeasibility
+	var notes []string
+
+	present := make(map[int]bool)
+	for _, level := range levels {
+		present[level] = true
+	}
+
+	keys := make([]int, 0, len(methods))
+	for level := range methods {
+		keys = append(keys, level)
+	}
+	sort.Ints(keys)
+
+	for _, level := range keys {
+		method := methods[level]
+		switch {
+		case !present[level]:
+			problems = append(problems, infeasibility{
+				problem:    fmt.Sprintf("addressing is set for /%d, which is not one of the subnet levels", level),
+				suggestion: fmt.Sprintf("add %d to -l or remove it from -addressing", level),
+			})
+		case level < 64:
+			problems = append(problems, infeasibility{
+				problem:    fmt.Sprintf("/%d is marked %s, but addressing methods apply to link prefixes (/64 or longer)", level, method),
+				suggestion: "mark the /64 (or longer) level instead",
+			})
+		case method == addressingSLAAC && level != 64:
+			problems = append(problems, infeasibility{
+				problem:    fmt.Sprintf("/%d is marked slaac, but SLAAC only forms addresses on /64 prefixes (RFC 4862)", level),
+				suggestion: fmt.Sprintf("use %d=dhcpv6 or %d=static", level, level),
+			})
+		case method == addressingDHCPv6 && level >= 127:
+			problems = append(problems, infeasibility{
+				problem:    fmt.Sprintf("/%d is marked dhcpv6, but a /%d leaves no addresses to lease", level, level),
+				suggestion: fmt.Sprintf("use %d=static", level),
+			})
+		case method == addressingDHCPv6:
+			notes = append(notes, fmt.Sprintf("/%d uses stateful DHCPv6: Android hosts do not request DHCPv6 addresses, so pair it with SLAAC on /64s where they are expected.", level))
+		}
+	}
+	return problems, notes
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// AllocationBatch is the document allocate returns: every prefix claimed
+// in one run.
+type AllocationBatch struct {
+	POP         string   `json:"pop"`
+	Pool        string   `json:"pool,omitempty"`
+	Size        int      `json:"size"`
+	Description string   `json:"description,omitempty"`
+	Prefixes    []string `json:"prefixes"`
+}
+
+// freePrefixes returns the first count /size prefixes of blocks, in
+// address order, that overlap none of used. Both are walked once in
+// address order, so a batch costs the blocks and assignments passed over,
+// not every candidate against every assignment.
+func freePrefixes(blocks, used []netip.Prefix, size, count int) []netip.Prefix {
+	blocks = append([]netip.Prefix(nil), blocks...)
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Addr().Less(blocks[j].Addr()) })
+	used = append([]netip.Prefix(nil), used...)
+	sort.Slice(used, func(i, j int) bool { return used[i].Addr().Less(used[j].Addr()) })
+
+	var free []netip.Prefix
+	j := 0
+	for _, block := range blocks {
+		if block.Bits() > size {
+			continue
+		}
+		cursor, end := block.Addr(), lastAddress(block)
+		for len(free) < count && cursor.IsValid() && cursor.Compare(end) <= 0 {
+			candidate := netip.PrefixFrom(cursor, size)
+			for j < len(used) && lastAddress(used[j]).Less(cursor) {
+				j++
+			}
+			last := lastAddress(candidate)
+			if j < len(used) && used[j].Addr().Compare(last) <= 0 {
+				// Resume after whichever ends later, the assignment or
+				// the candidate it lies in
+				if lastAddress(used[j]).Compare(last) > 0 {
+					last = lastAddress(used[j])
+				}
+				cursor = last.Next()
+				continue
+			}
+			free = append(free, candidate)
+			cursor = last.Next()
+		}
+	}
+	return free
+}
+
+// appendAssignments writes the claimed prefixes to the end of the
+// assignments file through a temporary file renamed over it, so readers see
+// the file either before or after the whole batch.
+func appendAssignments(path string, prefixes []netip.Prefix, pop, description string) error {
+	data, err := os.ReadFile(path)
+	perm := os.FileMode(0644)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		data = []byte("prefix,pop,description\n")
+	case err != nil:
+		return err
+	default:
+		if info, err := os.Stat(path); err == nil {
+			perm = info.Mode().Perm()
+		}
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	for _, p := range prefixes {
+		w.Write([]string{p.String(), pop, description})
+	}
+	w.Flush()
+
+	return writeFileAtomic(path, append(data, buf.Bytes()...), perm)
+}
+
+// runAllocate implements the allocate command.
+func runAllocate(args []string) {
+	fs := flag.NewFlagSet("allocate", flag.ExitOnError)
+	planPath := fs.String("plan", "", "Plan JSON file the prefixes are allocated from")
+	assignedPath := fs.String("assigned", "", "Assignments CSV (prefix,pop,description) the batch is checked against and added to; created if missing")
+	popRef := fs.String("pop", "", "POP number or name to allocate in")
+	pool := fs.String("pool", "", "Allocate from this pool of the POP only")
+	size := fs.Int("size", 48, "Prefix length to allocate")
+	count := fs.Int("count", 1, "Number of prefixes to claim")
+	description := fs.String("description", "", "Description recorded with every prefix of the batch")
+	dryRun := fs.Bool("dry-run", false, "Show the prefixes that would be claimed without recording them")
+	jsonOut := fs.Bool("j", false, "JSON output format")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner allocate -plan plan.json -assigned assigned.csv -pop n [-pool name] [-size 48] [-count n] [-description text] [-dry-run] [-j]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 || *planPath == "" || *assignedPath == "" || *popRef == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *count < 1 || *size < 1 || *size > 128 {
+		fmt.Println("Error: -count must be at least 1 and -size from 1 to 128")
+		os.Exit(2)
+	}
+
+	plan, err := loadPlan(*planPath)
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+	_, pops, err := auditBlocks(plan)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	var pop *auditPOP
+	for i := range pops {
+		if matchesPOP(pops[i].alloc, *popRef) {
+			pop = &pops[i]
+			break
+		}
+	}
+	if pop == nil {
+		fmt.Printf("Error: the plan has no POP %s\n", *popRef)
+		os.Exit(1)
+	}
+	blocks := []netip.Prefix{pop.prefix}
+	if *pool != "" {
+		blocks = nil
+		for _, p := range pop.alloc.Pools {
+			if p.Name != *pool {
+				continue
+			}
+			for _, prefix := range p.Prefixes {
+				if block, err := netip.ParsePrefix(prefix); err == nil {
+					blocks = append(blocks, block)
+				}
+			}
+		}
+		if len(blocks) == 0 {
+			fmt.Printf("Error: %s has no pool %s\n", popName(pop.alloc), *pool)
+			os.Exit(1)
+		}
+	}
+	if *size < blocks[0].Bits() {
+		fmt.Printf("Error: %v\n", failf(ErrPrefixTooSmall, "a /%d does not fit in the /%d blocks of %s", *size, blocks[0].Bits(), popName(pop.alloc)))
+		os.Exit(1)
+	}
+
+	// Claims are serialized by a lock file beside the assignments, so two
+	// provisioning runs cannot hand out the same prefix
+	unlock := func() {}
+	if !*dryRun {
+		if unlock, err = lockFile(*assignedPath); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	fail := func(format string, args ...interface{}) {
+		fmt.Printf("Error: "+format+"\n", args...)
+		unlock()
+		os.Exit(1)
+	}
+
+	entries, invalid, err := loadAuditCSV(*assignedPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fail("%v", err)
+	}
+	if len(invalid) > 0 {
+		// Space an unreadable line claims cannot be told apart from free space
+		fail("%s: %s is not an IPv6 prefix; fix it before allocating", invalid[0].Source, invalid[0].Prefix)
+	}
+	used := make([]netip.Prefix, len(entries))
+	for i, e := range entries {
+		used[i] = e.Prefix
+	}
+
+	free := freePrefixes(blocks, used, *size, *count)
+	where := popName(pop.alloc)
+	if *pool != "" {
+		where += " pool " + *pool
+	}
+	if len(free) < *count {
+		fail("%v", failf(ErrPrefixTooSmall, "%s has %d free /%ds, not %d; nothing was allocated", where, len(free), *size, *count))
+	}
+	popLabel := pop.alloc.Name
+	if popLabel == "" {
+		popLabel = strconv.Itoa(pop.alloc.POPNumber)
+	}
+	if !*dryRun {
+		if err := appendAssignments(*assignedPath, free, popLabel, *description); err != nil {
+			fail("%v", err)
+		}
+	}
+	unlock()
+
+	batch := AllocationBatch{POP: popLabel, Pool: *pool, Size: *size, Description: *description}
+	for _, p := range free {
+		batch.Prefixes = append(batch.Prefixes, p.String())
+	}
+	if *jsonOut {
+		jsonData, err := json.MarshalIndent(batch, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+	for _, p := range batch.Prefixes {
+		fmt.Println(p)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAllocateRecordsBatches(t *testing.T) {
+	opts := defaultPlanOptions()
+	opts.Subnet, opts.POPCount, opts.PreferredSize, opts.SubnetLevels = "2001:db8::/32", 2, 40, []int{48, 64}
+	plan, err := generateIPv6Plan(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	planPath := writeTestPlan(t, plan)
+	assigned := filepath.Join(t.TempDir(), "assigned.csv")
+
+	runAllocate([]string{"-plan", planPath, "-assigned", assigned, "-pop", "1", "-count", "2", "-description", "first"})
+	runAllocate([]string{"-plan", planPath, "-assigned", assigned, "-pop", "1", "-description", "second"})
+	runAllocate([]string{"-plan", planPath, "-assigned", assigned, "-pop", "1", "-dry-run"})
+
+	data, err := os.ReadFile(assigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "prefix,pop,description\n2001:db8::/48,1,first\n2001:db8:1::/48,1,first\n2001:db8:2::/48,1,second\n"
+	if string(data) != want {
+		t.Errorf("assignments:\n%s\nwant:\n%s", data, want)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(assigned))
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".lock") || strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("allocate left %s behind", e.Name())
+		}
+	}
+}
+
+func TestAppendAssignmentsKeepsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "assigned.csv")
+	if err := os.WriteFile(path, []byte("prefix,pop,description\n2001:db8::/48,ams,core"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendAssignments(path, nil, "ams", ""); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "prefix,pop,description\n2001:db8::/48,ams,core\n" {
+		t.Errorf("assignments %q, want the old rows with the last line ended", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode %v, want 0600", info.Mode().Perm())
+	}
+}
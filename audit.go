@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kinds of audit findings.
+const (
+	findingInvalid     = "invalid"
+	findingOutside     = "outside"
+	findingUnallocated = "unallocated"
+	findingSpans       = "spans-pops"
+	findingWrongPOP    = "wrong-pop"
+	findingOverlap     = "overlap"
+	findingDeaggregate = "more-specific"
+)
+
+// auditChecks names each kind of finding as a check that passes when there
+// are none of them, for JUnit and TAP reports.
+var auditChecks = []struct{ kind, name string }{
+	{findingInvalid, "Entries are IPv6 prefixes"},
+	{findingOutside, "Prefixes are inside the base subnet"},
+	{findingUnallocated, "Prefixes are inside a POP block"},
+	{findingSpans, "Prefixes do not span POP blocks"},
+	{findingWrongPOP, "Prefixes are in their listed POP"},
+	{findingOverlap, "Prefixes do not overlap"},
+	{findingDeaggregate, "Announcements match the POP aggregates"},
+}
+
+// auditEntry is one prefix being checked against the plan, with where it
+// came from so findings can point back at it.
+type auditEntry struct {
+	Prefix      netip.Prefix
+	POP         string
+	Description string
+	Source      string
+}
+
+// AuditFinding is one problem with an audited prefix.
+type AuditFinding struct {
+	Kind   string `json:"kind"`
+	Prefix string `json:"prefix"`
+	Source string `json:"source"`
+	Detail string `json:"detail"`
+}
+
+// AuditReport is the result of checking a set of prefixes against a plan.
+type AuditReport struct {
+	Plan     string         `json:"plan"`
+	Checked  int            `json:"checked"`
+	Findings []AuditFinding `json:"findings"`
+}
+
+// auditPOP is a POP block of the plan.
+type auditPOP struct {
+	alloc  POPAlloc
+	prefix netip.Prefix
+}
+
+// auditPrefixes checks that every entry aggregates under the POP it belongs
+// to: inside the base, inside exactly one POP block, in the declared POP when
+// one is given, and not overlapping another entry.
+func auditPrefixes(plan IPv6Plan, entries []auditEntry) (AuditReport, error) {
+	report := AuditReport{Plan: plan.BaseSubnet, Checked: len(entries), Findings: []AuditFinding{}}
+	base, pops, err := auditBlocks(plan)
+	if err != nil {
+		return report, err
+	}
+	index := newPOPIndex(pops)
+	add := report.adder()
+
+	for _, e := range entries {
+		if !inside(e.Prefix, base) {
+			add(findingOutside, e, "not inside the plan's base %s", base)
+			continue
+		}
+		within, spans := index.locate(e.Prefix)
+		switch {
+		case within == nil && spans > 0:
+			add(findingSpans, e, "covers %d POP blocks; it would leak more-specifics of other POPs", spans)
+		case within == nil:
+			add(findingUnallocated, e, "inside the base but outside every POP block")
+		case e.POP != "" && !matchesPOP(within.alloc, e.POP):
+			add(findingWrongPOP, e, "listed for POP %s but inside %s (%s)", e.POP, popName(within.alloc), within.prefix)
+		}
+	}
+
+	sorted := append([]auditEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if c := sorted[i].Prefix.Addr().Compare(sorted[j].Prefix.Addr()); c != 0 {
+			return c < 0
+		}
+		return sorted[i].Prefix.Bits() < sorted[j].Prefix.Bits()
+	})
+	var open []auditEntry
+	for _, e := range sorted {
+		for len(open) > 0 && !open[len(open)-1].Prefix.Contains(e.Prefix.Addr()) {
+			open = open[:len(open)-1]
+		}
+		if len(open) > 0 {
+			outer := open[len(open)-1]
+			if outer.Prefix == e.Prefix {
+				add(findingOverlap, e, "duplicate of %s", outer.Source)
+			} else {
+				add(findingOverlap, e, "inside %s from %s", outer.Prefix, outer.Source)
+			}
+		}
+		open = append(open, e)
+	}
+	return report, nil
+}
+
+// auditRIB checks announced routes against the plan's aggregates. Only the
+// base and the POP blocks themselves should be announced; routes outside
+// the base belong to someone else and are not counted.
+func auditRIB(plan IPv6Plan, routes []auditEntry) (AuditReport, error) {
+	report := AuditReport{Plan: plan.BaseSubnet, Findings: []AuditFinding{}}
+	base, pops, err := auditBlocks(plan)
+	if err != nil {
+		return report, err
+	}
+	index := newPOPIndex(pops)
+	add := report.adder()
+
+	seen := make(map[netip.Prefix]bool)
+	for _, e := range routes {
+		if !inside(e.Prefix, base) || seen[e.Prefix] {
+			continue
+		}
+		seen[e.Prefix] = true
+		report.Checked++
+		if e.Prefix == base {
+			continue
+		}
+		within, spans := index.locate(e.Prefix)
+		switch {
+		case within == nil && spans > 0:
+			add(findingSpans, e, "announced over %d POP blocks instead of the base or a POP aggregate", spans)
+		case within == nil:
+			add(findingUnallocated, e, "announced from space no POP is allocated")
+		case within.prefix != e.Prefix:
+			add(findingDeaggregate, e, "more-specific of %s aggregate %s", popName(within.alloc), within.prefix)
+		}
+	}
+	return report, nil
+}
+
+// auditBlocks parses the base and POP blocks of plan.
+func auditBlocks(plan IPv6Plan) (netip.Prefix, []auditPOP, error) {
+	base, err := netip.ParsePrefix(plan.BaseSubnet)
+	if err != nil {
+		return base, nil, failf(ErrInvalidPrefix, "invalid base subnet %q", plan.BaseSubnet)
+	}
+	var pops []auditPOP
+	for _, pop := range plan.POPAllocations {
+		p, err := netip.ParsePrefix(pop.POPSubnet)
+		if err != nil {
+			return base, nil, failf(ErrInvalidPrefix, "invalid POP subnet %q", pop.POPSubnet)
+		}
+		pops = append(pops, auditPOP{pop, p})
+	}
+	return base, pops, nil
+}
+
+// popIndex holds a plan's POP blocks sorted by address, shorter blocks
+// first where two start together, so finding the block that holds a prefix
+// is a binary search rather than a scan of every POP. Audits check each of
+// possibly millions of IPAM entries or routes against it. The blocks are
+// masked, as a plan generated despite warnings can hold POP subnets with
+// host bits set.
+type popIndex struct {
+	blocks []auditPOP
+	// overlap is set when some block lies inside another, which only a
+	// plan generated despite warnings has; locate then scans every block.
+	overlap bool
+}
+
+func newPOPIndex(pops []auditPOP) popIndex {
+	idx := popIndex{blocks: make([]auditPOP, len(pops))}
+	for i, pop := range pops {
+		idx.blocks[i] = auditPOP{pop.alloc, pop.prefix.Masked()}
+	}
+	sort.SliceStable(idx.blocks, func(i, j int) bool {
+		if c := idx.blocks[i].prefix.Addr().Compare(idx.blocks[j].prefix.Addr()); c != 0 {
+			return c < 0
+		}
+		return idx.blocks[i].prefix.Bits() < idx.blocks[j].prefix.Bits()
+	})
+	idx.overlap = len(idx.overlaps()) > 0
+	return idx
+}
+
+// locate returns the POP block holding p, or the number of POP blocks p
+// covers when it is shorter than they are. Where blocks do not overlap, the
+// block holding p is the last one starting at or before it. Where they do,
+// the longest block holding p is returned, the first in the plan's order
+// among equals.
+func (idx popIndex) locate(p netip.Prefix) (*auditPOP, int) {
+	if idx.overlap {
+		return idx.scan(p)
+	}
+	blocks := idx.blocks
+	start, end := p.Masked().Addr(), lastAddress(p)
+	after := sort.Search(len(blocks), func(i int) bool { return blocks[i].prefix.Addr().Compare(start) > 0 })
+	for i := after - 1; i >= 0 && blocks[i].prefix.Addr() == blocks[after-1].prefix.Addr(); i-- {
+		if inside(p, blocks[i].prefix) {
+			return &blocks[i], 0
+		}
+	}
+	first := sort.Search(len(blocks), func(i int) bool { return blocks[i].prefix.Addr().Compare(start) >= 0 })
+	past := sort.Search(len(blocks), func(i int) bool { return blocks[i].prefix.Addr().Compare(end) > 0 })
+	return nil, past - first
+}
+
+// scan is locate for overlapping blocks, checking each one.
+func (idx popIndex) scan(p netip.Prefix) (*auditPOP, int) {
+	var within *auditPOP
+	covers := 0
+	for i := range idx.blocks {
+		block := &idx.blocks[i]
+		switch {
+		case inside(p, block.prefix):
+			if within == nil || block.prefix.Bits() > within.prefix.Bits() {
+				within = block
+			}
+		case inside(block.prefix, p):
+			covers++
+		}
+	}
+	if within != nil {
+		return within, 0
+	}
+	return nil, covers
+}
+
+// overlaps returns each POP block that lies inside another, with the
+// innermost block holding it, in one pass over the sorted blocks.
+func (idx popIndex) overlaps() [][2]auditPOP {
+	var found [][2]auditPOP
+	var open []auditPOP
+	for _, pop := range idx.blocks {
+		for len(open) > 0 && !open[len(open)-1].prefix.Contains(pop.prefix.Addr()) {
+			open = open[:len(open)-1]
+		}
+		if len(open) > 0 {
+			found = append(found, [2]auditPOP{pop, open[len(open)-1]})
+		}
+		open = append(open, pop)
+	}
+	return found
+}
+
+// inside reports whether p lies within outer.
+func inside(p, outer netip.Prefix) bool {
+	return outer.Bits() <= p.Bits() && outer.Contains(p.Addr())
+}
+
+func (report *AuditReport) adder() func(kind string, e auditEntry, format string, args ...interface{}) {
+	return func(kind string, e auditEntry, format string, args ...interface{}) {
+		report.Findings = append(report.Findings, AuditFinding{
+			Kind:   kind,
+			Prefix: e.Prefix.String(),
+			Source: e.Source,
+			Detail: fmt.Sprintf(format, args...),
+		})
+	}
+}
+
+// matchesPOP reports whether ref names pop by number or by name.
+func matchesPOP(pop POPAlloc, ref string) bool {
+	ref = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(ref), "POP"))
+	if n, err := strconv.Atoi(ref); err == nil {
+		return n == pop.POPNumber
+	}
+	return strings.EqualFold(ref, pop.Name)
+}
+
+// loadAuditCSV reads assigned prefixes, one per line as
+// "prefix[,pop[,description]]". A header line is skipped.
+func loadAuditCSV(path string) ([]auditEntry, []AuditFinding, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+
+	var entries []auditEntry
+	var invalid []AuditFinding
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		source := fmt.Sprintf("%s:%d", path, line)
+		p, err := netip.ParsePrefix(strings.TrimSpace(record[0]))
+		if err != nil || !p.Addr().Is6() {
+			if line == 1 {
+				continue // header
+			}
+			invalid = append(invalid, AuditFinding{Kind: findingInvalid, Prefix: record[0], Source: source, Detail: "not an IPv6 prefix"})
+			continue
+		}
+		e := auditEntry{Prefix: p.Masked(), Source: source}
+		if len(record) > 1 {
+			e.POP = strings.TrimSpace(record[1])
+		}
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			e.Description = strings.TrimSpace(record[2])
+			e.Source += " (" + e.Description + ")"
+		}
+		entries = append(entries, e)
+	}
+	return entries, invalid, nil
+}
+
+// runAudit implements the audit command.
+func runAudit(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	planPath := fs.String("plan", "", "Plan JSON file with the declared POP blocks")
+	ribPath := fs.String("rib", "", "RIB export (MRT TABLE_DUMP_V2 or flat JSON) to check announced routes against the POP aggregates")
+	jsonOut := fs.Bool("j", false, "JSON output format")
+	format := fs.String("format", reportText, "Report format when not -j: text, junit or tap")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner audit -plan plan.json [-j | -format junit|tap] [-rib rib.json] [assigned.csv ...]")
+		fmt.Println("Each CSV line is prefix[,pop[,description]]; pop is a POP number or name.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *planPath == "" || (fs.NArg() == 0 && *ribPath == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := parseReportFormat(*format); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	plan, err := loadPlan(*planPath)
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+	var entries []auditEntry
+	var invalid []AuditFinding
+	for _, path := range fs.Args() {
+		e, bad, err := loadAuditCSV(path)
+		if err != nil {
+			fmt.Printf("Error loading prefixes: %v\n", err)
+			os.Exit(1)
+		}
+		entries = append(entries, e...)
+		invalid = append(invalid, bad...)
+	}
+
+	report, err := auditPrefixes(plan, entries)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	report.Findings = append(invalid, report.Findings...)
+	report.Checked += len(invalid)
+
+	if *ribPath != "" {
+		ctx, cancel := commandContext(0)
+		routes, err := loadRIB(ctx, *ribPath)
+		cancel()
+		if err != nil {
+			fmt.Printf("Error loading RIB: %v\n", err)
+			os.Exit(1)
+		}
+		rib, err := auditRIB(plan, routes)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		report.Checked += rib.Checked
+		report.Findings = append(report.Findings, rib.Findings...)
+	}
+	if *format != reportText && !*jsonOut {
+		suite := auditSuite(report, *ribPath != "")
+		if err := writeChecks(os.Stdout, *format, "audit", []checkSuite{suite}); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if failedChecks([]checkSuite{suite}) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	outputAudit(report, *jsonOut)
+}
+
+// auditSuite turns a report into one check per kind of finding. The
+// announcement check only applies when a RIB was read.
+func auditSuite(report AuditReport, rib bool) checkSuite {
+	suite := checkSuite{Name: "audit against " + report.Plan}
+	for _, check := range auditChecks {
+		if check.kind == findingDeaggregate && !rib {
+			continue
+		}
+		result := checkResult{Name: check.name}
+		for _, f := range report.Findings {
+			if f.Kind == check.kind {
+				result.Failures = append(result.Failures, fmt.Sprintf("%s (%s): %s", f.Prefix, f.Source, f.Detail))
+			}
+		}
+		suite.Checks = append(suite.Checks, result)
+	}
+	return suite
+}
+
+// outputAudit prints the report and exits non-zero when there are findings,
+// so audits can gate CI jobs.
+func outputAudit(report AuditReport, jsonOut bool) {
+	if jsonOut {
+		jsonData, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		fmt.Printf("Audit against %s: %d prefixes checked, %d findings\n", report.Plan, report.Checked, len(report.Findings))
+		for _, f := range report.Findings {
+			fmt.Printf("  %-13s %-40s %s\n      %s\n", f.Kind, f.Prefix, f.Detail, f.Source)
+		}
+	}
+	if len(report.Findings) > 0 {
+		os.Exit(1)
+	}
+}
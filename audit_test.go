@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+// overlappingPlan is what a plan generated despite overlap warnings can
+// hold: POP 2 nests inside POP 1, and POP 3 is POP 1's block written with
+// host bits set.
+var overlappingPlan = IPv6Plan{
+	BaseSubnet: "2001:db8::/32",
+	POPAllocations: []POPAlloc{
+		{POPNumber: 1, POPSubnet: "2001:db8::/36"},
+		{POPNumber: 2, POPSubnet: "2001:db8:100::/40"},
+		{POPNumber: 3, POPSubnet: "2001:db8:234::/36"},
+		{POPNumber: 4, POPSubnet: "2001:db8:f000::/36"},
+	},
+}
+
+func TestPOPIndexLocateOverlapping(t *testing.T) {
+	_, pops, err := auditBlocks(overlappingPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := newPOPIndex(pops)
+	for _, tc := range []struct {
+		prefix string
+		pop    int
+		spans  int
+	}{
+		{"2001:db8:200::/48", 1, 0},
+		{"2001:db8:180::/48", 2, 0},
+		{"2001:db8:234::/48", 1, 0},
+		{"2001:db8:f0ff::/48", 4, 0},
+		{"2001:db8:8000::/33", 0, 1},
+		{"2001:db8:4000::/36", 0, 0},
+	} {
+		within, spans := index.locate(netip.MustParsePrefix(tc.prefix))
+		got := 0
+		if within != nil {
+			got = within.alloc.POPNumber
+		}
+		if got != tc.pop || spans != tc.spans {
+			t.Errorf("locate(%s) = POP %d spanning %d, want POP %d spanning %d", tc.prefix, got, spans, tc.pop, tc.spans)
+		}
+	}
+}
+
+func TestPOPIndexLocateGenerated(t *testing.T) {
+	opts := defaultPlanOptions()
+	opts.Subnet, opts.POPCount, opts.PreferredSize, opts.SubnetLevels = "2001:db8::/32", 5, 40, []int{48, 64}
+	plan, err := generateIPv6Plan(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pops, err := auditBlocks(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := newPOPIndex(pops)
+	if index.overlap {
+		t.Fatal("a valid plan was indexed as overlapping")
+	}
+	for _, pop := range plan.POPAllocations {
+		inner := netip.MustParsePrefix(pop.Subnets[len(pop.Subnets)-1].CIDR)
+		if within, _ := index.locate(inner); within == nil || within.alloc.POPNumber != pop.POPNumber {
+			t.Errorf("locate(%s) = %v, want POP %d", inner, within, pop.POPNumber)
+		}
+	}
+}
+
+func TestAuditOverlappingPlan(t *testing.T) {
+	report, err := auditPrefixes(overlappingPlan, []auditEntry{{Prefix: netip.MustParsePrefix("2001:db8:200::/48"), Source: "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Findings) != 0 {
+		t.Errorf("findings for a prefix inside POP 1: %+v", report.Findings)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+)
+
+// pinnedPOPIDs returns, by POP index, the POP IDs of every POP in a
+// previously issued plan, so a regenerated plan keeps their prefixes and
+// only numbers the new POPs. POPs are matched by requirements name when
+// the new plan has names, and by POP number otherwise. The base plan must
+// use the same base and POP size, and its levels must all still be
+// planned, or the prefixes issued under them would change.
+func pinnedPOPIDs(old *IPv6Plan, reqs []POPRequirement, popCount int, base netip.Prefix, popSize int, levels []int, reserved []string) (map[int]*big.Int, error) {
+	if old == nil {
+		return nil, nil
+	}
+	if old.BaseSubnet != base.String() {
+		return nil, failf(ErrOutsideBase, "the base plan is for %s, not %s", old.BaseSubnet, base)
+	}
+	if old.PreferredSize != popSize {
+		return nil, failf(ErrInvalidLevel, "the base plan has /%d POPs, not /%d; keep -p at %d to preserve its prefixes", old.PreferredSize, popSize, old.PreferredSize)
+	}
+	if len(old.POPAllocations) != old.POPCount {
+		return nil, fmt.Errorf("the base plan lists %d of its %d POPs; write it again without -limit or -offset", len(old.POPAllocations), old.POPCount)
+	}
+	planned := make(map[int]bool)
+	for _, level := range levels {
+		planned[level] = true
+	}
+	for _, level := range old.SubnetLevels {
+		if !planned[level] {
+			return nil, failf(ErrInvalidLevel, "level /%d from the base plan is missing; add it to -l to keep the prefixes issued under it", level)
+		}
+	}
+	if old.POPCount > popCount {
+		return nil, fmt.Errorf("the base plan has %d POPs and this plan only %d; issued POPs cannot be dropped", old.POPCount, popCount)
+	}
+
+	byName := make(map[string]int)
+	for i, req := range reqs {
+		if req.Name != "" {
+			byName[req.Name] = i
+		}
+	}
+	fieldBits := popSize - base.Bits()
+	reservedRanges, err := parseReservedIDs(reserved, fieldBits)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned := make(map[int]*big.Int)
+	for _, pop := range old.POPAllocations {
+		index := pop.POPNumber - 1
+		if pop.Name != "" && len(byName) > 0 {
+			i, ok := byName[pop.Name]
+			if !ok {
+				return nil, fmt.Errorf("%s from the base plan is not in the requirements; issued POPs cannot be dropped", popName(pop))
+			}
+			index = i
+		}
+		prefix, err := netip.ParsePrefix(pop.POPSubnet)
+		if err != nil {
+			return nil, failf(ErrInvalidPrefix, "%s in the base plan: %v", popName(pop), err)
+		}
+		if prefix.Bits() != popSize || !base.Contains(prefix.Addr()) {
+			return nil, failf(ErrOutsideBase, "%s in the base plan is %s, not a /%d inside %s", popName(pop), prefix, popSize, base)
+		}
+		id := new(big.Int).Rsh(addrDiff(base.Addr(), prefix.Addr()), uint(128-popSize))
+		if reservedID(reservedRanges, id) {
+			return nil, failf(ErrOverlap, "%s in the base plan has POP ID %s, which is now reserved", popName(pop), formatPOPID(id, fieldBits))
+		}
+		pinned[index] = id
+	}
+	return pinned, nil
+}
+
+// addrDiff is how far b is past a, as an unsigned 128-bit number.
+func addrDiff(a, b netip.Addr) *big.Int {
+	x, y := a.As16(), b.As16()
+	return new(big.Int).Sub(new(big.Int).SetBytes(y[:]), new(big.Int).SetBytes(x[:]))
+}
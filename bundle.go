@@ -0,0 +1,155 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// bundleFiles names each format's file inside a bundle.
+var bundleFiles = map[string]string{
+	"json": "plan.json",
+	"text": "plan.txt",
+	"html": "plan.html",
+}
+
+// writeBundle packages the plan as a zip archive for handing over in one
+// piece: plan.json always, each other requested format, a JSON Schema for
+// plan.json, and a SHA256SUMS file that `sha256sum -c` accepts.
+func writeBundle(path string, plan IPv6Plan, formats []string, opts exportOptions) ([]string, error) {
+	want := map[string]bool{"json": true}
+	for _, format := range formats {
+		if _, ok := bundleFiles[format]; !ok {
+			return nil, fmt.Errorf("unknown bundle format %q", format)
+		}
+		want[format] = true
+	}
+	// Text in an archive is read in an editor, not a terminal
+	opts.Colors = palette{}
+
+	type entry struct {
+		name string
+		data []byte
+	}
+	var entries []entry
+	for _, format := range []string{"json", "text", "html"} {
+		if !want[format] {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := newExporter(format, opts).Export(&buf, plan); err != nil {
+			return nil, fmt.Errorf("%s: %v", bundleFiles[format], err)
+		}
+		entries = append(entries, entry{bundleFiles[format], buf.Bytes()})
+	}
+	schema, err := json.MarshalIndent(planSchema(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, entry{"plan.schema.json", append(schema, '\n')})
+
+	var sums strings.Builder
+	for _, e := range entries {
+		sum := sha256.Sum256(e.data)
+		fmt.Fprintf(&sums, "%s  %s\n", hex.EncodeToString(sum[:]), e.name)
+	}
+	entries = append(entries, entry{"SHA256SUMS", []byte(sums.String())})
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	zw := zip.NewWriter(f)
+	modified := time.Now()
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: modified})
+		if err == nil {
+			_, err = w.Write(e.data)
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		names[i] = e.name
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return names, f.Close()
+}
+
+// planSchema describes the plan JSON document as a JSON Schema, derived
+// from IPv6Plan so it cannot fall behind the format.
+func planSchema() map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf(IPv6Plan{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = fmt.Sprintf("ipv6planner plan, schema version %d", currentSchemaVersion)
+	return schema
+}
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == bigIntType {
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	// Empty slices and maps are written as null
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": []string{"object", "null"}, "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			// A struct must not list itself again, as the ULA plan would
+			if field.Type == reflect.PtrTo(t) {
+				properties[name] = map[string]interface{}{"$ref": "#"}
+			} else {
+				properties[name] = typeSchema(field.Type)
+			}
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		sort.Strings(required)
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]interface{}{}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// parseIPv6 accepts an IPv6 address or prefix. Addresses come back as a /128
+// with isPrefix false.
+func parseIPv6(s string) (p netip.Prefix, isPrefix bool, err error) {
+	if strings.Contains(s, "/") {
+		p, err = netip.ParsePrefix(s)
+		isPrefix = true
+	} else {
+		var addr netip.Addr
+		addr, err = netip.ParseAddr(s)
+		p = netip.PrefixFrom(addr, 128)
+	}
+	if err != nil {
+		return p, false, failf(ErrInvalidPrefix, "%q is not an IPv6 address or prefix", s)
+	}
+	if !p.Addr().Is6() || p.Addr().Is4In6() {
+		return p, false, failf(ErrInvalidPrefix, "%s is not IPv6", s)
+	}
+	return p, isPrefix, nil
+}
+
+// setBit sets bit i (0 is the most significant) of a to v.
+func setBit(a *[16]byte, i int, v bool) {
+	mask := byte(1) << uint(7-i%8)
+	if v {
+		a[i/8] |= mask
+	} else {
+		a[i/8] &^= mask
+	}
+}
+
+// lastAddress returns the highest address in p.
+func lastAddress(p netip.Prefix) netip.Addr {
+	a := p.Masked().Addr().As16()
+	for i := p.Bits(); i < 128; i++ {
+		setBit(&a, i, true)
+	}
+	return netip.AddrFrom16(a)
+}
+
+// randomSubnet picks a /size inside parent with crypto/rand, e.g. a ULA
+// subnet ID or a lab prefix nobody else is likely to pick.
+func randomSubnet(parent netip.Prefix, size int) (netip.Prefix, error) {
+	if size < parent.Bits() || size > 128 {
+		return netip.Prefix{}, failf(ErrPrefixTooSmall, "/%d does not fit inside %s", size, parent)
+	}
+	var r [16]byte
+	if _, err := rand.Read(r[:]); err != nil {
+		return netip.Prefix{}, err
+	}
+	a := parent.Masked().Addr().As16()
+	for i := parent.Bits(); i < size; i++ {
+		setBit(&a, i, r[i/8]&(1<<uint(7-i%8)) != 0)
+	}
+	return netip.PrefixFrom(netip.AddrFrom16(a), size), nil
+}
+
+// runCalc implements the expand, compress, range, count and random-subnet
+// commands.
+func runCalc(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var from, to string
+	usage := map[string]string{
+		"expand":        "expand address|prefix ...",
+		"compress":      "compress address|prefix ...",
+		"range":         "range prefix ...",
+		"count":         "count -from /x -to /y",
+		"random-subnet": "random-subnet parent-prefix size",
+	}[name]
+	if name == "count" {
+		fs.StringVar(&from, "from", "", "Parent prefix length")
+		fs.StringVar(&to, "to", "", "Child prefix length")
+	}
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner " + usage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	fail := func(err error) {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch name {
+	case "count":
+		if from == "" || to == "" || fs.NArg() != 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		parent, err := parsePrefixLength(from)
+		if err != nil {
+			fail(err)
+		}
+		child, err := parsePrefixLength(to)
+		if err != nil {
+			fail(err)
+		}
+		if child < parent {
+			fail(failf(ErrInvalidLevel, "/%d is larger than /%d", child, parent))
+		}
+		fmt.Printf("/%d contains %s /%d subnets\n", parent, calculateAvailableSubnets(parent, child), child)
+		return
+
+	case "random-subnet":
+		if fs.NArg() != 2 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		parent, _, err := parseIPv6(fs.Arg(0))
+		if err != nil {
+			fail(err)
+		}
+		size, err := parsePrefixLength(fs.Arg(1))
+		if err != nil {
+			fail(err)
+		}
+		p, err := randomSubnet(parent, size)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Println(p)
+		return
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	for _, arg := range fs.Args() {
+		p, isPrefix, err := parseIPv6(arg)
+		if err != nil {
+			fail(err)
+		}
+		switch name {
+		case "expand":
+			if isPrefix {
+				fmt.Printf("%s/%d\n", p.Addr().StringExpanded(), p.Bits())
+			} else {
+				fmt.Println(p.Addr().StringExpanded())
+			}
+		case "compress":
+			if isPrefix {
+				fmt.Println(p)
+			} else {
+				fmt.Println(p.Addr())
+			}
+		case "range":
+			if !isPrefix {
+				fail(fmt.Errorf("%s is an address, not a prefix", arg))
+			}
+			if p.Masked() != p {
+				fmt.Printf("Note: %s has host bits set, using %s\n", arg, p.Masked())
+			}
+			fmt.Printf("%s\n  First: %s\n  Last:  %s\n  Addresses: %s\n", p.Masked(), p.Masked().Addr(), lastAddress(p), calculateAvailableSubnets(p.Bits(), 128))
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ianaSpecialRegistry is the IANA IPv6 Special-Purpose Address Registry in
+// the CSV layout IANA publishes it in.
+//
+//go:embed data/iana-ipv6-special-registry.csv
+var ianaSpecialRegistry []byte
+
+// PrefixClass is a registry entry that relates to a classified prefix.
+type PrefixClass struct {
+	Block              string `json:"block"`
+	Name               string `json:"name"`
+	References         string `json:"references"`
+	Source             string `json:"source,omitempty"`
+	Destination        string `json:"destination,omitempty"`
+	Forwardable        string `json:"forwardable,omitempty"`
+	GloballyReachable  string `json:"globally_reachable,omitempty"`
+	ReservedByProtocol string `json:"reserved_by_protocol,omitempty"`
+	prefix             netip.Prefix
+}
+
+// addressSpace covers what the special-purpose registry does not: the
+// allocations of the IANA IPv6 Address Space registry. Unique local and
+// link-local space are in the special-purpose registry itself.
+var addressSpace = []PrefixClass{
+	{Block: "::/8", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "100::/8", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "200::/7", Name: "Reserved by IETF", References: "[RFC4048]"},
+	{Block: "400::/6", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "800::/5", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "1000::/4", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "2000::/3", Name: "Global Unicast", References: "[RFC4291]"},
+	{Block: "4000::/3", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "6000::/3", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "8000::/3", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "a000::/3", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "c000::/3", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "e000::/4", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "f000::/5", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "f800::/6", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "fe00::/9", Name: "Reserved by IETF", References: "[RFC4291]"},
+	{Block: "fec0::/10", Name: "Site-Local Unicast (deprecated)", References: "[RFC3879]"},
+	{Block: "ff00::/8", Name: "Multicast", References: "[RFC4291]"},
+}
+
+var specialRegistry = mustParseRegistry(ianaSpecialRegistry)
+
+func mustParseRegistry(data []byte) []PrefixClass {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("embedded IANA registry: %v", err))
+	}
+	var entries []PrefixClass
+	for _, r := range records[1:] {
+		entry := PrefixClass{
+			Block:              r[0],
+			Name:               r[1],
+			References:         r[2],
+			Source:             r[5],
+			Destination:        r[6],
+			Forwardable:        r[7],
+			GloballyReachable:  r[8],
+			ReservedByProtocol: r[9],
+		}
+		if r[4] != "N/A" {
+			entry.Name += " (terminated " + r[4] + ")"
+		}
+		// netip keeps ::ffff:0:0/96 in 16-byte form, where net.ParseCIDR
+		// would turn the IPv4-mapped block into an IPv4 one
+		if entry.prefix, err = netip.ParsePrefix(entry.Block); err != nil {
+			panic(fmt.Sprintf("embedded IANA registry: %v", err))
+		}
+		entry.prefix = entry.prefix.Masked()
+		entries = append(entries, entry)
+	}
+	for i := range addressSpace {
+		addressSpace[i].prefix = netip.MustParsePrefix(addressSpace[i].Block)
+	}
+	return entries
+}
+
+func prefixLen(n *net.IPNet) int {
+	ones, _ := n.Mask.Size()
+	return ones
+}
+
+// classifyPrefix returns the registry entries that contain p, most specific
+// first, and the entries that p itself contains. When no special-purpose
+// entry contains p, the address space allocation it falls in is returned
+// instead; a prefix spanning several allocations, such as ::/0, is within
+// none.
+func classifyPrefix(p netip.Prefix) (within, covers []PrefixClass) {
+	for _, entry := range specialRegistry {
+		switch {
+		case entry.prefix.Contains(p.Addr()) && entry.prefix.Bits() <= p.Bits():
+			within = append(within, entry)
+		case p.Contains(entry.prefix.Addr()) && p.Bits() < entry.prefix.Bits():
+			covers = append(covers, entry)
+		}
+	}
+	sort.SliceStable(within, func(i, j int) bool { return within[i].prefix.Bits() > within[j].prefix.Bits() })
+	sort.SliceStable(covers, func(i, j int) bool {
+		if c := covers[i].prefix.Addr().Compare(covers[j].prefix.Addr()); c != 0 {
+			return c < 0
+		}
+		return covers[i].prefix.Bits() < covers[j].prefix.Bits()
+	})
+
+	if len(within) == 0 {
+		for _, entry := range addressSpace {
+			if entry.prefix.Contains(p.Addr()) && entry.prefix.Bits() <= p.Bits() {
+				within = append(within, entry)
+				break
+			}
+		}
+	}
+	return within, covers
+}
+
+// baseClass returns the most specific classification of a plan's base.
+func baseClass(base *net.IPNet) *PrefixClass {
+	ones, _ := base.Mask.Size()
+	addr, ok := netip.AddrFromSlice(base.IP.To16())
+	if !ok {
+		return nil
+	}
+	within, _ := classifyPrefix(netip.PrefixFrom(addr, ones))
+	if len(within) == 0 {
+		return nil
+	}
+	return &within[0]
+}
+
+func (c PrefixClass) String() string {
+	return fmt.Sprintf("%s %s", c.Name, c.References)
+}
+
+// Classification is the classify command's result for one prefix.
+type Classification struct {
+	Prefix string        `json:"prefix"`
+	Within []PrefixClass `json:"within"`
+	Covers []PrefixClass `json:"covers,omitempty"`
+}
+
+// runClassify implements the classify command.
+func runClassify(args []string) {
+	fs := flag.NewFlagSet("classify", flag.ExitOnError)
+	jsonOut := fs.Bool("j", false, "JSON output format")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner classify [-j] prefix [prefix ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var results []Classification
+	for _, arg := range fs.Args() {
+		if !strings.Contains(arg, "/") {
+			arg += "/128"
+		}
+		p, err := netip.ParsePrefix(arg)
+		if err != nil || p.Addr().Is4() || p.Addr().Zone() != "" {
+			fmt.Printf("Error: %q is not an IPv6 prefix or address\n", arg)
+			os.Exit(1)
+		}
+		p = p.Masked()
+		within, covers := classifyPrefix(p)
+		if within == nil {
+			within = []PrefixClass{}
+		}
+		results = append(results, Classification{Prefix: p.String(), Within: within, Covers: covers})
+	}
+
+	if *jsonOut {
+		jsonData, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+
+	for i, r := range results {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(r.Prefix)
+		for _, c := range r.Within {
+			fmt.Printf("  Within %s: %s\n", c.Block, c)
+			printClassFlags(c)
+		}
+		for _, c := range r.Covers {
+			fmt.Printf("  Covers %s: %s\n", c.Block, c)
+			printClassFlags(c)
+		}
+	}
+}
+
+func printClassFlags(c PrefixClass) {
+	if c.Source == "" {
+		return
+	}
+	fmt.Printf("    Source: %s, Destination: %s, Forwardable: %s, Globally reachable: %s, Reserved-by-protocol: %s\n",
+		c.Source, c.Destination, c.Forwardable, c.GloballyReachable, c.ReservedByProtocol)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestClassifyPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		prefix string
+		within string
+	}{
+		{"::ffff:0:0/96", "::ffff:0:0/96"},
+		{"::ffff:10.0.0.1/128", "::ffff:0:0/96"},
+		{"2001:db8::/48", "2001:db8::/32"},
+		{"8000::/16", "8000::/3"},
+		{"2400::/12", "2000::/3"},
+		{"::/0", ""},
+		{"::/2", ""},
+	} {
+		within, _ := classifyPrefix(netip.MustParsePrefix(tc.prefix))
+		got := ""
+		if len(within) > 0 {
+			got = within[0].Block
+		}
+		if got != tc.within {
+			t.Errorf("classifyPrefix(%s) is within %q, want %q", tc.prefix, got, tc.within)
+		}
+	}
+
+	_, covers := classifyPrefix(netip.MustParsePrefix("::/0"))
+	found := false
+	for _, c := range covers {
+		found = found || c.Block == "::ffff:0:0/96"
+	}
+	if !found {
+		t.Error("::/0 does not list ::ffff:0:0/96 among the blocks it covers")
+	}
+}
+
+func TestNotIPv6Base(t *testing.T) {
+	if err := notIPv6Base("::ffff:10.0.0.0/104"); !strings.Contains(err.Error(), "IPv4-mapped") {
+		t.Errorf("IPv4-mapped base: %v", err)
+	}
+	if err := notIPv6Base("10.0.0.0/8"); !strings.Contains(err.Error(), "is an IPv4 prefix") {
+		t.Errorf("IPv4 base: %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// goIdentifier is a valid Go package name.
+var goIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// planConstant is one named prefix of a plan, for the code generators.
+// words make up its name in upper case, and comment describes it as a noun
+// phrase; a pool, which may span several prefixes, has values instead of
+// value.
+type planConstant struct {
+	words   []string
+	value   string
+	values  []string
+	comment string
+}
+
+// identWords splits s into upper-case words of letters and digits.
+func identWords(s string) []string {
+	return strings.FieldsFunc(strings.ToUpper(s), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9')
+	})
+}
+
+// planConstants lists a plan's named prefixes: the base, every POP by its
+// name (and number, when it has no name or two POPs would get the same
+// one), and the pools, management blocks, ULA twins and
+// delegations that go with them.
+func planConstants(plan IPv6Plan) []planConstant {
+	consts := []planConstant{{words: []string{"BASE"}, value: plan.BaseSubnet, comment: "the base subnet of the plan"}}
+	if plan.OOB != nil {
+		consts = append(consts, planConstant{words: []string{"OOB"}, value: plan.OOB.Aggregate, comment: "the out-of-band management aggregate"})
+	}
+	if plan.ULAPlan != nil {
+		consts = append(consts, planConstant{words: []string{"ULA", "BASE"}, value: plan.ULAPlan.BaseSubnet, comment: "the ULA twin of the base subnet"})
+	}
+
+	sites := make([][]string, len(plan.POPAllocations))
+	used := make(map[string]int)
+	for i, pop := range plan.POPAllocations {
+		sites[i] = identWords(pop.Name)
+		used[strings.Join(sites[i], "_")]++
+	}
+	ula := make(map[int]string)
+	if plan.ULAPlan != nil {
+		for _, pop := range plan.ULAPlan.POPAllocations {
+			ula[pop.POPNumber] = pop.POPSubnet
+		}
+	}
+	for i, pop := range plan.POPAllocations {
+		site := sites[i]
+		if len(site) == 0 || used[strings.Join(site, "_")] > 1 {
+			site = append(site, strconv.Itoa(pop.POPNumber))
+		}
+		name := append([]string{"POP"}, site...)
+		with := func(words ...string) []string {
+			return append(append([]string(nil), name...), words...)
+		}
+		comment := popName(pop)
+		if pop.Location != nil && pop.Location.City != "" {
+			comment += ", " + pop.Location.City
+		}
+		consts = append(consts, planConstant{words: name, value: pop.POPSubnet, comment: comment})
+		for _, pool := range pop.Pools {
+			if len(pool.Prefixes) == 0 {
+				continue
+			}
+			consts = append(consts, planConstant{words: with(append([]string{"POOL"}, identWords(pool.Name)...)...), values: pool.Prefixes, comment: fmt.Sprintf("the %s pool of %s", pool.Name, popName(pop))})
+		}
+		if pop.OOB != nil {
+			consts = append(consts, planConstant{words: with("OOB"), value: pop.OOB.Prefix, comment: "the out-of-band management block of " + popName(pop)})
+		}
+		if prefix, ok := ula[pop.POPNumber]; ok {
+			consts = append(consts, planConstant{words: with("ULA"), value: prefix, comment: "the ULA twin of " + popName(pop)})
+		}
+	}
+	for _, d := range plan.Delegations {
+		consts = append(consts, planConstant{words: append([]string{"DELEGATION"}, identWords(d.Organization)...), value: d.Prefix, comment: "the block delegated to " + d.Organization})
+	}
+
+	// Pool and organization names that differ only in punctuation would
+	// define the same constant twice
+	seen := make(map[string]int)
+	for i := range consts {
+		key := strings.Join(consts[i].words, "_")
+		if seen[key]++; seen[key] > 1 {
+			consts[i].words = append(consts[i].words, strconv.Itoa(seen[key]))
+		}
+	}
+	return consts
+}
+
+// generatedNotice marks generated files, in the form Go tools recognize.
+const generatedNotice = "Code generated by ipv6planner from the plan for %s. DO NOT EDIT."
+
+// oneLine keeps names from the plan from breaking out of a comment.
+var oneLine = strings.NewReplacer("\r", " ", "\n", " ", "*/", "* /")
+
+// writeGoConstants writes the named prefixes as a Go package, with
+// MixedCaps names such as POPAms and pools as string slices.
+func writeGoConstants(w io.Writer, plan IPv6Plan, pkg string) error {
+	if pkg == "" {
+		pkg = "ipv6plan"
+	}
+	name := func(c planConstant) string {
+		var b strings.Builder
+		for _, word := range c.words {
+			switch word {
+			case "POP", "OOB", "ULA":
+				b.WriteString(word)
+			default:
+				b.WriteString(word[:1] + strings.ToLower(word[1:]))
+			}
+		}
+		return b.String()
+	}
+	fmt.Fprintf(w, "// "+generatedNotice+"\n\n", plan.BaseSubnet)
+	fmt.Fprintf(w, "// Package %s holds the named prefixes of the IPv6 plan for %s.\npackage %s\n\n", pkg, plan.BaseSubnet, pkg)
+	consts := planConstants(plan)
+	fmt.Fprintln(w, "const (")
+	for _, c := range consts {
+		if c.values == nil {
+			fmt.Fprintf(w, "\t// %s is %s.\n\t%s = %s\n", name(c), oneLine.Replace(c.comment), name(c), strconv.Quote(c.value))
+		}
+	}
+	fmt.Fprintln(w, ")")
+	for _, c := range consts {
+		if c.values != nil {
+			quoted := make([]string, len(c.values))
+			for i, v := range c.values {
+				quoted[i] = strconv.Quote(v)
+			}
+			fmt.Fprintf(w, "\n// %s is %s.\nvar %s = []string{%s}\n", name(c), oneLine.Replace(c.comment), name(c), strings.Join(quoted, ", "))
+		}
+	}
+	return nil
+}
+
+// upperFirst capitalizes a constant's description where it stands alone.
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// writePythonConstants writes the named prefixes as a Python module, with
+// UPPER_CASE names and pools as tuples.
+func writePythonConstants(w io.Writer, plan IPv6Plan) error {
+	fmt.Fprintf(w, "# "+generatedNotice+"\n", plan.BaseSubnet)
+	fmt.Fprintf(w, "\"\"\"Named prefixes of the IPv6 plan for %s.\"\"\"\n\n", plan.BaseSubnet)
+	for _, c := range planConstants(plan) {
+		value := strconv.Quote(c.value)
+		if c.values != nil {
+			quoted := make([]string, len(c.values))
+			for i, v := range c.values {
+				quoted[i] = strconv.Quote(v) + ","
+			}
+			value = "(" + strings.Join(quoted, " ") + ")"
+		}
+		fmt.Fprintf(w, "%s = %s  # %s\n", strings.Join(c.words, "_"), value, oneLine.Replace(upperFirst(c.comment)))
+	}
+	return nil
+}
+
+// writeCHeader writes the named prefixes as C preprocessor macros,
+// prefixed IPV6PLAN_. A pool is an initializer list with a _COUNT macro.
+func writeCHeader(w io.Writer, plan IPv6Plan) error {
+	fmt.Fprintf(w, "/* "+generatedNotice+" */\n", plan.BaseSubnet)
+	fmt.Fprintln(w, "#ifndef IPV6PLAN_H\n#define IPV6PLAN_H")
+	for _, c := range planConstants(plan) {
+		name := "IPV6PLAN_" + strings.Join(c.words, "_")
+		fmt.Fprintf(w, "\n/* %s */\n", oneLine.Replace(upperFirst(c.comment)))
+		if c.values == nil {
+			fmt.Fprintf(w, "#define %s %s\n", name, strconv.Quote(c.value))
+			continue
+		}
+		quoted := make([]string, len(c.values))
+		for i, v := range c.values {
+			quoted[i] = strconv.Quote(v)
+		}
+		fmt.Fprintf(w, "#define %s { %s }\n#define %s_COUNT %d\n", name, strings.Join(quoted, ", "), name, len(c.values))
+	}
+	fmt.Fprintln(w, "\n#endif /* IPV6PLAN_H */")
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Color modes accepted by -color.
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// ANSI SGR codes used by the text renderer.
+const (
+	ansiBold   = "1"
+	ansiDim    = "2"
+	ansiGreen  = "32"
+	ansiYellow = "33"
+	ansiCyan   = "36"
+)
+
+// palette colors text output when enabled and passes it through otherwise.
+type palette struct {
+	enabled bool
+}
+
+// newPalette resolves a -color mode. auto colors only when stdout is a
+// terminal and NO_COLOR (https://no-color.org) is unset.
+func newPalette(mode string) (palette, error) {
+	switch mode {
+	case colorAlways:
+		return palette{enabled: true}, nil
+	case colorNever:
+		return palette{}, nil
+	case "", colorAuto:
+		if _, set := os.LookupEnv("NO_COLOR"); set {
+			return palette{}, nil
+		}
+		info, err := os.Stdout.Stat()
+		return palette{enabled: err == nil && info.Mode()&os.ModeCharDevice != 0}, nil
+	}
+	return palette{}, fmt.Errorf("unknown color mode %q (expected %s, %s or %s)", mode, colorAuto, colorAlways, colorNever)
+}
+
+func (c palette) paint(code, s string) string {
+	if !c.enabled || s == "" {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
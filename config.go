@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// PlanOptions holds the parameters a plan is generated from. It is also the
+// format of the config files written by interactive mode and read with -c.
+type PlanOptions struct {
+	Subnet        string            `json:"subnet"`
+	POPCount      int               `json:"pop_count"`
+	PreferredSize int               `json:"preferred_size"`
+	SubnetLevels  []int             `json:"subnet_levels"`
+	AutoSize      bool              `json:"auto_size,omitempty"`
+	NibbleAlign   bool              `json:"nibble_align,omitempty"`
+	GrowthBits    int               `json:"growth_bits,omitempty"`
+	Strict        bool              `json:"strict,omitempty"`
+	AllowSub64    bool              `json:"allow_sub64,omitempty"`
+	Addressing    map[int]string    `json:"addressing,omitempty"`
+	Roles         map[int]string    `json:"roles,omitempty"`
+	Policy        string            `json:"policy,omitempty"`
+	WithULA       bool              `json:"with_ula,omitempty"`
+	ULAPrefix     string            `json:"ula_prefix,omitempty"`
+	Requirements  []POPRequirement  `json:"requirements,omitempty"`
+	Rules         []Rule            `json:"rules,omitempty"`
+	ReservedIDs   []string          `json:"reserved_ids,omitempty"`
+	POPCodes      map[string]string `json:"pop_codes,omitempty"`
+	POPNumbering  string            `json:"pop_numbering,omitempty"`
+	Delegations   map[string]int    `json:"delegations,omitempty"`
+	DelegatedFrom *DelegatedFrom    `json:"delegated_from,omitempty"`
+	Split         []PoolShare       `json:"split,omitempty"`
+	SplitLevel    int               `json:"split_level,omitempty"`
+	Preset        string            `json:"preset,omitempty"`
+	OOBSize       int               `json:"oob_size,omitempty"`
+	OOBLevels     []int             `json:"oob_levels,omitempty"`
+	OOBNetworks   []string          `json:"oob_networks,omitempty"`
+	BasePlan      *IPv6Plan         `json:"-"`
+}
+
+func defaultPlanOptions() PlanOptions {
+	return PlanOptions{
+		Subnet:        "3fff::/20",
+		POPCount:      5,
+		PreferredSize: 36,
+		SubnetLevels:  []int{44, 48, 64},
+		Policy:        "bcp",
+	}
+}
+
+// loadConfig reads a config file. Settings missing from the file keep their
+// default values.
+func loadConfig(path string) (PlanOptions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return defaultPlanOptions(), err
+	}
+	opts, err := decodeConfig(data)
+	if err != nil {
+		return opts, fmt.Errorf("%s: %v", path, err)
+	}
+	return opts, nil
+}
+
+func decodeConfig(data []byte) (PlanOptions, error) {
+	opts := defaultPlanOptions()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&opts)
+	return opts, err
+}
+
+// decodeOptions accepts either an options document or a plan written with
+// -j. A plan is turned back into the options that produce it, so it can be
+// extended (more POPs, another level) without retyping its parameters.
+func decodeOptions(data []byte) (PlanOptions, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return defaultPlanOptions(), err
+	}
+	if _, ok := fields["pop_allocations"]; !ok {
+		return decodeConfig(data)
+	}
+	plan, _, err := decodePlan(data)
+	if err != nil {
+		return defaultPlanOptions(), err
+	}
+	return optionsFromPlan(plan)
+}
+
+// optionsFromPlan recovers the parameters a plan was generated with. Settings
+// the plan does not record (-auto-size, -nibble, -strict) are left off; the
+// recorded POP size already reflects them. Plans written before the policy
+// and rules were recorded get the default policy and no rules. A plan whose
+// POPs give a level different roles or addressing methods, which no set of
+// parameters produces, is an error.
+func optionsFromPlan(plan IPv6Plan) (PlanOptions, error) {
+	opts := defaultPlanOptions()
+	opts.Subnet = plan.BaseSubnet
+	opts.POPCount = plan.POPCount
+	opts.PreferredSize = plan.PreferredSize
+	opts.SubnetLevels = plan.SubnetLevels
+	opts.GrowthBits = plan.GrowthBits
+	for _, level := range plan.SubnetLevels {
+		opts.AllowSub64 = opts.AllowSub64 || level > 64
+	}
+	if plan.Policy != "" {
+		opts.Policy = plan.Policy
+	}
+	opts.Rules = plan.Rules
+	if len(plan.POPAllocations) > 0 {
+		opts.Roles = make(map[int]string)
+		opts.Addressing = make(map[int]string)
+		roleFrom := make(map[int]POPAlloc)
+		addressingFrom := make(map[int]POPAlloc)
+		for _, pop := range plan.POPAllocations {
+			for _, subnet := range pop.Subnets {
+				_, ipNet, err := net.ParseCIDR(subnet.CIDR)
+				if err != nil {
+					continue
+				}
+				level := prefixLen(ipNet)
+				if first, seen := roleFrom[level]; seen && opts.Roles[level] != subnet.Role {
+					return opts, fmt.Errorf("%s gives /%d the role %q, but %s gives it %q", popName(pop), level, subnet.Role, popName(first), opts.Roles[level])
+				} else if !seen {
+					roleFrom[level] = pop
+					opts.Roles[level] = subnet.Role
+				}
+				if first, seen := addressingFrom[level]; seen && opts.Addressing[level] != subnet.Addressing {
+					return opts, fmt.Errorf("%s addresses /%d with %q, but %s with %q", popName(pop), level, subnet.Addressing, popName(first), opts.Addressing[level])
+				} else if !seen {
+					addressingFrom[level] = pop
+					opts.Addressing[level] = subnet.Addressing
+				}
+			}
+		}
+		for level, role := range opts.Roles {
+			if role == "" {
+				delete(opts.Roles, level)
+			}
+		}
+		for level, method := range opts.Addressing {
+			if method == "" {
+				delete(opts.Addressing, level)
+			}
+		}
+	}
+	listed := false
+	for _, pop := range plan.POPAllocations {
+		listed = listed || pop.Location != nil || pop.Name != ""
+		for _, pool := range pop.Pools {
+			listed = listed || pool.Required > 0
+		}
+		listed = listed || len(pop.Counts) > 0
+	}
+	for _, pop := range plan.POPAllocations {
+		if len(pop.Demand) == 0 && !listed {
+			continue
+		}
+		req := POPRequirement{Name: pop.Name}
+		if loc := pop.Location; loc != nil {
+			req.City, req.Country, req.LOCODE, req.Latitude, req.Longitude = loc.City, loc.Country, loc.LOCODE, loc.Latitude, loc.Longitude
+		}
+		for _, d := range pop.Demand {
+			switch d.Kind {
+			case "sites":
+				req.Sites = d.Required
+			case "customers":
+				req.Customers = d.Required
+			case "vlans":
+				req.VLANs = d.Required
+			case "links":
+				req.Links = d.Required
+			}
+		}
+		req.Counts = pop.Counts
+		for _, pool := range pop.Pools {
+			if pool.Required > 0 && plan.Preset == "" {
+				if req.PoolCustomers == nil {
+					req.PoolCustomers = make(map[string]int)
+				}
+				req.PoolCustomers[pool.Name] = pool.Required
+			}
+		}
+		opts.Requirements = append(opts.Requirements, req)
+	}
+	for _, pop := range plan.POPAllocations {
+		if pop.Code == "" {
+			continue
+		}
+		if opts.POPCodes == nil {
+			opts.POPCodes = make(map[string]string)
+		}
+		key := fmt.Sprint(pop.POPNumber)
+		if pop.Name != "" {
+			key = pop.Name
+		}
+		opts.POPCodes[key] = pop.Code
+	}
+	opts.POPNumbering = plan.POPNumbering
+	for _, block := range plan.Delegations {
+		if prefix, err := netip.ParsePrefix(block.Prefix); err == nil {
+			if opts.Delegations == nil {
+				opts.Delegations = make(map[string]int)
+			}
+			opts.Delegations[block.Organization] = prefix.Bits()
+		}
+	}
+	opts.DelegatedFrom = plan.DelegatedFrom
+	opts.Preset = plan.Preset
+	if len(plan.POPAllocations) > 0 && plan.Preset == "" {
+		for _, pool := range plan.POPAllocations[0].Pools {
+			opts.Split = append(opts.Split, PoolShare{Name: pool.Name, Percent: pool.Percent})
+			opts.SplitLevel = pool.PrefixSize
+		}
+	}
+	if plan.OOB != nil {
+		opts.OOBSize = plan.OOB.POPSize
+		opts.OOBLevels = plan.OOB.Levels
+		opts.OOBNetworks = plan.OOB.Networks
+	}
+	for _, r := range plan.ReservedIDs {
+		opts.ReservedIDs = append(opts.ReservedIDs, r.ID)
+	}
+	if plan.ULAPlan != nil {
+		if _, ula, err := net.ParseCIDR(plan.ULAPlan.BaseSubnet); err == nil {
+			opts.WithULA = true
+			opts.ULAPrefix = (&net.IPNet{IP: ula.IP.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+		}
+	}
+	return opts, nil
+}
+
+func saveConfig(path string, opts PlanOptions) error {
+	data, err := json.MarshalIndent(opts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// commandLine renders the non-interactive invocation that reproduces opts.
+func commandLine(opts PlanOptions) string {
+	args := []string{
+		"ipv6planner",
+		"-s", opts.Subnet,
+		"-n", fmt.Sprint(opts.POPCount),
+		"-p", fmt.Sprint(opts.PreferredSize),
+		"-l", formatLevels(opts.SubnetLevels),
+	}
+	if opts.AutoSize {
+		args = append(args, "-auto-size")
+	}
+	if opts.NibbleAlign {
+		args = append(args, "-nibble")
+	}
+	if opts.GrowthBits > 0 {
+		args = append(args, "-growth-bits", fmt.Sprint(opts.GrowthBits))
+	}
+	if opts.Strict {
+		args = append(args, "-strict")
+	}
+	if opts.AllowSub64 {
+		args = append(args, "-allow-sub64")
+	}
+	if opts.ULAPrefix != "" {
+		args = append(args, "-ula-prefix", opts.ULAPrefix)
+	} else if opts.WithULA {
+		args = append(args, "-with-ula")
+	}
+	if len(opts.Roles) > 0 {
+		args = append(args, "-roles", formatLevelMap(opts.Roles))
+	}
+	if opts.Policy != "" && opts.Policy != "bcp" {
+		args = append(args, "-policy", opts.Policy)
+	}
+	if len(opts.Addressing) > 0 {
+		args = append(args, "-addressing", formatLevelMap(opts.Addressing))
+	}
+	if len(opts.ReservedIDs) > 0 {
+		args = append(args, "-reserve-ids", strings.Join(opts.ReservedIDs, ","))
+	}
+	if len(opts.POPCodes) > 0 {
+		args = append(args, "-pop-codes", formatPOPCodes(opts.POPCodes))
+	}
+	if opts.POPNumbering != "" && opts.POPNumbering != numberByIndex {
+		args = append(args, "-pop-numbering", opts.POPNumbering)
+	}
+	if len(opts.Delegations) > 0 {
+		args = append(args, "-delegate", formatDelegations(opts.Delegations))
+	}
+	if opts.Preset != "" {
+		args = append(args, "-preset", opts.Preset)
+	}
+	if len(opts.Split) > 0 {
+		args = append(args, "-split", formatSplit(opts.Split))
+		if opts.SplitLevel != 0 {
+			args = append(args, "-split-level", fmt.Sprint(opts.SplitLevel))
+		}
+	}
+	if opts.OOBSize > 0 {
+		args = append(args, "-oob", fmt.Sprint(opts.OOBSize))
+		if len(opts.OOBLevels) > 0 {
+			args = append(args, "-oob-levels", formatLevels(opts.OOBLevels))
+		}
+		if len(opts.OOBNetworks) > 0 {
+			args = append(args, "-oob-networks", strings.Join(opts.OOBNetworks, ","))
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOptionsFromPlanRoundTrip(t *testing.T) {
+	opts := defaultPlanOptions()
+	opts.Subnet, opts.POPCount, opts.PreferredSize, opts.SubnetLevels = "2001:db8::/32", 3, 40, []int{48, 56, 64}
+	opts.Roles = map[int]string{48: roleSite, 64: roleLAN}
+	opts.Addressing = map[int]string{64: "slaac"}
+	opts.Policy = "none"
+	opts.Rules = []Rule{{Name: "nibble", Nibble: true, Severity: ruleWarning}}
+	plan, err := generateIPv6Plan(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := optionsFromPlan(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Policy != opts.Policy || !reflect.DeepEqual(got.Rules, opts.Rules) {
+		t.Errorf("policy %q and rules %+v, want %q and %+v", got.Policy, got.Rules, opts.Policy, opts.Rules)
+	}
+	if !reflect.DeepEqual(got.Roles, opts.Roles) || !reflect.DeepEqual(got.Addressing, opts.Addressing) {
+		t.Errorf("roles %v and addressing %v, want %v and %v", got.Roles, got.Addressing, opts.Roles, opts.Addressing)
+	}
+
+	// POPs that disagree on a level's role come from no set of options
+	plan.POPAllocations[2].Subnets[0].Role = roleBusiness
+	if _, err := optionsFromPlan(plan); err == nil || !strings.Contains(err.Error(), "/48") {
+		t.Errorf("plan with conflicting roles: got %v, want an error naming /48", err)
+	}
+}
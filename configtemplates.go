@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// configManifest is the manifest.json of a template directory: how to lay
+// out each POP's interfaces, and which templates to render into which
+// files. Interface names start from platform's (or generic ones) and are
+// overridden by interfaces, keyed loopback, p2p and lan.
+type configManifest struct {
+	Description string            `json:"description,omitempty"`
+	Platform    string            `json:"platform,omitempty"`
+	Interfaces  map[string]string `json:"interfaces,omitempty"`
+	Links       *int              `json:"links,omitempty"`
+	LANs        *int              `json:"lans,omitempty"`
+	Templates   []configTemplate  `json:"templates"`
+}
+
+// configTemplate renders File once per POP, or once for the whole plan
+// when Per is "plan", into Output, itself a template seeing the same data.
+type configTemplate struct {
+	File   string `json:"file"`
+	Output string `json:"output,omitempty"`
+	Per    string `json:"per,omitempty"`
+}
+
+// ConfigPOP is one POP as config templates see it: the POP's allocation,
+// .Site (its name as a DNS label, or "pop" and its number) and .Router, its
+// turn-up addressing as router-config lays it out.
+type ConfigPOP struct {
+	POPAlloc
+	Site   string
+	Router POPRouter
+}
+
+// configPOPData is what per-POP templates see; .Plan is the whole plan.
+type configPOPData struct {
+	ConfigPOP
+	Plan IPv6Plan
+}
+
+// configPlanData is what per-plan templates see.
+type configPlanData struct {
+	Plan IPv6Plan
+	POPs []ConfigPOP
+}
+
+// templatePrefix reads a prefix given to a template function, as a string
+// or a netip.Prefix such as an interface's .Address.
+func templatePrefix(v interface{}) (netip.Prefix, error) {
+	p, err := netip.ParsePrefix(fmt.Sprint(v))
+	if err != nil || !p.Addr().Is6() {
+		return netip.Prefix{}, fmt.Errorf("%v is not an IPv6 prefix", v)
+	}
+	return p, nil
+}
+
+// hasNth reports whether a prefix of bits has an i-th /size, counting a
+// prefix of the same size as holding itself.
+func hasNth(bits, size, i int) bool {
+	return size >= bits && size <= 128 && i >= 0 && new(big.Int).Lsh(big.NewInt(1), uint(size-bits)).Cmp(big.NewInt(int64(i))) > 0
+}
+
+// configTemplateFuncs extend the router-config functions for user
+// templates: label makes a DNS label, subnet returns the i-th (0-based)
+// /size of a prefix, and address the n-th address of one.
+var configTemplateFuncs = template.FuncMap{
+	"inc":   routerTemplateFuncs["inc"],
+	"label": dnsLabel,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"join":  strings.Join,
+	"subnet": func(v interface{}, size, i int) (string, error) {
+		p, err := templatePrefix(v)
+		if err != nil {
+			return "", err
+		}
+		p = p.Masked()
+		if !hasNth(p.Bits(), size, i) {
+			return "", fmt.Errorf("%s has no /%d number %d", p, size, i)
+		}
+		return nthPrefix(p.Addr(), size, i).String(), nil
+	},
+	"address": func(v interface{}, n int) (string, error) {
+		p, err := templatePrefix(v)
+		if err != nil {
+			return "", err
+		}
+		p = p.Masked()
+		if !hasNth(p.Bits(), 128, n) {
+			return "", fmt.Errorf("%s has no address number %d", p, n)
+		}
+		return addrAdd(p.Addr(), big.NewInt(int64(n))).String(), nil
+	},
+}
+
+// configTemplateSet is one loaded template directory.
+type configTemplateSet struct {
+	Name      string
+	Dir       string
+	Manifest  configManifest
+	Names     interfaceNames
+	Links     int
+	LANs      int
+	templates *template.Template
+}
+
+// loadConfigTemplateSet reads the manifest of dir and parses every other
+// file in it as one template set, so templates can include each other by
+// file name or with define.
+func loadConfigTemplateSet(dir string) (*configTemplateSet, error) {
+	manifestPath := filepath.Join(dir, "manifest.json")
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	set := &configTemplateSet{Name: filepath.Base(dir), Dir: dir, Names: genericInterfaceNames, Links: 2, LANs: 1}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&set.Manifest); err != nil {
+		return nil, fmt.Errorf("%s: %v", manifestPath, err)
+	}
+	m := set.Manifest
+	if m.Platform != "" {
+		names, ok := platformInterfaceNames[m.Platform]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown platform %q (expected one of %s)", manifestPath, m.Platform, strings.Join(platformNames(), ", "))
+		}
+		set.Names = names
+	}
+	for role, name := range m.Interfaces {
+		switch role {
+		case roleLoopback:
+			set.Names.loopback = name
+		case roleP2P:
+			set.Names.p2p = name
+		case roleLAN:
+			set.Names.lan = name
+		default:
+			return nil, fmt.Errorf("%s: unknown interface role %q (expected loopback, p2p or lan)", manifestPath, role)
+		}
+	}
+	if m.Links != nil {
+		set.Links = *m.Links
+	}
+	if m.LANs != nil {
+		set.LANs = *m.LANs
+	}
+	if set.Links < 0 || set.LANs < 0 {
+		return nil, fmt.Errorf("%s: links and lans cannot be negative", manifestPath)
+	}
+	if len(m.Templates) == 0 {
+		return nil, fmt.Errorf("%s: no templates listed", manifestPath)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	set.templates = template.New(set.Name).Funcs(configTemplateFuncs)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || entry.Name() == "manifest.json" || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		text, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := set.templates.New(entry.Name()).Parse(string(text)); err != nil {
+			return nil, err
+		}
+	}
+	for i, t := range m.Templates {
+		if set.templates.Lookup(t.File) == nil {
+			return nil, fmt.Errorf("%s: template %q is not in %s", manifestPath, t.File, dir)
+		}
+		if t.Per != "" && t.Per != "pop" && t.Per != "plan" {
+			return nil, fmt.Errorf("%s: %s: per must be pop or plan, not %q", manifestPath, t.File, t.Per)
+		}
+		// Without an output name, a per-POP file goes in a directory
+		// for each site and a per-plan file keeps its own name
+		if t.Output == "" {
+			t.Output = strings.TrimSuffix(t.File, ".tmpl")
+			if t.Per != "plan" {
+				t.Output = "{{.Site}}/" + t.Output
+			}
+		}
+		if _, err := set.templates.New("output " + t.File).Parse(t.Output); err != nil {
+			return nil, fmt.Errorf("%s: output of %s: %v", manifestPath, t.File, err)
+		}
+		set.Manifest.Templates[i] = t
+	}
+	return set, nil
+}
+
+// loadConfigTemplates loads every subdirectory of dir holding a
+// manifest.json, in name order, or only those named in only.
+func loadConfigTemplates(dir string, only []string) ([]*configTemplateSet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var sets []*configTemplateSet
+	for _, entry := range entries {
+		sub := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() || (len(only) > 0 && !containsString(only, entry.Name())) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(sub, "manifest.json")); os.IsNotExist(err) {
+			continue
+		}
+		set, err := loadConfigTemplateSet(sub)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	for _, name := range only {
+		found := false
+		for _, set := range sets {
+			found = found || set.Name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("%s has no template directory %s with a manifest.json", dir, name)
+		}
+	}
+	sort.Slice(sets, func(i, j int) bool { return sets[i].Name < sets[j].Name })
+	return sets, nil
+}
+
+// renderConfigTemplates renders every template of set against the POPs of
+// plan, returning the files by path relative to the set's output
+// directory.
+func renderConfigTemplates(set *configTemplateSet, plan IPv6Plan, pops []POPAlloc) (map[string][]byte, error) {
+	configPOPs := make([]ConfigPOP, 0, len(pops))
+	for _, pop := range pops {
+		router, err := buildPOPRouter(pop, set.Names, set.Links, set.LANs)
+		if err != nil {
+			return nil, err
+		}
+		configPOPs = append(configPOPs, ConfigPOP{POPAlloc: pop, Site: siteLabel(pop), Router: router})
+	}
+
+	files := make(map[string][]byte)
+	from := make(map[string]string)
+	render := func(t configTemplate, data interface{}, what string) error {
+		var name, body bytes.Buffer
+		if err := set.templates.ExecuteTemplate(&name, "output "+t.File, data); err != nil {
+			return err
+		}
+		if err := set.templates.ExecuteTemplate(&body, t.File, data); err != nil {
+			return err
+		}
+		path := filepath.Clean(strings.TrimSpace(name.String()))
+		if path == "." || filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s: output %q for %s is not a path inside the output directory", t.File, name.String(), what)
+		}
+		if other, dup := from[path]; dup {
+			return fmt.Errorf("%s for %s and %s would both be written to %s; use .Site or .POPNumber in its output", t.File, other, what, path)
+		}
+		from[path] = what
+		files[path] = body.Bytes()
+		return nil
+	}
+	for _, t := range set.Manifest.Templates {
+		if t.Per == "plan" {
+			if err := render(t, configPlanData{Plan: plan, POPs: configPOPs}, "the plan"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, pop := range configPOPs {
+			if err := render(t, configPOPData{ConfigPOP: pop, Plan: plan}, popName(pop.POPAlloc)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// RenderedConfigs lists the files written for one template directory.
+type RenderedConfigs struct {
+	Templates   string   `json:"templates"`
+	Description string   `json:"description,omitempty"`
+	Files       []string `json:"files"`
+}
+
+// runRenderConfigs implements the render-configs command.
+func runRenderConfigs(args []string) {
+	fs := flag.NewFlagSet("render-configs", flag.ExitOnError)
+	planPath := fs.String("plan", "", "Plan JSON file to take the POPs from")
+	templatesDir := fs.String("templates", "", "Directory with a subdirectory of templates and a manifest.json per vendor or output")
+	outDir := fs.String("o", "", "Directory to write the configurations to, in a subdirectory per template directory")
+	only := fs.String("only", "", "Comma-separated template directories to render (default: all)")
+	popNumber := fs.Int("pop", 0, "Only this POP (default: every POP)")
+	jsonOut := fs.Bool("j", false, "Print the files written as JSON")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner render-configs -plan plan.json -templates dir -o out-dir [-only junos,frr] [-pop n] [-j]")
+		fmt.Println("Each subdirectory of -templates holding a manifest.json is rendered into the same name under -o.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *planPath == "" || *templatesDir == "" || *outDir == "" || fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	sets, err := loadConfigTemplates(*templatesDir, splitList(*only))
+	if err != nil {
+		fmt.Printf("Error loading templates: %v\n", err)
+		os.Exit(1)
+	}
+	if len(sets) == 0 {
+		fmt.Printf("Error: no subdirectory of %s has a manifest.json\n", *templatesDir)
+		os.Exit(1)
+	}
+	plan, err := loadPlan(*planPath)
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+	var pops []POPAlloc
+	for _, pop := range plan.POPAllocations {
+		if *popNumber == 0 || pop.POPNumber == *popNumber {
+			pops = append(pops, pop)
+		}
+	}
+	if len(pops) == 0 {
+		fmt.Printf("Error: POP %d is not in %s\n", *popNumber, *planPath)
+		os.Exit(1)
+	}
+
+	// Render everything before writing anything, so a broken template
+	// leaves no half-written set of configurations behind
+	rendered := make([]map[string][]byte, len(sets))
+	for i, set := range sets {
+		if rendered[i], err = renderConfigTemplates(set, plan, pops); err != nil {
+			fmt.Printf("Error rendering %s: %v\n", set.Dir, err)
+			os.Exit(1)
+		}
+	}
+	var results []RenderedConfigs
+	for i, set := range sets {
+		result := RenderedConfigs{Templates: set.Name, Description: set.Manifest.Description, Files: []string{}}
+		for path := range rendered[i] {
+			result.Files = append(result.Files, filepath.ToSlash(filepath.Join(set.Name, path)))
+		}
+		sort.Strings(result.Files)
+		for path, data := range rendered[i] {
+			file := filepath.Join(*outDir, set.Name, path)
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err == nil {
+				err = os.WriteFile(file, data, 0644)
+			}
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		results = append(results, result)
+	}
+
+	if *jsonOut {
+		jsonData, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+	for _, r := range results {
+		fmt.Printf("%s: %d files", r.Templates, len(r.Files))
+		if r.Description != "" {
+			fmt.Printf(" (%s)", r.Description)
+		}
+		fmt.Println()
+		for _, f := range r.Files {
+			fmt.Printf("  %s\n", filepath.Join(*outDir, filepath.FromSlash(f)))
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// commandContext is cancelled by Ctrl-C, and after deadline when it is
+// positive, so long-running commands (probe sweeps, large RIB dumps, policy
+// evaluation) can stop cleanly and report what they have.
+func commandContext(deadline time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	if deadline <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
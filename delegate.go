@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// DelegatedBlock is a block handed to a downstream organization, which
+// plans its own hierarchy inside it with -within.
+type DelegatedBlock struct {
+	Organization string `json:"organization"`
+	Prefix       string `json:"prefix"`
+}
+
+// DelegatedFrom records, in a downstream plan, the block of the parent plan
+// it was planned in.
+type DelegatedFrom struct {
+	Organization string `json:"organization"`
+	ParentBase   string `json:"parent_base"`
+}
+
+// parseDelegations reads "acme=40,globex=/44" into a map from organization
+// to the prefix length of its block.
+func parseDelegations(s string) (map[string]int, error) {
+	delegations := make(map[string]int)
+	for _, item := range splitList(s) {
+		org, size, ok := strings.Cut(item, "=")
+		org = strings.TrimSpace(org)
+		if !ok || org == "" {
+			return nil, fmt.Errorf("invalid entry %q (expected organization=prefix-length)", item)
+		}
+		length, err := parsePrefixLength(size)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", org, err)
+		}
+		if _, dup := delegations[org]; dup {
+			return nil, fmt.Errorf("%s is listed twice", org)
+		}
+		delegations[org] = length
+	}
+	return delegations, nil
+}
+
+// formatDelegations is the inverse of parseDelegations, in a stable order.
+func formatDelegations(delegations map[string]int) string {
+	orgs := make([]string, 0, len(delegations))
+	for org := range delegations {
+		orgs = append(orgs, org)
+	}
+	sort.Strings(orgs)
+	items := make([]string, len(orgs))
+	for i, org := range orgs {
+		items[i] = fmt.Sprintf("%s=%d", org, delegations[org])
+	}
+	return strings.Join(items, ",")
+}
+
+// span is a half-open range of offsets into the base subnet.
+type span struct {
+	start, end *big.Int
+}
+
+// placeDelegations carves the delegated blocks out of the top of the base,
+// largest first, so they stay clear of the POPs numbered from the bottom
+// and pack without gaps. Blocks issued in a previous plan keep their
+// prefixes. It returns the blocks and the POP ID ranges they cover, which
+// POP numbering has to skip.
+func placeDelegations(requested map[string]int, base netip.Prefix, popSize int, previous []DelegatedBlock) ([]DelegatedBlock, []idRange, error) {
+	if len(requested) == 0 && len(previous) == 0 {
+		return nil, nil, nil
+	}
+	if popSize <= base.Bits() {
+		return nil, nil, failf(ErrPrefixTooSmall, "/%d POPs fill the /%d base, leaving no room for delegated blocks", popSize, base.Bits())
+	}
+
+	var placed []span
+	var blocks []DelegatedBlock
+	kept := make(map[string]bool)
+	for _, block := range previous {
+		size, ok := requested[block.Organization]
+		prefix, err := netip.ParsePrefix(block.Prefix)
+		if err != nil {
+			return nil, nil, failf(ErrInvalidPrefix, "block delegated to %s in the base plan: %v", block.Organization, err)
+		}
+		if !ok {
+			return nil, nil, fmt.Errorf("%s was delegated %s in the base plan; issued delegations cannot be dropped", block.Organization, prefix)
+		}
+		if size != prefix.Bits() {
+			return nil, nil, failf(ErrInvalidLevel, "%s was delegated a /%d in the base plan, not a /%d", block.Organization, prefix.Bits(), size)
+		}
+		start := addrDiff(base.Addr(), prefix.Addr())
+		placed = append(placed, span{start, new(big.Int).Add(start, pow2(128-size))})
+		blocks = append(blocks, block)
+		kept[block.Organization] = true
+	}
+
+	var orgs []string
+	for org := range requested {
+		if !kept[org] {
+			orgs = append(orgs, org)
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool {
+		if requested[orgs[i]] != requested[orgs[j]] {
+			return requested[orgs[i]] < requested[orgs[j]]
+		}
+		return orgs[i] < orgs[j]
+	})
+	total := pow2(128 - base.Bits())
+	for _, org := range orgs {
+		size := requested[org]
+		if size <= base.Bits() || size > 128 {
+			return nil, nil, failf(ErrInvalidLevel, "/%d for %s does not fit inside the /%d base", size, org, base.Bits())
+		}
+		blockSize := pow2(128 - size)
+		start := new(big.Int).Sub(total, blockSize)
+		for start.Sign() >= 0 {
+			var hit *span
+			for i := range placed {
+				if start.Cmp(placed[i].end) < 0 && placed[i].start.Cmp(new(big.Int).Add(start, blockSize)) < 0 {
+					hit = &placed[i]
+					break
+				}
+			}
+			if hit == nil {
+				break
+			}
+			// Move below the block in the way, staying aligned
+			start.Sub(hit.start, blockSize)
+			start.Sub(start, new(big.Int).Mod(start, blockSize))
+		}
+		if start.Sign() < 0 {
+			return nil, nil, failf(ErrPrefixTooSmall, "no room is left in %s for the /%d delegated to %s", base, size, org)
+		}
+		placed = append(placed, span{start, new(big.Int).Add(start, blockSize)})
+		blocks = append(blocks, DelegatedBlock{
+			Organization: org,
+			Prefix:       netip.PrefixFrom(addrAdd(base.Addr(), start), size).String(),
+		})
+	}
+
+	shift := uint(128 - popSize)
+	ranges := make([]idRange, len(placed))
+	for i, s := range placed {
+		last := new(big.Int).Sub(s.end, big.NewInt(1))
+		ranges[i] = idRange{lo: new(big.Int).Rsh(s.start, shift), hi: last.Rsh(last, shift)}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Organization < blocks[j].Organization })
+	return blocks, ranges, nil
+}
+
+// placeBlocks places the blocks -delegate asks for and, with -oob, the
+// management aggregate, which is carved out alongside them so it stays
+// clear of production space. Blocks the base plan issued keep their
+// prefixes. It returns the delegated blocks, the POP ID ranges all of them
+// cover and the management space with its aggregate set.
+func placeBlocks(opts PlanOptions, base netip.Prefix, popSize, popCount int) ([]DelegatedBlock, []idRange, *OOBPlan, error) {
+	var issued []DelegatedBlock
+	if opts.BasePlan != nil {
+		issued = opts.BasePlan.Delegations
+	}
+	oob, err := newOOBPlan(opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	requested := opts.Delegations
+	if oob != nil {
+		size := oobAggregateSize(opts.OOBSize, popCount, opts.GrowthBits)
+		if opts.BasePlan != nil && opts.BasePlan.OOB != nil {
+			// An issued aggregate keeps its prefix
+			issued = append(append([]DelegatedBlock(nil), issued...), DelegatedBlock{Organization: oobOrganization, Prefix: opts.BasePlan.OOB.Aggregate})
+			if prefix, err := netip.ParsePrefix(opts.BasePlan.OOB.Aggregate); err == nil {
+				size = prefix.Bits()
+			}
+		}
+		requested = make(map[string]int, len(opts.Delegations)+1)
+		for org, length := range opts.Delegations {
+			requested[org] = length
+		}
+		requested[oobOrganization] = size
+	}
+	delegations, delegatedIDs, err := placeDelegations(requested, base, popSize, issued)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if oob != nil {
+		for i, block := range delegations {
+			if block.Organization == oobOrganization {
+				oob.Aggregate = block.Prefix
+				delegations = append(delegations[:i:i], delegations[i+1:]...)
+				break
+			}
+		}
+	}
+	return delegations, delegatedIDs, oob, nil
+}
+
+// delegatedOwner names the organization whose block covers POP ID v.
+func delegatedOwner(blocks []DelegatedBlock, base netip.Prefix, popSize int, v *big.Int) string {
+	addr := addrAdd(base.Addr(), new(big.Int).Lsh(v, uint(128-popSize)))
+	for _, block := range blocks {
+		prefix, err := netip.ParsePrefix(block.Prefix)
+		if err != nil {
+			continue
+		}
+		// A POP inside the block, or a block inside the POP
+		if prefix.Contains(addr) || (prefix.Bits() > popSize && netip.PrefixFrom(addr, popSize).Contains(prefix.Addr())) {
+			return block.Organization
+		}
+	}
+	return ""
+}
+
+// loadWithin finds the block an organization was delegated in a parent
+// plan, given as "parent.json:organization".
+func loadWithin(spec string) (string, *DelegatedFrom, error) {
+	i := strings.LastIndex(spec, ":")
+	if i <= 0 || i == len(spec)-1 {
+		return "", nil, fmt.Errorf("invalid -within %q (expected parent.json:organization)", spec)
+	}
+	path, org := spec[:i], spec[i+1:]
+	parent, err := loadPlan(path)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, block := range parent.Delegations {
+		if block.Organization == org {
+			return block.Prefix, &DelegatedFrom{Organization: org, ParentBase: parent.BaseSubnet}, nil
+		}
+	}
+	var orgs []string
+	for _, block := range parent.Delegations {
+		orgs = append(orgs, block.Organization)
+	}
+	if len(orgs) == 0 {
+		return "", nil, fmt.Errorf("%s delegates no blocks", path)
+	}
+	return "", nil, fmt.Errorf("%s delegates no block to %s (it delegates to %s)", path, org, strings.Join(orgs, ", "))
+}
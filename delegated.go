@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Delegation is an IPv6 allocation or assignment found in an RIR
+// delegated-extended statistics file.
+type Delegation struct {
+	Registry string `json:"registry"`
+	Country  string `json:"country"`
+	Prefix   string `json:"prefix"`
+	Date     string `json:"date"`
+	Status   string `json:"status"`
+	OpaqueID string `json:"opaque_id"`
+}
+
+// delegatedRecord is one resource line of a delegated-extended file:
+// registry|cc|type|start|value|date|status|opaque-id[|extensions].
+type delegatedRecord struct {
+	registry, cc, kind, start, value, date, status, opaqueID string
+}
+
+// parseDelegated reads the resource lines of a delegated-extended file,
+// skipping comments, the version line and the summary lines.
+func parseDelegated(r io.Reader) ([]delegatedRecord, error) {
+	var records []delegatedRecord
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "|")
+		if len(fields) >= 6 && fields[5] == "summary" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			// The version line: version|registry|serial|records|...
+			continue
+		}
+		if len(fields) < 8 {
+			return nil, fmt.Errorf("line %d: expected 8 fields of a delegated-extended file, got %d", line, len(fields))
+		}
+		records = append(records, delegatedRecord{
+			registry: fields[0], cc: fields[1], kind: fields[2], start: fields[3],
+			value: fields[4], date: fields[5], status: fields[6], opaqueID: fields[7],
+		})
+	}
+	return records, scanner.Err()
+}
+
+// findDelegations returns the IPv6 blocks held by an organization, named
+// by its opaque ID or by one of its ASNs ("AS64500" or "64500"), largest
+// first.
+func findDelegations(records []delegatedRecord, org string) ([]Delegation, error) {
+	org = strings.TrimSpace(org)
+	ids := map[string]bool{org: true}
+	if n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(org), "AS"), 10, 32); err == nil {
+		// An ASN: find the opaque IDs of the records covering it
+		ids = make(map[string]bool)
+		for _, r := range records {
+			if r.kind != "asn" {
+				continue
+			}
+			start, err1 := strconv.ParseUint(r.start, 10, 32)
+			count, err2 := strconv.ParseUint(r.value, 10, 32)
+			if err1 == nil && err2 == nil && n >= start && n < start+count {
+				ids[r.opaqueID] = true
+			}
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("AS%d is not in the delegated file", n)
+		}
+	}
+
+	var found []Delegation
+	for _, r := range records {
+		if r.kind != "ipv6" || !ids[r.opaqueID] {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(r.start + "/" + r.value)
+		if err != nil {
+			return nil, failf(ErrInvalidPrefix, "delegated record %s/%s: %v", r.start, r.value, err)
+		}
+		found = append(found, Delegation{
+			Registry: r.registry,
+			Country:  r.cc,
+			Prefix:   prefix.Masked().String(),
+			Date:     r.date,
+			Status:   r.status,
+			OpaqueID: r.opaqueID,
+		})
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no IPv6 blocks are delegated to %s", org)
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return netip.MustParsePrefix(found[i].Prefix).Bits() < netip.MustParsePrefix(found[j].Prefix).Bits()
+	})
+	return found, nil
+}
+
+// loadDelegations reads a delegated-extended file and looks up org in it.
+func loadDelegations(path, org string) ([]Delegation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := parseDelegated(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return findDelegations(records, org)
+}
+
+func (d Delegation) String() string {
+	date := d.Date
+	if len(date) == 8 {
+		date = date[:4] + "-" + date[4:6] + "-" + date[6:]
+	}
+	return fmt.Sprintf("%s (%s, %s, %s %s)", d.Prefix, d.Registry, d.Country, d.Status, date)
+}
+
+func runDelegated(args []string) {
+	fs := flag.NewFlagSet("delegated", flag.ExitOnError)
+	jsonOut := fs.Bool("j", false, "JSON output format")
+	org := fs.String("org", "", "Organization, by ASN (AS64500) or the file's opaque ID")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner delegated -org AS64500 [-j] delegated-extended-file")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *org == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	found, err := loadDelegations(fs.Arg(0), *org)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *jsonOut {
+		jsonData, err := json.MarshalIndent(found, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+	fmt.Printf("IPv6 blocks delegated to %s:\n", *org)
+	for _, d := range found {
+		fmt.Printf("  %s\n", d)
+	}
+}
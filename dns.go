@@ -0,0 +1,712 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DNSRecord is one AAAA or PTR record for an infrastructure address. Names
+// are fully qualified, with the trailing dot.
+type DNSRecord struct {
+	Zone string
+	Name string
+	Type string
+	Data string
+}
+
+// hostNameData is what hostname templates see: .POP (number), .Code (its
+// hex POP ID), .Name (the POP's name), .Site (its name as a DNS label, or
+// "pop" and its number), .Role (loopback, p2p or lan), .Index (0-based)
+// and .Number (1-based).
+type hostNameData struct {
+	POP                    int
+	Code, Name, Site, Role string
+	Index, Number          int
+}
+
+const defaultHostNameTemplate = "{{.Role}}{{.Number}}.{{.Site}}"
+
+// dnsLabel turns s into a DNS label: lower case letters, digits and "-".
+func dnsLabel(s string) string {
+	label := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(s))
+	for strings.Contains(label, "--") {
+		label = strings.ReplaceAll(label, "--", "-")
+	}
+	return strings.Trim(label, "-")
+}
+
+// siteLabel names a POP in hostnames and file names: its name as a DNS
+// label, or "pop" and its number when it has none.
+func siteLabel(pop POPAlloc) string {
+	if site := dnsLabel(pop.Name); site != "" {
+		return site
+	}
+	return fmt.Sprintf("pop%d", pop.POPNumber)
+}
+
+// hostnameLabel is a hostname label (RFC 1123), in lower case.
+var hostnameLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// checkHostname reports names that are not valid hostnames. The 253
+// character limit is for the name without its final dot.
+func checkHostname(name string) error {
+	if len(strings.TrimSuffix(name, ".")) > 253 {
+		return fmt.Errorf("%s is longer than 253 characters", name)
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if !hostnameLabel.MatchString(label) {
+			return fmt.Errorf("%q is not a valid hostname: %q is not a label of letters, digits and inner hyphens", name, label)
+		}
+	}
+	return nil
+}
+
+// fqdn makes name absolute, appending origin (written without the final
+// dot) unless name already ends in a dot.
+func fqdn(name, origin string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "." + origin + "."
+}
+
+// infrastructureRecords names the turn-up addresses of the plan's POPs,
+// as router-config lays them out, and returns an AAAA and a PTR record for
+// each. PTR records go in reverseZone, or in the base subnet's ip6.arpa
+// zone holding them when reverseZone is empty.
+func infrastructureRecords(plan IPv6Plan, names *template.Template, zone, reverseZone string, popNumber, links, lans int) ([]DNSRecord, error) {
+	base, err := netip.ParsePrefix(plan.BaseSubnet)
+	if err != nil {
+		return nil, failf(ErrInvalidPrefix, "%q is not an IPv6 prefix", plan.BaseSubnet)
+	}
+	ptrZones := reverseZones(base)
+	if reverseZone != "" {
+		ptrZones = []string{strings.ToLower(strings.TrimSuffix(reverseZone, "."))}
+	}
+
+	var records []DNSRecord
+	seen := make(map[string]string)
+	for _, pop := range plan.POPAllocations {
+		if popNumber != 0 && pop.POPNumber != popNumber {
+			continue
+		}
+		router, err := buildPOPRouter(pop, genericInterfaceNames, links, lans)
+		if err != nil {
+			return nil, err
+		}
+		site := siteLabel(pop)
+		counts := make(map[string]int)
+		for _, iface := range router.Interfaces {
+			i := counts[iface.Role]
+			counts[iface.Role]++
+			var b bytes.Buffer
+			data := hostNameData{POP: pop.POPNumber, Code: pop.Code, Name: pop.Name, Site: site, Role: iface.Role, Index: i, Number: i + 1}
+			if err := names.Execute(&b, data); err != nil {
+				return nil, err
+			}
+			name := strings.ToLower(fqdn(strings.TrimSpace(b.String()), zone))
+			if err := checkHostname(name); err != nil {
+				return nil, err
+			}
+			if !strings.HasSuffix(name, "."+zone+".") {
+				return nil, fmt.Errorf("%s (%s) is not in the zone %s", name, iface.Description, zone)
+			}
+			if other, dup := seen[name]; dup {
+				return nil, fmt.Errorf("%s and %s are both named %s; use .Site, .POP and .Number in -name", other, iface.Description, name)
+			}
+			seen[name] = iface.Description
+
+			addr := iface.Address.Addr()
+			ptr := reverseName(addr)
+			inZone := ""
+			for _, z := range ptrZones {
+				if strings.HasSuffix(ptr, "."+z) {
+					inZone = z + "."
+				}
+			}
+			if inZone == "" {
+				return nil, fmt.Errorf("%s (%s) is not in the reverse zone %s", addr, iface.Description, strings.Join(ptrZones, ", "))
+			}
+			records = append(records,
+				DNSRecord{Zone: zone + ".", Name: name, Type: "AAAA", Data: addr.String()},
+				DNSRecord{Zone: inZone, Name: ptr + ".", Type: "PTR", Data: name})
+		}
+	}
+	return records, nil
+}
+
+// reverseName returns the ip6.arpa name of a single address.
+func reverseName(addr netip.Addr) string {
+	return reverseZones(netip.PrefixFrom(addr, 128))[0]
+}
+
+// recordZones lists the zones of records in the order they first appear.
+func recordZones(records []DNSRecord) []string {
+	var zones []string
+	for _, r := range records {
+		if !containsString(zones, r.Zone) {
+			zones = append(zones, r.Zone)
+		}
+	}
+	return zones
+}
+
+// writeZoneRecords writes the records in master file format, zone by
+// zone, for pasting into zone files.
+func writeZoneRecords(w io.Writer, records []DNSRecord, ttl int) {
+	for i, zone := range recordZones(records) {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "; %s\n", zone)
+		for _, r := range records {
+			if r.Zone == zone {
+				fmt.Fprintf(w, "%s\t%d\tIN\t%s\t%s\n", r.Name, ttl, r.Type, r.Data)
+			}
+		}
+	}
+}
+
+// writeNsupdate writes the records as an nsupdate script replacing each
+// name's record, one update per zone.
+func writeNsupdate(w io.Writer, records []DNSRecord, ttl int, server string) {
+	if server != "" {
+		host, port, _ := net.SplitHostPort(server)
+		fmt.Fprintf(w, "server %s %s\n", host, port)
+	}
+	for _, zone := range recordZones(records) {
+		fmt.Fprintf(w, "zone %s\n", zone)
+		for _, r := range records {
+			if r.Zone == zone {
+				fmt.Fprintf(w, "update delete %s %s\nupdate add %s %d %s %s\n", r.Name, r.Type, r.Name, ttl, r.Type, r.Data)
+			}
+		}
+		fmt.Fprintln(w, "send")
+	}
+}
+
+// DNS wire format constants used by dynamic updates.
+const (
+	dnsTypeAAAA     = 28
+	dnsTypePTR      = 12
+	dnsTypeSOA      = 6
+	dnsTypeTSIG     = 250
+	dnsClassIN      = 1
+	dnsClassANY     = 255
+	dnsOpcodeUpdate = 5
+)
+
+var dnsRcodes = []string{"NOERROR", "FORMERR", "SERVFAIL", "NXDOMAIN", "NOTIMP", "REFUSED", "YXDOMAIN", "YXRRSET", "NXRRSET", "NOTAUTH", "NOTZONE"}
+
+func appendUint16(b []byte, v uint16) []byte { return append(b, byte(v>>8), byte(v)) }
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// appendDNSName appends name in wire format, without compression.
+func appendDNSName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func appendDNSRR(b []byte, name string, typ, class uint16, ttl uint32, rdata []byte) []byte {
+	b = appendDNSName(b, name)
+	b = appendUint16(b, typ)
+	b = appendUint16(b, class)
+	b = appendUint32(b, ttl)
+	b = appendUint16(b, uint16(len(rdata)))
+	return append(b, rdata...)
+}
+
+// dnsUpdateMessage builds an RFC 2136 UPDATE for one zone that replaces
+// each record's RRset: delete the name's records of the type, then add the
+// record, so stale addresses and names from an earlier plan go too.
+func dnsUpdateMessage(id uint16, zone string, records []DNSRecord, ttl int) []byte {
+	b := appendUint16(nil, id)
+	b = appendUint16(b, dnsOpcodeUpdate<<11)
+	b = appendUint16(b, 1)                      // zone
+	b = appendUint16(b, 0)                      // prerequisites
+	b = appendUint16(b, uint16(2*len(records))) // updates
+	b = appendUint16(b, 0)                      // additional
+	b = appendDNSName(b, zone)
+	b = appendUint16(b, dnsTypeSOA)
+	b = appendUint16(b, dnsClassIN)
+	for _, r := range records {
+		typ, rdata := uint16(dnsTypePTR), appendDNSName(nil, r.Data)
+		if r.Type == "AAAA" {
+			a := netip.MustParseAddr(r.Data).As16()
+			typ, rdata = dnsTypeAAAA, a[:]
+		}
+		b = appendDNSRR(b, r.Name, typ, dnsClassANY, 0, nil)
+		b = appendDNSRR(b, r.Name, typ, dnsClassIN, uint32(ttl), rdata)
+	}
+	return b
+}
+
+// tsigKey is a shared secret for signing updates (RFC 8945).
+type tsigKey struct {
+	name, algorithm string
+	secret          []byte
+}
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha1":   sha1.New,
+	"hmac-sha256": sha256.New,
+	"hmac-sha512": sha512.New,
+}
+
+var (
+	keyNamePattern      = regexp.MustCompile(`key\s+"?([^"\s{]+)"?\s*\{`)
+	keyAlgorithmPattern = regexp.MustCompile(`algorithm\s+"?([A-Za-z0-9-]+)"?\s*;`)
+	keySecretPattern    = regexp.MustCompile(`secret\s+"([^"]+)"\s*;`)
+)
+
+// loadTSIGKey reads a key file as tsig-keygen and rndc-confgen write it:
+// key "name" { algorithm hmac-sha256; secret "base64"; };
+func loadTSIGKey(path string) (tsigKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return tsigKey{}, err
+	}
+	name, algorithm, secret := keyNamePattern.FindSubmatch(data), keyAlgorithmPattern.FindSubmatch(data), keySecretPattern.FindSubmatch(data)
+	if name == nil || algorithm == nil || secret == nil {
+		return tsigKey{}, fmt.Errorf("%s: expected key \"name\" { algorithm ...; secret \"...\"; };", path)
+	}
+	key := tsigKey{name: strings.ToLower(string(name[1])), algorithm: strings.ToLower(string(algorithm[1]))}
+	if _, ok := tsigAlgorithms[key.algorithm]; !ok {
+		return tsigKey{}, fmt.Errorf("%s: unsupported algorithm %s (expected hmac-sha1, hmac-sha256 or hmac-sha512)", path, key.algorithm)
+	}
+	if key.secret, err = base64.StdEncoding.DecodeString(string(secret[1])); err != nil {
+		return tsigKey{}, fmt.Errorf("%s: the secret is not base64: %v", path, err)
+	}
+	return key, nil
+}
+
+// tsigFudge is the clock skew, in seconds, allowed between the signer
+// and the verifier of a TSIG.
+const tsigFudge = 300
+
+// tsigErrors names the TSIG error codes (RFC 8945 5.3).
+var tsigErrors = map[uint16]string{16: "BADSIG", 17: "BADKEY", 18: "BADTIME", 22: "BADTRUNC"}
+
+// variables returns the TSIG variables the MAC covers after the message
+// (RFC 8945 4.3.3).
+func (k tsigKey) variables(timeSigned []byte, fudge, errCode uint16, other []byte) []byte {
+	vars := appendDNSName(nil, k.name)
+	vars = appendUint16(vars, dnsClassANY)
+	vars = appendUint32(vars, 0)
+	vars = appendDNSName(vars, k.algorithm)
+	vars = append(vars, timeSigned...)
+	vars = appendUint16(vars, fudge)
+	vars = appendUint16(vars, errCode)
+	vars = appendUint16(vars, uint16(len(other)))
+	return append(vars, other...)
+}
+
+// mac computes the MAC over msg and the TSIG variables. A response's MAC
+// also covers the MAC of the request it answers (RFC 8945 4.3.1).
+func (k tsigKey) mac(requestMAC, msg, vars []byte) []byte {
+	mac := hmac.New(tsigAlgorithms[k.algorithm], k.secret)
+	if requestMAC != nil {
+		mac.Write(appendUint16(nil, uint16(len(requestMAC))))
+		mac.Write(requestMAC)
+	}
+	mac.Write(msg)
+	mac.Write(vars)
+	return mac.Sum(nil)
+}
+
+// sign appends a TSIG record to msg, which must not carry additional
+// records yet, and returns the signed message and its MAC, which the
+// server's reply must cover. requestMAC is nil unless msg is a reply.
+func (k tsigKey) sign(msg, requestMAC []byte, now time.Time) ([]byte, []byte) {
+	timeSigned := make([]byte, 6)
+	binary.BigEndian.PutUint16(timeSigned, uint16(now.Unix()>>32))
+	binary.BigEndian.PutUint32(timeSigned[2:], uint32(now.Unix()))
+	sum := k.mac(requestMAC, msg, k.variables(timeSigned, tsigFudge, 0, nil))
+
+	rdata := appendDNSName(nil, k.algorithm)
+	rdata = append(rdata, timeSigned...)
+	rdata = appendUint16(rdata, tsigFudge)
+	rdata = appendUint16(rdata, uint16(len(sum)))
+	rdata = append(rdata, sum...)
+	rdata = append(rdata, msg[0:2]...) // original ID
+	rdata = appendUint16(rdata, 0)     // error
+	rdata = appendUint16(rdata, 0)     // other length
+	signed := appendDNSRR(append([]byte(nil), msg...), k.name, dnsTypeTSIG, dnsClassANY, 0, rdata)
+	binary.BigEndian.PutUint16(signed[10:], 1)
+	return signed, sum
+}
+
+// tsigRecord is the TSIG record closing a DNS message.
+type tsigRecord struct {
+	start      int // offset of the record in the message
+	owner      string
+	algorithm  string
+	timeSigned []byte
+	fudge      uint16
+	mac        []byte
+	originalID []byte
+	errCode    uint16
+	other      []byte
+}
+
+var errMalformedDNS = fmt.Errorf("malformed DNS message")
+
+// readDNSName reads the name at off, following compression pointers, and
+// returns it with the offset just past it in the message.
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errMalformedDNS
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.ToLower(strings.Join(labels, ".")) + ".", end, nil
+		case n&0xc0 == 0xc0:
+			if off+2 > len(msg) || jumps > 16 {
+				return "", 0, errMalformedDNS
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errMalformedDNS
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
+
+// parseTSIG returns the TSIG record that ends msg's additional section, or
+// nil when the message is unsigned.
+func parseTSIG(msg []byte) (*tsigRecord, error) {
+	if len(msg) < 12 {
+		return nil, errMalformedDNS
+	}
+	count := func(i int) int { return int(binary.BigEndian.Uint16(msg[4+2*i:])) }
+	off := 12
+	for i := 0; i < count(0); i++ {
+		_, next, err := readDNSName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		off = next + 4
+	}
+	records := count(1) + count(2) + count(3)
+	for i := 0; i < records; i++ {
+		start := off
+		owner, next, err := readDNSName(msg, off)
+		if err != nil || next+10 > len(msg) {
+			return nil, errMalformedDNS
+		}
+		typ := binary.BigEndian.Uint16(msg[next:])
+		rdStart := next + 10
+		rdEnd := rdStart + int(binary.BigEndian.Uint16(msg[next+8:]))
+		if rdEnd > len(msg) {
+			return nil, errMalformedDNS
+		}
+		off = rdEnd
+		if typ != dnsTypeTSIG {
+			continue
+		}
+		if i != records-1 || count(3) == 0 {
+			return nil, fmt.Errorf("TSIG record is not the last record")
+		}
+		t := &tsigRecord{start: start, owner: owner}
+		if t.algorithm, off, err = readDNSName(msg, rdStart); err != nil || off+10 > rdEnd {
+			return nil, errMalformedDNS
+		}
+		t.timeSigned, t.fudge = msg[off:off+6], binary.BigEndian.Uint16(msg[off+6:])
+		macEnd := off + 10 + int(binary.BigEndian.Uint16(msg[off+8:]))
+		if macEnd+6 > rdEnd {
+			return nil, errMalformedDNS
+		}
+		t.mac, t.originalID = msg[off+10:macEnd], msg[macEnd:macEnd+2]
+		t.errCode = binary.BigEndian.Uint16(msg[macEnd+2:])
+		otherEnd := macEnd + 6 + int(binary.BigEndian.Uint16(msg[macEnd+4:]))
+		if otherEnd != rdEnd {
+			return nil, errMalformedDNS
+		}
+		t.other = msg[macEnd+6 : otherEnd]
+		return t, nil
+	}
+	return nil, nil
+}
+
+// verifyResponse checks the TSIG of a reply to a request whose MAC was
+// requestMAC: it must be signed with k, cover the request's MAC and be
+// within the fudge of now.
+func (k tsigKey) verifyResponse(resp, requestMAC []byte, now time.Time) error {
+	t, err := parseTSIG(resp)
+	switch {
+	case err != nil:
+		return err
+	case t == nil:
+		return fmt.Errorf("the reply is not signed")
+	case t.errCode != 0:
+		name, ok := tsigErrors[t.errCode]
+		if !ok {
+			name = fmt.Sprint(t.errCode)
+		}
+		return fmt.Errorf("the server rejected the request's TSIG: %s", name)
+	case t.owner != strings.TrimSuffix(k.name, ".")+"." || t.algorithm != strings.TrimSuffix(k.algorithm, ".")+".":
+		return fmt.Errorf("the reply is signed with key %s (%s), not %s", t.owner, t.algorithm, k.name)
+	}
+
+	// The MAC covers the reply as it was before the TSIG was added
+	unsigned := append([]byte(nil), resp[:t.start]...)
+	copy(unsigned[0:2], t.originalID)
+	binary.BigEndian.PutUint16(unsigned[10:], binary.BigEndian.Uint16(unsigned[10:])-1)
+	if !hmac.Equal(k.mac(requestMAC, unsigned, k.variables(t.timeSigned, t.fudge, t.errCode, t.other)), t.mac) {
+		return fmt.Errorf("the reply's TSIG does not verify; it did not come from a server holding the key")
+	}
+	signed := int64(binary.BigEndian.Uint16(t.timeSigned))<<32 | int64(binary.BigEndian.Uint32(t.timeSigned[2:]))
+	skew := now.Unix() - signed
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > int64(t.fudge) {
+		return fmt.Errorf("the reply's TSIG time is %ds off this host's clock, more than its %ds fudge", skew, t.fudge)
+	}
+	return nil
+}
+
+// sendDNSUpdate sends one update over TCP and returns the server's error,
+// if any. When the update was signed with key, the reply must carry a TSIG
+// from the same key covering requestMAC, or its status is not trusted.
+func sendDNSUpdate(server string, msg []byte, key *tsigKey, requestMAC []byte) error {
+	conn, err := net.DialTimeout("tcp", server, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	if _, err := conn.Write(append(appendUint16(nil, uint16(len(msg))), msg...)); err != nil {
+		return err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	if len(resp) < 12 || !bytes.Equal(resp[:2], msg[:2]) {
+		return fmt.Errorf("%s sent a malformed reply", server)
+	}
+	rcode := int(resp[3] & 0xf)
+	name := fmt.Sprint(rcode)
+	if rcode < len(dnsRcodes) {
+		name = dnsRcodes[rcode]
+	}
+	if key != nil {
+		if err := key.verifyResponse(resp, requestMAC, time.Now()); err != nil {
+			return fmt.Errorf("%s: %v (reply status %s)", server, err, name)
+		}
+	}
+	if rcode != 0 {
+		if name == "NOTAUTH" {
+			name += " (the server is not authoritative, or rejected the key)"
+		}
+		return fmt.Errorf("%s refused the update: %s", server, name)
+	}
+	return nil
+}
+
+// pushDNSRecords sends the records to server as dynamic updates, one zone
+// at a time and in batches that fit a DNS message, signed with key when
+// one is given. With dryRun, each update is printed instead of sent.
+func pushDNSRecords(server string, key *tsigKey, records []DNSRecord, ttl int, dryRun bool) error {
+	const batch = 200
+	for _, zone := range recordZones(records) {
+		var inZone []DNSRecord
+		for _, r := range records {
+			if r.Zone == zone {
+				inZone = append(inZone, r)
+			}
+		}
+		for start := 0; start < len(inZone); start += batch {
+			end := start + batch
+			if end > len(inZone) {
+				end = len(inZone)
+			}
+			if dryRun {
+				writeDryRunUpdate(os.Stdout, server, key, zone, inZone[start:end], ttl)
+				continue
+			}
+			var id [2]byte
+			if _, err := rand.Read(id[:]); err != nil {
+				return err
+			}
+			msg := dnsUpdateMessage(binary.BigEndian.Uint16(id[:]), zone, inZone[start:end], ttl)
+			var requestMAC []byte
+			if key != nil {
+				msg, requestMAC = key.sign(msg, nil, time.Now())
+			}
+			if err := sendDNSUpdate(server, msg, key, requestMAC); err != nil {
+				return fmt.Errorf("zone %s: %v", zone, err)
+			}
+		}
+		if !dryRun {
+			fmt.Printf("%s: %d records updated\n", zone, len(inZone))
+		}
+	}
+	return nil
+}
+
+// writeDryRunUpdate prints one update as pushDNSRecords would send it: the
+// RRset each record replaces, then the record, in nsupdate's syntax.
+func writeDryRunUpdate(w io.Writer, server string, key *tsigKey, zone string, records []DNSRecord, ttl int) {
+	signed := "unsigned"
+	if key != nil {
+		signed = "signed with TSIG key " + key.name
+	}
+	fmt.Fprintf(w, "; UPDATE to %s for zone %s, %d records, %s (not sent)\n", server, zone, len(records), signed)
+	for _, r := range records {
+		fmt.Fprintf(w, "update delete %s %s\nupdate add %s %d %s %s\n", r.Name, r.Type, r.Name, ttl, r.Type, r.Data)
+	}
+}
+
+// runDNS implements the dns command.
+func runDNS(args []string) {
+	fs := flag.NewFlagSet("dns", flag.ExitOnError)
+	planPath := fs.String("plan", "", "Plan JSON file to take the POPs from")
+	zone := fs.String("zone", "", "Forward zone the hostnames are in, e.g. example.net")
+	reverseZone := fs.String("reverse-zone", "", "ip6.arpa zone for the PTR records (default: the base subnet's)")
+	nameTemplate := fs.String("name", defaultHostNameTemplate, "Hostname template, relative to -zone unless it ends in a dot; sees .POP, .Code, .Name, .Site, .Role, .Index and .Number")
+	popNumber := fs.Int("pop", 0, "Only this POP (default: every POP)")
+	links := fs.Int("links", 2, "Point-to-point links per POP, as for router-config")
+	lans := fs.Int("lans", 1, "LAN gateways per POP, as for router-config")
+	ttl := fs.Int("ttl", 3600, "Record TTL in seconds")
+	format := fs.String("format", "zone", "Output when not sending updates: zone (master file records) or nsupdate")
+	server := fs.String("server", "", "Send the records to this server as RFC 2136 dynamic updates (host or host:port)")
+	keyPath := fs.String("key", "", "TSIG key file signing the updates, as tsig-keygen writes")
+	dryRun := fs.Bool("dry-run", false, "With -server, print the updates that would be sent without contacting the server")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner dns -plan plan.json -zone example.net [-name template] [-pop n] [-links n] [-lans n] [-ttl s] [-format zone|nsupdate] [-server ns1:53 [-key tsig.key] [-dry-run]]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *planPath == "" || *zone == "" || fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *keyPath != "" && (*server == "" || *format == "nsupdate") {
+		fmt.Println("Error: -key signs updates sent with -server; for -format nsupdate, give the key to nsupdate -k")
+		os.Exit(2)
+	}
+	if *dryRun && (*server == "" || *format == "nsupdate") {
+		fmt.Println("Error: -dry-run previews updates sent with -server; without -server nothing is sent")
+		os.Exit(2)
+	}
+	if *format != "zone" && *format != "nsupdate" {
+		fmt.Printf("Error: unknown format %q (expected zone or nsupdate)\n", *format)
+		os.Exit(2)
+	}
+	if *links < 0 || *lans < 0 || *ttl < 0 {
+		fmt.Println("Error: -links, -lans and -ttl cannot be negative")
+		os.Exit(2)
+	}
+	*zone = strings.ToLower(strings.TrimSuffix(*zone, "."))
+	if err := checkHostname(*zone); err != nil {
+		fmt.Printf("Error: -zone: %v\n", err)
+		os.Exit(2)
+	}
+	names, err := template.New("name").Funcs(template.FuncMap{"label": dnsLabel}).Parse(*nameTemplate)
+	if err != nil {
+		fmt.Printf("Error: -name: %v\n", err)
+		os.Exit(2)
+	}
+	if *server != "" {
+		if _, _, err := net.SplitHostPort(*server); err != nil {
+			*server = net.JoinHostPort(*server, "53")
+		}
+	}
+	var key *tsigKey
+	if *keyPath != "" {
+		k, err := loadTSIGKey(*keyPath)
+		if err != nil {
+			fmt.Printf("Error loading key: %v\n", err)
+			os.Exit(1)
+		}
+		key = &k
+	}
+
+	plan, err := loadPlan(*planPath)
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+	if *popNumber != 0 {
+		found := false
+		for _, pop := range plan.POPAllocations {
+			found = found || pop.POPNumber == *popNumber
+		}
+		if !found {
+			fmt.Printf("Error: POP %d is not in %s\n", *popNumber, *planPath)
+			os.Exit(1)
+		}
+	}
+	records, err := infrastructureRecords(plan, names, *zone, *reverseZone, *popNumber, *links, *lans)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(records) == 0 {
+		fmt.Println("Error: the plan has no loopback, p2p or LAN addresses to name; check -links, -lans and the level roles")
+		os.Exit(1)
+	}
+
+	switch {
+	case *server != "" && *format == "zone":
+		if err := pushDNSRecords(*server, key, records, *ttl, *dryRun); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	case *format == "nsupdate":
+		writeNsupdate(os.Stdout, records, *ttl, *server)
+	default:
+		writeZoneRecords(os.Stdout, records, *ttl)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTSIGKey = tsigKey{name: "ipv6planner", algorithm: "hmac-sha256", secret: []byte("0123456789abcdef0123456789abcdef")}
+
+// testReply answers a signed update as a server would: the header with
+// QR set and rcode, and the zone section.
+func testReply(request []byte, rcode byte) []byte {
+	_, end, err := readDNSName(request, 12)
+	if err != nil {
+		return nil
+	}
+	reply := append([]byte(nil), request[:end+4]...)
+	reply[2] |= 0x80
+	reply[3] = reply[3]&0xf0 | rcode
+	for i := 6; i < 12; i++ {
+		reply[i] = 0
+	}
+	return reply
+}
+
+func TestTSIGVerifyResponse(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	records := []DNSRecord{{Zone: "example.net.", Name: "lo1.example.net.", Type: "AAAA", Data: "2001:db8::1"}}
+	request, requestMAC := testTSIGKey.sign(dnsUpdateMessage(0x1234, "example.net.", records, 3600), nil, now)
+	if tsig, err := parseTSIG(request); err != nil || tsig == nil || tsig.owner != "ipv6planner." {
+		t.Fatalf("parseTSIG(request) = %+v, %v", tsig, err)
+	}
+
+	signed, _ := testTSIGKey.sign(testReply(request, 0), requestMAC, now)
+	if err := testTSIGKey.verifyResponse(signed, requestMAC, now.Add(time.Minute)); err != nil {
+		t.Errorf("reply signed with the key: %v", err)
+	}
+
+	other := testTSIGKey
+	other.secret = []byte("another secret")
+	forged, _ := other.sign(testReply(request, 0), requestMAC, now)
+	_, otherMAC := testTSIGKey.sign(dnsUpdateMessage(0x4321, "example.net.", records, 3600), nil, now)
+	for name, tc := range map[string]struct {
+		reply      []byte
+		requestMAC []byte
+		at         time.Time
+		want       string
+	}{
+		"unsigned":      {testReply(request, 0), requestMAC, now, "not signed"},
+		"other secret":  {forged, requestMAC, now, "does not verify"},
+		"other request": {signed, otherMAC, now, "does not verify"},
+		"late":          {signed, requestMAC, now.Add(time.Hour), "fudge"},
+	} {
+		if err := testTSIGKey.verifyResponse(tc.reply, tc.requestMAC, tc.at); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got %v, want an error containing %q", name, err, tc.want)
+		}
+	}
+}
+
+func TestPushDNSRecordsChecksReplyTSIG(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		key  tsigKey
+		want string
+	}{
+		{"signed", testTSIGKey, ""},
+		{"forged", tsigKey{name: "ipv6planner", algorithm: "hmac-sha256", secret: []byte("not the key")}, "does not verify"},
+	} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Skip(err)
+		}
+		go func(server tsigKey) {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			var length [2]byte
+			if _, err := io.ReadFull(conn, length[:]); err != nil {
+				return
+			}
+			request := make([]byte, binary.BigEndian.Uint16(length[:]))
+			if _, err := io.ReadFull(conn, request); err != nil {
+				return
+			}
+			tsig, err := parseTSIG(request)
+			if err != nil || tsig == nil {
+				return
+			}
+			reply, _ := server.sign(testReply(request, 0), tsig.mac, time.Now())
+			conn.Write(append(appendUint16(nil, uint16(len(reply))), reply...))
+		}(tc.key)
+
+		records := []DNSRecord{{Zone: "example.net.", Name: "lo1.example.net.", Type: "AAAA", Data: "2001:db8::1"}}
+		err = pushDNSRecords(ln.Addr().String(), &testTSIGKey, records, 3600, false)
+		ln.Close()
+		if tc.want == "" && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("%s: got %v, want an error containing %q", tc.name, err, tc.want)
+		}
+	}
+}
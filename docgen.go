@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// DocMeta is the hand-written part of a generated address plan document.
+// Everything else is derived from the plan itself.
+type DocMeta struct {
+	Title         string            `json:"title"`
+	Organization  string            `json:"organization,omitempty"`
+	Author        string            `json:"author,omitempty"`
+	Version       string            `json:"version,omitempty"`
+	Date          string            `json:"date,omitempty"`
+	Purpose       string            `json:"purpose,omitempty"`
+	LevelPurposes map[string]string `json:"level_purposes,omitempty"`
+	Rules         []string          `json:"rules,omitempty"`
+	Naming        []string          `json:"naming,omitempty"`
+}
+
+// docLevel describes one level of the hierarchy for the document.
+type docLevel struct {
+	Name       string
+	Prefix     int
+	Purpose    string
+	Parent     int
+	PerParent  *big.Int
+	PerPOP     *big.Int
+	Addressing string
+}
+
+// planDoc is what the document templates render.
+type planDoc struct {
+	Meta    DocMeta
+	Plan    IPv6Plan
+	Levels  []docLevel
+	Rules   []string
+	Naming  []string
+	Diagram string
+}
+
+func buildPlanDoc(plan IPv6Plan, meta DocMeta) planDoc {
+	if meta.Title == "" {
+		meta.Title = "IPv6 Address Plan"
+	}
+	doc := planDoc{Meta: meta, Plan: plan}
+
+	if len(plan.POPAllocations) > 0 {
+		pop := plan.POPAllocations[0]
+		parent := plan.PreferredSize
+		for i, subnet := range pop.Subnets {
+			_, ipNet, err := net.ParseCIDR(subnet.CIDR)
+			if err != nil {
+				continue
+			}
+			size := prefixLen(ipNet)
+			level := docLevel{
+				Name:       pop.LevelNames[i],
+				Prefix:     size,
+				Purpose:    meta.LevelPurposes[strconv.Itoa(size)],
+				Parent:     parent,
+				PerParent:  calculateAvailableSubnets(parent, size),
+				PerPOP:     subnet.Available,
+				Addressing: subnet.Addressing,
+			}
+			if level.Purpose == "" && subnet.Role != "" {
+				level.Purpose = strings.ToUpper(subnet.Role[:1]) + subnet.Role[1:] + " assignments"
+			}
+			doc.Levels = append(doc.Levels, level)
+			parent = size
+		}
+	}
+
+	doc.Rules = append(doc.Rules, fmt.Sprintf("All allocations come from the base subnet %s.", plan.BaseSubnet))
+	doc.Rules = append(doc.Rules, fmt.Sprintf("Each POP receives a /%d. %d POPs are allocated; the base has room for %s.", plan.PreferredSize, plan.POPCount, plan.MaxPOPCount))
+	doc.Rules = append(doc.Rules, "POP numbers are written bit-reversed into the bits after the base, so POPs spread evenly across it and keep their prefixes when more POPs are added.")
+	if plan.GrowthBits > 0 {
+		bits := "bits are"
+		if plan.GrowthBits == 1 {
+			bits = "bit is"
+		}
+		doc.Rules = append(doc.Rules, fmt.Sprintf("%d POP ID %s reserved for growth; POPs beyond the current count take them in order.", plan.GrowthBits, bits))
+	}
+	for _, level := range doc.Levels {
+		rule := fmt.Sprintf("%s blocks are carved from /%d blocks, %s per parent.", level.Name, level.Parent, level.PerParent)
+		if level.Addressing != "" {
+			rule += fmt.Sprintf(" Hosts are addressed by %s.", level.Addressing)
+		}
+		doc.Rules = append(doc.Rules, rule)
+	}
+	doc.Rules = append(doc.Rules, meta.Rules...)
+
+	doc.Naming = append(doc.Naming,
+		fmt.Sprintf("POPs are numbered 1 to %d in allocation order and referred to as \"POP n\".", plan.POPCount),
+		"Levels are named \"Level n (/length)\" after their position in the hierarchy.")
+	doc.Naming = append(doc.Naming, meta.Naming...)
+
+	doc.Diagram = hierarchyDiagram(plan, doc.Levels)
+	return doc
+}
+
+// hierarchyDiagram draws the level hierarchy as an indented tree.
+func hierarchyDiagram(plan IPv6Plan, levels []docLevel) string {
+	var b strings.Builder
+	label := "base"
+	if plan.BaseClass != nil {
+		label += " (" + plan.BaseClass.Name + ")"
+	}
+	fmt.Fprintf(&b, "%-28s %s\n", plan.BaseSubnet, label)
+	indent := ""
+	fmt.Fprintf(&b, "%s└── %-24s POP x%d (room for %s)\n", indent, "/"+strconv.Itoa(plan.PreferredSize), plan.POPCount, plan.MaxPOPCount)
+	for _, level := range levels {
+		indent += "    "
+		fmt.Fprintf(&b, "%s└── %-*s %s: %s per /%d\n", indent, 24-len(indent), "/"+strconv.Itoa(level.Prefix), level.Name, level.PerParent, level.Parent)
+	}
+	return b.String()
+}
+
+const docMarkdownTemplate = `# {{.Meta.Title}}
+{{with .Meta}}{{if or .Organization .Author .Version .Date}}
+{{- if .Organization}}
+- **Organization:** {{.Organization}}
+{{- end}}
+{{- if .Author}}
+- **Author:** {{.Author}}
+{{- end}}
+{{- if .Version}}
+- **Version:** {{.Version}}
+{{- end}}
+{{- if .Date}}
+- **Date:** {{.Date}}
+{{- end}}
+{{end}}{{end}}
+{{- if .Meta.Purpose}}
+## Purpose
+
+{{.Meta.Purpose}}
+{{end}}
+## Overview
+
+| Parameter | Value |
+|---|---|
+| Base subnet | {{.Plan.BaseSubnet}}{{with .Plan.BaseClass}} ({{.}}){{end}} |
+| POPs | {{.Plan.POPCount}} |
+| POP size | /{{.Plan.PreferredSize}} |
+| Maximum POPs | {{.Plan.MaxPOPCount}} |
+{{- if .Plan.GrowthBits}}
+| Growth bits | {{.Plan.GrowthBits}} |
+{{- end}}
+
+## Hierarchy
+
+| Level | Prefix | Purpose | Per parent | Per POP | Addressing |
+|---|---|---|---|---|---|
+{{- range .Levels}}
+| {{.Name}} | /{{.Prefix}} | {{.Purpose}} | {{.PerParent}} | {{.PerPOP}} | {{.Addressing}} |
+{{- end}}
+
+` + "```" + `
+{{.Diagram}}` + "```" + `
+
+## Allocation Rules
+{{range .Rules}}
+- {{.}}
+{{- end}}
+
+## Naming Conventions
+{{range .Naming}}
+- {{.}}
+{{- end}}
+
+## POP Allocations
+{{range .Plan.POPAllocations}}
+### POP {{.POPNumber}}: {{.POPSubnet}}
+
+| Level | First subnet | Available |
+|---|---|---|
+{{- $pop := .}}
+{{- range $i, $s := .Subnets}}
+| {{index $pop.LevelNames $i}} | {{$s.CIDR}} | {{$s.Available}} |
+{{- end}}
+{{end}}
+{{- if .Plan.Notes}}
+## Notes
+{{range .Plan.Notes}}
+- {{.}}
+{{- end}}
+{{end}}`
+
+const docHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+    <title>{{.Meta.Title}}</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; max-width: 1000px; }
+        h1 { color: #333; }
+        table { border-collapse: collapse; width: 100%; margin-bottom: 20px; }
+        th, td { border: 1px solid #ddd; padding: 8px; text-align: left; }
+        th { background-color: #f2f2f2; }
+        pre { background-color: #f7f7f7; padding: 10px; }
+        .meta { color: #666; }
+    </style>
+</head>
+<body>
+    <h1>{{.Meta.Title}}</h1>
+    <p class="meta">
+        {{if .Meta.Organization}}{{.Meta.Organization}}<br>{{end}}
+        {{if .Meta.Author}}Author: {{.Meta.Author}}<br>{{end}}
+        {{if .Meta.Version}}Version: {{.Meta.Version}}<br>{{end}}
+        {{if .Meta.Date}}Date: {{.Meta.Date}}{{end}}
+    </p>
+    {{if .Meta.Purpose}}
+    <h2>Purpose</h2>
+    <p>{{.Meta.Purpose}}</p>
+    {{end}}
+
+    <h2>Overview</h2>
+    <table>
+        <tr><th>Base subnet</th><td>{{.Plan.BaseSubnet}}{{with .Plan.BaseClass}} ({{.}}){{end}}</td></tr>
+        <tr><th>POPs</th><td>{{.Plan.POPCount}}</td></tr>
+        <tr><th>POP size</th><td>/{{.Plan.PreferredSize}}</td></tr>
+        <tr><th>Maximum POPs</th><td>{{.Plan.MaxPOPCount}}</td></tr>
+        {{if .Plan.GrowthBits}}<tr><th>Growth bits</th><td>{{.Plan.GrowthBits}}</td></tr>{{end}}
+    </table>
+
+    <h2>Hierarchy</h2>
+    <table>
+        <tr><th>Level</th><th>Prefix</th><th>Purpose</th><th>Per parent</th><th>Per POP</th><th>Addressing</th></tr>
+        {{range .Levels}}
+        <tr><td>{{.Name}}</td><td>/{{.Prefix}}</td><td>{{.Purpose}}</td><td>{{.PerParent}}</td><td>{{.PerPOP}}</td><td>{{.Addressing}}</td></tr>
+        {{end}}
+    </table>
+    <pre>{{.Diagram}}</pre>
+
+    <h2>Allocation Rules</h2>
+    <ul>
+        {{range .Rules}}<li>{{.}}</li>
+        {{end}}
+    </ul>
+
+    <h2>Naming Conventions</h2>
+    <ul>
+        {{range .Naming}}<li>{{.}}</li>
+        {{end}}
+    </ul>
+
+    <h2>POP Allocations</h2>
+    {{range $pop := .Plan.POPAllocations}}
+    <h3>POP {{.POPNumber}}: {{.POPSubnet}}</h3>
+    <table>
+        <tr><th>Level</th><th>First subnet</th><th>Available</th></tr>
+        {{range $i, $s := .Subnets}}
+        <tr><td>{{index $pop.LevelNames $i}}</td><td>{{$s.CIDR}}</td><td>{{$s.Available}}</td></tr>
+        {{end}}
+    </table>
+    {{end}}
+
+    {{if .Plan.Notes}}
+    <h2>Notes</h2>
+    <ul>
+        {{range .Plan.Notes}}<li>{{.}}</li>
+        {{end}}
+    </ul>
+    {{end}}
+</body>
+</html>
+`
+
+func renderPlanDoc(w io.Writer, doc planDoc, format string) error {
+	switch format {
+	case "markdown", "md":
+		tmpl, err := template.New("doc").Parse(docMarkdownTemplate)
+		if err != nil {
+			return err
+		}
+		return tmpl.Execute(w, doc)
+	case "html":
+		tmpl, err := htmltemplate.New("doc").Parse(docHTMLTemplate)
+		if err != nil {
+			return err
+		}
+		return tmpl.Execute(w, doc)
+	}
+	return fmt.Errorf("unknown document format %q (expected markdown or html)", format)
+}
+
+// runDocgen implements the docgen command.
+func runDocgen(args []string) {
+	fs := flag.NewFlagSet("docgen", flag.ExitOnError)
+	metaPath := fs.String("meta", "", "JSON file with the document title, purpose, level purposes, rules and naming conventions")
+	format := fs.String("format", "markdown", "Document format: markdown or html")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner docgen [-meta meta.json] [-format markdown|html] plan.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	plan, err := loadPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+
+	var meta DocMeta
+	if *metaPath != "" {
+		data, err := os.ReadFile(*metaPath)
+		if err == nil {
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.DisallowUnknownFields()
+			err = dec.Decode(&meta)
+		}
+		if err != nil {
+			fmt.Printf("Error loading document metadata: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := renderPlanDoc(os.Stdout, buildPlanDoc(plan, meta), *format); err != nil {
+		fmt.Printf("Error generating document: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// editorCommand is the user's editor: $VISUAL, then $EDITOR, then vi. It
+// may carry arguments, as in "code --wait".
+func editorCommand() []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(name)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+// regeneratePlan generates the plan of the edited parameters with the plan
+// being edited as its base plan, as -c and -base-plan would, so existing
+// POPs keep their prefixes. It returns the plan as written by -j.
+func regeneratePlan(config []byte, base IPv6Plan) ([]byte, error) {
+	opts, err := decodeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	opts.BasePlan = &base
+	plan, err := generateIPv6Plan(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.WithULA {
+		if err := attachULAPlan(&plan, opts.ULAPrefix); err != nil {
+			return nil, fmt.Errorf("generating ULA plan: %v", err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, plan); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// runEdit implements the edit command: the plan's parameters (sizes,
+// levels, roles, POP names and counts) are opened in an editor, checked
+// and the plan regenerated from them.
+func runEdit(args []string) {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	output := fs.String("o", "", "Write the regenerated plan here instead of over the plan edited")
+	dryRun := fs.Bool("dry-run", false, "Print the changes to the plan as a diff without writing it")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner edit [-o new-plan.json] [-dry-run] plan.json")
+		fmt.Println("The editor is $VISUAL, $EDITOR or vi.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if isAgeEncrypted(data) && *output == "" && !*dryRun {
+		// Writing it back would leave it in the clear
+		fmt.Printf("Error: %s is encrypted; give -o to write the edited plan elsewhere\n", path)
+		os.Exit(1)
+	}
+	plan, err := loadPlan(path)
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+
+	tmp, err := os.CreateTemp("", "ipv6planner-edit-*.json")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	opts, err := optionsFromPlan(plan)
+	if err != nil {
+		fmt.Printf("Error: %s cannot be edited: %v\n", path, err)
+		os.Exit(1)
+	}
+	if err := saveConfig(tmp.Name(), opts); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	original, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	var edited, regenerated []byte
+	for {
+		editor := editorCommand()
+		cmd := exec.Command(editor[0], append(editor[1:], tmp.Name())...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Printf("Error running %s: %v\n", editor[0], err)
+			os.Exit(1)
+		}
+		edited, err = os.ReadFile(tmp.Name())
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if bytes.Equal(edited, original) {
+			fmt.Printf("%s: no changes\n", path)
+			return
+		}
+		regenerated, err = regeneratePlan(edited, plan)
+		if err == nil {
+			break
+		}
+		fmt.Printf("The edited parameters do not make a plan:\n%v\n", err)
+		fmt.Print("Edit again? [Y/n] ")
+		answer, _ := stdin.ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer == "n" || answer == "no" {
+			os.Exit(1)
+		}
+	}
+
+	if plan.Integrity != nil {
+		// The checksum covers the plan as it was before the edit
+		fmt.Fprintln(os.Stderr, "Dropped the embedded checksum/signature; re-export to seal the regenerated plan")
+	}
+	if *dryRun {
+		fmt.Print(unifiedDiff(path, path+" (edited)", string(data), string(regenerated)))
+		return
+	}
+	if *output != "" {
+		if err := os.WriteFile(*output, regenerated, info.Mode().Perm()); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: plan regenerated from the edited parameters\n", *output)
+		return
+	}
+
+	// Someone else may have changed the plan while it was open in the
+	// editor; writing over it would silently undo their change. The lock
+	// keeps another edit from landing between the check and the write.
+	unlock, err := lockFile(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	current, err := os.ReadFile(path)
+	if err == nil && !bytes.Equal(current, data) {
+		unlock()
+		kept, err := os.CreateTemp("", "ipv6planner-edited-*.json")
+		if err == nil {
+			_, err = kept.Write(edited)
+			kept.Close()
+		}
+		fmt.Printf("Error: %s changed while it was being edited; it was not written\n", path)
+		if err == nil {
+			fmt.Printf("The edited parameters are in %s; run ipv6planner -c %s -base-plan %s -j to apply them to the new plan\n", kept.Name(), kept.Name(), path)
+		}
+		os.Exit(1)
+	}
+	err = writeFileAtomic(path, regenerated, info.Mode().Perm())
+	unlock()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: plan regenerated from the edited parameters\n", path)
+}
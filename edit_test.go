@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// scriptEditor points $VISUAL at a shell script that runs sed on the file
+// being edited.
+func scriptEditor(t *testing.T, sedExpr string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the test editor is a shell script")
+	}
+	script := filepath.Join(t.TempDir(), "editor")
+	body := "#!/bin/sh\nsed '" + sedExpr + "' \"$1\" > \"$1.new\" && mv \"$1.new\" \"$1\"\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", script)
+}
+
+func TestEditRegeneratesPlan(t *testing.T) {
+	opts := defaultPlanOptions()
+	opts.Subnet, opts.POPCount, opts.PreferredSize, opts.SubnetLevels = "2001:db8::/32", 3, 40, []int{48, 64}
+	opts.ReservedIDs = []string{"zero"}
+	before, err := generateIPv6Plan(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestPlan(t, before)
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	scriptEditor(t, `s/"pop_count": 3/"pop_count": 4/`)
+	runEdit([]string{path})
+
+	after, err := loadPlan(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.POPCount != 4 || len(after.POPAllocations) != 4 {
+		t.Fatalf("edited plan has %d POPs, want 4", len(after.POPAllocations))
+	}
+	for i, pop := range before.POPAllocations {
+		if got := after.POPAllocations[i].POPSubnet; got != pop.POPSubnet {
+			t.Errorf("POP %d moved from %s to %s", pop.POPNumber, pop.POPSubnet, got)
+		}
+	}
+	if len(after.ReservedIDs) != 1 {
+		t.Errorf("reserved POP IDs %+v, want the zero ID kept", after.ReservedIDs)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("edited plan mode %v (%v), want 0600", info.Mode().Perm(), err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("edit left files beside the plan: %v", entries)
+	}
+}
+
+func TestEditOutputLeavesPlan(t *testing.T) {
+	opts := defaultPlanOptions()
+	opts.Subnet, opts.POPCount, opts.PreferredSize, opts.SubnetLevels = "2001:db8::/32", 2, 40, []int{48, 64}
+	plan, err := generateIPv6Plan(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestPlan(t, plan)
+	original, _ := os.ReadFile(path)
+	output := filepath.Join(t.TempDir(), "edited.json")
+
+	scriptEditor(t, `s/"policy": "bcp"/"policy": "none"/`)
+	runEdit([]string{"-o", output, path})
+
+	if data, _ := os.ReadFile(path); string(data) != string(original) {
+		t.Error("edit -o changed the plan it edited")
+	}
+	edited, err := loadPlan(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.Policy != "none" {
+		t.Errorf("edited plan has policy %q, want none", edited.Policy)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Plans can be encrypted at rest with age (https://age-encryption.org),
+// since a detailed internal address plan is sensitive for some
+// organizations. Encrypted plans are recognized by their header and
+// decrypted transparently wherever a plan is read.
+const (
+	ageHeader       = "age-encryption.org/v1\n"
+	ageArmorHeader  = "-----BEGIN AGE ENCRYPTED FILE-----"
+	ageIdentityEnv  = "IPV6PLANNER_AGE_IDENTITY"
+	ageNoIdentities = "no identity matched"
+)
+
+func isAgeEncrypted(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	return bytes.HasPrefix(data, []byte(ageHeader)) || bytes.HasPrefix(trimmed, []byte(ageArmorHeader))
+}
+
+// readPlanFile reads a plan document, decrypting it if it is encrypted.
+func readPlanFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil || !isAgeEncrypted(data) {
+		return data, err
+	}
+	plain, err := decryptAge(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return plain, nil
+}
+
+// decryptAge decrypts with the identity file named by
+// $IPV6PLANNER_AGE_IDENTITY, or asks age for the passphrase when it is
+// unset.
+func decryptAge(data []byte) ([]byte, error) {
+	args := []string{"--decrypt"}
+	if identity := os.Getenv(ageIdentityEnv); identity != "" {
+		args = append(args, "--identity", identity)
+	}
+	return runAge(data, args...)
+}
+
+// encryptAge encrypts to recipients, a comma-separated list of age or SSH
+// public keys and recipient files. The result is ASCII armored so it can be
+// handled like the JSON it replaces.
+func encryptAge(data []byte, recipients string) ([]byte, error) {
+	args := []string{"--encrypt", "--armor"}
+	for _, r := range strings.Split(recipients, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if _, err := os.Stat(r); err == nil {
+			args = append(args, "--recipients-file", r)
+		} else {
+			args = append(args, "--recipient", r)
+		}
+	}
+	if len(args) == 2 {
+		return nil, fmt.Errorf("no recipients given")
+	}
+	return runAge(data, args...)
+}
+
+func runAge(data []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("age", args...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, ageNoIdentities) {
+			msg += fmt.Sprintf(" (set %s to your age identity file)", ageIdentityEnv)
+		}
+		if msg != "" {
+			return nil, fmt.Errorf("age: %v: %s", err, msg)
+		}
+		return nil, fmt.Errorf("age: %v (is age installed?)", err)
+	}
+	return stdout.Bytes(), nil
+}
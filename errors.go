@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Failure reasons. Errors carry their context in the message and wrap one
+// of these, so callers can branch with errors.Is instead of matching text.
+var (
+	ErrInvalidPrefix     = errors.New("invalid prefix")
+	ErrInvalidLevel      = errors.New("invalid subnet level")
+	ErrPrefixTooSmall    = errors.New("prefix too small")
+	ErrOverlap           = errors.New("overlapping prefixes")
+	ErrOutsideBase       = errors.New("prefix outside the base")
+	ErrUnsupportedSchema = errors.New("unsupported schema version")
+)
+
+// reasonError is an error message tied to one of the failure reasons.
+type reasonError struct {
+	reason error
+	msg    string
+}
+
+func (e *reasonError) Error() string { return e.msg }
+func (e *reasonError) Unwrap() error { return e.reason }
+
+// failf formats an error message that wraps reason.
+func failf(reason error, format string, args ...interface{}) error {
+	return &reasonError{reason: reason, msg: fmt.Sprintf(format, args...)}
+}
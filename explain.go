@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+)
+
+// explainPlan walks through the bit-level decisions behind a plan, from
+// the base prefix down to the interface ID, for -explain.
+func explainPlan(plan IPv6Plan, opts PlanOptions) []string {
+	_, ipNet, err := net.ParseCIDR(plan.BaseSubnet)
+	if err != nil {
+		return nil
+	}
+	ones, _ := ipNet.Mask.Size()
+	size := plan.PreferredSize
+
+	lines := []string{fmt.Sprintf("Base %s: the first %d bits are the routing prefix you were assigned; the other %d bits are yours to plan.",
+		plan.BaseSubnet, ones, 128-ones)}
+
+	switch {
+	case hasDemand(opts.Requirements):
+		lines = append(lines, fmt.Sprintf("POP size /%d comes from the largest POP's requirements, the shortest prefix that holds its demand.", size))
+	case opts.AutoSize:
+		line := fmt.Sprintf("POP size /%d was chosen automatically: the shortest prefix that still gives every POP its own block", size)
+		if exact := ones + popBits(plan.POPCount) + plan.GrowthBits; exact != size {
+			line += fmt.Sprintf(", rounded from /%d so POP boundaries fall on a nibble (-nibble)", exact)
+		}
+		lines = append(lines, line+".")
+	default:
+		lines = append(lines, fmt.Sprintf("POP size /%d was set with -p.", size))
+	}
+
+	if size > ones {
+		needed := popBits(plan.POPCount)
+		line := fmt.Sprintf("POP ID: %s (%s, %s) number the /%d POP blocks, room for %s POPs. %d POPs use %d of them (2^%d = %s)",
+			bitRange(ones+1, size), countBits(size-ones), hexDigits(ones+1, size), size, plan.MaxPOPCount, plan.POPCount, needed, needed, pow2(needed))
+		if plan.GrowthBits > 0 {
+			line += fmt.Sprintf(", and growth bits reserve %d more so the plan can grow to %s POPs without renumbering", plan.GrowthBits, pow2(needed+plan.GrowthBits))
+		}
+		if spare := size - ones - needed - plan.GrowthBits; spare > 0 {
+			line += fmt.Sprintf("; spare POP slots use the other %d", spare)
+		}
+		lines = append(lines, line+".")
+		if size%4 != 0 {
+			lines = append(lines, midNibble("The POP ID", size))
+		}
+	}
+
+	parent := size
+	for i, level := range plan.SubnetLevels {
+		if level <= parent {
+			lines = append(lines, fmt.Sprintf("Level %d (/%d) is not more specific than /%d above it, so it adds no bits.", i+1, level, parent))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("Level %d (/%d): %s (%s, %s) number %s /%ds inside each /%d.",
+			i+1, level, bitRange(parent+1, level), countBits(level-parent), hexDigits(parent+1, level), pow2(level-parent), level, parent))
+		if level%4 != 0 {
+			lines = append(lines, midNibble(fmt.Sprintf("Level %d", i+1), level))
+		}
+		parent = level
+	}
+
+	switch {
+	case parent < 64:
+		lines = append(lines, fmt.Sprintf("Below the last level, %s (%s) are left to whoever receives a /%d: %s /64s before the 64-bit interface ID.",
+			bitRange(parent+1, 64), countBits(64-parent), parent, pow2(64-parent)))
+	case parent == 64:
+		lines = append(lines, "The last 64 bits (bits 65-128) are the interface ID that SLAAC, DHCPv6 or static configuration fills in on each /64.")
+	case parent < 128:
+		lines = append(lines, fmt.Sprintf("Hosts inside each /%d are numbered by the last %s (%s); SLAAC does not work there.", parent, countBits(128-parent), bitRange(parent+1, 128)))
+	}
+	return lines
+}
+
+// hexDigits names the hex digits, numbered from 1, that bits first to last
+// fall in.
+func hexDigits(first, last int) string {
+	if (first+3)/4 == (last+3)/4 {
+		return fmt.Sprintf("hex digit %d", (first+3)/4)
+	}
+	return fmt.Sprintf("hex digits %d-%d", (first+3)/4, (last+3)/4)
+}
+
+// midNibble explains what a field ending at prefix length end costs when it
+// stops inside a hex digit.
+func midNibble(field string, end int) string {
+	return fmt.Sprintf("%s ends mid-nibble at /%d, so its last hex digit is shared with the next field: prefixes are harder to read, and each /%d spans %s ip6.arpa zones.",
+		field, end, end, pow2(4-end%4))
+}
+
+// bitRange renders "bit 33" or "bits 33-40" with bits numbered from 1.
+func bitRange(first, last int) string {
+	if first == last {
+		return fmt.Sprintf("bit %d", first)
+	}
+	return fmt.Sprintf("bits %d-%d", first, last)
+}
+
+func countBits(n int) string {
+	if n == 1 {
+		return "1 bit"
+	}
+	return fmt.Sprintf("%d bits", n)
+}
+
+func pow2(n int) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(n))
+}
@@ -0,0 +1,83 @@
+package main
+
+import "io"
+
+// planExporter renders a whole plan in one output format. Exporters write
+// to w rather than stdout, so a format renders the same way into a file, a
+// buffer or an archive, and two renderings of one plan can be compared
+// byte for byte.
+type planExporter interface {
+	Export(w io.Writer, plan IPv6Plan) error
+}
+
+// exportOptions carries the presentation settings an exporter may need.
+// Each format reads only the fields that apply to it.
+type exportOptions struct {
+	Colors     palette
+	Messages   messages
+	Lang       string
+	Theme      htmlTheme
+	Recipients string
+	Package    string
+	Enumerate  int
+	Nested     bool
+}
+
+// exporterFunc adapts a plain function to planExporter.
+type exporterFunc func(w io.Writer, plan IPv6Plan) error
+
+func (f exporterFunc) Export(w io.Writer, plan IPv6Plan) error {
+	return f(w, plan)
+}
+
+// exporters builds the exporter for each -format name. A new format is
+// added here and nowhere else in the output path.
+var exporters = map[string]func(opts exportOptions) planExporter{
+	"text": func(opts exportOptions) planExporter {
+		return exporterFunc(func(w io.Writer, plan IPv6Plan) error {
+			return writeText(w, plan, opts.Colors, opts.Messages)
+		})
+	},
+	"json": func(opts exportOptions) planExporter {
+		return exporterFunc(func(w io.Writer, plan IPv6Plan) error {
+			if opts.Recipients != "" {
+				return writeEncryptedJSON(w, plan, opts.Recipients)
+			}
+			return writeJSON(w, plan)
+		})
+	},
+	"html": func(opts exportOptions) planExporter {
+		return exporterFunc(func(w io.Writer, plan IPv6Plan) error {
+			return writeHTML(w, plan, opts.Messages, opts.Lang, opts.Theme)
+		})
+	},
+	"state-csv": func(opts exportOptions) planExporter {
+		return exporterFunc(writeStateCSV)
+	},
+	"go": func(opts exportOptions) planExporter {
+		return exporterFunc(func(w io.Writer, plan IPv6Plan) error {
+			return writeGoConstants(w, plan, opts.Package)
+		})
+	},
+	"python": func(opts exportOptions) planExporter {
+		return exporterFunc(writePythonConstants)
+	},
+	"c-header": func(opts exportOptions) planExporter {
+		return exporterFunc(writeCHeader)
+	},
+	"jinja": func(opts exportOptions) planExporter {
+		return exporterFunc(func(w io.Writer, plan IPv6Plan) error {
+			return writeJinjaVars(w, plan, opts.Enumerate, opts.Nested)
+		})
+	},
+}
+
+// newExporter returns the exporter for format, falling back to text as the
+// command line always has.
+func newExporter(format string, opts exportOptions) planExporter {
+	build, ok := exporters[format]
+	if !ok {
+		build = exporters["text"]
+	}
+	return build(opts)
+}
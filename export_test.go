@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata from the current exporters")
+
+// TestExportersGolden renders testdata/plan.json in every -format and
+// compares the output with testdata/<format>.golden. After an intended
+// output change, rerun with -update and review the diff.
+func TestExportersGolden(t *testing.T) {
+	plan, err := loadPlan(filepath.Join("testdata", "plan.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := catalog("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := exportOptions{Messages: m, Lang: "en", Enumerate: 2}
+
+	for _, format := range exportFormats() {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := newExporter(format, opts).Export(&buf, plan); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", format+".golden")
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("%s output differs from %s:\n%s", format, golden, unifiedDiff(golden, format, string(want), buf.String()))
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// infeasibility is one reason the requested parameters cannot produce a
+// meaningful plan, with a parameter change that would resolve it.
+type infeasibility struct {
+	problem    string
+	suggestion string
+}
+
+// checkFeasibility inspects the plan parameters after the POP size has been
+// settled. ones is the base prefix length and popBits the number of bits the
+// POP ID field needs, growth bits included.
+func checkFeasibility(opts PlanOptions, ones, popBits, preferredSize int) []infeasibility {
+	var found []infeasibility
+
+	switch {
+	case preferredSize < ones:
+		found = append(found, infeasibility{
+			problem:    fmt.Sprintf("POP size /%d is larger than the base subnet %s", preferredSize, opts.Subnet),
+			suggestion: fmt.Sprintf("use -p %d or more specific, or -auto-size", ones+popBits),
+		})
+	case ones+popBits > preferredSize:
+		fit := calculateAvailableSubnets(ones, preferredSize-opts.GrowthBits)
+		if preferredSize-opts.GrowthBits == ones {
+			fit.SetInt64(1)
+		}
+		var options []string
+		if ones+popBits <= 128 {
+			options = append(options, fmt.Sprintf("-p %d", ones+popBits))
+		}
+		if preferredSize-popBits >= 0 {
+			options = append(options, fmt.Sprintf("a base of /%d or shorter", preferredSize-popBits))
+		}
+		if fit.Sign() > 0 {
+			options = append(options, fmt.Sprintf("-n %d or fewer", fit))
+		}
+		if opts.GrowthBits > 0 {
+			options = append(options, "fewer -growth-bits")
+		}
+		found = append(found, infeasibility{
+			problem: fmt.Sprintf("%d POPs need a /%d POP prefix (%d POP ID bits after the /%d base), but POPs are /%d, so POP subnets would overlap",
+				opts.POPCount, ones+popBits, popBits, ones, preferredSize),
+			suggestion: "use " + strings.Join(options, ", or "),
+		})
+	}
+
+	parent, parentName := preferredSize, "the POP size"
+	var bad []int
+	for _, level := range opts.SubnetLevels {
+		if level <= parent {
+			found = append(found, infeasibility{
+				problem: fmt.Sprintf("level /%d is not more specific than %s /%d", level, parentName, parent),
+			})
+			bad = append(bad, level)
+			continue
+		}
+		parent, parentName = level, "the level above it,"
+	}
+	if len(bad) > 0 {
+		if levels := usableLevels(opts.SubnetLevels, preferredSize); len(levels) > 0 {
+			found[len(found)-1].suggestion = fmt.Sprintf("use -l %s", formatLevels(levels))
+		} else {
+			found[len(found)-1].suggestion = fmt.Sprintf("choose levels longer than /%d", preferredSize)
+		}
+	}
+
+	return found
+}
+
+// usableLevels returns the distinct levels more specific than the POP size,
+// in increasing order.
+func usableLevels(levels []int, preferredSize int) []int {
+	seen := make(map[int]bool)
+	var usable []int
+	for _, level := range levels {
+		if level > preferredSize && !seen[level] {
+			seen[level] = true
+			usable = append(usable, level)
+		}
+	}
+	sort.Ints(usable)
+	return usable
+}
+
+// infeasibleError lists every problem and its suggested fix.
+func infeasibleError(problems []infeasibility) error {
+	var b strings.Builder
+	b.WriteString("the requested plan is infeasible:")
+	for _, p := range problems {
+		fmt.Fprintf(&b, "\n  - %s", p.problem)
+		if p.suggestion != "" {
+			fmt.Fprintf(&b, "\n    Suggestion: %s", p.suggestion)
+		}
+	}
+	return errors.New(b.String())
+}
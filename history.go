@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// planSnapshot is one saved plan in a utilization history.
+type planSnapshot struct {
+	Label    string
+	Modified time.Time
+	Plan     IPv6Plan
+}
+
+// historySeries is the use of one pool across the snapshots: the POP slots
+// of the whole plan, or one level of one POP. Points has one entry per
+// snapshot, nil where the snapshot does not have the pool.
+type historySeries struct {
+	POP    string
+	Level  string
+	Points []*Utilization
+}
+
+// loadSnapshots reads saved plans in the order given, which is the order
+// of the history.
+func loadSnapshots(paths []string) ([]planSnapshot, error) {
+	snapshots := make([]planSnapshot, len(paths))
+	for i, path := range paths {
+		plan, err := loadPlan(path)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		snapshots[i] = planSnapshot{Label: filepath.Base(path), Modified: info.ModTime(), Plan: plan}
+	}
+	return snapshots, nil
+}
+
+// popKey identifies a POP across snapshots: by name when it has one, so
+// renumbering does not split its history, and by number otherwise.
+func popKey(pop POPAlloc) string {
+	if pop.Name != "" {
+		return pop.Name
+	}
+	return strconv.Itoa(pop.POPNumber)
+}
+
+// utilizationHistory lines up the utilization of every pool across the
+// snapshots. With pop set, only that POP (by number or name) is included
+// and the plan-wide POP slots are left out.
+func utilizationHistory(snapshots []planSnapshot, pop string) ([]historySeries, error) {
+	var series []historySeries
+	index := make(map[string]int)
+	popOrder := make(map[string]int)
+	point := func(popLabel, level string, i int, u Utilization) {
+		if _, ok := popOrder[popLabel]; !ok {
+			popOrder[popLabel] = len(popOrder)
+		}
+		key := popLabel + "\x00" + level
+		j, ok := index[key]
+		if !ok {
+			j = len(series)
+			index[key] = j
+			series = append(series, historySeries{POP: popLabel, Level: level, Points: make([]*Utilization, len(snapshots))})
+		}
+		series[j].Points[i] = &u
+	}
+
+	found := pop == ""
+	for i, snapshot := range snapshots {
+		if pop == "" {
+			u := snapshot.Plan.POPSlotUtilization()
+			point("all", "POP slots", i, u)
+		}
+		for _, alloc := range snapshot.Plan.POPAllocations {
+			key := popKey(alloc)
+			if pop != "" && pop != key && pop != strconv.Itoa(alloc.POPNumber) {
+				continue
+			}
+			found = true
+			for _, u := range alloc.Utilization() {
+				point(key, u.Label, i, u)
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no snapshot has a POP %q", pop)
+	}
+	// A level first seen in a later snapshot joins the rest of its POP
+	sort.SliceStable(series, func(a, b int) bool { return popOrder[series[a].POP] < popOrder[series[b].POP] })
+	return series, nil
+}
+
+func writeHistoryText(w io.Writer, snapshots []planSnapshot, series []historySeries) {
+	fmt.Fprintln(w, "Utilization history (% allocated)")
+	header := []string{"POP", "Level"}
+	for _, s := range snapshots {
+		header = append(header, s.Label)
+	}
+	rows := [][]string{header}
+	for _, s := range series {
+		row := []string{s.POP, s.Level}
+		for _, u := range s.Points {
+			cell := "-"
+			if u != nil {
+				cell = fmt.Sprintf("%.1f%%", u.AllocatedPercent())
+			}
+			row = append(row, cell)
+		}
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, len(header))
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			if i < 2 {
+				fmt.Fprintf(&line, "%-*s  ", widths[i], cell)
+			} else {
+				fmt.Fprintf(&line, "%*s  ", widths[i], cell)
+			}
+		}
+		fmt.Fprintln(w, strings.TrimRight(line.String(), " "))
+	}
+	if len(series) == 0 {
+		fmt.Fprintln(w, "\nNo usage data: plans record demand only when generated with -requirements.")
+	}
+}
+
+// writeHistoryCSV writes one row per pool and snapshot, for spreadsheets
+// and plotting tools.
+func writeHistoryCSV(w io.Writer, snapshots []planSnapshot, series []historySeries) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"snapshot", "modified", "pop", "level", "allocated", "reserved", "total", "allocated_percent"})
+	for _, s := range series {
+		for i, u := range s.Points {
+			if u == nil {
+				continue
+			}
+			cw.Write([]string{
+				snapshots[i].Label,
+				snapshots[i].Modified.UTC().Format(time.RFC3339),
+				s.POP,
+				s.Level,
+				u.Allocated.String(),
+				u.Reserved.String(),
+				u.Total.String(),
+				strconv.FormatFloat(u.AllocatedPercent(), 'f', 2, 64),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// historyChart is one POP's lines on the HTML history chart.
+type historyChart struct {
+	POP   string
+	Lines []historyLine
+}
+
+type historyLine struct {
+	Level  string
+	Color  string
+	Points string
+	Last   string
+}
+
+var historyColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b"}
+
+// writeHistoryHTML draws a line chart per POP of each level's allocated
+// percentage over the snapshots, followed by the same numbers as a table.
+func writeHistoryHTML(w io.Writer, snapshots []planSnapshot, series []historySeries) error {
+	const tpl = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <title>Utilization history</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; }
+        table { border-collapse: collapse; margin-bottom: 20px; }
+        th, td { border: 1px solid #ddd; padding: 6px; text-align: right; }
+        th:first-child, td:first-child, th:nth-child(2), td:nth-child(2) { text-align: left; }
+        th { background-color: #f2f2f2; }
+        .chart { margin-bottom: 30px; }
+    </style>
+</head>
+<body>
+    <h1>Utilization history</h1>
+    {{range .Charts}}
+    <section class="chart">
+        <h2>{{if eq .POP "all"}}All POPs{{else}}POP {{.POP}}{{end}}</h2>
+        <svg width="{{$.Width}}" height="{{$.Height}}" role="img" aria-label="Allocated percentage per snapshot">
+            <rect x="{{$.Left}}" y="{{$.Top}}" width="{{$.PlotWidth}}" height="{{$.PlotHeight}}" fill="none" stroke="#ccc"/>
+            {{range $.YTicks}}<line x1="{{$.Left}}" x2="{{$.Right}}" y1="{{.Y}}" y2="{{.Y}}" stroke="#eee"/>
+            <text x="{{$.Left}}" y="{{.Y}}" dx="-4" dy="4" text-anchor="end" font-size="10">{{.Label}}</text>
+            {{end}}
+            {{range $.XTicks}}<text x="{{.X}}" y="{{$.Bottom}}" dy="14" text-anchor="middle" font-size="10">{{.Label}}</text>
+            {{end}}
+            {{range $i, $l := .Lines}}<polyline points="{{$l.Points}}" fill="none" stroke="{{$l.Color}}" stroke-width="2"><title>{{$l.Level}}: {{$l.Last}}</title></polyline>
+            <text x="{{$.Right}}" y="{{legendY $i}}" dx="8" font-size="11" fill="{{$l.Color}}">{{$l.Level}} ({{$l.Last}})</text>
+            {{end}}
+        </svg>
+    </section>
+    {{end}}
+    <table>
+        <thead><tr><th scope="col">POP</th><th scope="col">Level</th>{{range .Snapshots}}<th scope="col">{{.Label}}</th>{{end}}</tr></thead>
+        <tbody>
+        {{range .Series}}<tr><th scope="row">{{.POP}}</th><td>{{.Level}}</td>{{range .Points}}<td>{{if .}}{{printf "%.1f" .AllocatedPercent}}%{{else}}-{{end}}</td>{{end}}</tr>
+        {{end}}
+        </tbody>
+    </table>
+</body>
+</html>
+`
+	const left, top, plotWidth, plotHeight, legendWidth = 50, 20, 480, 200, 220
+	x := func(i int) float64 {
+		if len(snapshots) < 2 {
+			return left + plotWidth/2
+		}
+		return left + float64(i)*plotWidth/float64(len(snapshots)-1)
+	}
+	y := func(percent float64) float64 {
+		return top + plotHeight - percent*plotHeight/100
+	}
+
+	var charts []historyChart
+	chartIndex := make(map[string]int)
+	for _, s := range series {
+		j, ok := chartIndex[s.POP]
+		if !ok {
+			j = len(charts)
+			chartIndex[s.POP] = j
+			charts = append(charts, historyChart{POP: s.POP})
+		}
+		var points []string
+		last := ""
+		for i, u := range s.Points {
+			if u != nil {
+				points = append(points, fmt.Sprintf("%.1f,%.1f", x(i), y(u.AllocatedPercent())))
+				last = fmt.Sprintf("%.1f%%", u.AllocatedPercent())
+			}
+		}
+		color := historyColors[len(charts[j].Lines)%len(historyColors)]
+		charts[j].Lines = append(charts[j].Lines, historyLine{Level: s.Level, Color: color, Points: strings.Join(points, " "), Last: last})
+	}
+
+	type tick struct {
+		X, Y  float64
+		Label string
+	}
+	var xTicks, yTicks []tick
+	for i, s := range snapshots {
+		xTicks = append(xTicks, tick{X: x(i), Label: s.Label})
+	}
+	for p := 0; p <= 100; p += 25 {
+		yTicks = append(yTicks, tick{Y: y(float64(p)), Label: fmt.Sprintf("%d%%", p)})
+	}
+
+	funcs := template.FuncMap{"legendY": func(i int) int { return top + 10 + 16*i }}
+	tmpl, err := template.New("history").Funcs(funcs).Parse(tpl)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, map[string]interface{}{
+		"Charts":     charts,
+		"Series":     series,
+		"Snapshots":  snapshots,
+		"Width":      left + plotWidth + legendWidth,
+		"Height":     top + plotHeight + 30,
+		"Left":       left,
+		"Top":        top,
+		"Right":      left + plotWidth,
+		"Bottom":     top + plotHeight,
+		"PlotWidth":  plotWidth,
+		"PlotHeight": plotHeight,
+		"XTicks":     xTicks,
+		"YTicks":     yTicks,
+	})
+}
+
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	pop := fs.String("pop", "", "Only this POP, by number or name")
+	format := fs.String("format", "text", "Report format: text, csv or html")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner history [-pop N] [-format text|csv|html] snapshot.json...")
+		fmt.Println("Snapshots are saved plans, listed oldest first.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	snapshots, err := loadSnapshots(fs.Args())
+	if err != nil {
+		fmt.Printf("Error loading snapshot: %v\n", err)
+		os.Exit(1)
+	}
+	series, err := utilizationHistory(snapshots, *pop)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch *format {
+	case "text":
+		writeHistoryText(os.Stdout, snapshots, series)
+	case "csv":
+		err = writeHistoryCSV(os.Stdout, snapshots, series)
+	case "html":
+		err = writeHistoryHTML(os.Stdout, snapshots, series)
+	default:
+		fmt.Printf("Error: unknown format %q (expected text, csv or html)\n", *format)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Printf("Error generating %s report: %v\n", *format, err)
+		os.Exit(1)
+	}
+}
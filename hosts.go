@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// HostBlock is one range of interface IDs inside a /64, written in IPv6
+// notation with only the low 64 bits set (e.g. "::100").
+type HostBlock struct {
+	Name     string `json:"name"`
+	First    string `json:"first"`
+	Last     string `json:"last"`
+	Reserved bool   `json:"reserved,omitempty"`
+	Hosts    int    `json:"hosts,omitempty"`
+}
+
+// HostConventions is the layout applied to every selected /64.
+type HostConventions struct {
+	Blocks []HostBlock `json:"blocks"`
+}
+
+// defaultHostConventions numbers gateways and routers from the bottom,
+// servers from ::100, and keeps the first address and the top of the range
+// reserved.
+func defaultHostConventions() HostConventions {
+	return HostConventions{Blocks: []HostBlock{
+		{Name: "subnet-router anycast (RFC 4291)", First: "::", Last: "::", Reserved: true},
+		{Name: "gateway", First: "::1", Last: "::1", Hosts: 1},
+		{Name: "router", First: "::2", Last: "::f", Hosts: 2},
+		{Name: "infrastructure", First: "::10", Last: "::ff", Hosts: 4},
+		{Name: "server", First: "::100", Last: "::fff", Hosts: 8},
+		{Name: "reserved subnet anycast (RFC 2526)", First: "::fdff:ffff:ffff:ff80", Last: "::fdff:ffff:ffff:ffff", Reserved: true},
+		{Name: "reserved (last block)", First: "::ffff:ffff:ffff:ff00", Last: "::ffff:ffff:ffff:ffff", Reserved: true},
+	}}
+}
+
+// HostTable is the addressing laid out in one /64.
+type HostTable struct {
+	Prefix  string          `json:"prefix"`
+	Blocks  []HostBlockInfo `json:"blocks"`
+	IPv4Map []V4Mapping     `json:"ipv4_map,omitempty"`
+}
+
+type HostBlockInfo struct {
+	Name     string        `json:"name"`
+	First    string        `json:"first"`
+	Last     string        `json:"last"`
+	Size     *big.Int      `json:"size"`
+	Reserved bool          `json:"reserved,omitempty"`
+	Hosts    []HostAddress `json:"hosts,omitempty"`
+}
+
+type HostAddress struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	URL     string `json:"url,omitempty"`
+	Scoped  string `json:"scoped,omitempty"`
+}
+
+// zonePattern is what a zone may hold to be written in a URL without
+// percent-encoding: RFC 6874 allows unreserved characters.
+var zonePattern = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+
+// addressLiterals returns an address as a URL host, in brackets, and, for a
+// link-local address when zone is set, in its scoped form. The zone's "%"
+// is written "%25" in the URL form, as RFC 6874 requires; zones mean
+// nothing for other addresses, which get no scoped form.
+func addressLiterals(addr, zone string) (url, scoped string) {
+	if zone == "" || !net.ParseIP(addr).IsLinkLocalUnicast() {
+		return "[" + addr + "]", ""
+	}
+	return "[" + addr + "%25" + zone + "]", addr + "%" + zone
+}
+
+// addLiterals fills in the URL and scoped forms of every address in the
+// table, so templates can use them without reformatting.
+func (t *HostTable) addLiterals(zone string) {
+	for i := range t.Blocks {
+		for j := range t.Blocks[i].Hosts {
+			h := &t.Blocks[i].Hosts[j]
+			h.URL, h.Scoped = addressLiterals(h.Address, zone)
+		}
+	}
+	for i := range t.IPv4Map {
+		m := &t.IPv4Map[i]
+		m.IPv6URL, m.IPv6Scoped = addressLiterals(m.IPv6, zone)
+	}
+}
+
+// interfaceID parses "::100" style notation into the low 64 bits.
+func interfaceID(s string) (uint64, error) {
+	ip := net.ParseIP(s)
+	if ip == nil || !strings.Contains(s, ":") {
+		return 0, fmt.Errorf("invalid interface ID %q", s)
+	}
+	ip = ip.To16()
+	for _, b := range ip[:8] {
+		if b != 0 {
+			return 0, fmt.Errorf("interface ID %q sets bits in the upper 64", s)
+		}
+	}
+	return binary.BigEndian.Uint64(ip[8:]), nil
+}
+
+type parsedBlock struct {
+	HostBlock
+	first, last uint64
+}
+
+// validate resolves every block and rejects empty, inverted, or overlapping
+// ranges.
+func (c HostConventions) validate() ([]parsedBlock, error) {
+	var blocks []parsedBlock
+	for _, b := range c.Blocks {
+		if b.Name == "" {
+			return nil, fmt.Errorf("block %s-%s has no name", b.First, b.Last)
+		}
+		first, err := interfaceID(b.First)
+		if err != nil {
+			return nil, fmt.Errorf("block %q: %v", b.Name, err)
+		}
+		last, err := interfaceID(b.Last)
+		if err != nil {
+			return nil, fmt.Errorf("block %q: %v", b.Name, err)
+		}
+		if last < first {
+			return nil, fmt.Errorf("block %q: last %s is below first %s", b.Name, b.Last, b.First)
+		}
+		if b.Hosts < 0 {
+			return nil, fmt.Errorf("block %q: hosts cannot be negative", b.Name)
+		}
+		if b.Reserved && b.Hosts > 0 {
+			return nil, fmt.Errorf("block %q: reserved blocks cannot list hosts", b.Name)
+		}
+		if b.Hosts > 0 && uint64(b.Hosts-1) > last-first {
+			return nil, failf(ErrPrefixTooSmall, "block %q: %d hosts do not fit in %s-%s", b.Name, b.Hosts, b.First, b.Last)
+		}
+		blocks = append(blocks, parsedBlock{b, first, last})
+	}
+
+	sorted := append([]parsedBlock(nil), blocks...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].first < sorted[j].first })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].first <= sorted[i-1].last {
+			return nil, failf(ErrOverlap, "blocks %q and %q overlap", sorted[i-1].Name, sorted[i].Name)
+		}
+	}
+	return sorted, nil
+}
+
+// hostAddress combines the network half of prefix with an interface ID.
+func hostAddress(prefix net.IP, id uint64) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefix.To16()[:8])
+	binary.BigEndian.PutUint64(ip[8:], id)
+	return ip
+}
+
+func buildHostTable(ipNet *net.IPNet, blocks []parsedBlock) HostTable {
+	table := HostTable{Prefix: ipNet.String()}
+	for _, b := range blocks {
+		size := new(big.Int).SetUint64(b.last - b.first)
+		size.Add(size, big.NewInt(1))
+		info := HostBlockInfo{
+			Name:     b.Name,
+			First:    hostAddress(ipNet.IP, b.first).String(),
+			Last:     hostAddress(ipNet.IP, b.last).String(),
+			Size:     size,
+			Reserved: b.Reserved,
+		}
+		for i := 0; i < b.Hosts; i++ {
+			name := b.Name
+			if b.Hosts > 1 {
+				name = fmt.Sprintf("%s-%d", b.Name, i+1)
+			}
+			info.Hosts = append(info.Hosts, HostAddress{
+				Name:    name,
+				Address: hostAddress(ipNet.IP, b.first+uint64(i)).String(),
+			})
+		}
+		table.Blocks = append(table.Blocks, info)
+	}
+	return table
+}
+
+// runHosts implements the hosts command.
+func runHosts(args []string) {
+	fs := flag.NewFlagSet("hosts", flag.ExitOnError)
+	planPath := fs.String("plan", "", "Lay out every /64 listed in this plan JSON file")
+	conventionsPath := fs.String("conventions", "", "JSON file with the host block layout (default: built-in conventions)")
+	ipv4Path := fs.String("ipv4-map", "", "File of IPv4 hosts (\"address\" or \"name,address\" per line) to number by their IPv4 address")
+	ipv4Encoding := fs.String("ipv4-encoding", ipv4Embedded, "How IPv4 addresses become interface IDs: embedded, hex or octets")
+	literals := fs.Bool("literals", false, "Also write each address as a bracketed URL literal, e.g. [3fff:db8:0:1::1]")
+	zone := fs.String("zone", "", "Zone (interface) for scoped literals of link-local addresses, e.g. fe80::1%eth0; implies -literals")
+	jsonOut := fs.Bool("j", false, "JSON output format")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner hosts [-conventions file.json] [-ipv4-map hosts.csv] [-literals] [-zone eth0] [-j] (-plan plan.json | prefix/64 ...)")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	prefixes := fs.Args()
+	if *planPath != "" {
+		plan, err := loadPlan(*planPath)
+		if err != nil {
+			fmt.Printf("Error loading plan: %v\n", err)
+			os.Exit(1)
+		}
+		for _, pop := range plan.POPAllocations {
+			for _, subnet := range pop.Subnets {
+				if strings.HasSuffix(subnet.CIDR, "/64") {
+					prefixes = append(prefixes, subnet.CIDR)
+				}
+			}
+		}
+	}
+	if len(prefixes) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *zone != "" && !zonePattern.MatchString(*zone) {
+		fmt.Printf("Error: zone %q may only hold letters, digits and . _ ~ -\n", *zone)
+		os.Exit(2)
+	}
+
+	conventions := defaultHostConventions()
+	if *conventionsPath != "" {
+		data, err := os.ReadFile(*conventionsPath)
+		if err == nil {
+			conventions = HostConventions{}
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.DisallowUnknownFields()
+			err = dec.Decode(&conventions)
+		}
+		if err != nil {
+			fmt.Printf("Error loading conventions: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	blocks, err := conventions.validate()
+	if err != nil {
+		fmt.Printf("Error in host conventions: %v\n", err)
+		os.Exit(1)
+	}
+
+	var v4Hosts []ipv4Host
+	if *ipv4Path != "" {
+		if _, err := ipv4InterfaceID(net.IPv4zero.To4(), *ipv4Encoding); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		v4Hosts, err = loadIPv4Hosts(*ipv4Path)
+		if err != nil {
+			fmt.Printf("Error loading IPv4 hosts: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var tables []HostTable
+	for _, prefix := range prefixes {
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil || ipNet.IP.To4() != nil {
+			fmt.Printf("Error: %q is not an IPv6 prefix\n", prefix)
+			os.Exit(1)
+		}
+		if ones, _ := ipNet.Mask.Size(); ones != 64 {
+			fmt.Printf("Error: %s is not a /64; host conventions apply to /64 subnets\n", prefix)
+			os.Exit(1)
+		}
+		table := buildHostTable(ipNet, blocks)
+		if len(v4Hosts) > 0 {
+			table.IPv4Map, err = mapIPv4Hosts(ipNet, v4Hosts, *ipv4Encoding, blocks)
+			if err != nil {
+				fmt.Printf("Error mapping IPv4 hosts into %s: %v\n", table.Prefix, err)
+				os.Exit(1)
+			}
+		}
+		if *literals || *zone != "" {
+			table.addLiterals(*zone)
+		}
+		tables = append(tables, table)
+	}
+
+	if *jsonOut {
+		jsonData, err := json.MarshalIndent(tables, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+	for i, table := range tables {
+		if i > 0 {
+			fmt.Println()
+		}
+		outputHostTable(table)
+	}
+}
+
+func outputHostTable(table HostTable) {
+	fmt.Printf("Host addressing for %s\n", table.Prefix)
+	fmt.Println("\nBlocks:")
+	for _, b := range table.Blocks {
+		status := ""
+		if b.Reserved {
+			status = " (reserved)"
+		}
+		if b.First == b.Last {
+			fmt.Printf("  %-36s %s%s\n", b.Name, b.First, status)
+		} else {
+			fmt.Printf("  %-36s %s - %s (%s addresses)%s\n", b.Name, b.First, b.Last, b.Size, status)
+		}
+	}
+	fmt.Println("\nHosts:")
+	for _, b := range table.Blocks {
+		for _, h := range b.Hosts {
+			fmt.Printf("  %-20s %s\n", h.Name, strings.TrimRight(fmt.Sprintf("%-39s %s %s", h.Address, h.URL, h.Scoped), " "))
+		}
+	}
+	if len(table.IPv4Map) > 0 {
+		fmt.Println("\nIPv4 to IPv6 mapping:")
+		for _, m := range table.IPv4Map {
+			fmt.Printf("  %-20s %-15s -> %s\n", m.Name, m.IPv4, strings.TrimRight(fmt.Sprintf("%-39s %s %s", m.IPv6, m.IPv6URL, m.IPv6Scoped), " "))
+		}
+	}
+}
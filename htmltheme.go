@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// htmlTheme brands the HTML report: a title in place of "IPv6 Address
+// Plan", a stylesheet applied after the built-in one, and a logo embedded as
+// a data URL so the report stays a single file.
+type htmlTheme struct {
+	Title string
+	CSS   template.CSS
+	Logo  template.URL
+}
+
+// loadHTMLTheme reads the files named by -html-css and -html-logo.
+func loadHTMLTheme(title, cssPath, logoPath string) (htmlTheme, error) {
+	theme := htmlTheme{Title: title}
+	if cssPath != "" {
+		css, err := os.ReadFile(cssPath)
+		if err != nil {
+			return theme, err
+		}
+		if strings.Contains(strings.ToLower(string(css)), "</style") {
+			return theme, fmt.Errorf("%s: stylesheet must not contain </style>", cssPath)
+		}
+		theme.CSS = template.CSS(css)
+	}
+	if logoPath != "" {
+		ext := strings.ToLower(filepath.Ext(logoPath))
+		mimeType := mime.TypeByExtension(ext)
+		if ext == ".svg" {
+			mimeType = "image/svg+xml"
+		}
+		if !strings.HasPrefix(mimeType, "image/") {
+			return theme, fmt.Errorf("%s: logo must be an image (.png, .jpg, .gif, .svg or .webp)", logoPath)
+		}
+		data, err := os.ReadFile(logoPath)
+		if err != nil {
+			return theme, err
+		}
+		theme.Logo = template.URL("data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data))
+	}
+	return theme, nil
+}
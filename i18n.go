@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// messages translates the fixed strings of the text and HTML reports.
+// Strings missing from a catalog, and everything derived from the plan
+// itself (notes, warnings), are shown in English.
+type messages map[string]string
+
+// catalogs holds the report translations, keyed by -lang code and then by
+// the English string.
+var catalogs = map[string]messages{
+	"en": {},
+	"es": {
+		"This tool is not intended to provide a comprehensive address plan.":         "Esta herramienta no pretende proporcionar un plan de direccionamiento completo.",
+		"It should be used to generate a top level heirarchy of IPv6 address plans.": "Debe usarse para generar la jerarquía de nivel superior de los planes de direccionamiento IPv6.",
+		"IPv6 Address Plan":         "Plan de direccionamiento IPv6",
+		"Base Subnet":               "Subred base",
+		"Number of POPs":            "Número de POPs",
+		"Preferred POP subnet size": "Tamaño de subred preferido por POP",
+		"Growth bits reserved":      "Bits de crecimiento reservados",
+		"Maximum POP count":         "Número máximo de POPs",
+		"Subnet levels":             "Niveles de subred",
+		"ULA Base Subnet":           "Subred base ULA",
+		"Notes":                     "Notas",
+		"Global Subnet Counts":      "Recuento global de subredes",
+		"available subnets":         "subredes disponibles",
+		"POP Allocations":           "Asignaciones de POP",
+		"Level":                     "Nivel",
+		"Available":                 "Disponibles",
+		"Role":                      "Rol",
+		"Addressing":                "Direccionamiento",
+		"Prefix Size":               "Tamaño de prefijo",
+		"Available Subnets":         "Subredes disponibles",
+		"Subnet":                    "Subred",
+		"ULA Subnet":                "Subred ULA",
+		"Demand":                    "Demanda",
+		"Location":                  "Ubicación",
+		"Pools":                     "Pools",
+		"Unsplit":                   "Sin repartir",
+		"Map":                       "Mapa",
+		"Utilization":               "Utilización",
+		"Summary":                   "Resumen",
+		"allocated":                 "asignado",
+		"reserved":                  "reservado",
+		"free":                      "libre",
+		"Explanation":               "Explicación",
+		"Reserved POP IDs":          "IDs de POP reservados",
+		"Delegated Blocks":          "Bloques delegados",
+		"Out-of-band Management":    "Gestión fuera de banda",
+		"Management":                "Gestión",
+		"Aggregate":                 "Agregado",
+		"Block per POP":             "Bloque por POP",
+		"Delegated from":            "Delegado de",
+		"Organization":              "Organización",
+		"Count":                     "Cantidad",
+	},
+	"de": {
+		"This tool is not intended to provide a comprehensive address plan.":         "Dieses Werkzeug ist nicht dafür gedacht, einen vollständigen Adressplan zu liefern.",
+		"It should be used to generate a top level heirarchy of IPv6 address plans.": "Es dient dazu, die oberste Hierarchieebene von IPv6-Adressplänen zu erstellen.",
+		"IPv6 Address Plan":         "IPv6-Adressplan",
+		"Base Subnet":               "Basis-Subnetz",
+		"Number of POPs":            "Anzahl der POPs",
+		"Preferred POP subnet size": "Bevorzugte Subnetzgröße pro POP",
+		"Growth bits reserved":      "Reservierte Wachstumsbits",
+		"Maximum POP count":         "Maximale Anzahl POPs",
+		"Subnet levels":             "Subnetzebenen",
+		"ULA Base Subnet":           "ULA-Basis-Subnetz",
+		"Notes":                     "Hinweise",
+		"Global Subnet Counts":      "Subnetzanzahl gesamt",
+		"available subnets":         "verfügbare Subnetze",
+		"POP Allocations":           "POP-Zuweisungen",
+		"Level":                     "Ebene",
+		"Available":                 "Verfügbar",
+		"Role":                      "Rolle",
+		"Addressing":                "Adressierung",
+		"Prefix Size":               "Präfixlänge",
+		"Available Subnets":         "Verfügbare Subnetze",
+		"Subnet":                    "Subnetz",
+		"ULA Subnet":                "ULA-Subnetz",
+		"Demand":                    "Bedarf",
+		"Location":                  "Standort",
+		"Pools":                     "Pools",
+		"Unsplit":                   "Nicht aufgeteilt",
+		"Map":                       "Karte",
+		"Utilization":               "Auslastung",
+		"Summary":                   "Übersicht",
+		"allocated":                 "vergeben",
+		"reserved":                  "reserviert",
+		"free":                      "frei",
+		"Explanation":               "Erläuterung",
+		"Reserved POP IDs":          "Reservierte POP-IDs",
+		"Delegated Blocks":          "Delegierte Blöcke",
+		"Out-of-band Management":    "Out-of-Band-Management",
+		"Management":                "Management",
+		"Aggregate":                 "Aggregat",
+		"Block per POP":             "Block pro POP",
+		"Delegated from":            "Delegiert von",
+		"Organization":              "Organisation",
+		"Count":                     "Anzahl",
+	},
+	"ja": {
+		"This tool is not intended to provide a comprehensive address plan.":         "このツールは包括的なアドレス計画を提供するものではありません。",
+		"It should be used to generate a top level heirarchy of IPv6 address plans.": "IPv6 アドレス計画の最上位の階層を作成するために使用してください。",
+		"IPv6 Address Plan":         "IPv6 アドレス計画",
+		"Base Subnet":               "ベースサブネット",
+		"Number of POPs":            "POP 数",
+		"Preferred POP subnet size": "POP ごとの推奨サブネットサイズ",
+		"Growth bits reserved":      "予約済み拡張ビット",
+		"Maximum POP count":         "最大 POP 数",
+		"Subnet levels":             "サブネットレベル",
+		"ULA Base Subnet":           "ULA ベースサブネット",
+		"Notes":                     "注記",
+		"Global Subnet Counts":      "全体のサブネット数",
+		"available subnets":         "利用可能なサブネット",
+		"POP Allocations":           "POP 割り当て",
+		"Level":                     "レベル",
+		"Available":                 "利用可能数",
+		"Role":                      "ロール",
+		"Addressing":                "アドレス割り当て方式",
+		"Prefix Size":               "プレフィックス長",
+		"Available Subnets":         "利用可能なサブネット数",
+		"Subnet":                    "サブネット",
+		"ULA Subnet":                "ULA サブネット",
+		"Demand":                    "需要",
+		"Location":                  "所在地",
+		"Pools":                     "プール",
+		"Unsplit":                   "未分割",
+		"Map":                       "地図",
+		"Utilization":               "使用率",
+		"Summary":                   "概要",
+		"allocated":                 "割り当て済み",
+		"reserved":                  "予約済み",
+		"free":                      "空き",
+		"Explanation":               "解説",
+		"Reserved POP IDs":          "予約済み POP ID",
+		"Delegated Blocks":          "委任ブロック",
+		"Out-of-band Management":    "アウトオブバンド管理",
+		"Management":                "管理",
+		"Aggregate":                 "集約",
+		"Block per POP":             "POP ごとのブロック",
+		"Delegated from":            "委任元",
+		"Organization":              "組織",
+		"Count":                     "数",
+	},
+}
+
+func catalog(lang string) (messages, error) {
+	if m, ok := catalogs[strings.ToLower(lang)]; ok {
+		return m, nil
+	}
+	langs := make([]string, 0, len(catalogs))
+	for l := range catalogs {
+		langs = append(langs, l)
+	}
+	sort.Strings(langs)
+	return nil, fmt.Errorf("unsupported language %q (expected one of %s)", lang, strings.Join(langs, ", "))
+}
+
+// T returns the translation of s, or s itself.
+func (m messages) T(s string) string {
+	if t, ok := m[s]; ok {
+		return t
+	}
+	return s
+}
+
+// LevelName translates the "Level n (/len)" names stored in plans.
+func (m messages) LevelName(name string) string {
+	if rest := strings.TrimPrefix(name, "Level "); rest != name {
+		return m.T("Level") + " " + rest
+	}
+	return name
+}
+
+// displayWidth approximates the terminal columns s occupies, counting East
+// Asian wide characters as two.
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x1100 && (r <= 0x115f || (r >= 0x2e80 && r <= 0xa4cf) || (r >= 0xac00 && r <= 0xd7a3) || (r >= 0xf900 && r <= 0xfaff) || (r >= 0xfe30 && r <= 0xfe4f) || (r >= 0xff00 && r <= 0xff60) || (r >= 0xffe0 && r <= 0xffe6)) {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// padRight pads s with spaces to width display columns.
+func padRight(s string, width int) string {
+	if w := displayWidth(s); w < width {
+		return s + strings.Repeat(" ", width-w)
+	}
+	return s
+}
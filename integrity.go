@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// signatureNamespace scopes SSH signatures so a plan signature cannot be
+// replayed as a signature over some other kind of file.
+const signatureNamespace = "ipv6planner-plan"
+
+// PlanIntegrity is embedded in exported plans so a copy circulated by email
+// can be checked for modification. The checksum and signature both cover the
+// canonical encoding of the plan with this block removed.
+type PlanIntegrity struct {
+	Checksum  string `json:"checksum"`
+	Signer    string `json:"signer,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// canonicalPlanBytes returns the bytes covered by the checksum and
+// signature: the plan document with its integrity block removed, with
+// object keys sorted and no whitespace. It is built from the JSON itself
+// rather than from IPv6Plan, so a plan still verifies after fields are
+// added to the struct.
+func canonicalPlanBytes(raw []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	delete(doc, "integrity")
+	return json.Marshal(doc)
+}
+
+func planChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// sealPlan embeds a checksum into plan and, when keyPath is set, an SSH
+// signature made with that private key via ssh-keygen.
+func sealPlan(plan IPv6Plan, keyPath, signer string) (IPv6Plan, error) {
+	plan.Integrity = nil
+	raw, err := json.Marshal(plan)
+	if err != nil {
+		return plan, err
+	}
+	data, err := canonicalPlanBytes(raw)
+	if err != nil {
+		return plan, err
+	}
+
+	integrity := &PlanIntegrity{Checksum: planChecksum(data)}
+	if keyPath != "" {
+		cmd := exec.Command("ssh-keygen", "-q", "-Y", "sign", "-f", keyPath, "-n", signatureNamespace)
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Stderr = os.Stderr
+		sig, err := cmd.Output()
+		if err != nil {
+			return plan, fmt.Errorf("signing with %s: %v", keyPath, err)
+		}
+		integrity.Signer = signer
+		integrity.Signature = string(sig)
+	}
+
+	plan.Integrity = integrity
+	return plan, nil
+}
+
+// runVerify implements the verify command.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	allowedSigners := fs.String("allowed-signers", "", "ssh-keygen allowed_signers file used to check the signer")
+	identity := fs.String("identity", "", "Principal the plan must be signed by (default: any principal in allowed-signers)")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner verify [-allowed-signers file] [-identity principal] plan.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := verifyPlanFile(fs.Arg(0), *allowedSigners, *identity); err != nil {
+		fmt.Printf("Verification failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func verifyPlanFile(path, allowedSigners, identity string) error {
+	raw, err := readPlanFile(path)
+	if err != nil {
+		return err
+	}
+
+	// Only the integrity block is decoded: the checksum covers the document
+	// as it was signed, not as this release would read or upgrade it.
+	var plan struct {
+		Integrity *PlanIntegrity `json:"integrity"`
+	}
+	if err := json.Unmarshal(raw, &plan); err != nil {
+		return fmt.Errorf("%s: invalid plan document: %v", path, err)
+	}
+	if plan.Integrity == nil || plan.Integrity.Checksum == "" {
+		return fmt.Errorf("%s: plan has no embedded checksum", path)
+	}
+
+	data, err := canonicalPlanBytes(raw)
+	if err != nil {
+		return fmt.Errorf("%s: invalid plan document: %v", path, err)
+	}
+	if got := planChecksum(data); got != plan.Integrity.Checksum {
+		return fmt.Errorf("%s: checksum mismatch, plan has been modified (expected %s, got %s)", path, plan.Integrity.Checksum, got)
+	}
+	fmt.Printf("%s: checksum OK (%s)\n", path, plan.Integrity.Checksum)
+
+	if plan.Integrity.Signature == "" {
+		if allowedSigners != "" {
+			return fmt.Errorf("%s: plan is not signed", path)
+		}
+		return nil
+	}
+
+	sigFile, err := os.CreateTemp("", "ipv6planner-*.sig")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sigFile.Name())
+	if _, err := sigFile.WriteString(plan.Integrity.Signature); err != nil {
+		sigFile.Close()
+		return err
+	}
+	sigFile.Close()
+
+	if allowedSigners == "" {
+		// Without a trust list we can only confirm the signature is intact.
+		if err := sshKeygen(data, "-Y", "check-novalidate", "-n", signatureNamespace, "-s", sigFile.Name()); err != nil {
+			return fmt.Errorf("%s: bad signature: %v", path, err)
+		}
+		fmt.Printf("%s: signature intact (signer not checked, pass -allowed-signers to verify it)\n", path)
+		return nil
+	}
+
+	principals := []string{identity}
+	if identity == "" {
+		out, err := exec.Command("ssh-keygen", "-Y", "find-principals", "-f", allowedSigners, "-s", sigFile.Name()).Output()
+		if err != nil {
+			return fmt.Errorf("%s: signing key is not in %s", path, allowedSigners)
+		}
+		principals = strings.Fields(string(out))
+	}
+
+	for _, principal := range principals {
+		err := sshKeygen(data, "-Y", "verify", "-f", allowedSigners, "-I", principal, "-n", signatureNamespace, "-s", sigFile.Name())
+		if err == nil {
+			fmt.Printf("%s: good signature from %s\n", path, principal)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: signature does not verify against %s", path, allowedSigners)
+}
+
+// sshKeygen runs ssh-keygen with data on stdin, folding its diagnostics into
+// the returned error.
+func sshKeygen(data []byte, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("ssh-keygen", args...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
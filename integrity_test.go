@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestPlan(t *testing.T, doc interface{}) string {
+	t.Helper()
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifySealedPlan(t *testing.T) {
+	opts := defaultPlanOptions()
+	opts.Subnet, opts.POPCount, opts.PreferredSize, opts.SubnetLevels = "2001:db8::/32", 3, 40, []int{48, 64}
+	plan, err := generateIPv6Plan(opts)
+	if err == nil {
+		plan, err = sealPlan(plan, "", "")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestPlan(t, plan)
+	if err := verifyPlanFile(path, "", ""); err != nil {
+		t.Fatalf("freshly sealed plan: %v", err)
+	}
+
+	// Reindenting or reordering the document does not change the checksum
+	var doc map[string]interface{}
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyPlanFile(writeTestPlan(t, doc), "", ""); err != nil {
+		t.Fatalf("reencoded plan: %v", err)
+	}
+
+	// A field this release does not know about is still covered
+	doc["added_later"] = true
+	if err := verifyPlanFile(writeTestPlan(t, doc), "", ""); err == nil {
+		t.Fatal("plan with an added field verified")
+	}
+
+	delete(doc, "added_later")
+	doc["pop_count"] = 4
+	if err := verifyPlanFile(writeTestPlan(t, doc), "", ""); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("modified plan: got %v, want a checksum mismatch", err)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// question is one prompt of the interactive wizard. show renders the current
+// answer and set validates and stores a new one.
+type question struct {
+	label string
+	show  func() string
+	set   func(input string) error
+}
+
+// getInteractiveInput walks the user through the plan parameters, starting
+// from opts, and returns the confirmed answers. Candidates, such as blocks
+// found in an RIR delegated file, can be picked as the base by number.
+func getInteractiveInput(opts PlanOptions, candidates []Delegation) PlanOptions {
+	reader := bufio.NewReader(os.Stdin)
+
+	if len(candidates) > 0 {
+		fmt.Println("IPv6 blocks delegated to you:")
+		for i, d := range candidates {
+			fmt.Printf("  %d. %s\n", i+1, d)
+		}
+		fmt.Println("Enter one of these numbers as the base subnet to use that block.")
+	}
+
+	subnet := opts.Subnet
+	popCount := opts.POPCount
+	preferredSize := opts.PreferredSize
+	subnetLevels := opts.SubnetLevels
+
+	baseSize := func() int {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return 128
+		}
+		ones, _ := ipNet.Mask.Size()
+		return ones
+	}
+
+	questions := []question{
+		{
+			label: "base IPv6 subnet",
+			show:  func() string { return subnet },
+			set: func(input string) error {
+				if n, err := strconv.Atoi(input); err == nil && len(candidates) > 0 {
+					if n < 1 || n > len(candidates) {
+						return fmt.Errorf("there is no delegated block %d", n)
+					}
+					input = candidates[n-1].Prefix
+				}
+				ip, ipNet, err := net.ParseCIDR(input)
+				if err != nil {
+					return failf(ErrInvalidPrefix, "%q is not a valid CIDR prefix", input)
+				}
+				if ip.To4() != nil {
+					return notIPv6Base(input)
+				}
+				if !ip.Equal(ipNet.IP) {
+					fmt.Printf("  Note: %s has host bits set, using %s\n", input, ipNet)
+				}
+				subnet = ipNet.String()
+				return nil
+			},
+		},
+		{
+			label: "number of POPs",
+			show:  func() string { return strconv.Itoa(popCount) },
+			set: func(input string) error {
+				n, err := strconv.Atoi(input)
+				if err != nil || n < 1 {
+					return fmt.Errorf("%q is not a positive number", input)
+				}
+				popCount = n
+				return nil
+			},
+		},
+		{
+			label: "preferred subnet size per POP",
+			show:  func() string { return "/" + strconv.Itoa(preferredSize) },
+			set: func(input string) error {
+				size, err := parsePrefixLength(input)
+				if err != nil {
+					return err
+				}
+				if size <= baseSize() {
+					return failf(ErrPrefixTooSmall, "/%d is not more specific than the base subnet %s", size, subnet)
+				}
+				preferredSize = size
+				return nil
+			},
+		},
+		{
+			label: "subnet levels (comma separated)",
+			show:  func() string { return formatLevels(subnetLevels) },
+			set: func(input string) error {
+				levels, err := parseSubnetLevels(input)
+				if err != nil {
+					return err
+				}
+				for _, level := range levels {
+					if level <= preferredSize {
+						return failf(ErrInvalidLevel, "level /%d is not more specific than the POP size /%d", level, preferredSize)
+					}
+					if level > 64 && !opts.AllowSub64 {
+						return failf(ErrInvalidLevel, "level /%d is longer than /64 (restart with -allow-sub64 to plan below /64)", level)
+					}
+				}
+				subnetLevels = levels
+				return nil
+			},
+		},
+	}
+
+	// checkAnswers catches combinations that became inconsistent after an
+	// earlier answer was edited.
+	checkAnswers := func() []string {
+		var problems []string
+		ones := baseSize()
+		if preferredSize <= ones {
+			problems = append(problems, fmt.Sprintf("POP size /%d is not more specific than the base subnet %s (question 3)", preferredSize, subnet))
+		} else if preferredSize-ones < 63 && int64(1)<<uint(preferredSize-ones) < int64(popCount) {
+			problems = append(problems, fmt.Sprintf("%s only holds %d /%d POPs, not %d (questions 1-3)", subnet, int64(1)<<uint(preferredSize-ones), preferredSize, popCount))
+		}
+		for _, level := range subnetLevels {
+			if level <= preferredSize {
+				problems = append(problems, fmt.Sprintf("level /%d is not more specific than the POP size /%d (question 4)", level, preferredSize))
+			}
+		}
+		return problems
+	}
+
+	for _, q := range questions {
+		ask(reader, q)
+	}
+
+	for {
+		fmt.Println("\nPlan parameters:")
+		for i, q := range questions {
+			fmt.Printf("  %d. %s: %s\n", i+1, strings.ToUpper(q.label[:1])+q.label[1:], q.show())
+		}
+		problems := checkAnswers()
+		for _, p := range problems {
+			fmt.Printf("  Problem: %s\n", p)
+		}
+
+		if len(problems) == 0 {
+			fmt.Print("Enter a number to change an answer, or press Enter to generate the plan: ")
+		} else {
+			fmt.Print("Enter a number to change an answer: ")
+		}
+		input, eof := readAnswer(reader)
+		if input == "" {
+			if len(problems) == 0 {
+				// Only the answered fields change; flag options still apply
+				opts.Subnet = subnet
+				opts.POPCount = popCount
+				opts.PreferredSize = preferredSize
+				opts.SubnetLevels = subnetLevels
+				offerSaveConfig(reader, opts)
+				return opts
+			}
+			if eof {
+				fmt.Println("\nError: input ended before the problems above were fixed")
+				os.Exit(1)
+			}
+			continue
+		}
+
+		n, err := strconv.Atoi(input)
+		if err != nil || n < 1 || n > len(questions) {
+			fmt.Printf("  Please enter a number between 1 and %d.\n", len(questions))
+			if eof {
+				os.Exit(1)
+			}
+			continue
+		}
+		ask(reader, questions[n-1])
+	}
+}
+
+// offerSaveConfig prints the equivalent command line and optionally writes
+// the answers to a config file for later runs with -c.
+func offerSaveConfig(reader *bufio.Reader, opts PlanOptions) {
+	fmt.Printf("\nEquivalent command line:\n  %s\n", commandLine(opts))
+	for {
+		fmt.Print("Save these parameters to a config file? Enter a path, or press Enter to skip: ")
+		path, eof := readAnswer(reader)
+		if path == "" {
+			fmt.Println()
+			return
+		}
+		err := saveConfig(path, opts)
+		if err == nil {
+			fmt.Printf("Saved. Re-run with:\n  ipv6planner -c %s\n\n", path)
+			return
+		}
+		fmt.Printf("  Could not save config: %v\n", err)
+		if eof {
+			return
+		}
+	}
+}
+
+// ask prompts until q accepts the answer. An empty answer keeps the current
+// value, which is always valid on its own.
+func ask(reader *bufio.Reader, q question) {
+	for {
+		fmt.Printf("Enter %s (default %s): ", q.label, q.show())
+		input, eof := readAnswer(reader)
+		if input == "" {
+			if eof {
+				fmt.Println()
+			}
+			return
+		}
+		err := q.set(input)
+		if err == nil {
+			return
+		}
+		fmt.Printf("  Invalid input: %v\n", err)
+		if eof {
+			fmt.Println("Error: input ended without a valid answer")
+			os.Exit(1)
+		}
+	}
+}
+
+// readAnswer reads one trimmed line and reports whether input has ended.
+func readAnswer(reader *bufio.Reader) (string, bool) {
+	line, err := reader.ReadString('\n')
+	return strings.TrimSpace(line), err != nil
+}
+
+func formatLevels(levels []int) string {
+	parts := make([]string, len(levels))
+	for i, level := range levels {
+		parts[i] = strconv.Itoa(level)
+	}
+	return strings.Join(parts, ",")
+}
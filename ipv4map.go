@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Ways of writing a legacy IPv4 address into an interface ID.
+const (
+	// ipv4Embedded stores the 32 address bits in the low 32 bits and writes
+	// them dotted, e.g. 3fff:db8:0:1::10.1.2.3.
+	ipv4Embedded = "embedded"
+	// ipv4Hex stores the same bits but writes them in plain hex, e.g.
+	// 3fff:db8:0:1::a01:203.
+	ipv4Hex = "hex"
+	// ipv4Octets gives each octet its own group, reusing its decimal digits,
+	// e.g. 3fff:db8:0:1:10:1:2:3. Readable, but not a bitwise encoding.
+	ipv4Octets = "octets"
+)
+
+// V4Mapping pairs a legacy IPv4 host with its IPv6 address in one /64.
+type V4Mapping struct {
+	Name string `json:"name,omitempty"`
+	IPv4 string `json:"ipv4"`
+	IPv6 string `json:"ipv6"`
+
+	IPv6URL    string `json:"ipv6_url,omitempty"`
+	IPv6Scoped string `json:"ipv6_scoped,omitempty"`
+}
+
+type ipv4Host struct {
+	name string
+	addr net.IP
+}
+
+// loadIPv4Hosts reads one host per line, either "address" or
+// "name,address". Blank lines and lines starting with # are skipped.
+func loadIPv4Hosts(path string) ([]ipv4Host, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var hosts []ipv4Host
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		var h ipv4Host
+		addr := fields[0]
+		if len(fields) == 2 {
+			h.name = strings.TrimSpace(fields[0])
+			addr = fields[1]
+		} else if len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"address\" or \"name,address\"", path, lineNo)
+		}
+		h.addr = net.ParseIP(strings.TrimSpace(addr)).To4()
+		if h.addr == nil {
+			// Skip a header row such as "name,ipv4"
+			if lineNo == 1 && len(hosts) == 0 && net.ParseIP(strings.TrimSpace(addr)) == nil {
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: %q is not an IPv4 address", path, lineNo, strings.TrimSpace(addr))
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, scanner.Err()
+}
+
+// ipv4InterfaceID returns the interface ID that encodes v4.
+func ipv4InterfaceID(v4 net.IP, encoding string) (uint64, error) {
+	switch encoding {
+	case ipv4Embedded, ipv4Hex:
+		return uint64(binary.BigEndian.Uint32(v4)), nil
+	case ipv4Octets:
+		var id uint64
+		for _, octet := range v4 {
+			// Read the decimal digits as hex so 10 becomes 0x10
+			group, err := strconv.ParseUint(strconv.Itoa(int(octet)), 16, 16)
+			if err != nil {
+				return 0, err
+			}
+			id = id<<16 | group
+		}
+		return id, nil
+	}
+	return 0, fmt.Errorf("unknown IPv4 encoding %q (expected embedded, hex or octets)", encoding)
+}
+
+// formatEmbedded writes the address with a dotted-quad tail when the
+// encoding calls for it.
+func formatEmbedded(ip net.IP, encoding string) string {
+	if encoding != ipv4Embedded {
+		return ip.String()
+	}
+	head := make(net.IP, net.IPv6len)
+	copy(head, ip[:12])
+	s := head.String()
+	if !strings.HasSuffix(s, "::") {
+		s += ":"
+	}
+	return s + net.IP(ip[12:16]).String()
+}
+
+// mapIPv4Hosts places every host into the /64 and refuses interface IDs that
+// land in a reserved block of the host conventions.
+func mapIPv4Hosts(ipNet *net.IPNet, hosts []ipv4Host, encoding string, blocks []parsedBlock) ([]V4Mapping, error) {
+	var mappings []V4Mapping
+	for _, h := range hosts {
+		id, err := ipv4InterfaceID(h.addr, encoding)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range blocks {
+			if b.Reserved && id >= b.first && id <= b.last {
+				return nil, fmt.Errorf("%s maps into reserved block %q", h.addr, b.Name)
+			}
+		}
+		mappings = append(mappings, V4Mapping{
+			Name: h.name,
+			IPv4: h.addr.String(),
+			IPv6: formatEmbedded(hostAddress(ipNet.IP, id), encoding),
+		})
+	}
+	return mappings, nil
+}
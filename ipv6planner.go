@@ -1,62 +1,237 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
+	"io"
+	"math/big"
+	"math/bits"
 	"net"
+	"net/netip"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 type IPv6Plan struct {
-	BaseSubnet     string        `json:"base_subnet"`
-	POPCount       int           `json:"pop_count"`
-	PreferredSize  int           `json:"preferred_size"`
-	SubnetLevels   []int         `json:"subnet_levels"`
-	POPAllocations []POPAlloc    `json:"pop_allocations"`
-	SubnetCounts   []SubnetCount `json:"subnet_counts"`
+	SchemaVersion  int              `json:"schema_version"`
+	BaseSubnet     string           `json:"base_subnet"`
+	BaseClass      *PrefixClass     `json:"base_class,omitempty"`
+	POPCount       int              `json:"pop_count"`
+	PreferredSize  int              `json:"preferred_size"`
+	GrowthBits     int              `json:"growth_bits,omitempty"`
+	MaxPOPCount    *big.Int         `json:"max_pop_count"`
+	SubnetLevels   []int            `json:"subnet_levels"`
+	POPOffset      int              `json:"pop_offset,omitempty"`
+	POPAllocations []POPAlloc       `json:"pop_allocations"`
+	ReservedIDs    []ReservedPOPID  `json:"reserved_pop_ids,omitempty"`
+	POPNumbering   string           `json:"pop_numbering,omitempty"`
+	Delegations    []DelegatedBlock `json:"delegations,omitempty"`
+	DelegatedFrom  *DelegatedFrom   `json:"delegated_from,omitempty"`
+	Preset         string           `json:"preset,omitempty"`
+	Policy         string           `json:"policy,omitempty"`
+	Rules          []Rule           `json:"rules,omitempty"`
+	OOB            *OOBPlan         `json:"oob,omitempty"`
+	SubnetCounts   []SubnetCount    `json:"subnet_counts"`
+	Notes          []string         `json:"notes,omitempty"`
+	Explanation    []string         `json:"explanation,omitempty"`
+	ULAPlan        *IPv6Plan        `json:"ula_plan,omitempty"`
+	Integrity      *PlanIntegrity   `json:"integrity,omitempty"`
 }
 
 type POPAlloc struct {
-	POPNumber  int            `json:"pop_number"`
-	POPSubnet  string         `json:"pop_subnet"`
-	Subnets    []SubnetDetail `json:"subnets"`
-	LevelNames []string       `json:"level_names"`
+	POPNumber    int            `json:"pop_number"`
+	Name         string         `json:"name,omitempty"`
+	Code         string         `json:"code,omitempty"`
+	Location     *POPLocation   `json:"location,omitempty"`
+	POPSubnet    string         `json:"pop_subnet"`
+	Subnets      []SubnetDetail `json:"subnets"`
+	LevelNames   []string       `json:"level_names"`
+	RequiredSize int            `json:"required_size,omitempty"`
+	Demand       []LevelDemand  `json:"demand,omitempty"`
+	Pools        []POPPool      `json:"pools,omitempty"`
+	Counts       map[string]int `json:"counts,omitempty"`
+	OOB          *POPOOB        `json:"oob,omitempty"`
 }
 
 type SubnetDetail struct {
-	CIDR      string `json:"cidr"`
-	Count     int64  `json:"count"`
-	Available int64  `json:"available"`
+	CIDR       string   `json:"cidr"`
+	Count      *big.Int `json:"count"`
+	Available  *big.Int `json:"available"`
+	Role       string   `json:"role,omitempty"`
+	Addressing string   `json:"addressing,omitempty"`
 }
 
 type SubnetCount struct {
-	PrefixSize int   `json:"prefix_size"`
-	Count      int64 `json:"count"`
-	Available  int64 `json:"available"`
+	PrefixSize int      `json:"prefix_size"`
+	Count      *big.Int `json:"count"`
+	Available  *big.Int `json:"available"`
 }
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "plan":
+			// Generating a plan is the default; "plan" just names it
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "render":
+			runRender(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		case "edit":
+			runEdit(os.Args[2:])
+			return
+		case "upgrade":
+			runUpgrade(os.Args[2:])
+			return
+		case "verify":
+			runVerify(os.Args[2:])
+			return
+		case "hosts":
+			runHosts(os.Args[2:])
+			return
+		case "classify":
+			runClassify(os.Args[2:])
+			return
+		case "docgen":
+			runDocgen(os.Args[2:])
+			return
+		case "stats":
+			runStats(os.Args[2:])
+			return
+		case "layout":
+			runLayout(os.Args[2:])
+			return
+		case "history":
+			runHistory(os.Args[2:])
+			return
+		case "metrics":
+			runMetrics(os.Args[2:])
+			return
+		case "delegated":
+			runDelegated(os.Args[2:])
+			return
+		case "peeringdb":
+			runPeeringDB(os.Args[2:])
+			return
+		case "lint":
+			runLint(os.Args[2:])
+			return
+		case "practice":
+			runPractice(os.Args[2:])
+			return
+		case "validate":
+			runValidate(os.Args[2:])
+			return
+		case "probe":
+			runProbe(os.Args[2:])
+			return
+		case "allocate":
+			runAllocate(os.Args[2:])
+			return
+		case "reconcile":
+			runReconcile(os.Args[2:])
+			return
+		case "watch":
+			runWatch(os.Args[2:])
+			return
+		case "audit":
+			runAudit(os.Args[2:])
+			return
+		case "router-config":
+			runRouterConfig(os.Args[2:])
+			return
+		case "render-configs":
+			runRenderConfigs(os.Args[2:])
+			return
+		case "dns":
+			runDNS(os.Args[2:])
+			return
+		case "reverse-zones":
+			runReverseZones(os.Args[2:])
+			return
+		case "inet6num":
+			runInet6num(os.Args[2:])
+			return
+		case "view":
+			runView(os.Args[2:])
+			return
+		case "anonymize":
+			runAnonymize(os.Args[2:])
+			return
+		case "peering-lan":
+			runPeeringLAN(os.Args[2:])
+			return
+		case "expand", "compress", "range", "count", "random-subnet":
+			runCalc(os.Args[1], os.Args[2:])
+			return
+		}
+	}
+
 	// Default values
-	subnet := "3fff::/20"
-	popCount := 5
-	preferredSize := 36
-	subnetLevelsStr := "44,48,64"
+	planArgs := newPlanFlags()
+	configPath := ""
+	fromStdin := false
+	sortOrder := sortByIndex
+	lang := "en"
+	colorMode := colorAuto
+	offset := 0
+	limit := 0
 	outputFormat := "text"
 	interactive := false
 	showHelp := false
+	checksum := false
+	signKey := ""
+	signer := ""
+	encryptTo := ""
+	htmlTitle := ""
+	htmlCSS := ""
+	htmlLogo := ""
+	suggestEnd := ""
+	explain := false
+	basePlanPath := ""
+	bundlePath := ""
+	delegatedPath := ""
+	delegatedOrg := ""
+	withinSpec := ""
+	twinDoc := ""
 
 	// Parse flags
-	flag.StringVar(&subnet, "s", subnet, "Base IPv6 subnet (e.g., 3fff::/20)")
-	flag.IntVar(&popCount, "n", popCount, "Number of POPs")
-	flag.IntVar(&preferredSize, "p", preferredSize, "Preferred subnet size per POP")
-	flag.StringVar(&subnetLevelsStr, "l", subnetLevelsStr, "Comma-separated list of subnet levels")
+	planArgs.register(flag.CommandLine)
+	flag.StringVar(&configPath, "c", configPath, "Load plan parameters from a config file")
+	flag.BoolVar(&fromStdin, "stdin", fromStdin, "Read plan parameters, or a plan to extend, as JSON from standard input")
+	flag.StringVar(&basePlanPath, "base-plan", basePlanPath, "Previously issued plan whose POP prefixes a regenerated plan must keep")
+	flag.StringVar(&bundlePath, "bundle", bundlePath, "Write the plan as a zip of the requested formats, plan JSON, JSON Schema and checksums")
+	flag.StringVar(&delegatedPath, "delegated", delegatedPath, "RIR delegated-extended file to find base subnet candidates in")
+	flag.StringVar(&delegatedOrg, "delegated-org", delegatedOrg, "Organization to look up in -delegated, by ASN (AS64500) or opaque ID")
+	flag.StringVar(&withinSpec, "within", withinSpec, "Plan inside the block a parent plan delegated to an organization (e.g. parent.json:acme)")
+	flag.StringVar(&twinDoc, "twin-doc-prefix", twinDoc, "Output a structurally identical twin of the plan in a documentation prefix: auto, 2001:db8::/32 or 3fff::/20")
+	flag.StringVar(&sortOrder, "sort", sortOrder, "POP order in the output: index, prefix or name")
+	flag.IntVar(&offset, "offset", offset, "Skip this many POPs in the output")
+	flag.IntVar(&limit, "limit", limit, "Show at most this many POPs (0 for all)")
+	flag.StringVar(&colorMode, "color", colorMode, "Color text output: auto, always or never")
+	flag.StringVar(&lang, "lang", lang, "Language of text and HTML report headings: en, es, de or ja")
+	flag.StringVar(&htmlTitle, "html-title", htmlTitle, "Title of the HTML report")
+	flag.StringVar(&htmlCSS, "html-css", htmlCSS, "Stylesheet applied after the HTML report's own")
+	flag.StringVar(&htmlLogo, "html-logo", htmlLogo, "Image embedded as a logo in the HTML report")
+	flag.StringVar(&suggestEnd, "suggest-levels", suggestEnd, "Suggest a nibble-aligned level hierarchy down to this end unit (e.g. 64 or 48) instead of generating a plan")
+	flag.BoolVar(&explain, "explain", explain, "Explain how the bits of each prefix were allocated")
 	flag.BoolVar(&interactive, "i", interactive, "Interactive mode")
 	flag.BoolVar(&showHelp, "h", showHelp, "Show help information")
+	flag.BoolVar(&checksum, "checksum", checksum, "Embed a checksum in JSON output")
+	flag.StringVar(&signKey, "sign-key", signKey, "SSH private key used to sign JSON output")
+	flag.StringVar(&signer, "signer", signer, "Principal recorded alongside the signature")
+	flag.StringVar(&encryptTo, "encrypt", encryptTo, "Encrypt JSON output with age to these recipients (comma-separated keys or recipient files)")
 
 	// Output format flags
 	jsonFlag := flag.Bool("j", false, "JSON output format")
@@ -80,51 +255,548 @@ func main() {
 		return
 	}
 
-	// Parse subnet levels
-	subnetLevels := parseSubnetLevels(subnetLevelsStr)
+	colors, err := newPalette(colorMode)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	msgs, err := catalog(lang)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	theme, err := loadHTMLTheme(htmlTitle, htmlCSS, htmlLogo)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if bundlePath != "" && encryptTo != "" {
+		fmt.Println("Error: -encrypt cannot be combined with -bundle, whose other formats would be unencrypted")
+		os.Exit(1)
+	}
+	if (checksum || signKey != "" || encryptTo != "") && outputFormat != "json" && bundlePath == "" {
+		fmt.Println("Error: -checksum, -sign-key and -encrypt require JSON output (-j)")
+		os.Exit(1)
+	}
+
+	opts, err := planArgs.options()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	flagged := opts
+	if configPath != "" && fromStdin {
+		fmt.Println("Error: -c and -stdin cannot be combined")
+		os.Exit(1)
+	}
+	if fromStdin && interactive {
+		fmt.Println("Error: -stdin cannot be combined with interactive mode")
+		os.Exit(1)
+	}
+	var basePlan *IPv6Plan
+	if basePlanPath != "" {
+		plan, err := loadPlan(basePlanPath)
+		if err != nil {
+			fmt.Printf("Error loading base plan: %v\n", err)
+			os.Exit(1)
+		}
+		basePlan = &plan
+	}
+	if configPath != "" || fromStdin || basePlan != nil {
+		if fromStdin {
+			var data []byte
+			data, err = io.ReadAll(os.Stdin)
+			if err == nil && isAgeEncrypted(data) {
+				data, err = decryptAge(data)
+			}
+			if err == nil {
+				opts, err = decodeOptions(data)
+			}
+			if err != nil {
+				fmt.Printf("Error reading parameters from standard input: %v\n", err)
+				os.Exit(1)
+			}
+		} else if configPath != "" {
+			opts, err = loadConfig(configPath)
+			if err != nil {
+				fmt.Printf("Error loading config: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			// Without other parameters, the base plan's own are the
+			// starting point
+			opts, err = optionsFromPlan(*basePlan)
+			if err != nil {
+				fmt.Printf("Error reading base plan parameters: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		// Flags given on the command line override the loaded parameters
+		overrideOptions(&opts, flagged, flag.CommandLine)
+	}
+	opts.BasePlan = basePlan
+
+	// A preset given on the command line fills in the levels, roles and
+	// addressing not given with it
+	if planArgs.preset != "" {
+		preset, err := lookupPreset(planArgs.preset)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		given := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+		if !given["l"] {
+			opts.SubnetLevels = preset.levels
+		}
+		if !given["roles"] {
+			opts.Roles = preset.roles
+		}
+		if !given["addressing"] {
+			opts.Addressing = preset.addressing
+		}
+	}
+
+	// A downstream plan's base is the block its parent delegated to it
+	if withinSpec != "" {
+		explicitSubnet := false
+		flag.Visit(func(f *flag.Flag) { explicitSubnet = explicitSubnet || f.Name == "s" })
+		if explicitSubnet {
+			fmt.Println("Error: -within sets the base subnet, so it cannot be combined with -s")
+			os.Exit(1)
+		}
+		prefix, from, err := loadWithin(withinSpec)
+		if err != nil {
+			fmt.Printf("Error loading parent plan: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Subnet = prefix
+		opts.DelegatedFrom = from
+	}
+
+	if suggestEnd != "" {
+		runSuggestLevels(opts, suggestEnd, outputFormat == "json")
+		return
+	}
+
+	// Blocks the RIR delegated to the organization are candidates for the
+	// base subnet when none was given
+	var candidates []Delegation
+	if delegatedPath != "" || delegatedOrg != "" {
+		if delegatedPath == "" || delegatedOrg == "" {
+			fmt.Println("Error: -delegated and -delegated-org must be given together")
+			os.Exit(1)
+		}
+		candidates, err = loadDelegations(delegatedPath, delegatedOrg)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	subnetGiven := configPath != "" || fromStdin || basePlan != nil || withinSpec != ""
+	flag.Visit(func(f *flag.Flag) { subnetGiven = subnetGiven || f.Name == "s" })
 
+	if len(candidates) > 0 && !subnetGiven {
+		if len(candidates) > 1 && !interactive {
+			fmt.Printf("Error: %s holds %d IPv6 blocks; choose the base with -s:\n", delegatedOrg, len(candidates))
+			for _, d := range candidates {
+				fmt.Printf("  %s\n", d)
+			}
+			os.Exit(1)
+		}
+		opts.Subnet = candidates[0].Prefix
+	}
 	if interactive {
-		subnet, popCount, preferredSize, subnetLevels = getInteractiveInput()
+		opts = getInteractiveInput(opts, candidates)
+	}
+
+	plan, err := generateIPv6Plan(opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.WithULA {
+		if err := attachULAPlan(&plan, opts.ULAPrefix); err != nil {
+			fmt.Printf("Error generating ULA plan: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if twinDoc != "" {
+		plan, err = twinPlan(plan, twinDoc)
+		if err != nil {
+			fmt.Printf("Error generating documentation twin: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if explain {
+		plan.Explanation = explainPlan(plan, opts)
+	}
+
+	if err := sortPOPs(&plan, sortOrder); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := pagePOPs(&plan, offset, limit); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if checksum || signKey != "" {
+		plan, err = sealPlan(plan, signKey, signer)
+		if err != nil {
+			fmt.Printf("Error sealing plan: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	exportOpts := exportOptions{
+		Colors:     colors,
+		Messages:   msgs,
+		Lang:       strings.ToLower(lang),
+		Theme:      theme,
+		Recipients: encryptTo,
+	}
+	if bundlePath != "" {
+		// Every format flag given adds a file; with none, text and HTML
+		formats := []string{"text", "html"}
+		if *jsonFlag || *htmlFlag || *textFlag {
+			formats = nil
+			for format, set := range map[string]bool{"json": *jsonFlag, "html": *htmlFlag, "text": *textFlag} {
+				if set {
+					formats = append(formats, format)
+				}
+			}
+		}
+		names, err := writeBundle(bundlePath, plan, formats, exportOpts)
+		if err != nil {
+			fmt.Printf("Error writing bundle: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %s: %s\n", bundlePath, strings.Join(names, ", "))
+		return
 	}
+	exporter := newExporter(outputFormat, exportOpts)
+	if err := exporter.Export(os.Stdout, plan); err != nil {
+		fmt.Printf("Error generating %s output: %v\n", outputFormat, err)
+		os.Exit(1)
+	}
+}
 
-	plan := generateIPv6Plan(subnet, popCount, preferredSize, subnetLevels)
+// parseSubnetLevels parses a comma-separated list of levels such as
+// "44, 48, 64". An entry may also be a range such as "44-56", which expands
+// in nibble steps from the first length to the second, or "44-64:2" with an
+// explicit step.
+func parseSubnetLevels(levelsStr string) ([]int, error) {
+	var subnetLevels []int
+	for _, entry := range strings.Split(levelsStr, ",") {
+		entry = strings.TrimSpace(entry)
+		span, stepStr, hasStep := strings.Cut(entry, ":")
+		from, to, isRange := strings.Cut(span, "-")
+		if !isRange {
+			if hasStep {
+				return nil, failf(ErrInvalidLevel, "%q has a step but no range (use e.g. 44-64:4)", entry)
+			}
+			level, err := parsePrefixLength(from)
+			if err != nil {
+				return nil, err
+			}
+			subnetLevels = append(subnetLevels, level)
+			continue
+		}
+		step := 4
+		if hasStep {
+			n, err := strconv.Atoi(strings.TrimSpace(stepStr))
+			if err != nil || n < 1 || n > 128 {
+				return nil, failf(ErrInvalidLevel, "invalid step %q in %q (expected 1-128)", stepStr, entry)
+			}
+			step = n
+		}
+		levels, err := parseLevelRange(from, to, step)
+		if err != nil {
+			return nil, err
+		}
+		subnetLevels = append(subnetLevels, levels...)
+	}
+	return subnetLevels, nil
+}
+
+// parseLevelRange expands from-to into every step-th prefix length. The
+// range must land exactly on its end so a typo does not silently drop the
+// last level.
+func parseLevelRange(from, to string, step int) ([]int, error) {
+	start, err := parsePrefixLength(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parsePrefixLength(to)
+	if err != nil {
+		return nil, err
+	}
+	if end < start {
+		return nil, failf(ErrInvalidLevel, "level range /%d-/%d runs backwards (use %d-%d)", start, end, end, start)
+	}
+	if (end-start)%step != 0 {
+		return nil, failf(ErrInvalidLevel, "level range /%d-/%d is not a whole number of %d-bit steps", start, end, step)
+	}
+	var levels []int
+	for level := start; level <= end; level += step {
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
 
-	switch outputFormat {
-	case "json":
-		outputJSON(plan)
-	case "html":
-		outputHTML(plan)
-	default:
-		outputText(plan)
+func parsePrefixLength(s string) (int, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "/")
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 128 {
+		return 0, failf(ErrInvalidLevel, "invalid prefix length %q (expected 0-128)", s)
 	}
+	return n, nil
 }
 
-func parseSubnetLevels(levelsStr string) []int {
-	levels := strings.Split(levelsStr, ",")
-	subnetLevels := make([]int, len(levels))
-	for i, l := range levels {
-		l = strings.TrimSpace(l)
-		if strings.HasPrefix(l, "/") {
-			l = l[1:]
+// parseLevelMap reads "64=slaac,127=static" style lists that attach one of
+// the allowed values to a prefix length.
+func parseLevelMap(s, what string, allowed []string) (map[int]string, error) {
+	values := make(map[int]string)
+	if strings.TrimSpace(s) == "" {
+		return values, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid entry %q (expected level=%s)", strings.TrimSpace(item), strings.ReplaceAll(what, " ", "-"))
+		}
+		level, err := parsePrefixLength(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		value := strings.ToLower(strings.TrimSpace(parts[1]))
+		known := false
+		for _, a := range allowed {
+			known = known || value == a
 		}
-		subnetLevels[i], _ = strconv.Atoi(l)
+		if !known {
+			return nil, fmt.Errorf("unknown %s %q (expected one of %s)", what, parts[1], strings.Join(allowed, ", "))
+		}
+		values[level] = value
+	}
+	return values, nil
+}
+
+// formatLevelMap is the inverse of parseLevelMap.
+func formatLevelMap(values map[int]string) string {
+	levels := make([]int, 0, len(values))
+	for level := range values {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+	parts := make([]string, len(levels))
+	for i, level := range levels {
+		parts[i] = fmt.Sprintf("%d=%s", level, values[level])
 	}
-	return subnetLevels
+	return strings.Join(parts, ",")
 }
 
 func printHelp() {
 	fmt.Println(`IPv6 Address Planner - Help
-Usage: ipv6planner [flags]
+Usage: ipv6planner [plan] [flags]
+       ipv6planner <command> [arguments]
+
+Commands:
+  export       Write a saved plan as text, JSON, HTML, state-csv, Go,
+               Python or C constants, or Jinja template variables
+  render       Render a directory of plans into every format in parallel,
+               with an index page
+  import       Apply a state-csv file edited in a spreadsheet to a plan
+  edit         Edit a plan's parameters in $EDITOR and regenerate it
+  upgrade      Convert plan JSON files written by older releases in place
+  verify       Check the embedded checksum and signature of a plan JSON file
+  hosts        Lay out static host addressing inside /64 subnets
+  classify     Look up prefixes in the IANA special-purpose address registry
+  docgen       Write an address plan document (Markdown or HTML) from a plan JSON file
+  stats        Summarize allocated and free space in a plan JSON file
+  layout       Draw a plan's 128-bit address layout as text or SVG
+  history      Report utilization over time from saved plan snapshots
+  metrics      Export plan allocation counts as Prometheus metrics
+  delegated    List an organization's IPv6 blocks from an RIR delegated-extended file
+  peeringdb    Write an ASN's PeeringDB facilities as a -requirements file
+  validate     Check a saved plan's consistency and assignment policy
+  lint         Score a saved plan against a best-practice checklist
+  practice     Generate a planning exercise, or grade a plan against one
+  allocate     Claim a batch of free prefixes in a POP and record them in
+               the assignments CSV
+  reconcile    Report prefixes IPAM exports claim twice or describe
+               differently, and routes or interfaces none records
+  audit        Check assigned prefixes aggregate under the plan's POP blocks
+  watch        Re-read the RIB and router configurations periodically and
+               report prefixes in use that no assignment documents
+  probe        Ping a plan's loopbacks and gateways, or check a block is unused
+  router-config
+               Write interface addressing for POP turn-up (IOS-XE, Junos, EOS,
+               FRR with aggregates, prefix-lists and route-maps, or
+               OpenConfig JSON for gNMI)
+  render-configs
+               Render each vendor's templates from a templates directory
+               against a plan's POPs into configuration files
+  dns          Name loopbacks, links and LAN gateways and write or send
+               their AAAA and PTR records (zone file, nsupdate, RFC 2136)
+  reverse-zones
+               List the ip6.arpa zones to delegate for a plan or prefixes
+  inet6num     Write RIPE database inet6num objects for customer pools,
+               delegated blocks and assignments
+  view         Browse a plan read-only in a local web viewer with search
+               and address lookup
+  anonymize    Move a plan, or a document made from one, into a
+               documentation prefix for sharing
+  peering-lan  Plan peering LAN /64s and participant addressing for an
+               interconnection fabric
+  expand       Write addresses and prefixes in full, all 32 hex digits
+  compress     Write addresses and prefixes in RFC 5952 compressed form
+  range        Show the first and last address of prefixes
+  count        Count the /y subnets in a /x (count -from 48 -to 64)
+  random-subnet
+               Pick a random subnet of a given size inside a prefix
 
 Flags:
   -s string    Base IPv6 subnet (default "3fff::/20")
   -n int       Number of POPs (default 5)
-  -p int       Preferred subnet size per POP (default 36)
-  -l string    Comma-separated list of subnet levels (default "44,48,64")
+  -p string    Preferred subnet size per POP, e.g. 40 or /40 (default 36)
+  -auto-size   Use the largest POP size that fits the POP count instead of -p
+  -nibble      Round the automatic POP size to a nibble (4-bit) boundary
+  -growth-bits int
+               Reserve this many unused bits for future POPs (default 0)
+  -l string    Comma-separated list of subnet levels or start-end[:step]
+               ranges, e.g. 44,48-56:4,64 (default "44,48,64")
+  -explain     Add an Explanation section walking through the bits behind
+               the plan: the POP ID field, each level, nibble alignment and
+               the interface ID
+  -suggest-levels string
+               Print a nibble-aligned level hierarchy for the POP size down
+               to this end unit (e.g. 64 or 48), with the reason for each
+               level, instead of generating a plan
+  -c string    Load plan parameters from a JSON config file; other flags override it
+  -stdin       Read plan parameters as JSON from standard input, like -c; a
+               plan written with -j is also accepted and regenerated, so it
+               can be extended with e.g. a larger -n
   -t           Text output format (default)
   -j           JSON output format
   -k           HTML output format
+  -addressing string
+               Addressing method per level: slaac, dhcpv6 or static
+               (e.g. "64=slaac,127=static"); checked for combinations that
+               cannot work, such as SLAAC on anything but a /64
+  -roles string
+               What each level is handed out as: site, residential, business,
+               lan, p2p or loopback (e.g. "48=business,56=residential,64=lan")
+  -policy string
+               Profile the roles are checked against: bcp (RFC 6177 and
+               RIPE-690: /48 per site, /56 per residential customer),
+               generous (/48 for everyone) or none (default "bcp")
+  -with-ula    Also generate a ULA plan with the same POPs and levels and
+               show it side by side with the GUA plan
+  -ula-prefix string
+               ULA /48 to use with -with-ula (default: random Global ID)
+  -twin-doc-prefix string
+               Output a twin of the plan in 2001:db8::/32 or 3fff::/20
+               ("auto" picks 2001:db8::/32 when the base fits), numbered
+               the same below the base, for labs and documentation that
+               must not show the real prefixes
+  -requirements string
+               CSV or JSON file with per-POP demand (name, sites, vlans,
+               customers, links); sets the POP count and sizes the POPs
+               from the largest demand. Needs -roles to say which level
+               serves each column. Optional city, country, latitude and
+               longitude columns locate each POP on the HTML report's map
+  -reserve-ids string
+               POP IDs to keep out of automatic assignment, as hex values,
+               ranges, zero or ones (e.g. "zero,ones,10-1f,0a3"); they are
+               listed separately in the plan
+  -pop-codes string
+               Hex code per POP, by requirements name or POP number (e.g.
+               "ams=0a3,fra=0b1"), written into the POP ID digits instead of
+               the automatic number; needs nibble-aligned base and POP sizes
+  -base-plan string
+               A plan written earlier with -j whose POPs must keep their
+               prefixes: its parameters are the starting point, other flags
+               change them, and new POPs are numbered around the issued ones
+  -bundle string
+               Write a zip archive instead of printing: plan.json, each
+               format given with -t, -k or -j (text and HTML by default),
+               plan.schema.json and a SHA256SUMS file for sha256sum -c
+  -from-peeringdb string
+               Use the facilities where this ASN is present in PeeringDB as
+               the POPs, with their names, cities and coordinates
+  -delegated string
+  -delegated-org string
+               Find the IPv6 blocks an organization (ASN such as AS64500, or
+               the file's opaque ID) holds in an RIR delegated-extended
+               file. Interactive mode offers them as base subnets; otherwise
+               the only one is used when -s is not given
+  -pop-numbering string
+               How POPs without a code are numbered: index (default) or
+               locode, which derives each POP ID from a hash of the POP's
+               UN/LOCODE (or country and name) so a site keeps its prefix
+               when POPs are added, removed or reordered
+  -delegate string
+               Blocks handed to downstream organizations, by prefix length
+               (e.g. "acme=40,globex=44"); they are carved from the top of
+               the base, POPs are numbered around them, and -base-plan keeps
+               issued blocks in place
+  -within string
+               Plan inside the block a parent plan delegated, given as
+               parent.json:organization; the block becomes the base subnet
+  -split string
+               Divide each POP between pools by percentage of its prefixes
+               at the split level (e.g. "wholesale=25,retail=75"); a
+               <pool>_customers requirements column tracks each pool's use
+  -preset string
+               Plan the blocks an access network needs in each POP from
+               counts in -requirements, and default -l, -roles and
+               -addressing to suit it. mobile: a pool of /64s per UPF sized
+               from subscribers (PDU sessions) and upfs, plus N6 and roaming
+               /56s; cable: per CMTS, CM management /64s per node, CPE
+               /56 PD pools and MTA /64s, from cmts, nodes, subscribers
+               and mtas; ftth: per OLT, a /56 PD pool for every ONT its
+               pon_ports serve at split_ratio, plus management /64s, from
+               olts, pon_ports, split_ratio and optionally onts in use
+  -split-level int
+               Level -split divides (default: the first level with a
+               site, business or residential role)
+  -oob int     Give each POP an out-of-band management block of this size.
+               The blocks share one aggregate, carved from the top of the
+               base apart from production space and sized for every POP
+               the POP ID and growth bits can number
+  -oob-levels string
+               Subnet levels inside each management block (default "64")
+  -oob-networks string
+               Management networks of each POP, one prefix of the first
+               -oob-levels level each (default "console,bmc,jump-hosts")
+  -allow-sub64 Allow levels longer than /64 (e.g. /127 links, /128 loopbacks),
+               with warnings about what that means for SLAAC
+  -strict      Abort with an explanation and suggested parameters when the
+               plan is infeasible, instead of warning and continuing
+  -sort string Order of the POPs in the output: index (POP number),
+               prefix (address order) or name (default "index"); the same
+               parameters always give the same output
+  -offset int  Skip this many POPs (after -sort) in the output
+  -limit int   Show at most this many POPs; text and HTML output say how
+               many were left out (default 0, all)
+  -color string
+               Color text output: auto (when writing to a terminal and
+               NO_COLOR is unset), always or never (default "auto")
+  -lang string Language of text and HTML report headings: en, es, de or
+               ja (default "en"); notes and warnings stay in English
   -i           Interactive mode
+  -checksum    Embed a SHA-256 checksum in JSON output
+  -sign-key string
+               Sign JSON output with this SSH private key (implies -checksum)
+  -signer string
+               Principal recorded with the signature (e.g. noc@example.com)
   -h           Show this help message
 
 Examples:
@@ -134,74 +806,361 @@ Examples:
   Custom parameters with JSON output:
     ipv6planner -s 2001:db8::/32 -n 10 -p 40 -l 48,52,56,64 -j
 
+  Let the tool pick a nibble-aligned POP size:
+    ipv6planner -s 2001:db8::/32 -n 10 -auto-size -nibble -l 48,56,64
+
+  Learn how the plan's bits are laid out:
+    ipv6planner -s 2001:db8::/32 -n 10 -p 38 -l 44,48,56,64 -explain
+
+  Not sure which levels to use? Ask for a suggestion down to /64:
+    ipv6planner -s 2001:db8::/32 -p 36 -suggest-levels 64
+
+  Nibble-aligned levels from /44 to /64 as a range:
+    ipv6planner -s 2001:db8::/32 -n 10 -p 40 -l 44-64:4
+
+  Leave room to grow to 64 POPs (4 POP bits + 2 growth bits):
+    ipv6planner -s 2001:db8::/32 -n 10 -growth-bits 2 -auto-size -l 48,56,64
+
+  Carve /127 point-to-point links and /128 loopbacks below the /64s:
+    ipv6planner -l 48,64,127,128 -allow-sub64 -addressing 64=slaac,127=static
+
+  Check customer assignment sizes against RIPE-690:
+    ipv6planner -s 2001:db8::/32 -p 40 -l 48,60,64 -roles 48=business,60=residential,64=lan
+
+  GUA plan with a matching ULA plan:
+    ipv6planner -s 2001:db8::/48 -n 4 -p 52 -l 56,64 -with-ula
+
+  Lab twin of the production plan, numbered the same inside 2001:db8::/32:
+    ipv6planner -c plan-config.json -twin-doc-prefix auto -k > lab.html
+
   Interactive mode:
     ipv6planner -i
 
+  Re-run with parameters saved by interactive mode:
+    ipv6planner -c plan-config.json -j
+
   HTML output:
-    ipv6planner -k`)
-}
+    ipv6planner -k
 
-func getInteractiveInput() (string, int, int, []int) {
-	reader := bufio.NewReader(os.Stdin)
+  Parameters from another tool, or extend a saved plan to 8 POPs:
+    gen-params | ipv6planner plan -stdin -j
+    ipv6planner plan -stdin -n 8 -j < plan.json
 
-	fmt.Print("Enter base IPv6 subnet (default 3fff::/20): ")
-	subnet, _ := reader.ReadString('\n')
-	subnet = strings.TrimSpace(subnet)
-	if subnet == "" {
-		subnet = "3fff::/20"
-	}
+  Grow an issued plan to 8 POPs without moving any issued prefix:
+    ipv6planner -base-plan plan.json -n 8 -j
 
-	fmt.Print("Enter number of POPs (default 5): ")
-	popStr, _ := reader.ReadString('\n')
-	popStr = strings.TrimSpace(popStr)
-	popCount := 5
-	if popStr != "" {
-		popCount, _ = strconv.Atoi(popStr)
-	}
+  Mobile network with UPF pools sized from subscribers per POP:
+    ipv6planner -s 2001:db8::/32 -preset mobile -requirements pops.csv -nibble
 
-	fmt.Print("Enter preferred subnet size per POP (default /36): ")
-	sizeStr, _ := reader.ReadString('\n')
-	sizeStr = strings.TrimSpace(sizeStr)
-	preferredSize := 36
-	if sizeStr != "" {
-		if strings.HasPrefix(sizeStr, "/") {
-			sizeStr = sizeStr[1:]
-		}
-		preferredSize, _ = strconv.Atoi(sizeStr)
+  Cable network with CMTS pools sized from nodes and subscribers:
+    ipv6planner -s 2001:db8::/32 -preset cable -requirements hubs.csv -nibble
+
+  FTTH network with a PD pool per OLT:
+    ipv6planner -s 2001:db8::/32 -preset ftth -requirements olts.csv -nibble
+
+  Give wholesale partners a quarter of each POP's /56s:
+    ipv6planner -roles 56=residential -split wholesale=25,retail=75 -requirements pops.csv
+
+  Out-of-band management /52 per POP, with a /56 each for consoles, BMCs and jump hosts:
+    ipv6planner -s 2001:db8::/32 -n 8 -p 40 -oob 52 -oob-levels 56,64
+
+  Delegate a /36 to a customer, who then plans inside it:
+    ipv6planner -s 2001:db8::/32 -delegate acme=36 -j > parent.json
+    ipv6planner -within parent.json:acme -n 4 -p 40 -j > acme.json
+
+  Signed JSON output, checked by the recipient:
+    ipv6planner -j -sign-key ~/.ssh/id_ed25519 -signer noc@example.com > plan.json
+    ipv6planner verify -allowed-signers allowed_signers plan.json
+
+  Host address tables for the /64s of a saved plan:
+    ipv6planner hosts -plan plan.json
+    ipv6planner hosts -literals -j -plan plan.json
+
+  What is 2001:db8::/48 reserved for?
+    ipv6planner classify 2001:db8::/48
+
+  Address plan document with purposes and rules from meta.json:
+    ipv6planner docgen -meta meta.json -format html plan.json > plan.html
+
+  How much of the base is allocated:
+    ipv6planner stats plan.json
+
+  Bit-layout figure for a design document:
+    ipv6planner layout -format svg plan.json > layout.svg
+
+  Utilization of POP ams across quarterly snapshots, as a chart:
+    ipv6planner history -pop ams -format html plans/*.json > history.html
+
+  Claim 500 customer /48s in POP 3 for a provisioning run:
+    ipv6planner allocate -plan plan.json -assigned assigned.csv -pop 3 -count 500 -j
+
+  Reconcile two IPAM exports with the RIB and router configurations:
+    ipv6planner reconcile -plan plan.json -rib rib.json -configs r1.conf,r2.conf netbox.csv legacy.csv
+
+  Check an IPAM export against the plan:
+    ipv6planner audit -plan plan.json assigned.csv
+    ipv6planner audit -plan plan.json -rib rib.mrt.bz2
+
+  Report undocumented prefixes as they appear, to a webhook and Prometheus:
+    ipv6planner watch -plan plan.json -rib rib.mrt.bz2 -configs r1.conf -webhook https://hooks.example.net/ipam -metrics /var/lib/node_exporter/ipv6planner.prom assigned.csv
+
+  Enforce organizational rules:
+    ipv6planner -c plan-config.json -rules rules.json
+
+  Score a plan against the best-practice checklist:
+    ipv6planner lint -min-score 80 plan.json
+    ipv6planner lint -rules standards.json plan.json
+
+  Generate a training exercise and grade a trainee's plan:
+    ipv6planner practice -seed 42 -j > exercise.json
+    ipv6planner practice -grade exercise.json plan.json
+
+  Report plan checks as CI test results:
+    ipv6planner validate -format junit plan.json > validate.xml
+    ipv6planner audit -plan plan.json -format tap assigned.csv
+
+  Check turned-up POPs answer, and a block is free before using it:
+    sudo ipv6planner probe -plan plan.json -rate 5
+    sudo ipv6planner probe 2001:db8:1234::/48
+
+  Junos interface addressing for POP 3:
+    ipv6planner router-config -plan plan.json -platform junos -pop 3
+
+  FRR configuration for every POP:
+    ipv6planner router-config -plan plan.json -platform frr
+
+  Configurations for each POP from your own templates, one directory per vendor:
+    ipv6planner render-configs -plan plan.json -templates ./templates -o configs
+
+  ip6.arpa zones to delegate for each POP and level:
+    ipv6planner reverse-zones -plan plan.json
+
+  Create AAAA and PTR records for infrastructure addresses on the name server:
+    ipv6planner dns -plan plan.json -zone net.example.com -server ns1.example.com -key ipv6planner.key -dry-run
+    ipv6planner dns -plan plan.json -zone net.example.com -server ns1.example.com -key ipv6planner.key
+
+  RIPE database objects for customer pools and assignments:
+    ipv6planner inet6num -plan plan.json -mnt EXAMPLE-MNT -admin-c AB123-RIPE assigned.csv
+
+  Browse a plan in a web browser, read-only, for NOC staff:
+    ipv6planner view plan.json
+
+  Share a plan and its document with a vendor without the real prefix:
+    ipv6planner anonymize plan.json > shared.json
+    ipv6planner anonymize -plan plan.json plan.md > shared.md
+
+  Two peering LANs with ASN-derived participant addresses:
+    ipv6planner peering-lan -lans 2 -ids asn 2001:db8:ff00::/48 participants.csv
+
+  Prefix arithmetic:
+    ipv6planner expand 2001:db8::1
+    ipv6planner range 2001:db8:1200::/40
+    ipv6planner count -from 48 -to 64
+    ipv6planner random-subnet fd00::/8 48
+
+  Rename and locate POPs in bulk in a spreadsheet:
+    ipv6planner export -format state-csv plan.json > pops.csv
+    ipv6planner import -dry-run plan.json pops.csv
+    ipv6planner import -format state-csv plan.json pops.csv > updated.json
+
+  Plan prefixes as constants for application code:
+    ipv6planner export -format go -package netplan plan.json > netplan/plan.go
+
+  Plan variables for Ansible or other Jinja templates (ipv6plan['pop_03.site_12.lan_30']):
+    ipv6planner export -format jinja plan.json > group_vars/all/ipv6plan.json
+
+  Render every regional plan into text, JSON, HTML and CSV with an index page:
+    ipv6planner render -o site/ plans/
+
+  Change a plan's POPs, levels or counts in an editor:
+    EDITOR=nano ipv6planner edit plan.json
+
+  Upgrade a saved plan to the current format:
+    ipv6planner upgrade plan.json`)
+}
+
+// calculateAvailableSubnets returns 2^(child-parent). Below /64 this can
+// exceed any fixed-size integer, hence big.Int.
+func calculateAvailableSubnets(parentSize, childSize int) *big.Int {
+	if childSize <= parentSize {
+		return big.NewInt(0)
 	}
+	return new(big.Int).Lsh(big.NewInt(1), uint(childSize-parentSize))
+}
 
-	fmt.Print("Enter subnet levels (comma separated, default 44,48,64): ")
-	levelsStr, _ := reader.ReadString('\n')
-	levelsStr = strings.TrimSpace(levelsStr)
-	subnetLevels := []int{44, 48, 64}
-	if levelsStr != "" {
-		subnetLevels = parseSubnetLevels(levelsStr)
+// maxPOPCount is how many /popSize POPs a base of baseBits holds.
+func maxPOPCount(baseBits, popSize int) *big.Int {
+	if popSize == baseBits {
+		return big.NewInt(1)
 	}
+	return calculateAvailableSubnets(baseBits, popSize)
+}
 
-	return subnet, popCount, preferredSize, subnetLevels
+// checkPOPSize rejects POP sizes that cannot place popCount POPs inside a
+// base of baseBits: lengths outside 0-128, and POPs no longer than the base
+// unless a single POP takes all of it.
+func checkPOPSize(baseBits, popSize, popCount int) error {
+	if popSize < 0 || popSize > 128 {
+		return failf(ErrInvalidLevel, "POP size /%d is not a prefix length (expected 0-128)", popSize)
+	}
+	if popSize < baseBits || (popSize == baseBits && popCount > 1) {
+		return failf(ErrPrefixTooSmall, "POP size /%d is not longer than the /%d base; use -p %d or longer, or -auto-size", popSize, baseBits, baseBits+1)
+	}
+	return nil
 }
 
-func calculateAvailableSubnets(parentSize, childSize int) int64 {
-	if childSize <= parentSize {
+// popBits is the number of bits that number count POPs.
+func popBits(count int) int {
+	if count <= 1 {
 		return 0
 	}
-	return int64(1) << uint(childSize-parentSize)
+	return bits.Len(uint(count - 1))
 }
 
-func generateIPv6Plan(subnet string, popCount, preferredSize int, subnetLevels []int) IPv6Plan {
+// notIPv6Base explains why a prefix net.ParseCIDR reads as IPv4 cannot be
+// a plan base: it is an IPv4 prefix, or IPv4-mapped IPv6 space, which only
+// stands for IPv4 addresses inside a host and is never routed.
+func notIPv6Base(prefix string) error {
+	if p, err := netip.ParsePrefix(strings.TrimSpace(prefix)); err == nil && p.Addr().Is4In6() {
+		return failf(ErrInvalidPrefix, "%s is IPv4-mapped space (::ffff:0:0/96), which is not routable; use a global unicast or ULA prefix", prefix)
+	}
+	return failf(ErrInvalidPrefix, "%s is an IPv4 prefix", prefix)
+}
+
+func generateIPv6Plan(opts PlanOptions) (IPv6Plan, error) {
+	subnet := opts.Subnet
+	popCount := opts.POPCount
+	subnetLevels := opts.SubnetLevels
+
 	_, ipNet, err := net.ParseCIDR(subnet)
 	if err != nil {
-		fmt.Printf("Error parsing subnet: %v\n", err)
-		os.Exit(1)
+		return IPv6Plan{}, fmt.Errorf("parsing subnet: %v", err)
+	}
+
+	if ipNet.IP.To4() != nil {
+		return IPv6Plan{}, notIPv6Base(subnet)
 	}
 
 	ones, _ := ipNet.Mask.Size()
 
+	// Requirements fix the POP count and, below, the POP size
+	if len(opts.Requirements) > 0 {
+		popCount = len(opts.Requirements)
+	}
+	if popCount < 1 {
+		return IPv6Plan{}, errors.New("the plan needs at least one POP")
+	}
+
+	// Calculate how many bits we need for POP allocation
+	bitsNeeded := popBits(popCount)
+
+	// Growth bits sit between the POP bits in use today and the POP prefix,
+	// so the POP ID field can later number this many POPs
+	popFieldBits := bitsNeeded + opts.GrowthBits
+	if ones+popFieldBits > 128 {
+		return IPv6Plan{}, fmt.Errorf("%d POP bits plus %d growth bits do not fit after a /%d base", bitsNeeded, opts.GrowthBits, ones)
+	}
+
+	var notes []string
+	sizing, err := sizePOPs(opts, ones, popCount, bitsNeeded)
+	if err != nil {
+		return IPv6Plan{}, err
+	}
+	preferredSize := sizing.size
+	if sizing.note != "" {
+		notes = append(notes, sizing.note)
+	}
+
+	if err := checkPOPSize(ones, preferredSize, popCount); err != nil {
+		return IPv6Plan{}, err
+	}
+
+	if deep := sub64Levels(preferredSize, subnetLevels); len(deep) > 0 {
+		if !opts.AllowSub64 {
+			return IPv6Plan{}, fmt.Errorf("/%d is longer than /64; pass -allow-sub64 to plan below the /64 boundary", deep[0])
+		}
+		seen := make(map[int]bool)
+		for _, size := range deep {
+			if !seen[size] {
+				seen[size] = true
+				warning := "Warning: " + sub64Advisory(size)
+				fmt.Fprintln(os.Stderr, warning)
+				notes = append(notes, warning)
+			}
+		}
+	}
+
+	problems := checkFeasibility(opts, ones, popFieldBits, preferredSize)
+	addressingProblems, addressingNotes := checkAddressing(opts.Addressing, subnetLevels)
+	problems = append(problems, addressingProblems...)
+	notes = append(notes, addressingNotes...)
+	ruleWarnings, err := applyRules(opts, ones, preferredSize)
+	if err != nil {
+		return IPv6Plan{}, err
+	}
+	for _, warning := range ruleWarnings {
+		fmt.Fprintln(os.Stderr, warning)
+		notes = append(notes, warning)
+	}
+	if len(problems) > 0 {
+		if opts.Strict {
+			return IPv6Plan{}, infeasibleError(problems)
+		}
+		// Keep going, but make sure the warnings travel with the plan
+		for _, p := range problems {
+			warning := "Warning: " + p.problem
+			if p.suggestion != "" {
+				warning += " (" + p.suggestion + ")"
+			}
+			fmt.Fprintln(os.Stderr, warning)
+			notes = append(notes, warning)
+		}
+	}
+
+	// Pools divide each POP at one level, so pool demand can be tracked
+	// separately
+	poolLevel, err := checkSplit(opts, preferredSize)
+	if err != nil {
+		return IPv6Plan{}, err
+	}
+
+	// Delegated blocks and the management aggregate come off the top of
+	// the base, clear of every POP
+	basePrefix, _ := netip.ParsePrefix(ipNet.String())
+	delegations, delegatedIDs, oob, err := placeBlocks(opts, basePrefix, preferredSize, popCount)
+	if err != nil {
+		return IPv6Plan{}, err
+	}
+
+	// POPs with a chosen code or an issued ID keep it; the rest are
+	// numbered around them and the reserved IDs
+	ids, err := assignPOPIDs(opts, basePrefix, preferredSize, popCount, delegations, delegatedIDs)
+	if err != nil {
+		return IPv6Plan{}, err
+	}
+	notes = append(notes, ids.notes...)
+	popIndexes := ids.indexes
+
 	plan := IPv6Plan{
+		SchemaVersion: currentSchemaVersion,
 		BaseSubnet:    subnet,
+		BaseClass:     baseClass(ipNet),
 		POPCount:      popCount,
 		PreferredSize: preferredSize,
 		SubnetLevels:  subnetLevels,
+		GrowthBits:    opts.GrowthBits,
+		MaxPOPCount:   maxPOPCount(ones, preferredSize),
+		ReservedIDs:   ids.reserved,
+		Delegations:   delegations,
+		DelegatedFrom: opts.DelegatedFrom,
+		Preset:        opts.Preset,
+		Policy:        opts.Policy,
+		Rules:         opts.Rules,
+		OOB:           oob,
+		Notes:         notes,
+	}
+	if ids.hashed {
+		plan.POPNumbering = numberByLOCODE
 	}
 
 	// Calculate subnet counts for each level
@@ -217,29 +1176,25 @@ func generateIPv6Plan(subnet string, popCount, preferredSize int, subnetLevels [
 		})
 	}
 
-	// Calculate how many bits we need for POP allocation
-	bitsNeeded := 0
-	for (1 << bitsNeeded) < popCount {
-		bitsNeeded++
-	}
-
-	// Calculate the new prefix length for POP allocations
-	newPrefixLen := ones + bitsNeeded
-	if newPrefixLen > preferredSize {
-		fmt.Printf("Warning: Required prefix length %d is larger than preferred size %d\n", newPrefixLen, preferredSize)
-	}
-
 	// Generate POP allocations
 	for i := 0; i < popCount; i++ {
 		popIP := make(net.IP, len(ipNet.IP))
 		copy(popIP, ipNet.IP)
 
 		// Set the POP bits
-		for bit := 0; bit < bitsNeeded; bit++ {
-			byteIndex := (ones + bit) / 8
-			bitIndex := 7 - (ones+bit)%8
-			if (i>>bit)&1 == 1 {
-				popIP[byteIndex] |= 1 << bitIndex
+		code, coded := ids.codes[i]
+		if coded {
+			addr := addrAdd(basePrefix.Addr(), new(big.Int).Lsh(code, uint(128-preferredSize))).As16()
+			copy(popIP, addr[:])
+		} else {
+			id := popIndexes[0]
+			popIndexes = popIndexes[1:]
+			for bit := 0; bit < ids.bits; bit++ {
+				byteIndex := (ones + bit) / 8
+				bitIndex := 7 - (ones+bit)%8
+				if (id>>bit)&1 == 1 {
+					popIP[byteIndex] |= 1 << bitIndex
+				}
 			}
 		}
 
@@ -251,11 +1206,10 @@ func generateIPv6Plan(subnet string, popCount, preferredSize int, subnetLevels [
 
 		// Generate subnets for this POP
 		var subnets []SubnetDetail
-		levelNames := make([]string, len(subnetLevels))
+		var levelNames []string
 
 		for j, level := range subnetLevels {
 			if level <= preferredSize {
-				fmt.Printf("Warning: Subnet level %d is not more specific than POP size %d\n", level, preferredSize)
 				continue
 			}
 
@@ -268,131 +1222,544 @@ func generateIPv6Plan(subnet string, popCount, preferredSize int, subnetLevels [
 			subnet := &net.IPNet{IP: subnetIP, Mask: net.CIDRMask(level, 128)}
 
 			subnets = append(subnets, SubnetDetail{
-				CIDR:      subnet.String(),
-				Count:     available,
-				Available: available,
+				CIDR:       subnet.String(),
+				Count:      available,
+				Available:  available,
+				Role:       opts.Roles[level],
+				Addressing: opts.Addressing[level],
 			})
-			levelNames[j] = fmt.Sprintf("Level %d (/%d)", j+1, level)
+			levelNames = append(levelNames, fmt.Sprintf("Level %d (/%d)", j+1, level))
 		}
 
-		plan.POPAllocations = append(plan.POPAllocations, POPAlloc{
+		alloc := POPAlloc{
 			POPNumber:  i + 1,
 			POPSubnet:  popSubnet.String(),
 			Subnets:    subnets,
 			LevelNames: levelNames,
-		})
+		}
+		if ids.chosen[i] {
+			alloc.Code = fmt.Sprintf("%0*x", (preferredSize-ones)/4, code)
+		}
+		if len(opts.Requirements) > 0 {
+			alloc.Name = opts.Requirements[i].Name
+			alloc.Location = opts.Requirements[i].Location()
+		}
+		if sizing.demands != nil {
+			alloc.RequiredSize = sizing.required[i]
+			for _, d := range sizing.demands[i] {
+				d.Available = calculateAvailableSubnets(preferredSize, d.PrefixSize)
+				alloc.Demand = append(alloc.Demand, d)
+			}
+		}
+		if sizing.blocks != nil {
+			alloc.Pools = layoutPreset(netip.MustParsePrefix(alloc.POPSubnet), sizing.blocks[i])
+			alloc.Counts = opts.Requirements[i].Counts
+		}
+		if len(opts.Split) > 0 {
+			var poolDemand map[string]int
+			if len(opts.Requirements) > 0 {
+				poolDemand = opts.Requirements[i].PoolCustomers
+			}
+			alloc.Pools, err = splitPOP(netip.MustParsePrefix(alloc.POPSubnet), poolLevel, opts.Split, poolDemand)
+			if err != nil {
+				return IPv6Plan{}, err
+			}
+			for _, pool := range alloc.Pools {
+				if big.NewInt(int64(pool.Required)).Cmp(pool.Capacity) > 0 {
+					warning := fmt.Sprintf("Warning: the %s pool of %s needs %d /%ds but holds %s", pool.Name, popName(alloc), pool.Required, pool.PrefixSize, pool.Capacity)
+					fmt.Fprintln(os.Stderr, warning)
+					plan.Notes = append(plan.Notes, warning)
+				}
+			}
+		}
+		if oob != nil {
+			alloc.OOB, err = layoutOOB(netip.MustParsePrefix(oob.Aggregate), alloc.POPNumber, oob)
+			if err != nil {
+				return IPv6Plan{}, err
+			}
+		}
+		plan.POPAllocations = append(plan.POPAllocations, alloc)
 	}
 
-	return plan
+	return plan, nil
 }
 
-func outputText(plan IPv6Plan) {
-	fmt.Printf("This tool is not intended to provide a comprehensive address plan.\n")
-	fmt.Printf("It should be used to generate a top level heirarchy of IPv6 address plans.\n")
-	fmt.Printf("IPv6 Address Plan\n")
-	fmt.Printf("Base Subnet: %s\n", plan.BaseSubnet)
-	fmt.Printf("Number of POPs: %d\n", plan.POPCount)
-	fmt.Printf("Preferred POP subnet size: /%d\n", plan.PreferredSize)
-	fmt.Printf("Subnet levels: /%v\n", plan.SubnetLevels)
+func writeText(w io.Writer, plan IPv6Plan, c palette, m messages) error {
+	fmt.Fprintln(w, m.T("This tool is not intended to provide a comprehensive address plan."))
+	fmt.Fprintln(w, m.T("It should be used to generate a top level heirarchy of IPv6 address plans."))
+	fmt.Fprintln(w, c.paint(ansiBold, m.T("IPv6 Address Plan")))
+
+	base := c.paint(ansiGreen, plan.BaseSubnet)
+	if plan.BaseClass != nil {
+		base += fmt.Sprintf(" (%s)", plan.BaseClass)
+	}
+	header := [][2]string{
+		{m.T("Base Subnet"), base},
+		{m.T("Number of POPs"), fmt.Sprint(plan.POPCount)},
+		{m.T("Preferred POP subnet size"), fmt.Sprintf("/%d", plan.PreferredSize)},
+	}
+	if plan.GrowthBits > 0 {
+		header = append(header, [2]string{m.T("Growth bits reserved"), fmt.Sprint(plan.GrowthBits)})
+	}
+	header = append(header,
+		[2]string{m.T("Maximum POP count"), plan.MaxPOPCount.String()},
+		[2]string{m.T("Subnet levels"), fmt.Sprintf("/%v", plan.SubnetLevels)})
+	if plan.ULAPlan != nil {
+		header = append(header, [2]string{m.T("ULA Base Subnet"), c.paint(ansiGreen, plan.ULAPlan.BaseSubnet)})
+	}
+	if from := plan.DelegatedFrom; from != nil {
+		header = append(header, [2]string{m.T("Delegated from"), from.Organization + " @ " + from.ParentBase})
+	}
+	width := 0
+	for _, h := range header {
+		if w := displayWidth(h[0]); w > width {
+			width = w
+		}
+	}
+	for _, h := range header {
+		fmt.Fprintf(w, "%s %s\n", padRight(h[0]+":", width+1), h[1])
+	}
+
+	notes := plan.Notes
+	if plan.ULAPlan != nil {
+		notes = append(append([]string(nil), notes...), plan.ULAPlan.Notes...)
+	}
+	if len(notes) > 0 {
+		fmt.Fprintln(w, "\n"+c.paint(ansiBold, m.T("Notes")+":"))
+		for _, note := range notes {
+			if strings.HasPrefix(note, "Warning:") {
+				note = c.paint(ansiYellow, note)
+			}
+			fmt.Fprintf(w, "  %s\n", note)
+		}
+	}
+
+	if len(plan.Explanation) > 0 {
+		fmt.Fprintln(w, "\n"+c.paint(ansiBold, m.T("Explanation")+":"))
+		for _, line := range plan.Explanation {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
 
-	fmt.Println("\nGlobal Subnet Counts:")
+	fmt.Fprintln(w, "\n"+c.paint(ansiBold, m.T("Global Subnet Counts")+":"))
+	countWidth := 0
+	for _, count := range plan.SubnetCounts {
+		if n := len(count.Available.String()); n > countWidth {
+			countWidth = n
+		}
+	}
 	for _, count := range plan.SubnetCounts {
-		fmt.Printf("  /%d: %d available subnets\n", count.PrefixSize, count.Available)
+		fmt.Fprintf(w, "  %-5s %*s %s\n", fmt.Sprintf("/%d:", count.PrefixSize), countWidth, count.Available, m.T("available subnets"))
 	}
 
-	fmt.Println("\nPOP Allocations:")
-	for _, pop := range plan.POPAllocations {
-		fmt.Printf("\nPOP %d: %s\n", pop.POPNumber, pop.POPSubnet)
+	// Levels are indented by depth; the name and subnet columns are padded
+	// to the widest entry so subnets and details line up across POPs.
+	nameWidth, cidrWidth := 0, 0
+	for p, pop := range plan.POPAllocations {
 		for i, subnet := range pop.Subnets {
-			fmt.Printf("  %s: %s (Available: %d)\n", pop.LevelNames[i], subnet.CIDR, subnet.Available)
+			if n := 2*i + displayWidth(m.LevelName(pop.LevelNames[i])) + 1; n > nameWidth {
+				nameWidth = n
+			}
+			cidr := subnet.CIDR
+			if ula := plan.ULASubnet(p, i); ula != "" {
+				cidr += " | ULA " + ula
+			}
+			if len(cidr) > cidrWidth {
+				cidrWidth = len(cidr)
+			}
 		}
 	}
+
+	if len(plan.ReservedIDs) > 0 {
+		fmt.Fprintln(w, "\n"+c.paint(ansiBold, m.T("Reserved POP IDs")+":"))
+		idWidth := 0
+		for _, r := range plan.ReservedIDs {
+			if len(r.ID) > idWidth {
+				idWidth = len(r.ID)
+			}
+		}
+		for _, r := range plan.ReservedIDs {
+			line := fmt.Sprintf("  %-*s %s", idWidth, r.ID, c.paint(ansiGreen, r.Prefix))
+			if r.Count.Cmp(big.NewInt(1)) > 0 {
+				line += fmt.Sprintf(" (%s /%ds)", r.Count, plan.PreferredSize)
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+
+	if len(plan.Delegations) > 0 {
+		fmt.Fprintln(w, "\n"+c.paint(ansiBold, m.T("Delegated Blocks")+":"))
+		orgWidth := 0
+		for _, block := range plan.Delegations {
+			if n := displayWidth(block.Organization); n > orgWidth {
+				orgWidth = n
+			}
+		}
+		for _, block := range plan.Delegations {
+			fmt.Fprintf(w, "  %s %s\n", padRight(block.Organization, orgWidth), c.paint(ansiGreen, block.Prefix))
+		}
+	}
+
+	if oob := plan.OOB; oob != nil {
+		fmt.Fprintln(w, "\n"+c.paint(ansiBold, m.T("Out-of-band Management")+":"))
+		fmt.Fprintf(w, "  %s: %s\n", m.T("Aggregate"), c.paint(ansiGreen, oob.Aggregate))
+		fmt.Fprintf(w, "  %s: /%d\n", m.T("Block per POP"), oob.POPSize)
+		fmt.Fprintf(w, "  %s: /%v\n", m.T("Subnet levels"), oob.Levels)
+	}
+
+	fmt.Fprintln(w, "\n"+c.paint(ansiBold, m.T("POP Allocations")+":"))
+	if before := plan.PagingBefore(); before != "" {
+		fmt.Fprintf(w, "  %s\n", c.paint(ansiDim, before))
+	}
+	for p, pop := range plan.POPAllocations {
+		title := c.paint(ansiCyan+";"+ansiBold, popName(pop)+":")
+		code := ""
+		if pop.Code != "" {
+			code = c.paint(ansiDim, " (code "+pop.Code+")")
+		}
+		if ula := plan.ULAPOP(p); ula != "" {
+			fmt.Fprintf(w, "\n%s %s | ULA %s%s\n", title, c.paint(ansiGreen, pop.POPSubnet), c.paint(ansiGreen, ula), code)
+		} else {
+			fmt.Fprintf(w, "\n%s %s%s\n", title, c.paint(ansiGreen, pop.POPSubnet), code)
+		}
+		for i, subnet := range pop.Subnets {
+			cidr := subnet.CIDR
+			if ula := plan.ULASubnet(p, i); ula != "" {
+				cidr += " | ULA " + ula
+			}
+			details := []string{fmt.Sprintf("%s: %d", m.T("Available"), subnet.Available)}
+			if subnet.Role != "" {
+				details = append(details, m.T("Role")+": "+subnet.Role)
+			}
+			if subnet.Addressing != "" {
+				details = append(details, m.T("Addressing")+": "+subnet.Addressing)
+			}
+			indent := strings.Repeat("  ", i+1)
+			name := padRight(m.LevelName(pop.LevelNames[i])+":", nameWidth-2*i)
+			fmt.Fprintf(w, "%s%s %s (%s)\n", indent, name, c.paint(ansiGreen, fmt.Sprintf("%-*s", cidrWidth, cidr)), c.paint(ansiDim, strings.Join(details, ", ")))
+		}
+		if len(pop.Demand) > 0 {
+			fmt.Fprintf(w, "  %s: %s\n", m.T("Demand"), pop.DemandSummary())
+		}
+		if len(pop.Pools) > 0 {
+			fmt.Fprintf(w, "  %s:\n", m.T("Pools"))
+			for _, pool := range pop.Pools {
+				fmt.Fprintf(w, "    %s: %s %s\n", pool.Name, c.paint(ansiGreen, strings.Join(pool.Prefixes, " ")), c.paint(ansiDim, "("+pool.Summary()+")"))
+			}
+			if left := pop.Unsplit(); left.Sign() > 0 {
+				fmt.Fprintf(w, "    %s: %s /%ds\n", m.T("Unsplit"), left, pop.Pools[0].PrefixSize)
+			}
+		}
+		if pop.OOB != nil {
+			fmt.Fprintf(w, "  %s: %s\n", m.T("Management"), c.paint(ansiGreen, pop.OOB.Prefix))
+			for _, network := range pop.OOB.Networks {
+				fmt.Fprintf(w, "    %s: %s\n", network.Name, c.paint(ansiGreen, network.Prefix))
+			}
+		}
+		if pop.Location != nil {
+			fmt.Fprintf(w, "  %s: %s\n", m.T("Location"), pop.Location)
+		}
+	}
+	if after := plan.PagingAfter(); after != "" {
+		fmt.Fprintf(w, "\n%s\n", c.paint(ansiDim, after))
+	}
+	return nil
 }
 
-func outputJSON(plan IPv6Plan) {
+func writeJSON(w io.Writer, plan IPv6Plan) error {
 	jsonData, err := json.MarshalIndent(plan, "", "  ")
 	if err != nil {
-		fmt.Printf("Error generating JSON: %v\n", err)
-		os.Exit(1)
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(jsonData))
+	return err
+}
+
+// writeEncryptedJSON writes the JSON plan encrypted with age. The checksum
+// and signature, if any, are inside the encrypted document.
+func writeEncryptedJSON(w io.Writer, plan IPv6Plan, recipients string) error {
+	jsonData, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptAge(append(jsonData, '\n'), recipients)
+	if err != nil {
+		return fmt.Errorf("encrypting plan: %w", err)
 	}
-	fmt.Println(string(jsonData))
+	_, err = w.Write(encrypted)
+	return err
 }
 
-func outputHTML(plan IPv6Plan) {
+func writeHTML(w io.Writer, plan IPv6Plan, m messages, lang string, theme htmlTheme) error {
 	const tpl = `
 <!DOCTYPE html>
-<html>
+<html lang="{{Lang}}">
 <head>
-    <title>IPv6 Address Plan</title>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{Title}}</title>
     <style>
-        body { font-family: Arial, sans-serif; margin: 20px; }
-        h1 { color: #333; }
+        :root {
+            --background: #fff; --text: #000; --heading: #333; --muted: #595959;
+            --border: #ddd; --header-background: #f2f2f2; --pop-background: #e6f7ff;
+        }
+        body { font-family: Arial, sans-serif; margin: 20px; background-color: var(--background); color: var(--text); }
+        h1 { color: var(--heading); }
+        .logo { max-height: 60px; float: right; }
         table { border-collapse: collapse; width: 100%; margin-bottom: 20px; }
-        th, td { border: 1px solid #ddd; padding: 8px; text-align: left; }
-        th { background-color: #f2f2f2; }
+        caption { text-align: left; font-weight: bold; padding: 4px 0; }
+        th, td { border: 1px solid var(--border); padding: 8px; text-align: left; }
+        th { background-color: var(--header-background); }
+        tbody th { font-weight: normal; }
         .pop { margin-bottom: 30px; }
-        .pop-header { background-color: #e6f7ff; padding: 10px; margin-bottom: 10px; }
-        .count { color: #666; font-size: 0.9em; }
+        .pop-header { background-color: var(--pop-background); padding: 10px; margin: 0 0 10px; font-size: 1em; }
+        .count { color: var(--muted); font-size: 0.9em; }
+        .util { display: flex; align-items: center; gap: 10px; margin: 4px 0; }
+        .util-label { width: 180px; }
+        .bar { display: flex; width: 300px; height: 14px; background-color: #eee; border: 1px solid #ccc; }
+        .bar span { height: 100%; }
+        .reserved { background-color: #b0b0b0; }
+        .heat-cool { background-color: #5cb85c; }
+        .heat-warm { background-color: #f0ad4e; }
+        .heat-hot { background-color: #d9534f; }
+        .pop-header.heat-hot { border-left: 6px solid #d9534f; }
+        .pop-header.heat-warm { border-left: 6px solid #f0ad4e; }
+        .map { width: 100%; max-width: 720px; height: auto; }
+        .visually-hidden { position: absolute; width: 1px; height: 1px; overflow: hidden; clip: rect(0 0 0 0); white-space: nowrap; }
+        @media print {
+            @page { margin: 15mm; }
+            body { margin: 0; font-size: 10pt; background-color: #fff; color: #000; }
+            .pop { break-before: page; page-break-before: always; }
+            .pop-header, h2, h3 { break-after: avoid; page-break-after: avoid; }
+            thead { display: table-header-group; }
+            tr, .util { break-inside: avoid; page-break-inside: avoid; }
+            .bar, .pop-header, th { -webkit-print-color-adjust: exact; print-color-adjust: exact; }
+        }
     </style>
+    {{with (Theme).CSS}}<style>
+{{.}}
+    </style>{{end}}
 </head>
 <body>
-    <h1>IPv6 Address Plan</h1>
+    <header>
+        {{with (Theme).Logo}}<img class="logo" src="{{.}}" alt="{{Title}}">{{end}}
+        <h1>{{Title}}</h1>
+    </header>
+    <main>
     <table>
-        <tr><th>Base Subnet</th><td>{{.BaseSubnet}}</td></tr>
-        <tr><th>Number of POPs</th><td>{{.POPCount}}</td></tr>
-        <tr><th>Preferred POP subnet size</th><td>/{{.PreferredSize}}</td></tr>
-        <tr><th>Subnet levels</th><td>{{range .SubnetLevels}}/{{.}} {{end}}</td></tr>
+        <caption class="visually-hidden">{{T "Summary"}}</caption>
+        <tbody>
+            <tr><th scope="row">{{T "Base Subnet"}}</th><td>{{.BaseSubnet}}{{with .BaseClass}} ({{.}}){{end}}</td></tr>
+            <tr><th scope="row">{{T "Number of POPs"}}</th><td>{{.POPCount}}</td></tr>
+            <tr><th scope="row">{{T "Preferred POP subnet size"}}</th><td>/{{.PreferredSize}}</td></tr>
+            {{if .GrowthBits}}<tr><th scope="row">{{T "Growth bits reserved"}}</th><td>{{.GrowthBits}}</td></tr>{{end}}
+            <tr><th scope="row">{{T "Maximum POP count"}}</th><td>{{.MaxPOPCount}}</td></tr>
+            <tr><th scope="row">{{T "Subnet levels"}}</th><td>{{range .SubnetLevels}}/{{.}} {{end}}</td></tr>
+            {{with .ULAPlan}}<tr><th scope="row">{{T "ULA Base Subnet"}}</th><td>{{.BaseSubnet}}</td></tr>{{end}}
+            {{with .DelegatedFrom}}<tr><th scope="row">{{T "Delegated from"}}</th><td>{{.Organization}} @ {{.ParentBase}}</td></tr>{{end}}
+        </tbody>
     </table>
 
-    <h2>Global Subnet Counts</h2>
-    <table>
-        <tr>
-            <th>Prefix Size</th>
-            <th>Available Subnets</th>
-        </tr>
-        {{range .SubnetCounts}}
-        <tr>
-            <td>/{{.PrefixSize}}</td>
-            <td>{{.Available}}</td>
-        </tr>
-        {{end}}
-    </table>
+    <section aria-labelledby="utilization">
+        <h2 id="utilization">{{T "Utilization"}}</h2>
+        {{template "bar" .POPSlotUtilization}}
+    </section>
+    {{if or .Notes (and .ULAPlan .ULAPlan.Notes)}}
+    <section aria-labelledby="notes">
+        <h2 id="notes">{{T "Notes"}}</h2>
+        <ul>
+            {{range .Notes}}<li>{{.}}</li>
+            {{end}}
+            {{with .ULAPlan}}{{range .Notes}}<li>{{.}}</li>
+            {{end}}{{end}}
+        </ul>
+    </section>
+    {{end}}
 
-    <h2>POP Allocations</h2>
-    {{range .POPAllocations}}
-    <div class="pop">
-        <div class="pop-header">
-            <strong>POP {{.POPNumber}}:</strong> {{.POPSubnet}}
-        </div>
+    {{with .Explanation}}
+    <section aria-labelledby="explanation">
+        <h2 id="explanation">{{T "Explanation"}}</h2>
+        <ol>
+            {{range .}}<li>{{.}}</li>
+            {{end}}
+        </ol>
+    </section>
+    {{end}}
+
+    {{with .ReservedIDs}}
+    <section aria-labelledby="reserved-ids">
+        <h2 id="reserved-ids">{{T "Reserved POP IDs"}}</h2>
+        <table>
+            <thead>
+                <tr>
+                    <th scope="col">ID</th>
+                    <th scope="col">{{T "Subnet"}}</th>
+                    <th scope="col">{{T "Count"}}</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{range .}}
+                <tr>
+                    <th scope="row">{{.ID}}</th>
+                    <td>{{.Prefix}}</td>
+                    <td>{{.Count}}</td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+    </section>
+    {{end}}
+
+    {{with .Delegations}}
+    <section aria-labelledby="delegations">
+        <h2 id="delegations">{{T "Delegated Blocks"}}</h2>
         <table>
-            <tr>
-                <th>Level</th>
-                <th>Subnet</th>
-                <th>Available</th>
-            </tr>
-            {{range $index, $subnet := .Subnets}}
-            <tr>
-                <td>{{index $.POPAllocations $index "LevelNames"}}</td>
-                <td>{{$subnet.CIDR}}</td>
-                <td>{{$subnet.Available}}</td>
-            </tr>
+            <thead>
+                <tr>
+                    <th scope="col">{{T "Organization"}}</th>
+                    <th scope="col">{{T "Subnet"}}</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{range .}}
+                <tr>
+                    <th scope="row">{{.Organization}}</th>
+                    <td>{{.Prefix}}</td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+    </section>
+    {{end}}
+
+    {{with .OOB}}
+    <section aria-labelledby="oob">
+        <h2 id="oob">{{T "Out-of-band Management"}}</h2>
+        <table>
+            <tbody>
+                <tr><th scope="row">{{T "Aggregate"}}</th><td>{{.Aggregate}}</td></tr>
+                <tr><th scope="row">{{T "Block per POP"}}</th><td>/{{.POPSize}}</td></tr>
+                <tr><th scope="row">{{T "Subnet levels"}}</th><td>{{range .Levels}}/{{.}} {{end}}</td></tr>
+            </tbody>
+        </table>
+    </section>
+    {{end}}
+
+    <section aria-labelledby="subnet-counts">
+        <h2 id="subnet-counts">{{T "Global Subnet Counts"}}</h2>
+        <table>
+            <thead>
+                <tr>
+                    <th scope="col">{{T "Prefix Size"}}</th>
+                    <th scope="col">{{T "Available Subnets"}}</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{range .SubnetCounts}}
+                <tr>
+                    <th scope="row">/{{.PrefixSize}}</th>
+                    <td>{{.Available}}</td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+    </section>
+
+    {{with .MapPoints}}
+    <section aria-labelledby="map">
+        <h2 id="map">{{T "Map"}}</h2>
+        <svg class="map" viewBox="0 0 720 360" role="img" aria-labelledby="map">
+            <rect width="720" height="360" style="fill: var(--pop-background); stroke: var(--border)"/>
+            {{range Graticule}}<line x1="{{.X1}}" y1="{{.Y1}}" x2="{{.X2}}" y2="{{.Y2}}" style="stroke: var(--border)"/>
+            {{end}}
+            {{range .}}<g>
+                <title>{{.Label}}: {{.Prefix}}, {{.Where}}</title>
+                <circle cx="{{printf "%.1f" .X}}" cy="{{printf "%.1f" .Y}}" r="4" fill="#d9534f" stroke="#333"/>
+                <text x="{{printf "%.1f" .X}}" y="{{printf "%.1f" .Y}}" dx="6" dy="-6" font-size="10">{{.Label}} {{.Prefix}}</text>
+            </g>
             {{end}}
+        </svg>
+    </section>
+    {{end}}
+
+    <h2>{{T "POP Allocations"}}</h2>
+    {{with .PagingBefore}}<p class="count">{{.}}</p>{{end}}
+    {{range $p, $pop := .POPAllocations}}
+    <section class="pop" aria-labelledby="pop-{{.POPNumber}}">
+        <h3 id="pop-{{.POPNumber}}" class="pop-header {{.Hottest}}">
+            <strong>{{.Label}}:</strong> {{.POPSubnet}}{{with $.ULAPOP $p}} | ULA {{.}}{{end}}{{with .Code}} <span class="count">(code {{.}})</span>{{end}}
+        </h3>
+        <table>
+            <caption class="visually-hidden">{{.Label}}</caption>
+            <thead>
+                <tr>
+                    <th scope="col">{{T "Level"}}</th>
+                    <th scope="col">{{T "Subnet"}}</th>
+                    {{if $.ULAPlan}}<th scope="col">{{T "ULA Subnet"}}</th>{{end}}
+                    <th scope="col">{{T "Available"}}</th>
+                    <th scope="col">{{T "Role"}}</th>
+                    <th scope="col">{{T "Addressing"}}</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{range $index, $subnet := .Subnets}}
+                <tr>
+                    <th scope="row">{{LevelName (index $pop.LevelNames $index)}}</th>
+                    <td>{{$subnet.CIDR}}</td>
+                    {{if $.ULAPlan}}<td>{{$.ULASubnet $p $index}}</td>{{end}}
+                    <td>{{$subnet.Available}}</td>
+                    <td>{{$subnet.Role}}</td>
+                    <td>{{$subnet.Addressing}}</td>
+                </tr>
+                {{end}}
+            </tbody>
         </table>
-    </div>
+        {{with .Demand}}<p class="count">{{T "Demand"}}: {{$pop.DemandSummary}}</p>{{end}}
+        {{with .Pools}}<p class="count">{{T "Pools"}}:</p>
+        <ul>
+            {{range .}}<li>{{.Name}}: <code>{{join .Prefixes " "}}</code> ({{.Summary}})</li>
+            {{end}}{{with $pop.Unsplit}}{{if .Sign}}<li>{{T "Unsplit"}}: {{.}} /{{(index $pop.Pools 0).PrefixSize}}s</li>{{end}}{{end}}
+        </ul>{{end}}
+        {{with .OOB}}<p class="count">{{T "Management"}}: <code>{{.Prefix}}</code></p>
+        <ul>
+            {{range .Networks}}<li>{{.Name}}: <code>{{.Prefix}}</code></li>
+            {{end}}
+        </ul>{{end}}
+        {{with .Location}}<p class="count">{{T "Location"}}: {{.}}</p>{{end}}
+        {{range .Utilization}}{{template "bar" .}}{{end}}
+    </section>
     {{end}}
+    {{with .PagingAfter}}<p class="count">{{.}}</p>{{end}}
+    </main>
 </body>
 </html>
+{{define "bar"}}<div class="util">
+        <span class="util-label">{{.Label}}</span>
+        <div class="bar" aria-hidden="true" title="{{.Allocated}} {{T "allocated"}}, {{.Reserved}} {{T "reserved"}}, {{.Free}} {{T "free"}}">
+            <span class="{{.Heat}}" style="width: {{.AllocatedPercent}}%"></span><span class="reserved" style="width: {{.ReservedPercent}}%"></span>
+        </div>
+        <span class="count">{{.AllocatedPercent}}% {{T "allocated"}}{{if .Reserved.Sign}}, {{.ReservedPercent}}% {{T "reserved"}}{{end}}</span>
+    </div>
+{{end}}
 `
 
-	tmpl, err := template.New("plan").Parse(tpl)
-	if err != nil {
-		fmt.Printf("Error creating HTML template: %v\n", err)
-		os.Exit(1)
+	funcs := template.FuncMap{
+		"T":         m.T,
+		"LevelName": m.LevelName,
+		"Lang":      func() string { return lang },
+		"Theme":     func() htmlTheme { return theme },
+		"Graticule": mapGraticule,
+		"join":      strings.Join,
+		"Title": func() string {
+			if theme.Title != "" {
+				return theme.Title
+			}
+			return m.T("IPv6 Address Plan")
+		},
 	}
-
-	err = tmpl.Execute(os.Stdout, plan)
+	tmpl, err := template.New("plan").Funcs(funcs).Parse(tpl)
 	if err != nil {
-		fmt.Printf("Error generating HTML: %v\n", err)
-		os.Exit(1)
+		return err
 	}
+	return tmpl.Execute(w, plan)
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func FuzzParsePrefixLength(f *testing.F) {
+	for _, seed := range []string{"48", "/64", " 128", "0", "-5", "200", "", "/", "4x", "99999999999999999999"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		n, err := parsePrefixLength(s)
+		if err != nil {
+			return
+		}
+		if n < 0 || n > 128 {
+			t.Fatalf("parsePrefixLength(%q) = %d, outside 0-128", s, n)
+		}
+	})
+}
+
+func FuzzParseSubnetLevels(f *testing.F) {
+	for _, seed := range []string{"44,48,64", "44-56,64", " 48 , 56 ", "40-64:4", "56-44", "44-57", "", ",", "-", "48,,64", "0-128", "1-128:1"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		levels, err := parseSubnetLevels(s)
+		if err != nil {
+			return
+		}
+		if len(levels) == 0 {
+			t.Fatalf("parseSubnetLevels(%q) returned no levels and no error", s)
+		}
+		for _, level := range levels {
+			if level < 0 || level > 128 {
+				t.Fatalf("parseSubnetLevels(%q) returned /%d", s, level)
+			}
+		}
+	})
+}
+
+func FuzzCheckPOPSize(f *testing.F) {
+	f.Add(32, 40, 3)
+	f.Add(32, 32, 1)
+	f.Add(32, 32, 2)
+	f.Add(32, 200, 3)
+	f.Add(32, -5, 3)
+	f.Add(48, 20, 1)
+	f.Fuzz(func(t *testing.T, baseBits, popSize, popCount int) {
+		if baseBits < 0 || baseBits > 128 || popCount < 1 {
+			t.Skip()
+		}
+		if checkPOPSize(baseBits, popSize, popCount) != nil {
+			return
+		}
+		// An accepted size must give net.CIDRMask and nthPrefix a length
+		// they can use, and leave room for more than one POP when asked
+		if popSize < baseBits || popSize > 128 {
+			t.Fatalf("checkPOPSize(%d, %d, %d) accepted a POP outside the base", baseBits, popSize, popCount)
+		}
+		if popCount > 1 && popSize == baseBits {
+			t.Fatalf("checkPOPSize(%d, %d, %d) accepted %d POPs in one block", baseBits, popSize, popCount, popCount)
+		}
+	})
+}
+
+func TestCheckPOPSize(t *testing.T) {
+	for _, tc := range []struct {
+		base, size, count int
+		ok                bool
+	}{
+		{32, 40, 3, true},
+		{32, 32, 1, true},
+		{32, 32, 2, false},
+		{32, 20, 3, false},
+		{32, 200, 3, false},
+		{32, -5, 3, false},
+		{0, 128, 3, true},
+	} {
+		err := checkPOPSize(tc.base, tc.size, tc.count)
+		if (err == nil) != tc.ok {
+			t.Errorf("checkPOPSize(%d, %d, %d) = %v, want ok=%v", tc.base, tc.size, tc.count, err, tc.ok)
+		}
+	}
+	if _, err := parsePrefixLength(strconv.Itoa(-5)); err == nil {
+		t.Error("parsePrefixLength accepted -5")
+	}
+}
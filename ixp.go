@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Interface ID schemes for peering LAN participants.
+const (
+	peeringIDSequential = "sequential"
+	peeringIDASN        = "asn"
+	peeringIDASNHex     = "asn-hex"
+)
+
+// PeeringParticipant is a network connected to the peering LANs, with how
+// many routers it connects.
+type PeeringParticipant struct {
+	ASN     uint64 `json:"asn"`
+	Name    string `json:"name,omitempty"`
+	Routers int    `json:"routers"`
+}
+
+// PeeringAddress is one participant router's address on a peering LAN.
+type PeeringAddress struct {
+	ASN     uint64 `json:"asn"`
+	Name    string `json:"name,omitempty"`
+	Router  int    `json:"router"`
+	Address string `json:"address"`
+}
+
+// PeeringLAN is one /64 of the fabric and its participant addressing.
+type PeeringLAN struct {
+	Number       int              `json:"number"`
+	Prefix       string           `json:"prefix"`
+	Participants []PeeringAddress `json:"participants"`
+}
+
+// loadParticipants reads asn[,name[,routers]] lines; a header line is
+// skipped.
+func loadParticipants(path string) ([]PeeringParticipant, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+
+	var participants []PeeringParticipant
+	seen := make(map[uint64]int)
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		asn, err := parseASN(record[0])
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		if prev, dup := seen[asn]; dup {
+			return nil, fmt.Errorf("%s:%d: AS%d is already listed on line %d", path, line, asn, prev)
+		}
+		seen[asn] = line
+		p := PeeringParticipant{ASN: asn, Routers: 1}
+		if len(record) > 1 {
+			p.Name = strings.TrimSpace(record[1])
+		}
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			p.Routers, err = strconv.Atoi(strings.TrimSpace(record[2]))
+			if err != nil || p.Routers < 1 || p.Routers > 0xffff {
+				return nil, fmt.Errorf("%s:%d: %q is not a router count from 1 to 65535", path, line, record[2])
+			}
+		}
+		participants = append(participants, p)
+	}
+	return participants, nil
+}
+
+// peeringInterfaceID numbers router (from 1) of participant p. Sequential
+// IDs count up from next. The asn scheme writes the ASN's decimal digits
+// as hex digits, so AS64500 is ::6:4500:router, as many exchanges do;
+// asn-hex writes the ASN in hex, so AS64500 is ::fbf4:router.
+func peeringInterfaceID(scheme string, p PeeringParticipant, router int, next *big.Int) (*big.Int, error) {
+	switch scheme {
+	case peeringIDSequential:
+		id := new(big.Int).Set(next)
+		next.Add(next, big.NewInt(1))
+		return id, nil
+	case peeringIDASN:
+		digits, _ := new(big.Int).SetString(strconv.FormatUint(p.ASN, 10), 16)
+		return digits.Lsh(digits, 16).Add(digits, big.NewInt(int64(router))), nil
+	case peeringIDASNHex:
+		id := new(big.Int).SetUint64(p.ASN)
+		return id.Lsh(id, 16).Add(id, big.NewInt(int64(router))), nil
+	}
+	return nil, fmt.Errorf("unknown interface ID scheme %q (expected %s, %s or %s)", scheme, peeringIDSequential, peeringIDASN, peeringIDASNHex)
+}
+
+// planPeeringLANs carves count /64s from the start of prefix and numbers
+// every participant router on each; a participant has the same interface
+// ID on every LAN.
+func planPeeringLANs(prefix netip.Prefix, count int, participants []PeeringParticipant, scheme string, first int64) ([]PeeringLAN, error) {
+	if !prefix.Addr().Is6() || prefix.Addr().Is4In6() {
+		return nil, failf(ErrInvalidPrefix, "%s is not an IPv6 prefix", prefix)
+	}
+	if prefix.Bits() > 64 {
+		return nil, failf(ErrPrefixTooSmall, "%s is longer than a /64; peering LANs are /64s", prefix)
+	}
+	if count < 1 || pow2(64-prefix.Bits()).Cmp(big.NewInt(int64(count))) < 0 {
+		return nil, failf(ErrPrefixTooSmall, "%s does not hold %d /64 peering LANs", prefix, count)
+	}
+	if first < 1 {
+		return nil, fmt.Errorf("the first sequential interface ID must be at least 1")
+	}
+
+	var addresses []PeeringAddress
+	var ids []*big.Int
+	next := big.NewInt(first)
+	for _, p := range participants {
+		for router := 1; router <= p.Routers; router++ {
+			id, err := peeringInterfaceID(scheme, p, router, next)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+			addresses = append(addresses, PeeringAddress{ASN: p.ASN, Name: p.Name, Router: router})
+		}
+	}
+	if next.BitLen() > 64 {
+		return nil, failf(ErrPrefixTooSmall, "sequential interface IDs from %d run past the /64", first)
+	}
+
+	base := prefix.Masked()
+	lans := make([]PeeringLAN, count)
+	for i := range lans {
+		lan := nthPrefix(base.Addr(), 64, i)
+		lans[i] = PeeringLAN{Number: i + 1, Prefix: lan.String(), Participants: make([]PeeringAddress, len(addresses))}
+		for j, a := range addresses {
+			a.Address = addrAdd(lan.Addr(), ids[j]).String()
+			lans[i].Participants[j] = a
+		}
+	}
+	return lans, nil
+}
+
+func runPeeringLAN(args []string) {
+	fs := flag.NewFlagSet("peering-lan", flag.ExitOnError)
+	count := fs.Int("lans", 1, "Number of /64 peering LANs to carve from the prefix")
+	scheme := fs.String("ids", peeringIDSequential, "Participant interface IDs: sequential, asn (AS64500 is ::6:4500:1) or asn-hex (::fbf4:1)")
+	first := fs.Int64("first", 1, "First sequential interface ID; lower ones stay free for route servers and the fabric")
+	jsonOut := fs.Bool("j", false, "JSON output format")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner peering-lan [-lans n] [-ids sequential|asn|asn-hex] [-first n] [-j] prefix participants.csv")
+		fmt.Println("Each CSV line is asn[,name[,routers]]; a header line is skipped.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	prefix, err := netip.ParsePrefix(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error: invalid prefix %q: %v\n", fs.Arg(0), err)
+		os.Exit(2)
+	}
+	participants, err := loadParticipants(fs.Arg(1))
+	if err != nil {
+		fmt.Printf("Error loading participants: %v\n", err)
+		os.Exit(1)
+	}
+	lans, err := planPeeringLANs(prefix, *count, participants, *scheme, *first)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOut {
+		jsonData, err := json.MarshalIndent(lans, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+	for i, lan := range lans {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("Peering LAN %d: %s\n", lan.Number, lan.Prefix)
+		for _, a := range lan.Participants {
+			name := fmt.Sprintf("AS%d", a.ASN)
+			if a.Name != "" {
+				name += " " + a.Name
+			}
+			fmt.Printf("  %-40s %-8s %s\n", name, fmt.Sprintf("router %d", a.Router), a.Address)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"strconv"
+)
+
+// defaultJinjaEnumerate is how many prefixes of each level the jinja
+// format lists inside each parent prefix by default.
+const defaultJinjaEnumerate = 16
+
+// maxJinjaPrefixes caps the prefixes the jinja format lists in a plan.
+// Each level lists -enumerate prefixes inside every prefix listed above it,
+// so deep plans grow as enumerate to the power of their depth.
+const maxJinjaPrefixes = 100000
+
+// jinjaLevel summarizes one level of a POP for templates that compute
+// prefixes themselves, e.g. with the ipsubnet filter.
+type jinjaLevel struct {
+	Key   string   `json:"key"`
+	Size  int      `json:"size"`
+	Role  string   `json:"role,omitempty"`
+	First string   `json:"first"`
+	Count *big.Int `json:"count"`
+}
+
+// jinjaKey is the variable name of a level's prefixes: its role, or
+// "level" and its size when it has none.
+func jinjaKey(subnet SubnetDetail) string {
+	if subnet.Role != "" {
+		return subnet.Role
+	}
+	return fmt.Sprintf("level%d", prefixLenOf(subnet.CIDR))
+}
+
+// jinjaIndex writes a 1-based index zero-padded to at least two digits and
+// to the width of the largest index, so keys sort in order.
+func jinjaIndex(key string, i, largest int) string {
+	width := len(strconv.Itoa(largest))
+	if width < 2 {
+		width = 2
+	}
+	return fmt.Sprintf("%s_%0*d", key, width, i)
+}
+
+// jinjaChildren lists the first enumerate prefixes of each level inside
+// parent, nesting each level's prefixes in the one above: a prefix with
+// levels below it is a map holding its own "prefix", and a prefix of the
+// last level is the prefix itself.
+func jinjaChildren(parent netip.Prefix, levels []SubnetDetail, enumerate int) map[string]interface{} {
+	vars := make(map[string]interface{})
+	if len(levels) == 0 || enumerate <= 0 {
+		return vars
+	}
+	size := prefixLenOf(levels[0].CIDR)
+	n := enumerate
+	if total := calculateAvailableSubnets(parent.Bits(), size); total.Cmp(big.NewInt(int64(n))) < 0 {
+		n = int(total.Int64())
+	}
+	key := jinjaKey(levels[0])
+	for i := 0; i < n; i++ {
+		p := nthPrefix(parent.Addr(), size, i)
+		name := jinjaIndex(key, i+1, n)
+		if len(levels) == 1 {
+			vars[name] = p.String()
+			continue
+		}
+		child := jinjaChildren(p, levels[1:], enumerate)
+		child["prefix"] = p.String()
+		vars[name] = child
+	}
+	return vars
+}
+
+// jinjaPrefixCount is the number of prefixes jinjaChildren lists for the
+// POPs of plan.
+func jinjaPrefixCount(plan IPv6Plan, enumerate int) *big.Int {
+	total := new(big.Int)
+	for _, pop := range plan.POPAllocations {
+		parent := prefixLenOf(pop.POPSubnet)
+		listed := big.NewInt(1)
+		for _, subnet := range pop.Subnets {
+			size := prefixLenOf(subnet.CIDR)
+			n := calculateAvailableSubnets(parent, size)
+			if n.Cmp(big.NewInt(int64(enumerate))) > 0 {
+				n = big.NewInt(int64(enumerate))
+			}
+			listed.Mul(listed, n)
+			total.Add(total, listed)
+			parent = size
+		}
+	}
+	return total
+}
+
+// jinjaVarsName is the one variable the flat layout defines, since dotted
+// keys are not valid variable names in Ansible.
+const jinjaVarsName = "ipv6plan"
+
+// jinjaVars lays a plan out as template variables: the base, and per POP
+// its details, a summary of its levels and the first prefixes of each
+// level. By default the prefixes are flat keys such as
+// "pop_03.site_12.lan_30" in a single ipv6plan map. With nested, each POP
+// is a pop_NN variable and each prefix with levels below it a map holding
+// its own "prefix".
+func jinjaVars(plan IPv6Plan, enumerate int, nested bool) (map[string]interface{}, error) {
+	if enumerate < 1 {
+		return nil, fmt.Errorf("-enumerate must be at least 1, not %d", enumerate)
+	}
+	if total := jinjaPrefixCount(plan, enumerate); total.Cmp(big.NewInt(maxJinjaPrefixes)) > 0 {
+		return nil, fmt.Errorf("listing %d prefixes of each level inside each parent would write %s prefixes, more than %d; lower -enumerate, or use levels to compute prefixes in the template", enumerate, total, maxJinjaPrefixes)
+	}
+	vars := map[string]interface{}{
+		"base":          plan.BaseSubnet,
+		"subnet_levels": plan.SubnetLevels,
+	}
+	largest := 0
+	for _, pop := range plan.POPAllocations {
+		if pop.POPNumber > largest {
+			largest = pop.POPNumber
+		}
+	}
+	popKeys := []string{}
+	for _, pop := range plan.POPAllocations {
+		prefix, err := netip.ParsePrefix(pop.POPSubnet)
+		if err != nil {
+			return nil, failf(ErrInvalidPrefix, "POP %d: %q is not an IPv6 prefix", pop.POPNumber, pop.POPSubnet)
+		}
+		levels := []jinjaLevel{}
+		for _, subnet := range pop.Subnets {
+			levels = append(levels, jinjaLevel{Key: jinjaKey(subnet), Size: prefixLenOf(subnet.CIDR), Role: subnet.Role, First: subnet.CIDR, Count: subnet.Count})
+		}
+		popVars := jinjaChildren(prefix, pop.Subnets, enumerate)
+		popVars["number"] = pop.POPNumber
+		popVars["prefix"] = pop.POPSubnet
+		popVars["levels"] = levels
+		if pop.Name != "" {
+			popVars["name"] = pop.Name
+		}
+		if pop.Code != "" {
+			popVars["code"] = pop.Code
+		}
+		if pop.Location != nil {
+			popVars["location"] = pop.Location
+		}
+		key := jinjaIndex("pop", pop.POPNumber, largest)
+		vars[key] = popVars
+		popKeys = append(popKeys, key)
+	}
+	vars["pop_keys"] = popKeys
+	if len(plan.Delegations) > 0 {
+		vars["delegations"] = plan.Delegations
+	}
+	if nested {
+		return vars, nil
+	}
+	flat := make(map[string]interface{})
+	for key, value := range vars {
+		if popVars, ok := value.(map[string]interface{}); ok {
+			flattenJinja(flat, key, popVars)
+		} else {
+			flat[key] = value
+		}
+	}
+	return map[string]interface{}{jinjaVarsName: flat}, nil
+}
+
+// flattenJinja copies the nested variables of vars into flat under dotted
+// keys starting with path. A prefix with levels below it becomes the
+// prefix itself, as the last level's prefixes are.
+func flattenJinja(flat map[string]interface{}, path string, vars map[string]interface{}) {
+	for key, value := range vars {
+		child, ok := value.(map[string]interface{})
+		if !ok {
+			flat[path+"."+key] = value
+			continue
+		}
+		flat[path+"."+key] = child["prefix"]
+		delete(child, "prefix")
+		flattenJinja(flat, path+"."+key, child)
+	}
+}
+
+// writeJinjaVars writes the plan's template variables as JSON, which
+// Ansible, Salt and Nornir load as they would YAML.
+func writeJinjaVars(w io.Writer, plan IPv6Plan, enumerate int, nested bool) error {
+	vars, err := jinjaVars(plan, enumerate, nested)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(vars, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
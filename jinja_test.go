@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestJinjaFlatMatchesNested(t *testing.T) {
+	plan, err := loadPlan(filepath.Join("testdata", "plan.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested, err := jinjaVars(plan, 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := jinjaVars(plan, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flat := doc[jinjaVarsName].(map[string]interface{})
+
+	pop := nested["pop_02"].(map[string]interface{})
+	site := pop["level48_02"].(map[string]interface{})
+	for key, want := range map[string]interface{}{
+		"pop_02.prefix":                           pop["prefix"],
+		"pop_02.level48_02":                       site["prefix"],
+		"pop_02.level48_02.level56_01":            site["level56_01"].(map[string]interface{})["prefix"],
+		"pop_02.level48_02.level56_01.level64_02": site["level56_01"].(map[string]interface{})["level64_02"],
+		"base": nested["base"],
+	} {
+		if got := flat[key]; got != want || got == nil {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+}
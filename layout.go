@@ -0,0 +1,228 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// layoutField is one field of the 128-bit address layout, covering bits
+// First to Last, numbered from 1.
+type layoutField struct {
+	Key    string
+	Name   string
+	First  int
+	Last   int
+	Detail string
+}
+
+func (f layoutField) Bits() int { return f.Last - f.First + 1 }
+
+func (f layoutField) Range() string { return bitRange(f.First, f.Last) }
+
+// planLayout splits a plan's address into its fields: the routing prefix,
+// the POP ID, one field per level, the subnet ID left to the end user and
+// the interface ID.
+func planLayout(plan IPv6Plan) ([]layoutField, error) {
+	_, ipNet, err := net.ParseCIDR(plan.BaseSubnet)
+	if err != nil {
+		return nil, failf(ErrInvalidPrefix, "base subnet %q: %v", plan.BaseSubnet, err)
+	}
+	ones, _ := ipNet.Mask.Size()
+
+	var fields []layoutField
+	add := func(name string, first, last int, detail string) {
+		if last < first {
+			return
+		}
+		key := string(rune('A' + len(fields)))
+		fields = append(fields, layoutField{Key: key, Name: name, First: first, Last: last, Detail: detail})
+	}
+
+	add("Routing prefix", 1, ones, plan.BaseSubnet)
+	popDetail := fmt.Sprintf("/%d, %d POPs, room for %s", plan.PreferredSize, plan.POPCount, plan.MaxPOPCount)
+	if plan.GrowthBits > 0 {
+		popDetail += fmt.Sprintf(", %s reserved for growth", countBits(plan.GrowthBits))
+	}
+	add("POP ID", ones+1, plan.PreferredSize, popDetail)
+
+	parent := plan.PreferredSize
+	for i, level := range plan.SubnetLevels {
+		if level <= parent {
+			continue
+		}
+		name := fmt.Sprintf("Level %d", i+1)
+		if len(plan.POPAllocations) > 0 && i < len(plan.POPAllocations[0].Subnets) {
+			if role := plan.POPAllocations[0].Subnets[i].Role; role != "" {
+				name += " (" + role + ")"
+			}
+		}
+		add(name, parent+1, level, fmt.Sprintf("/%d, %s per /%d", level, pow2(level-parent), parent))
+		parent = level
+	}
+
+	if parent < 64 {
+		add("Subnet ID", parent+1, 64, fmt.Sprintf("%s /64s per /%d", pow2(64-parent), parent))
+		parent = 64
+	}
+	if parent == 64 {
+		add("Interface ID", 65, 128, "64-bit interface identifier")
+	} else {
+		add("Host ID", parent+1, 128, fmt.Sprintf("hosts inside each /%d", parent))
+	}
+	return fields, nil
+}
+
+// writeLayoutText draws the fields as a bar at two bits per column, giving
+// every field at least one column, followed by a legend. Field names go
+// inside the bar where they fit and are replaced by their key otherwise.
+func writeLayoutText(w io.Writer, plan IPv6Plan, fields []layoutField) {
+	fmt.Fprintf(w, "%s address layout (128 bits)\n\n", plan.BaseSubnet)
+
+	bar, ruler := "|", ""
+	for _, f := range fields {
+		width := (f.Bits() + 1) / 2
+		if width < 1 {
+			width = 1
+		}
+		label := f.Name
+		if len(label) > width {
+			label = f.Key
+		}
+		if len(label) > width {
+			label = ""
+		}
+		// The ruler marks each field's start above its left border.
+		start := len(bar) - 1
+		if mark := fmt.Sprintf("/%d", f.First-1); start == 0 || len(ruler) < start {
+			ruler += strings.Repeat(" ", start-len(ruler)) + mark
+		}
+		left := (width - len(label)) / 2
+		bar += strings.Repeat(" ", left) + label + strings.Repeat(" ", width-left-len(label)) + "|"
+	}
+	if end := len(bar) - 1; len(ruler) < end {
+		ruler += strings.Repeat(" ", end-len(ruler)) + "/128"
+	}
+	border := strings.Map(func(r rune) rune {
+		if r == '|' {
+			return '+'
+		}
+		return '-'
+	}, bar)
+	fmt.Fprintf(w, "%s\n%s\n%s\n%s\n\n", ruler, border, bar, border)
+
+	nameWidth := 0
+	for _, f := range fields {
+		if len(f.Name) > nameWidth {
+			nameWidth = len(f.Name)
+		}
+	}
+	for _, f := range fields {
+		fmt.Fprintf(w, "  %s  %-12s %-*s  %s\n", f.Key, f.Range(), nameWidth, f.Name, f.Detail)
+	}
+}
+
+// svgField is a layoutField placed on the SVG canvas.
+type svgField struct {
+	layoutField
+	X, Width, LabelX int
+	Fill             string
+	ShowName         bool
+}
+
+var layoutColors = []string{"#d9d9d9", "#9ecae1", "#a1d99b", "#fdd0a2", "#bcbddc", "#fcbba1", "#c7e9c0", "#fdae6b", "#dadaeb", "#f0f0f0"}
+
+// writeLayoutSVG draws the fields to scale, eight pixels per bit.
+func writeLayoutSVG(w io.Writer, plan IPv6Plan, fields []layoutField) error {
+	const tpl = `<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" font-family="Arial, sans-serif" font-size="12">
+  <title>{{.Title}}</title>
+  <text x="20" y="20" font-size="14" font-weight="bold">{{.Title}}</text>
+{{- range .Fields}}
+  <rect x="{{.X}}" y="50" width="{{.Width}}" height="40" fill="{{.Fill}}" stroke="#333"/>
+  <text x="{{.LabelX}}" y="74" text-anchor="middle">{{if .ShowName}}{{.Name}}{{else}}{{.Key}}{{end}}</text>
+  <text x="{{.X}}" y="44" text-anchor="middle" font-size="10">/{{.First | prev}}</text>
+{{- end}}
+  <text x="{{.End}}" y="44" text-anchor="middle" font-size="10">/128</text>
+{{- range $i, $f := .Fields}}
+  <rect x="20" y="{{legendY $i | add -10}}" width="12" height="12" fill="{{$f.Fill}}" stroke="#333"/>
+  <text x="40" y="{{legendY $i}}">{{$f.Key}}  {{$f.Name}}: {{$f.Range}}, {{$f.Detail}}</text>
+{{- end}}
+</svg>
+`
+	const scale, margin = 8, 20
+	var placed []svgField
+	for i, f := range fields {
+		x, width := margin+(f.First-1)*scale, f.Bits()*scale
+		placed = append(placed, svgField{
+			layoutField: f,
+			X:           x,
+			Width:       width,
+			LabelX:      x + width/2,
+			Fill:        layoutColors[i%len(layoutColors)],
+			ShowName:    len(f.Name)*7 < width,
+		})
+	}
+	funcs := template.FuncMap{
+		"prev":    func(n int) int { return n - 1 },
+		"add":     func(d, n int) int { return n + d },
+		"legendY": func(i int) int { return 120 + 18*i },
+	}
+	tmpl, err := template.New("layout").Funcs(funcs).Parse(tpl)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, struct {
+		Title         string
+		Width, Height int
+		End           int
+		Fields        []svgField
+	}{
+		Title:  plan.BaseSubnet + " address layout (128 bits)",
+		Width:  2*margin + 128*scale,
+		Height: 120 + 18*len(fields) + margin,
+		End:    margin + 128*scale,
+		Fields: placed,
+	})
+}
+
+func runLayout(args []string) {
+	fs := flag.NewFlagSet("layout", flag.ExitOnError)
+	format := fs.String("format", "text", "Figure format: text or svg")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner layout [-format text|svg] plan.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	plan, err := loadPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+	fields, err := planLayout(plan)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch *format {
+	case "text":
+		writeLayoutText(os.Stdout, plan, fields)
+	case "svg":
+		if err := writeLayoutSVG(os.Stdout, plan, fields); err != nil {
+			fmt.Printf("Error generating SVG: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Printf("Error: unknown format %q (expected text or svg)\n", *format)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// Lint outcomes.
+const (
+	lintPass = "pass"
+	lintFail = "fail"
+	lintSkip = "skip"
+)
+
+// lintRule is one item of the best-practice checklist. check returns the
+// outcome and a detail explaining it.
+type lintRule struct {
+	name        string
+	description string
+	severity    string
+	check       func(plan IPv6Plan) (string, string)
+}
+
+// LintResult is the outcome of one checklist rule.
+type LintResult struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	Severity    string `json:"severity"`
+	Status      string `json:"status"`
+	Detail      string `json:"detail,omitempty"`
+}
+
+// LintReport scores a plan against the checklist: the share of the rules
+// that apply to it which it passes.
+type LintReport struct {
+	Plan    string       `json:"plan"`
+	Score   float64      `json:"score"`
+	Passed  int          `json:"passed"`
+	Failed  int          `json:"failed"`
+	Skipped int          `json:"skipped,omitempty"`
+	Results []LintResult `json:"results"`
+}
+
+// lintChecklist is the built-in checklist, drawn from RFC 6177, RFC 7421
+// and RIPE-690.
+var lintChecklist = []lintRule{
+	{
+		name:        "nibble-aligned",
+		description: "Base, POP and level prefix lengths fall on nibble boundaries",
+		severity:    ruleWarning,
+		check: func(plan IPv6Plan) (string, string) {
+			var off []string
+			for _, size := range append([]int{prefixLenOf(plan.BaseSubnet), plan.PreferredSize}, plan.SubnetLevels...) {
+				if size%4 != 0 && size < 127 {
+					off = append(off, fmt.Sprintf("/%d", size))
+				}
+			}
+			if len(off) > 0 {
+				return lintFail, "not nibble-aligned: " + strings.Join(off, ", ")
+			}
+			return lintPass, ""
+		},
+	},
+	{
+		name:        "lan-64",
+		description: "LANs are /64s, so SLAAC and every host stack work (RFC 7421)",
+		severity:    ruleError,
+		check: func(plan IPv6Plan) (string, string) {
+			roles := planRoleLevels(plan)
+			var lans []string
+			for _, level := range plan.SubnetLevels {
+				if roles[level] == roleLAN && level != 64 {
+					lans = append(lans, fmt.Sprintf("/%d", level))
+				}
+			}
+			if len(lans) > 0 {
+				return lintFail, "lan levels that are not /64: " + strings.Join(lans, ", ")
+			}
+			if !containsInt(plan.SubnetLevels, 64) {
+				return lintFail, "no level is a /64"
+			}
+			return lintPass, ""
+		},
+	},
+	{
+		name:        "site-48",
+		description: "Sites and business customers get a /48 (RFC 6177, RIPE-690)",
+		severity:    ruleWarning,
+		check: func(plan IPv6Plan) (string, string) {
+			found := false
+			roles := planRoleLevels(plan)
+			for _, level := range plan.SubnetLevels {
+				role := roles[level]
+				if role != roleSite && role != roleBusiness {
+					continue
+				}
+				found = true
+				if level > 48 {
+					return lintFail, fmt.Sprintf("%s prefixes are /%d", role, level)
+				}
+			}
+			if !found {
+				return lintSkip, "no level has the site or business role"
+			}
+			return lintPass, ""
+		},
+	},
+	{
+		name:        "growth-headroom",
+		description: "At least half of the POP IDs are free for new POPs",
+		severity:    ruleWarning,
+		check: func(plan IPv6Plan) (string, string) {
+			if plan.MaxPOPCount == nil || plan.MaxPOPCount.Sign() == 0 {
+				return lintSkip, "the plan does not record its POP capacity"
+			}
+			used := big.NewInt(int64(2 * plan.POPCount))
+			if used.Cmp(plan.MaxPOPCount) > 0 {
+				return lintFail, fmt.Sprintf("%d of %s POP IDs are used", plan.POPCount, plan.MaxPOPCount)
+			}
+			return lintPass, fmt.Sprintf("%d of %s POP IDs are used", plan.POPCount, plan.MaxPOPCount)
+		},
+	},
+	{
+		name:        "infrastructure-block",
+		description: "Infrastructure (loopbacks, links, management) is kept apart from customer space",
+		severity:    ruleWarning,
+		check: func(plan IPv6Plan) (string, string) {
+			if plan.OOB != nil {
+				return lintPass, "management aggregate " + plan.OOB.Aggregate
+			}
+			roles := planRoleLevels(plan)
+			for _, level := range plan.SubnetLevels {
+				if role := roles[level]; role == roleLoopback || role == roleP2P {
+					return lintPass, fmt.Sprintf("/%d %s level", level, role)
+				}
+			}
+			return lintFail, "no management aggregate (-oob) and no loopback or p2p level"
+		},
+	},
+}
+
+// planRoleLevels maps each level of a plan to its role, as recorded in the
+// first POP.
+func planRoleLevels(plan IPv6Plan) map[int]string {
+	roles := make(map[int]string)
+	if len(plan.POPAllocations) == 0 {
+		return roles
+	}
+	for _, subnet := range plan.POPAllocations[0].Subnets {
+		if subnet.Role != "" {
+			roles[prefixLenOf(subnet.CIDR)] = subnet.Role
+		}
+	}
+	return roles
+}
+
+// customLintRule checks a plan against an organizational rule, which is
+// skipped when the plan has none of the levels it constrains.
+func customLintRule(r Rule) lintRule {
+	rule := lintRule{name: r.Name, description: r.Description, severity: r.Severity}
+	if rule.description == "" {
+		rule.description = "Organizational rule"
+	}
+	if rule.severity == "" {
+		rule.severity = ruleError
+	}
+	rule.check = func(plan IPv6Plan) (string, string) {
+		base, roles := prefixLenOf(plan.BaseSubnet), planRoleLevels(plan)
+		if targets, _ := ruleTargets(r, base, plan.PreferredSize, plan.SubnetLevels, roles); len(targets) == 0 {
+			return lintSkip, "no level matches the rule's roles or levels"
+		}
+		var problems []string
+		for _, v := range evaluateRules([]Rule{r}, base, plan.PreferredSize, plan.SubnetLevels, roles) {
+			problems = append(problems, v.message)
+		}
+		if len(problems) > 0 {
+			detail := strings.Join(problems, "; ")
+			if r.Message != "" {
+				detail += "; " + r.Message
+			}
+			return lintFail, detail
+		}
+		return lintPass, ""
+	}
+	return rule
+}
+
+// lintRules merges organizational rules into the built-in checklist. A
+// rule named like a built-in one replaces it; the others are added after
+// the checklist in the order given.
+func lintRules(custom []Rule) []lintRule {
+	rules := append([]lintRule(nil), lintChecklist...)
+	for _, r := range custom {
+		replaced := false
+		for i := range rules {
+			if rules[i].name == r.Name {
+				rules[i], replaced = customLintRule(r), true
+			}
+		}
+		if !replaced {
+			rules = append(rules, customLintRule(r))
+		}
+	}
+	return rules
+}
+
+// lintPlan runs the rules against plan and scores it.
+func lintPlan(name string, plan IPv6Plan, rules []lintRule) LintReport {
+	report := LintReport{Plan: name}
+	for _, rule := range rules {
+		status, detail := rule.check(plan)
+		report.Results = append(report.Results, LintResult{
+			Rule:        rule.name,
+			Description: rule.description,
+			Severity:    rule.severity,
+			Status:      status,
+			Detail:      detail,
+		})
+		switch status {
+		case lintPass:
+			report.Passed++
+		case lintFail:
+			report.Failed++
+		default:
+			report.Skipped++
+		}
+	}
+	if applicable := report.Passed + report.Failed; applicable > 0 {
+		report.Score = float64(100*report.Passed) / float64(applicable)
+	}
+	return report
+}
+
+// failedErrors counts the failed rules of error severity.
+func (r LintReport) failedErrors() int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Status == lintFail && result.Severity == ruleError {
+			n++
+		}
+	}
+	return n
+}
+
+// writeLintText writes the reports as a scored pass/fail list.
+func writeLintText(w io.Writer, reports []LintReport) {
+	for i, r := range reports {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s: score %.0f%% (%d of %d rules passed", r.Plan, r.Score, r.Passed, r.Passed+r.Failed)
+		if r.Skipped > 0 {
+			fmt.Fprintf(w, ", %d not applicable", r.Skipped)
+		}
+		fmt.Fprintln(w, ")")
+		for _, result := range r.Results {
+			fmt.Fprintf(w, "  %-4s  %-20s %s\n", strings.ToUpper(result.Status), result.Rule, result.Description)
+			switch result.Status {
+			case lintFail:
+				fmt.Fprintf(w, "        %-20s %s (%s)\n", "", result.Detail, result.Severity)
+			case lintSkip:
+				fmt.Fprintf(w, "        %-20s %s\n", "", result.Detail)
+			}
+		}
+	}
+}
+
+// lintSuites turns the reports into check suites for JUnit and TAP output.
+// Rules that do not apply pass.
+func lintSuites(reports []LintReport) []checkSuite {
+	suites := make([]checkSuite, len(reports))
+	for i, r := range reports {
+		suites[i].Name = r.Plan
+		for _, result := range r.Results {
+			c := checkResult{Name: result.Rule + ": " + result.Description}
+			if result.Status == lintFail {
+				c.Failures = []string{result.Detail}
+			}
+			suites[i].Checks = append(suites[i].Checks, c)
+		}
+	}
+	return suites
+}
+
+// runLint implements the lint command.
+func runLint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := fs.String("format", reportText, "Report format: text, junit or tap")
+	jsonOut := fs.Bool("j", false, "JSON output format")
+	minScore := fs.Float64("min-score", 0, "Exit with status 1 when a plan scores below this percentage")
+	rulesPaths := fs.String("rules", "", "Comma-separated JSON rule files to merge with the built-in checklist")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner lint [-rules rules.json,...] [-min-score 80] [-format text|junit|tap] [-j] plan.json ...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := parseReportFormat(*format); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	var custom []Rule
+	for _, path := range splitList(*rulesPaths) {
+		rules, err := loadRules(path)
+		if err != nil {
+			fmt.Printf("Error loading rules: %v\n", err)
+			os.Exit(1)
+		}
+		custom = append(custom, rules...)
+	}
+	rules := lintRules(custom)
+
+	var reports []LintReport
+	for _, path := range fs.Args() {
+		plan, err := loadPlan(path)
+		if err != nil {
+			fmt.Printf("Error loading plan: %v\n", err)
+			os.Exit(1)
+		}
+		reports = append(reports, lintPlan(path, plan, rules))
+	}
+
+	switch {
+	case *jsonOut:
+		jsonData, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	case *format == reportText:
+		writeLintText(os.Stdout, reports)
+	default:
+		if err := writeChecks(os.Stdout, *format, "lint", lintSuites(reports)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	for _, r := range reports {
+		if r.failedErrors() > 0 || r.Score < *minScore {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// POPLocation is where a POP is, copied from its requirements into the
+// plan.
+type POPLocation struct {
+	City      string   `json:"city,omitempty"`
+	Country   string   `json:"country,omitempty"`
+	LOCODE    string   `json:"locode,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+// Location returns the requirement's location, or nil if it has none.
+func (r POPRequirement) Location() *POPLocation {
+	if r.City == "" && r.Country == "" && r.LOCODE == "" && r.Latitude == nil && r.Longitude == nil {
+		return nil
+	}
+	return &POPLocation{City: r.City, Country: r.Country, LOCODE: r.LOCODE, Latitude: r.Latitude, Longitude: r.Longitude}
+}
+
+// HasCoordinates reports whether the location can be placed on a map.
+func (l *POPLocation) HasCoordinates() bool {
+	return l != nil && l.Latitude != nil && l.Longitude != nil
+}
+
+func (l *POPLocation) String() string {
+	parts := []string{}
+	for _, p := range []string{l.City, l.Country} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	s := strings.Join(parts, ", ")
+	if l.LOCODE != "" {
+		s = strings.TrimSpace(s + " [" + l.LOCODE + "]")
+	}
+	if l.HasCoordinates() {
+		s = strings.TrimSpace(fmt.Sprintf("%s (%.4f, %.4f)", s, *l.Latitude, *l.Longitude))
+	}
+	return s
+}
+
+// checkLocation normalizes a UN/LOCODE to its five-character form, taking
+// the country from it when none is given, and rejects coordinates off the
+// globe or only one of the pair.
+func checkLocation(req *POPRequirement, i int) error {
+	if req.LOCODE != "" {
+		code, err := normalizeLOCODE(req.LOCODE)
+		if err != nil {
+			return fmt.Errorf("%s: %v", requirementName(*req, i), err)
+		}
+		req.LOCODE = code
+		if req.Country == "" {
+			req.Country = code[:2]
+		}
+	}
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		return fmt.Errorf("%s: give both latitude and longitude, or neither", requirementName(*req, i))
+	}
+	if req.Latitude != nil && (*req.Latitude < -90 || *req.Latitude > 90) {
+		return fmt.Errorf("%s: latitude %g is outside -90 to 90", requirementName(*req, i), *req.Latitude)
+	}
+	if req.Longitude != nil && (*req.Longitude < -180 || *req.Longitude > 180) {
+		return fmt.Errorf("%s: longitude %g is outside -180 to 180", requirementName(*req, i), *req.Longitude)
+	}
+	return nil
+}
+
+// mapPoint is a located POP placed on the HTML report's map, an
+// equirectangular projection two pixels per degree wide.
+type mapPoint struct {
+	X, Y   float64
+	Label  string
+	Prefix string
+	Where  string
+}
+
+const mapWidth, mapHeight = 720, 360
+
+// MapPoints places every POP with coordinates on the map.
+func (p IPv6Plan) MapPoints() []mapPoint {
+	var points []mapPoint
+	for _, pop := range p.POPAllocations {
+		if !pop.Location.HasCoordinates() {
+			continue
+		}
+		points = append(points, mapPoint{
+			X:      (*pop.Location.Longitude + 180) * mapWidth / 360,
+			Y:      (90 - *pop.Location.Latitude) * mapHeight / 180,
+			Label:  pop.Label(),
+			Prefix: pop.POPSubnet,
+			Where:  pop.Location.String(),
+		})
+	}
+	return points
+}
+
+// mapLine is one line of the map's graticule.
+type mapLine struct {
+	X1, Y1, X2, Y2 int
+}
+
+// mapGraticule draws meridians and parallels every 30 degrees, enough to
+// place the POPs without shipping a coastline.
+func mapGraticule() []mapLine {
+	var lines []mapLine
+	for x := 60; x < mapWidth; x += 60 {
+		lines = append(lines, mapLine{X1: x, Y1: 0, X2: x, Y2: mapHeight})
+	}
+	for y := 60; y < mapHeight; y += 60 {
+		lines = append(lines, mapLine{X1: 0, Y1: y, X2: mapWidth, Y2: y})
+	}
+	return lines
+}
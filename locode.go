@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// POP numbering schemes for -pop-numbering.
+const (
+	numberByIndex  = "index"
+	numberByLOCODE = "locode"
+)
+
+// normalizeLOCODE checks a UN/LOCODE such as "NL AMS" or "nlams" and
+// returns it as five upper-case characters: an ISO 3166 country code and a
+// three-character location code of letters and the digits 2-9.
+func normalizeLOCODE(s string) (string, error) {
+	code := strings.ToUpper(strings.Join(strings.Fields(s), ""))
+	if len(code) != 5 {
+		return "", fmt.Errorf("UN/LOCODE %q is not a country code and a three-character location", s)
+	}
+	for i, r := range code {
+		letter := r >= 'A' && r <= 'Z'
+		if !letter && (i < 2 || r < '2' || r > '9') {
+			return "", fmt.Errorf("UN/LOCODE %q is not a country code and a three-character location", s)
+		}
+	}
+	return code, nil
+}
+
+// locationKey is what a POP's ID is derived from: its UN/LOCODE, or its
+// country and name when it has none.
+func locationKey(req POPRequirement) string {
+	if req.LOCODE != "" {
+		return req.LOCODE
+	}
+	if req.Name == "" {
+		return ""
+	}
+	return req.Country + "/" + strings.ToLower(req.Name)
+}
+
+// locodePOPIDs derives a POP ID for every POP without a code from a hash of
+// its location key, so a site keeps its prefix when the plan is regenerated
+// with POPs added, removed or reordered, as long as the base and POP size
+// stay the same. IDs taken by codes, reservations or delegated blocks are
+// skipped, and collisions move to the next free ID in key order.
+func locodePOPIDs(reqs []POPRequirement, codes map[int]*big.Int, reserved []string, delegated []idRange, fieldBits int) (map[int]*big.Int, error) {
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("-pop-numbering %s needs -requirements naming or locating each POP", numberByLOCODE)
+	}
+	if fieldBits < 1 {
+		return nil, failf(ErrPrefixTooSmall, "the POP size leaves no POP ID bits to number POPs by location")
+	}
+	skip, err := parseReservedIDs(reserved, fieldBits)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range codes {
+		skip = append(skip, idRange{lo: v, hi: v})
+	}
+	skip = append(skip, delegated...)
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(fieldBits))
+	// Probing steps past a used ID or over a whole blocked range, so more
+	// steps than both together means the field is full
+	blocked := int64(len(reqs) + len(skip))
+
+	type keyed struct {
+		key   string
+		index int
+	}
+	var pops []keyed
+	seen := make(map[string]int)
+	for i, req := range reqs {
+		if _, coded := codes[i]; coded {
+			continue
+		}
+		key := locationKey(req)
+		if key == "" {
+			return nil, fmt.Errorf("%s has no locode or name to number it by", requirementName(req, i))
+		}
+		if j, dup := seen[key]; dup {
+			return nil, fmt.Errorf("%s and %s share the location key %s", requirementName(reqs[j], j), requirementName(req, i), key)
+		}
+		seen[key] = i
+		pops = append(pops, keyed{key, i})
+	}
+	free := new(big.Int).Sub(limit, big.NewInt(int64(len(codes))))
+	for _, r := range delegated {
+		free.Sub(free, new(big.Int).Sub(r.hi, r.lo)).Sub(free, big.NewInt(1))
+	}
+	if free.Cmp(big.NewInt(int64(len(pops)))) < 0 {
+		return nil, failf(ErrOverlap, "%d POPs do not fit in a %d-bit POP ID field", len(reqs), fieldBits)
+	}
+	sort.Slice(pops, func(a, b int) bool { return pops[a].key < pops[b].key })
+
+	ids := make(map[int]*big.Int)
+	used := make(map[string]bool)
+	for _, pop := range pops {
+		h := fnv.New64a()
+		h.Write([]byte(pop.key))
+		v := new(big.Int).Mod(new(big.Int).SetUint64(h.Sum64()), limit)
+		for tries := int64(0); ; tries++ {
+			if tries > blocked {
+				return nil, failf(ErrOverlap, "no free POP ID near the one derived for %s", pop.key)
+			}
+			if r := holdingRange(skip, v); r != nil {
+				v.Add(r.hi, big.NewInt(1)).Mod(v, limit)
+			} else if used[v.String()] {
+				v.Add(v, big.NewInt(1)).Mod(v, limit)
+			} else {
+				break
+			}
+		}
+		used[v.String()] = true
+		ids[pop.index] = v
+	}
+	return ids, nil
+}
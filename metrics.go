@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// metricFamily is one metric in the Prometheus text exposition format.
+type metricFamily struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+type metricSample struct {
+	labels [][2]string
+	value  *big.Int
+}
+
+func (f *metricFamily) add(value *big.Int, labels ...string) {
+	s := metricSample{value: value}
+	for i := 0; i+1 < len(labels); i += 2 {
+		s.labels = append(s.labels, [2]string{labels[i], labels[i+1]})
+	}
+	f.samples = append(f.samples, s)
+}
+
+// planMetrics counts what a plan allocates, per POP and level, as gauges
+// Prometheus can scrape and Grafana can chart. Prefix counts can exceed
+// what a float64 holds exactly; Prometheus stores them as floats anyway.
+func planMetrics(plan IPv6Plan) []*metricFamily {
+	pops := &metricFamily{name: "ipv6planner_pops", help: "POPs allocated in the plan."}
+	slots := &metricFamily{name: "ipv6planner_pop_slots", help: "POP blocks the base subnet holds at the POP size."}
+	reserved := &metricFamily{name: "ipv6planner_pop_slots_reserved", help: "POP blocks held back for growth."}
+	available := &metricFamily{name: "ipv6planner_level_prefixes", help: "Prefixes of each level inside one POP."}
+	required := &metricFamily{name: "ipv6planner_demand_prefixes", help: "Prefixes a POP needs at a level, from its requirements."}
+	capacity := &metricFamily{name: "ipv6planner_demand_capacity_prefixes", help: "Prefixes a POP gets at a level that has demand."}
+	poolCapacity := &metricFamily{name: "ipv6planner_pool_capacity_prefixes", help: "Prefixes a -split pool holds in a POP."}
+	poolRequired := &metricFamily{name: "ipv6planner_pool_demand_prefixes", help: "Prefixes a -split pool needs in a POP, from its requirements."}
+
+	base := []string{"base", plan.BaseSubnet}
+	u := plan.POPSlotUtilization()
+	pops.add(u.Allocated, base...)
+	slots.add(u.Total, base...)
+	reserved.add(u.Reserved, base...)
+	for _, pop := range plan.POPAllocations {
+		labels := append(base[:2:2], "pop", strconv.Itoa(pop.POPNumber), "pop_name", pop.Name, "pop_prefix", pop.POPSubnet)
+		for _, subnet := range pop.Subnets {
+			level := subnet.CIDR[strings.LastIndex(subnet.CIDR, "/"):]
+			available.add(subnet.Available, append(labels, "level", level, "role", subnet.Role)...)
+		}
+		for _, d := range pop.Demand {
+			l := append(labels, "level", fmt.Sprintf("/%d", d.PrefixSize), "kind", d.Kind)
+			required.add(big.NewInt(int64(d.Required)), l...)
+			capacity.add(d.Available, l...)
+		}
+		for _, pool := range pop.Pools {
+			l := append(labels, "level", fmt.Sprintf("/%d", pool.PrefixSize), "pool", pool.Name)
+			poolCapacity.add(pool.Capacity, l...)
+			if pool.Required > 0 {
+				poolRequired.add(big.NewInt(int64(pool.Required)), l...)
+			}
+		}
+	}
+	return []*metricFamily{pops, slots, reserved, available, required, capacity, poolCapacity, poolRequired}
+}
+
+// labelEscaper escapes label values the way the text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeMetrics writes the families in the Prometheus text format, leaving
+// out families without samples and empty labels.
+func writeMetrics(w io.Writer, families []*metricFamily) error {
+	for _, f := range families {
+		if len(f.samples) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", f.name, f.help, f.name); err != nil {
+			return err
+		}
+		for _, s := range f.samples {
+			var labels []string
+			for _, l := range s.labels {
+				if l[1] != "" {
+					labels = append(labels, fmt.Sprintf(`%s="%s"`, l[0], labelEscaper.Replace(l[1])))
+				}
+			}
+			if _, err := fmt.Fprintf(w, "%s{%s} %s\n", f.name, strings.Join(labels, ","), s.value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func runMetrics(args []string) {
+	fs := flag.NewFlagSet("metrics", flag.ExitOnError)
+	out := fs.String("o", "", "Write to this file, replacing it atomically, instead of standard output")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner metrics [-o file.prom] plan.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	plan, err := loadPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+	families := planMetrics(plan)
+	if *out == "" {
+		if err := writeMetrics(os.Stdout, families); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := writeMetricsFile(*out, families); err != nil {
+		fmt.Printf("Error writing %s: %v\n", *out, err)
+		os.Exit(1)
+	}
+}
+
+// writeMetricsFile writes the families to path for the node exporter's
+// textfile collector. The collector may read at any moment, so the file is
+// written beside it and renamed over it, never left half-written.
+func writeMetricsFile(path string, families []*metricFamily) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".ipv6planner-*.prom")
+	if err != nil {
+		return err
+	}
+	err = writeMetrics(tmp, families)
+	if err == nil {
+		// Readable by the exporter, like the file it replaces
+		err = tmp.Chmod(0o644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"strings"
+)
+
+// oobOrganization keys the management aggregate among the blocks carved
+// from the top of the base, which it shares with delegated blocks.
+const oobOrganization = "out-of-band management"
+
+// defaultOOBNetworks are the management networks of every POP unless
+// -oob-networks names others.
+var defaultOOBNetworks = []string{"console", "bmc", "jump-hosts"}
+
+// OOBPlan describes the out-of-band management space: one aggregate, kept
+// apart from production space so it can be filtered and left unannounced
+// as a whole, holding a block for every POP.
+type OOBPlan struct {
+	Aggregate string   `json:"aggregate"`
+	POPSize   int      `json:"pop_size"`
+	Levels    []int    `json:"levels"`
+	Networks  []string `json:"networks"`
+}
+
+// POPOOB is a POP's block of the management aggregate.
+type POPOOB struct {
+	Prefix   string         `json:"prefix"`
+	Subnets  []SubnetDetail `json:"subnets"`
+	Networks []OOBNetwork   `json:"networks"`
+}
+
+// OOBNetwork is one management network of a POP, such as its console
+// servers or BMCs, a prefix of the first management level.
+type OOBNetwork struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+}
+
+// checkOOB validates the management block size, levels and networks.
+func checkOOB(size int, levels []int, networks []string, allowSub64 bool) error {
+	if len(levels) == 0 {
+		return failf(ErrInvalidLevel, "the management blocks need at least one level")
+	}
+	for i, level := range levels {
+		if level <= size || level > 128 || (i > 0 && level <= levels[i-1]) {
+			return failf(ErrInvalidLevel, "management levels must grow longer from the /%d block: /%d", size, level)
+		}
+		if level > 64 && !allowSub64 {
+			return fmt.Errorf("the /%d management level is longer than /64; pass -allow-sub64 to plan below the /64 boundary", level)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, name := range networks {
+		if seen[name] {
+			return fmt.Errorf("management network %s is listed twice", name)
+		}
+		seen[name] = true
+	}
+	if calculateAvailableSubnets(size, levels[0]).Cmp(big.NewInt(int64(len(networks)))) < 0 {
+		return failf(ErrPrefixTooSmall, "%d management networks do not fit in a /%d as /%ds", len(networks), size, levels[0])
+	}
+	return nil
+}
+
+// newOOBPlan is the management space -oob asks for, before its aggregate
+// is placed; nil without -oob.
+func newOOBPlan(opts PlanOptions) (*OOBPlan, error) {
+	if opts.OOBSize <= 0 {
+		return nil, nil
+	}
+	if _, clash := opts.Delegations[oobOrganization]; clash {
+		return nil, fmt.Errorf("%q names the management aggregate and cannot be delegated", oobOrganization)
+	}
+	oob := &OOBPlan{POPSize: opts.OOBSize, Levels: opts.OOBLevels, Networks: opts.OOBNetworks}
+	if len(oob.Networks) == 0 {
+		oob.Networks = defaultOOBNetworks
+	}
+	if len(oob.Levels) == 0 {
+		oob.Levels = []int{64}
+	}
+	if err := checkOOB(oob.POPSize, oob.Levels, oob.Networks, opts.AllowSub64); err != nil {
+		return nil, err
+	}
+	return oob, nil
+}
+
+// oobAggregateSize is the length of the aggregate holding a /size block for
+// every POP the POP ID field can number, growth included, so POPs added
+// later find their block already set aside.
+func oobAggregateSize(size, popCount, growthBits int) int {
+	return size - popBits(popCount) - growthBits
+}
+
+// layoutOOB lays out POP number n's block of the aggregate, its levels and
+// its networks, one per prefix of the first level.
+func layoutOOB(aggregate netip.Prefix, n int, plan *OOBPlan) (*POPOOB, error) {
+	if max := calculateAvailableSubnets(aggregate.Bits(), plan.POPSize); max.Cmp(big.NewInt(int64(n))) < 0 {
+		return nil, failf(ErrPrefixTooSmall, "the %s management aggregate has no /%d left for POP %d; -growth-bits sets aside room for more POPs", aggregate, plan.POPSize, n)
+	}
+	block := nthPrefix(aggregate.Addr(), plan.POPSize, n-1)
+	oob := &POPOOB{Prefix: block.String()}
+	for _, level := range plan.Levels {
+		available := calculateAvailableSubnets(plan.POPSize, level)
+		oob.Subnets = append(oob.Subnets, SubnetDetail{
+			CIDR:      netip.PrefixFrom(block.Addr(), level).String(),
+			Count:     available,
+			Available: available,
+		})
+	}
+	for i, name := range plan.Networks {
+		oob.Networks = append(oob.Networks, OOBNetwork{Name: name, Prefix: nthPrefix(block.Addr(), plan.Levels[0], i).String()})
+	}
+	return oob, nil
+}
+
+// Summary lists the management networks, e.g.
+// "console 2001:db8:ff00::/60, bmc 2001:db8:ff00:10::/60".
+func (oob POPOOB) Summary() string {
+	parts := make([]string, len(oob.Networks))
+	for i, network := range oob.Networks {
+		parts[i] = network.Name + " " + network.Prefix
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,70 @@
+package main
+
+import "fmt"
+
+// openConfigDocument renders a POP's turn-up addressing as an OpenConfig
+// tree: openconfig-interfaces with openconfig-if-ip IPv6 addresses on
+// subinterface 0, and openconfig-routing-policy prefix-sets matching the
+// ones -platform frr writes. It is RFC 7951 JSON, ready for a gNMI Set.
+func openConfigDocument(router POPRouter) map[string]interface{} {
+	var interfaces []interface{}
+	for _, iface := range router.Interfaces {
+		address := map[string]interface{}{
+			"ip": iface.Address.Addr().String(),
+			"config": map[string]interface{}{
+				"ip":            iface.Address.Addr().String(),
+				"prefix-length": iface.Address.Bits(),
+			},
+		}
+		interfaces = append(interfaces, map[string]interface{}{
+			"name": iface.Name,
+			"config": map[string]interface{}{
+				"name":        iface.Name,
+				"description": iface.Description,
+				"enabled":     true,
+			},
+			"subinterfaces": map[string]interface{}{
+				"subinterface": []interface{}{map[string]interface{}{
+					"index":  0,
+					"config": map[string]interface{}{"index": 0},
+					"openconfig-if-ip:ipv6": map[string]interface{}{
+						"addresses": map[string]interface{}{"address": []interface{}{address}},
+					},
+				}},
+			},
+		})
+	}
+
+	prefixSet := func(name, masklength string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":   name,
+			"config": map[string]interface{}{"name": name, "mode": "IPV6"},
+			"prefixes": map[string]interface{}{
+				"prefix": []interface{}{map[string]interface{}{
+					"ip-prefix":        router.Prefix,
+					"masklength-range": masklength,
+					"config": map[string]interface{}{
+						"ip-prefix":        router.Prefix,
+						"masklength-range": masklength,
+					},
+				}},
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"openconfig-interfaces:interfaces": map[string]interface{}{
+			"interface": interfaces,
+		},
+		"openconfig-routing-policy:routing-policy": map[string]interface{}{
+			"defined-sets": map[string]interface{}{
+				"prefix-sets": map[string]interface{}{
+					"prefix-set": []interface{}{
+						prefixSet(fmt.Sprintf("POP%d-AGGREGATE", router.POP), "exact"),
+						prefixSet(fmt.Sprintf("POP%d-MORE-SPECIFICS", router.POP), fmt.Sprintf("%d..128", router.PrefixLen+1)),
+					},
+				},
+			},
+		},
+	}
+}
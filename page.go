@@ -0,0 +1,54 @@
+package main
+
+import "fmt"
+
+// pagePOPs keeps limit POPs starting at offset (after sorting) and drops the
+// rest from plan and its ULA plan. A limit of 0 keeps every POP from offset
+// on. plan.POPOffset records where the page starts so outputs can say what
+// was left out.
+func pagePOPs(plan *IPv6Plan, offset, limit int) error {
+	if offset < 0 || limit < 0 {
+		return fmt.Errorf("-offset and -limit cannot be negative")
+	}
+	if offset == 0 && limit == 0 {
+		return nil
+	}
+	page := func(pops []POPAlloc) []POPAlloc {
+		if offset >= len(pops) {
+			return []POPAlloc{}
+		}
+		pops = pops[offset:]
+		if limit > 0 && limit < len(pops) {
+			pops = pops[:limit]
+		}
+		return pops
+	}
+	plan.POPAllocations = page(plan.POPAllocations)
+	plan.POPOffset = offset
+	if plan.ULAPlan != nil {
+		ula := *plan.ULAPlan
+		ula.POPAllocations = page(ula.POPAllocations)
+		ula.POPOffset = offset
+		plan.ULAPlan = &ula
+	}
+	return nil
+}
+
+// PagingBefore describes the POPs left out before the listed ones, or
+// returns "" when there are none.
+func (p IPv6Plan) PagingBefore() string {
+	if p.POPOffset == 0 {
+		return ""
+	}
+	return fmt.Sprintf("(%d POPs before these not shown)", p.POPOffset)
+}
+
+// PagingAfter describes the POPs left out after the listed ones, or returns
+// "" when there are none.
+func (p IPv6Plan) PagingAfter() string {
+	shown := p.POPOffset + len(p.POPAllocations)
+	if shown >= p.POPCount {
+		return ""
+	}
+	return fmt.Sprintf("… and %d more POPs (use -offset %d to see them)", p.POPCount-shown, shown)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// peeringDBURL is the PeeringDB API root. PEERINGDB_URL points it at a
+// local mirror or cache instead.
+func peeringDBURL() string {
+	if u := os.Getenv("PEERINGDB_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "https://www.peeringdb.com/api"
+}
+
+// peeringDBGet fetches one API object list into out. PEERINGDB_API_KEY, if
+// set, authenticates the request for higher rate limits.
+func peeringDBGet(path string, query url.Values, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, peeringDBURL()+"/"+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if key := os.Getenv("PEERINGDB_API_KEY"); key != "" {
+		req.Header.Set("Authorization", "Api-Key "+key)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("PeeringDB %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// peeringDBFacilities lists the facilities where an ASN is present, as
+// POP requirements carrying only names and locations.
+func peeringDBFacilities(asn uint64) ([]POPRequirement, error) {
+	var nets struct {
+		Data []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	if err := peeringDBGet("net", url.Values{"asn": {strconv.FormatUint(asn, 10)}}, &nets); err != nil {
+		return nil, err
+	}
+	if len(nets.Data) == 0 {
+		return nil, fmt.Errorf("AS%d has no PeeringDB network record", asn)
+	}
+
+	var netfacs struct {
+		Data []struct {
+			FacID int `json:"fac_id"`
+		} `json:"data"`
+	}
+	if err := peeringDBGet("netfac", url.Values{"net_id": {strconv.Itoa(nets.Data[0].ID)}}, &netfacs); err != nil {
+		return nil, err
+	}
+	if len(netfacs.Data) == 0 {
+		return nil, fmt.Errorf("%s (AS%d) lists no facilities in PeeringDB", nets.Data[0].Name, asn)
+	}
+	ids := make([]string, len(netfacs.Data))
+	for i, nf := range netfacs.Data {
+		ids[i] = strconv.Itoa(nf.FacID)
+	}
+
+	var facs struct {
+		Data []struct {
+			Name      string   `json:"name"`
+			City      string   `json:"city"`
+			Country   string   `json:"country"`
+			Latitude  *float64 `json:"latitude"`
+			Longitude *float64 `json:"longitude"`
+		} `json:"data"`
+	}
+	if err := peeringDBGet("fac", url.Values{"id__in": {strings.Join(ids, ",")}}, &facs); err != nil {
+		return nil, err
+	}
+	reqs := make([]POPRequirement, 0, len(facs.Data))
+	for _, fac := range facs.Data {
+		req := POPRequirement{Name: fac.Name, City: fac.City, Country: strings.ToUpper(fac.Country)}
+		// PeeringDB leaves coordinates unset or zero when unknown
+		if fac.Latitude != nil && fac.Longitude != nil && (*fac.Latitude != 0 || *fac.Longitude != 0) {
+			req.Latitude, req.Longitude = fac.Latitude, fac.Longitude
+		}
+		reqs = append(reqs, req)
+	}
+	sort.SliceStable(reqs, func(i, j int) bool {
+		if reqs[i].Country != reqs[j].Country {
+			return reqs[i].Country < reqs[j].Country
+		}
+		if reqs[i].City != reqs[j].City {
+			return reqs[i].City < reqs[j].City
+		}
+		return reqs[i].Name < reqs[j].Name
+	})
+	for i := range reqs {
+		if err := checkLocation(&reqs[i], i); err != nil {
+			return nil, err
+		}
+	}
+	return reqs, nil
+}
+
+// parseASN accepts "64500" or "AS64500".
+func parseASN(s string) (uint64, error) {
+	asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "AS"), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an AS number", s)
+	}
+	return asn, nil
+}
+
+// writeRequirementsCSV writes POPs in the -requirements CSV format, with
+// the location columns, ready for demand columns to be added.
+func writeRequirementsCSV(w io.Writer, reqs []POPRequirement) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "city", "country", "latitude", "longitude"})
+	coord := func(f *float64) string {
+		if f == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*f, 'f', -1, 64)
+	}
+	for _, req := range reqs {
+		cw.Write([]string{req.Name, req.City, req.Country, coord(req.Latitude), coord(req.Longitude)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func runPeeringDB(args []string) {
+	fs := flag.NewFlagSet("peeringdb", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner peeringdb AS64500 > pops.csv")
+		fmt.Println("Writes the ASN's PeeringDB facilities as a -requirements file.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	asn, err := parseASN(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	reqs, err := peeringDBFacilities(asn)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := writeRequirementsCSV(os.Stdout, reqs); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
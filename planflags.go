@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// planFlags are the command-line flags that set PlanOptions, as typed.
+type planFlags struct {
+	subnet        string
+	popCount      int
+	preferredSize string
+	subnetLevels  string
+	autoSize      bool
+	nibbleAlign   bool
+	growthBits    int
+	strict        bool
+	allowSub64    bool
+	addressing    string
+	roles         string
+	policy        string
+	withULA       bool
+	ulaPrefix     string
+	requirements  string
+	fromPeeringDB string
+	rules         string
+	reserveIDs    string
+	popCodes      string
+	popNumbering  string
+	delegate      string
+	split         string
+	splitLevel    int
+	preset        string
+	oobSize       int
+	oobLevels     string
+	oobNetworks   string
+}
+
+func newPlanFlags() *planFlags {
+	defaults := defaultPlanOptions()
+	return &planFlags{
+		subnet:        defaults.Subnet,
+		popCount:      defaults.POPCount,
+		preferredSize: strconv.Itoa(defaults.PreferredSize),
+		subnetLevels:  formatLevels(defaults.SubnetLevels),
+		policy:        defaults.Policy,
+		popNumbering:  numberByIndex,
+		oobLevels:     "64",
+		oobNetworks:   strings.Join(defaultOOBNetworks, ","),
+	}
+}
+
+func (f *planFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.subnet, "s", f.subnet, "Base IPv6 subnet (e.g., 3fff::/20)")
+	fs.IntVar(&f.popCount, "n", f.popCount, "Number of POPs")
+	fs.StringVar(&f.preferredSize, "p", f.preferredSize, "Preferred subnet size per POP, e.g. 40 or /40")
+	fs.StringVar(&f.subnetLevels, "l", f.subnetLevels, "Comma-separated list of subnet levels or ranges, e.g. 44,48-56:4,64")
+	fs.BoolVar(&f.autoSize, "auto-size", f.autoSize, "Compute the POP size from the POP count instead of using -p")
+	fs.IntVar(&f.growthBits, "growth-bits", f.growthBits, "Unused bits to reserve after the POP bits for future POPs")
+	fs.BoolVar(&f.nibbleAlign, "nibble", f.nibbleAlign, "Round automatically computed sizes to a nibble boundary")
+	fs.StringVar(&f.addressing, "addressing", f.addressing, "Addressing method per level, e.g. 64=slaac,127=static")
+	fs.StringVar(&f.roles, "roles", f.roles, "Role per level, e.g. 48=site,56=residential,64=lan")
+	fs.StringVar(&f.policy, "policy", f.policy, "Assignment policy profile: bcp, generous or none")
+	fs.BoolVar(&f.withULA, "with-ula", f.withULA, "Also generate a matching ULA plan")
+	fs.StringVar(&f.ulaPrefix, "ula-prefix", f.ulaPrefix, "ULA /48 for -with-ula (default: random RFC 4193 Global ID)")
+	fs.StringVar(&f.requirements, "requirements", f.requirements, "CSV or JSON file of per-POP sites, VLANs, customers, links and locations")
+	fs.StringVar(&f.reserveIDs, "reserve-ids", f.reserveIDs, "POP IDs to keep out of automatic assignment: hex values, ranges, zero or ones (e.g. zero,ff,10-1f)")
+	fs.StringVar(&f.popCodes, "pop-codes", f.popCodes, "Hex code per POP name or number, placed in the POP ID digits (e.g. ams=0a3,fra=0b1)")
+	fs.StringVar(&f.popNumbering, "pop-numbering", f.popNumbering, "How POPs without a code are numbered: index, or locode to derive stable IDs from each POP's UN/LOCODE or name")
+	fs.StringVar(&f.fromPeeringDB, "from-peeringdb", f.fromPeeringDB, "Take the POPs, with names and locations, from this ASN's facilities in PeeringDB")
+	fs.StringVar(&f.delegate, "delegate", f.delegate, "Blocks to delegate to downstream organizations, by prefix length (e.g. acme=40,globex=44)")
+	fs.StringVar(&f.split, "split", f.split, "Divide each POP between pools by percentage, e.g. wholesale=25,retail=75")
+	fs.IntVar(&f.splitLevel, "split-level", f.splitLevel, "Level the -split pools divide (default: the first level with a customer role)")
+	fs.StringVar(&f.preset, "preset", f.preset, "Plan the blocks an access network needs in each POP from -requirements counts: "+strings.Join(presetNames(), ", "))
+	fs.IntVar(&f.oobSize, "oob", f.oobSize, "Give each POP an out-of-band management block of this size, from one aggregate apart from production space")
+	fs.StringVar(&f.oobLevels, "oob-levels", f.oobLevels, "Subnet levels inside each management block, e.g. 60,64")
+	fs.StringVar(&f.oobNetworks, "oob-networks", f.oobNetworks, "Management networks of each POP, one prefix of the first -oob-levels level each")
+	fs.StringVar(&f.rules, "rules", f.rules, "JSON file of organizational rules every plan must follow")
+	fs.BoolVar(&f.allowSub64, "allow-sub64", f.allowSub64, "Allow POP sizes and levels longer than /64")
+	fs.BoolVar(&f.strict, "strict", f.strict, "Abort instead of warning when the plan is infeasible")
+}
+
+// options parses the flags into the options they set, loading the
+// requirements and rules files they name.
+func (f *planFlags) options() (PlanOptions, error) {
+	if f.growthBits < 0 {
+		return PlanOptions{}, errors.New("-growth-bits cannot be negative")
+	}
+	preferredSize, err := parsePrefixLength(f.preferredSize)
+	if err != nil {
+		return PlanOptions{}, fmt.Errorf("parsing POP size: %v", err)
+	}
+	subnetLevels, err := parseSubnetLevels(f.subnetLevels)
+	if err != nil {
+		return PlanOptions{}, fmt.Errorf("parsing subnet levels: %v", err)
+	}
+	addressing, err := parseAddressing(f.addressing)
+	if err != nil {
+		return PlanOptions{}, fmt.Errorf("parsing addressing methods: %v", err)
+	}
+	roles, err := parseRoles(f.roles)
+	if err != nil {
+		return PlanOptions{}, fmt.Errorf("parsing roles: %v", err)
+	}
+
+	var requirements []POPRequirement
+	if f.requirements != "" {
+		requirements, err = loadRequirements(f.requirements)
+		if err != nil {
+			return PlanOptions{}, fmt.Errorf("loading requirements: %v", err)
+		}
+	}
+	if f.fromPeeringDB != "" {
+		if f.requirements != "" {
+			return PlanOptions{}, errors.New("-from-peeringdb and -requirements cannot be combined; write the facilities with 'ipv6planner peeringdb' and add demand columns instead")
+		}
+		asn, err := parseASN(f.fromPeeringDB)
+		if err == nil {
+			requirements, err = peeringDBFacilities(asn)
+		}
+		if err != nil {
+			return PlanOptions{}, fmt.Errorf("loading POPs from PeeringDB: %v", err)
+		}
+	}
+
+	var rules []Rule
+	if f.rules != "" {
+		rules, err = loadRules(f.rules)
+		if err != nil {
+			return PlanOptions{}, fmt.Errorf("loading rules: %v", err)
+		}
+	}
+
+	popCodes, err := parsePOPCodes(f.popCodes)
+	if err != nil {
+		return PlanOptions{}, fmt.Errorf("parsing POP codes: %v", err)
+	}
+	delegations, err := parseDelegations(f.delegate)
+	if err != nil {
+		return PlanOptions{}, fmt.Errorf("parsing delegations: %v", err)
+	}
+	split, err := parseSplit(f.split)
+	if err != nil {
+		return PlanOptions{}, fmt.Errorf("parsing pool split: %v", err)
+	}
+	oobLevels, err := parseSubnetLevels(f.oobLevels)
+	if err != nil {
+		return PlanOptions{}, fmt.Errorf("parsing management levels: %v", err)
+	}
+
+	return PlanOptions{
+		Subnet:        f.subnet,
+		POPCount:      f.popCount,
+		PreferredSize: preferredSize,
+		SubnetLevels:  subnetLevels,
+		AutoSize:      f.autoSize,
+		NibbleAlign:   f.nibbleAlign,
+		GrowthBits:    f.growthBits,
+		Strict:        f.strict,
+		AllowSub64:    f.allowSub64,
+		Addressing:    addressing,
+		Roles:         roles,
+		Policy:        f.policy,
+		WithULA:       f.withULA || f.ulaPrefix != "",
+		ULAPrefix:     f.ulaPrefix,
+		Requirements:  requirements,
+		Rules:         rules,
+		ReservedIDs:   splitList(f.reserveIDs),
+		POPCodes:      popCodes,
+		POPNumbering:  f.popNumbering,
+		Delegations:   delegations,
+		Split:         split,
+		SplitLevel:    f.splitLevel,
+		Preset:        f.preset,
+		OOBSize:       f.oobSize,
+		OOBLevels:     oobLevels,
+		OOBNetworks:   splitList(f.oobNetworks),
+	}, nil
+}
+
+// overrideOptions replaces the settings of opts, loaded from a config file,
+// standard input or a base plan, with those of the flags given in fs.
+func overrideOptions(opts *PlanOptions, flags PlanOptions, fs *flag.FlagSet) {
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "s":
+			opts.Subnet = flags.Subnet
+		case "n":
+			opts.POPCount = flags.POPCount
+		case "p":
+			opts.PreferredSize = flags.PreferredSize
+		case "l":
+			opts.SubnetLevels = flags.SubnetLevels
+		case "auto-size":
+			opts.AutoSize = flags.AutoSize
+		case "nibble":
+			opts.NibbleAlign = flags.NibbleAlign
+		case "growth-bits":
+			opts.GrowthBits = flags.GrowthBits
+		case "strict":
+			opts.Strict = flags.Strict
+		case "allow-sub64":
+			opts.AllowSub64 = flags.AllowSub64
+		case "addressing":
+			opts.Addressing = flags.Addressing
+		case "roles":
+			opts.Roles = flags.Roles
+		case "policy":
+			opts.Policy = flags.Policy
+		case "with-ula":
+			opts.WithULA = flags.WithULA
+		case "ula-prefix":
+			opts.WithULA = true
+			opts.ULAPrefix = flags.ULAPrefix
+		case "requirements", "from-peeringdb":
+			opts.Requirements = flags.Requirements
+		case "rules":
+			opts.Rules = flags.Rules
+		case "reserve-ids":
+			opts.ReservedIDs = flags.ReservedIDs
+		case "pop-codes":
+			opts.POPCodes = flags.POPCodes
+		case "pop-numbering":
+			opts.POPNumbering = flags.POPNumbering
+		case "delegate":
+			opts.Delegations = flags.Delegations
+		case "split":
+			opts.Split = flags.Split
+		case "split-level":
+			opts.SplitLevel = flags.SplitLevel
+		case "preset":
+			opts.Preset = flags.Preset
+		case "oob":
+			opts.OOBSize = flags.OOBSize
+		case "oob-levels":
+			opts.OOBLevels = flags.OOBLevels
+		case "oob-networks":
+			opts.OOBNetworks = flags.OOBNetworks
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Level roles describe what a level's prefixes are handed out as, so that
+// assignment policy can be checked against them.
+const (
+	roleSite        = "site"
+	roleResidential = "residential"
+	roleBusiness    = "business"
+	roleLAN         = "lan"
+	roleP2P         = "p2p"
+	roleLoopback    = "loopback"
+)
+
+var levelRoles = []string{roleSite, roleResidential, roleBusiness, roleLAN, roleP2P, roleLoopback}
+
+// policyProfile sets the longest prefix each customer-facing role should get.
+type policyProfile struct {
+	name    string
+	maxSize map[string]int
+}
+
+// Policy profiles selectable with -policy. "bcp" follows RFC 6177 and
+// RIPE-690 (/48 per site or business, /56 per residential customer);
+// "generous" asks for a /48 everywhere, which RIPE-690 also presents as the
+// simplest choice; "none" disables the checks.
+var policyProfiles = map[string]policyProfile{
+	"bcp": {
+		name:    "bcp",
+		maxSize: map[string]int{roleSite: 48, roleBusiness: 48, roleResidential: 56},
+	},
+	"generous": {
+		name:    "generous",
+		maxSize: map[string]int{roleSite: 48, roleBusiness: 48, roleResidential: 48},
+	},
+	"none": {name: "none"},
+}
+
+var policyReferences = map[string]string{
+	roleSite:        "RFC 6177, RIPE-690",
+	roleBusiness:    "RIPE-690",
+	roleResidential: "RIPE-690",
+}
+
+// parseRoles reads "48=site,64=lan" into a map from prefix length to role.
+func parseRoles(s string) (map[int]string, error) {
+	return parseLevelMap(s, "role", levelRoles)
+}
+
+// checkPolicy compares each role's prefix length with the profile and with
+// the RFC guidance for links. Findings are advisory warnings.
+func checkPolicy(profileName string, roles map[int]string, levels []int) ([]string, error) {
+	if profileName == "" {
+		profileName = "bcp"
+	}
+	profile, ok := policyProfiles[profileName]
+	if !ok {
+		return nil, fmt.Errorf("unknown policy profile %q (expected bcp, generous or none)", profileName)
+	}
+	if profile.name == "none" {
+		return nil, nil
+	}
+
+	present := make(map[int]bool)
+	for _, level := range levels {
+		present[level] = true
+	}
+	keys := make([]int, 0, len(roles))
+	for level := range roles {
+		keys = append(keys, level)
+	}
+	sort.Ints(keys)
+
+	var warnings []string
+	warn := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf("Policy (%s): ", profile.name)+fmt.Sprintf(format, args...))
+	}
+	for _, level := range keys {
+		role := roles[level]
+		if !present[level] {
+			warn("role %s is set for /%d, which is not one of the subnet levels", role, level)
+			continue
+		}
+		switch role {
+		case roleSite, roleBusiness, roleResidential:
+			if level >= 64 {
+				warn("%s customers get a /%d; a single subnet per end site is not recommended [RFC 6177 section 3]", role, level)
+			} else if max := profile.maxSize[role]; level > max {
+				warn("%s customers get a /%d, less than the /%d this profile recommends [%s]", role, level, max, policyReferences[role])
+			}
+			if level%4 != 0 {
+				warn("%s delegations of /%d are not on a nibble boundary, which complicates reverse DNS delegation [RIPE-690]", role, level)
+			}
+		case roleLAN:
+			if level != 64 {
+				warn("LANs are /%d; anything but /64 breaks SLAAC and other /64-dependent features [RFC 7421]", level)
+			}
+		case roleP2P:
+			if level != 127 && level != 64 {
+				warn("point-to-point links are /%d; use /127 or /64 [RFC 6164]", level)
+			}
+		case roleLoopback:
+			if level != 128 {
+				warn("loopbacks are /%d; a /128 per loopback is the usual practice", level)
+			}
+		}
+	}
+	return warnings, nil
+}
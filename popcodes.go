@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parsePOPCodes reads "ams=0a3,fra=0b1" (or POP numbers instead of names)
+// into a map from POP to hex code.
+func parsePOPCodes(s string) (map[string]string, error) {
+	codes := make(map[string]string)
+	for _, item := range splitList(s) {
+		pop, code, ok := strings.Cut(item, "=")
+		pop, code = strings.TrimSpace(pop), strings.ToLower(strings.TrimSpace(code))
+		if !ok || pop == "" || code == "" {
+			return nil, fmt.Errorf("invalid entry %q (expected pop=hex-code)", item)
+		}
+		codes[pop] = code
+	}
+	return codes, nil
+}
+
+// formatPOPCodes is the inverse of parsePOPCodes, in a stable order.
+func formatPOPCodes(codes map[string]string) string {
+	pops := make([]string, 0, len(codes))
+	for pop := range codes {
+		pops = append(pops, pop)
+	}
+	sort.Strings(pops)
+	items := make([]string, len(pops))
+	for i, pop := range pops {
+		items[i] = pop + "=" + codes[pop]
+	}
+	return strings.Join(items, ",")
+}
+
+// resolvePOPCodes places each chosen code in the POP ID field, the hex
+// digits between a /baseSize base and /popSize POPs, and returns the POP ID
+// of each coded POP by index. POPs are named by their requirements name or
+// by number. Codes shorter than the field are padded with leading zeros;
+// two POPs with one code, or a code that is also reserved, are errors.
+func resolvePOPCodes(codes map[string]string, reqs []POPRequirement, popCount, baseSize, popSize int, reserved []string) (map[int]*big.Int, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	if baseSize%4 != 0 || popSize%4 != 0 {
+		return nil, failf(ErrInvalidLevel, "POP codes need the POP ID field on nibble boundaries, but the base is /%d and POPs are /%d", baseSize, popSize)
+	}
+	digits := (popSize - baseSize) / 4
+	if digits < 1 {
+		return nil, failf(ErrPrefixTooSmall, "/%d POPs leave no hex digits after the /%d base for POP codes", popSize, baseSize)
+	}
+	reservedRanges, err := parseReservedIDs(reserved, popSize-baseSize)
+	if err != nil {
+		return nil, err
+	}
+
+	byPOP := make(map[int]*big.Int)
+	owner := make(map[string]string)
+	keys := make([]string, 0, len(codes))
+	for key := range codes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		code := codes[key]
+		label, index := key, -1
+		for i, req := range reqs {
+			if req.Name == key {
+				index = i
+			}
+		}
+		if index < 0 {
+			n, err := strconv.Atoi(key)
+			if err != nil || n < 1 || n > popCount {
+				return nil, fmt.Errorf("POP code for %q: no POP has that name or number", key)
+			}
+			label, index = "POP "+key, n-1
+		}
+		if _, dup := byPOP[index]; dup {
+			return nil, fmt.Errorf("POP %d is given a code twice (by name and by number)", index+1)
+		}
+
+		hex := strings.TrimPrefix(code, "0x")
+		v, ok := new(big.Int).SetString(hex, 16)
+		if !ok || v.Sign() < 0 {
+			return nil, failf(ErrInvalidPrefix, "POP code %q for %s is not a hex number", code, label)
+		}
+		if len(hex) > digits && v.BitLen() > digits*4 {
+			return nil, failf(ErrInvalidPrefix, "POP code %q for %s has more than the %d hex digits between /%d and /%d", code, label, digits, baseSize, popSize)
+		}
+		padded := fmt.Sprintf("%0*x", digits, v)
+		if other, taken := owner[padded]; taken {
+			return nil, failf(ErrOverlap, "%s and %s both use code %s", other, label, padded)
+		}
+		if reservedID(reservedRanges, v) {
+			return nil, failf(ErrOverlap, "POP code %s for %s is a reserved POP ID", padded, label)
+		}
+		owner[padded] = label
+		byPOP[index] = v
+	}
+	return byPOP, nil
+}
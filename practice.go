@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+// PracticeScenario is a planning exercise: an organization, the block it
+// was given and what its plan has to provide.
+type PracticeScenario struct {
+	Seed         int64           `json:"seed"`
+	Organization string          `json:"organization"`
+	Brief        string          `json:"brief"`
+	BaseSubnet   string          `json:"base_subnet"`
+	POPs         int             `json:"pops"`
+	GrowthPOPs   int             `json:"growth_pops"`
+	Nibble       bool            `json:"nibble,omitempty"`
+	Demand       []PracticeLevel `json:"demand"`
+}
+
+// PracticeLevel is a role the plan needs a level for, with the prefix
+// length it must have and how many prefixes each POP needs.
+type PracticeLevel struct {
+	Role   string `json:"role"`
+	Size   int    `json:"size"`
+	PerPOP int    `json:"per_pop"`
+}
+
+// practiceProfile is a kind of organization exercises are drawn from.
+// POP counts and per-POP demand are picked between the bounds given.
+type practiceProfile struct {
+	article      string
+	organization string
+	pop          string
+	popPlural    string
+	baseSizes    []int
+	pops         [2]int
+	demand       []practiceDemand
+}
+
+type practiceDemand struct {
+	role   string
+	size   int
+	perPOP [2]int
+	what   string
+}
+
+var practiceProfiles = []practiceProfile{
+	{
+		article:      "a",
+		organization: "regional ISP",
+		pop:          "POP",
+		popPlural:    "POPs",
+		baseSizes:    []int{29, 32},
+		pops:         [2]int{4, 24},
+		demand: []practiceDemand{
+			{roleResidential, 56, [2]int{2000, 60000}, "residential subscribers"},
+			{roleBusiness, 48, [2]int{50, 500}, "business customers"},
+			{roleLAN, 64, [2]int{20, 200}, "infrastructure LANs"},
+		},
+	},
+	{
+		article:      "an",
+		organization: "enterprise",
+		pop:          "region",
+		popPlural:    "regions",
+		baseSizes:    []int{40, 44},
+		pops:         [2]int{2, 8},
+		demand: []practiceDemand{
+			{roleSite, 48, [2]int{5, 40}, "sites"},
+		},
+	},
+	{
+		article:      "a",
+		organization: "university",
+		pop:          "campus",
+		popPlural:    "campuses",
+		baseSizes:    []int{44, 48},
+		pops:         [2]int{1, 4},
+		demand: []practiceDemand{
+			{roleLAN, 64, [2]int{200, 2000}, "VLANs"},
+		},
+	},
+	{
+		article:      "a",
+		organization: "hosting provider",
+		pop:          "data centre",
+		popPlural:    "data centres",
+		baseSizes:    []int{32, 36},
+		pops:         [2]int{2, 6},
+		demand: []practiceDemand{
+			{roleBusiness, 48, [2]int{100, 2000}, "customers"},
+			{roleLAN, 64, [2]int{50, 500}, "platform VLANs"},
+		},
+	},
+}
+
+// newPracticeScenario draws an exercise from seed, so the same seed always
+// gives the same exercise. The base is a documentation prefix.
+func newPracticeScenario(seed int64) PracticeScenario {
+	rng := rand.New(rand.NewSource(seed))
+	between := func(r [2]int) int { return r[0] + rng.Intn(r[1]-r[0]+1) }
+	profile := practiceProfiles[rng.Intn(len(practiceProfiles))]
+
+	s := PracticeScenario{
+		Seed:         seed,
+		Organization: profile.organization,
+		POPs:         between(profile.pops),
+		Nibble:       rng.Intn(2) == 0,
+	}
+	s.GrowthPOPs = s.POPs * (2 + rng.Intn(3))
+	for _, d := range profile.demand {
+		s.Demand = append(s.Demand, PracticeLevel{Role: d.role, Size: d.size, PerPOP: between(d.perPOP)})
+	}
+
+	// The base is the profile's usual size unless the demand drawn needs
+	// more, so every exercise has a solution.
+	size := profile.baseSizes[rng.Intn(len(profile.baseSizes))]
+	if longest := practiceBaseSize(s); size > longest {
+		size = longest
+	}
+	if s.Nibble {
+		size = size / 4 * 4
+	}
+	doc := netip.MustParsePrefix(documentationPrefixes[0])
+	if size < doc.Bits() {
+		doc = netip.MustParsePrefix(documentationPrefixes[1])
+	}
+	// Any aligned block of the documentation prefix
+	offset := new(big.Int).Lsh(big.NewInt(rng.Int63n(1<<uint(size-doc.Bits()))), uint(128-size))
+	s.BaseSubnet = netip.PrefixFrom(addrAdd(doc.Addr(), offset), size).String()
+
+	pops := profile.popPlural
+	if s.POPs == 1 {
+		pops = profile.pop
+	}
+	brief := []string{fmt.Sprintf("You plan the IPv6 addressing of %s %s with %d %s in %s.", profile.article, profile.organization, s.POPs, pops, s.BaseSubnet)}
+	for i, d := range profile.demand {
+		brief = append(brief, fmt.Sprintf("Each %s needs %d %s, as /%ds.", profile.pop, s.Demand[i].PerPOP, d.what, d.size))
+	}
+	brief = append(brief, fmt.Sprintf("Leave room for %d %s in total.", s.GrowthPOPs, profile.popPlural))
+	if s.Nibble {
+		brief = append(brief, "Every prefix length has to fall on a nibble boundary.")
+	}
+	s.Brief = strings.Join(brief, " ")
+	return s
+}
+
+// practiceBaseSize is the longest base that holds the exercise's POPs,
+// growth included, each with room for its demand.
+func practiceBaseSize(s PracticeScenario) int {
+	fieldBits := func(n int) int {
+		b := popBits(n)
+		if s.Nibble {
+			b = (b + 3) / 4 * 4
+		}
+		return b
+	}
+	popSize := 128
+	for _, d := range s.Demand {
+		if size := d.Size - fieldBits(d.PerPOP); size < popSize {
+			popSize = size
+		}
+	}
+	size := popSize - fieldBits(s.GrowthPOPs)
+	if s.Nibble {
+		size = size / 4 * 4
+	}
+	return size
+}
+
+// gradePractice checks a plan against an exercise.
+func gradePractice(s PracticeScenario, plan IPv6Plan) []checkResult {
+	var checks []checkResult
+	check := func(name string, failures ...string) {
+		checks = append(checks, checkResult{Name: name, Failures: failures})
+	}
+
+	want, err := netip.ParsePrefix(s.BaseSubnet)
+	got, gotErr := netip.ParsePrefix(plan.BaseSubnet)
+	if err != nil || gotErr != nil || want.Masked() != got.Masked() {
+		check("Base subnet is "+s.BaseSubnet, "the plan's base is "+plan.BaseSubnet)
+	} else {
+		check("Base subnet is " + s.BaseSubnet)
+	}
+
+	if plan.POPCount < s.POPs {
+		check(fmt.Sprintf("At least %d POPs", s.POPs), fmt.Sprintf("the plan has %d", plan.POPCount))
+	} else {
+		check(fmt.Sprintf("At least %d POPs", s.POPs))
+	}
+
+	if plan.MaxPOPCount == nil || plan.MaxPOPCount.Cmp(big.NewInt(int64(s.GrowthPOPs))) < 0 {
+		check(fmt.Sprintf("Room for %d POPs", s.GrowthPOPs), fmt.Sprintf("the base holds %s /%d POPs", plan.MaxPOPCount, plan.PreferredSize))
+	} else {
+		check(fmt.Sprintf("Room for %d POPs", s.GrowthPOPs))
+	}
+
+	roles := planRoleLevels(plan)
+	for _, d := range s.Demand {
+		name := fmt.Sprintf("%d %s /%ds per POP", d.PerPOP, d.Role, d.Size)
+		switch {
+		case !containsInt(plan.SubnetLevels, d.Size):
+			check(name, fmt.Sprintf("the plan has no /%d level", d.Size))
+		case roles[d.Size] != d.Role:
+			check(name, fmt.Sprintf("the /%d level's role is %q, not %s", d.Size, roles[d.Size], d.Role))
+		case d.Size <= plan.PreferredSize || calculateAvailableSubnets(plan.PreferredSize, d.Size).Cmp(big.NewInt(int64(d.PerPOP))) < 0:
+			check(name, fmt.Sprintf("a /%d POP holds %s /%ds", plan.PreferredSize, calculateAvailableSubnets(plan.PreferredSize, d.Size), d.Size))
+		default:
+			check(name)
+		}
+	}
+
+	if s.Nibble {
+		var off []string
+		for _, size := range append([]int{prefixLenOf(plan.BaseSubnet), plan.PreferredSize}, plan.SubnetLevels...) {
+			if size%4 != 0 {
+				off = append(off, fmt.Sprintf("/%d is not nibble-aligned", size))
+			}
+		}
+		check("Prefix lengths on nibble boundaries", off...)
+	}
+	return checks
+}
+
+// writePracticeText writes an exercise for the trainee.
+func writePracticeText(w io.Writer, s PracticeScenario) {
+	fmt.Fprintf(w, "Exercise %d: %s\n\n", s.Seed, s.Organization)
+	fmt.Fprintln(w, s.Brief)
+	fmt.Fprintln(w, "\nYour plan is graded on:")
+	for _, c := range gradePractice(s, IPv6Plan{}) {
+		fmt.Fprintf(w, "  - %s\n", c.Name)
+	}
+	fmt.Fprintf(w, "\nSave the exercise with 'ipv6planner practice -seed %d -j > exercise.json',\nthen grade a plan with 'ipv6planner practice -grade exercise.json plan.json'.\n", s.Seed)
+}
+
+func loadPracticeScenario(path string) (PracticeScenario, error) {
+	var s PracticeScenario
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return s, fmt.Errorf("%s: %v", path, err)
+	}
+	return s, nil
+}
+
+// runPractice implements the practice command.
+func runPractice(args []string) {
+	fs := flag.NewFlagSet("practice", flag.ExitOnError)
+	seed := fs.Int64("seed", 0, "Exercise number; the same seed gives the same exercise (default: random)")
+	grade := fs.String("grade", "", "Grade the plan JSON files given against this exercise JSON file")
+	format := fs.String("format", reportText, "Grading report format: text, junit or tap")
+	jsonOut := fs.Bool("j", false, "Write the exercise as JSON, for grading")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner practice [-seed n] [-j]")
+		fmt.Println("       ipv6planner practice -grade exercise.json [-format text|junit|tap] plan.json ...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *grade == "" {
+		if fs.NArg() > 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if *seed == 0 {
+			*seed = time.Now().UnixNano() % 1000000
+		}
+		scenario := newPracticeScenario(*seed)
+		if *jsonOut {
+			jsonData, err := json.MarshalIndent(scenario, "", "  ")
+			if err != nil {
+				fmt.Printf("Error generating JSON: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(jsonData))
+			return
+		}
+		writePracticeText(os.Stdout, scenario)
+		return
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := parseReportFormat(*format); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	scenario, err := loadPracticeScenario(*grade)
+	if err != nil {
+		fmt.Printf("Error loading exercise: %v\n", err)
+		os.Exit(1)
+	}
+	var suites []checkSuite
+	for _, path := range fs.Args() {
+		suite := checkSuite{Name: path}
+		plan, err := loadPlan(path)
+		if err != nil {
+			suite.Checks = []checkResult{{Name: "Plan loads", Failures: []string{err.Error()}}}
+		} else {
+			suite.Checks = gradePractice(scenario, plan)
+		}
+		suites = append(suites, suite)
+	}
+	if err := writeChecks(os.Stdout, *format, "practice", suites); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *format == reportText {
+		for _, s := range suites {
+			passed := len(s.Checks)
+			for _, c := range s.Checks {
+				if len(c.Failures) > 0 {
+					passed--
+				}
+			}
+			fmt.Printf("%s: %d of %d passed\n", s.Name, passed, len(s.Checks))
+		}
+	}
+	if failedChecks(suites) > 0 {
+		os.Exit(1)
+	}
+}
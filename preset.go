@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// planPreset plans the blocks one kind of access network needs in every
+// POP from counts in the requirements, with the levels, roles and
+// addressing that suit it as defaults.
+type planPreset struct {
+	name       string
+	levels     []int
+	roles      map[int]string
+	addressing map[int]string
+	// columns are the requirement counts the preset reads
+	columns []string
+	blocks  func(counts map[string]int) ([]presetBlock, error)
+}
+
+// presetBlock is a block of a POP holding count prefixes of length unit,
+// rounded up to a power of two and, for infrastructure that grows in ways
+// the counts do not show, to at least a /longest. used is how many are in
+// use, where the requirements say.
+type presetBlock struct {
+	name    string
+	unit    int
+	count   int
+	longest int
+	used    int
+}
+
+// prefixLen is the length of the block.
+func (b presetBlock) prefixLen() int {
+	length := b.unit
+	if b.count > 1 {
+		length -= bits.Len(uint(b.count - 1))
+	}
+	if b.longest > 0 && length > b.longest {
+		length = b.longest
+	}
+	return length
+}
+
+var planPresets = map[string]planPreset{
+	// One /64 per PDU session (3GPP TS 23.501), pooled per UPF or PGW,
+	// with /56s for the N6 links to the data networks and for roaming
+	// interconnects
+	"mobile": {
+		name:       "mobile",
+		levels:     []int{56, 64},
+		roles:      map[int]string{64: roleLAN},
+		addressing: map[int]string{64: addressingSLAAC},
+		columns:    []string{"subscribers", "upfs", "roaming_partners"},
+		blocks: func(counts map[string]int) ([]presetBlock, error) {
+			sessions, upfs := counts["subscribers"], counts["upfs"]
+			if sessions < 1 {
+				return nil, fmt.Errorf("the mobile preset needs a subscribers count (PDU sessions)")
+			}
+			if upfs < 1 {
+				upfs = 1
+			}
+			var blocks []presetBlock
+			for i := 1; i <= upfs; i++ {
+				perUPF := (sessions + upfs - 1) / upfs
+				blocks = append(blocks, presetBlock{name: fmt.Sprintf("upf-%d", i), unit: 64, count: perUPF, used: perUPF})
+			}
+			partners := counts["roaming_partners"]
+			return append(blocks,
+				presetBlock{name: "n6", unit: 64, count: upfs, longest: 56, used: upfs},
+				presetBlock{name: "roaming", unit: 64, count: partners, longest: 56, used: partners}), nil
+		},
+	},
+	// Per CMTS: a /64 of cable modem management addresses per node (service
+	// group), a /56 delegated to each subscriber's CPE, and a /64 per node
+	// for the MTAs of voice customers
+	"cable": {
+		name:       "cable",
+		levels:     []int{56, 64},
+		roles:      map[int]string{56: roleResidential, 64: roleLAN},
+		addressing: map[int]string{64: addressingDHCPv6},
+		columns:    []string{"cmts", "nodes", "subscribers", "mtas"},
+		blocks: func(counts map[string]int) ([]presetBlock, error) {
+			cmts, nodes, subscribers := counts["cmts"], counts["nodes"], counts["subscribers"]
+			if subscribers < 1 {
+				return nil, fmt.Errorf("the cable preset needs a subscribers count")
+			}
+			if cmts < 1 {
+				cmts = 1
+			}
+			if nodes < cmts {
+				nodes = cmts
+			}
+			// Nodes and subscribers are spread evenly, rounding up
+			share := func(n int) int { return (n + cmts - 1) / cmts }
+			var blocks []presetBlock
+			for i := 1; i <= cmts; i++ {
+				name := fmt.Sprintf("cmts-%d", i)
+				blocks = append(blocks,
+					presetBlock{name: name + "-cm", unit: 64, count: share(nodes), used: share(nodes)},
+					presetBlock{name: name + "-cpe-pd", unit: 56, count: share(subscribers), used: share(subscribers)})
+				if counts["mtas"] > 0 {
+					blocks = append(blocks, presetBlock{name: name + "-mta", unit: 64, count: share(nodes), used: share(nodes)})
+				}
+			}
+			return blocks, nil
+		},
+	},
+	// Per OLT (or fixed-wireless access point): a /56 for every ONT its PON
+	// ports can serve at their split ratio, and a /64 per OLT for managing
+	// it and its ONTs
+	"ftth": {
+		name:       "ftth",
+		levels:     []int{56, 64},
+		roles:      map[int]string{56: roleResidential, 64: roleLAN},
+		addressing: map[int]string{64: addressingSLAAC},
+		columns:    []string{"olts", "pon_ports", "split_ratio", "onts"},
+		blocks: func(counts map[string]int) ([]presetBlock, error) {
+			olts, ports, ratio := counts["olts"], counts["pon_ports"], counts["split_ratio"]
+			if olts < 1 {
+				return nil, fmt.Errorf("the ftth preset needs an olts count")
+			}
+			if ports < 1 {
+				ports = 16
+			}
+			if ratio < 1 {
+				ratio = 32
+			}
+			// Pools are sized for every ONT the ports can serve; ONTs
+			// connected today, if counted, are spread evenly
+			onts := (counts["onts"] + olts - 1) / olts
+			var blocks []presetBlock
+			for i := 1; i <= olts; i++ {
+				blocks = append(blocks, presetBlock{name: fmt.Sprintf("olt-%d-pd", i), unit: 56, count: ports * ratio, used: onts})
+			}
+			return append(blocks, presetBlock{name: "mgmt", unit: 64, count: 2 * olts, longest: 56, used: 2 * olts}), nil
+		},
+	},
+}
+
+func presetNames() []string {
+	names := make([]string, 0, len(planPresets))
+	for name := range planPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupPreset(name string) (planPreset, error) {
+	preset, ok := planPresets[name]
+	if !ok {
+		return preset, fmt.Errorf("unknown preset %q (expected %s)", name, strings.Join(presetNames(), ", "))
+	}
+	return preset, nil
+}
+
+// isPresetColumn reports whether some preset reads a requirements column.
+func isPresetColumn(column string) bool {
+	for _, preset := range planPresets {
+		for _, c := range preset.columns {
+			if c == column {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// presetSpace is the number of addresses the blocks take together.
+func presetSpace(blocks []presetBlock) *big.Int {
+	space := new(big.Int)
+	for _, b := range blocks {
+		space.Add(space, new(big.Int).Lsh(big.NewInt(1), uint(128-b.prefixLen())))
+	}
+	return space
+}
+
+// sizeFromPreset derives the POP size from the POP needing the most room for
+// its preset blocks and its demands, and returns every POP's demands, blocks
+// and own required size.
+func sizeFromPreset(name string, reqs []POPRequirement, roles map[int]string, nibble bool) (int, [][]LevelDemand, [][]presetBlock, []int, string, error) {
+	preset, err := lookupPreset(name)
+	if err != nil {
+		return 0, nil, nil, nil, "", err
+	}
+	if len(reqs) == 0 {
+		return 0, nil, nil, nil, "", fmt.Errorf("-preset %s needs -requirements with %s for each POP", name, strings.Join(preset.columns, ", "))
+	}
+	size, largest := 128, 0
+	demands := make([][]LevelDemand, len(reqs))
+	blocks := make([][]presetBlock, len(reqs))
+	sizes := make([]int, len(reqs))
+	for i, req := range reqs {
+		if demands[i], err = popDemands(req, roles); err != nil {
+			return 0, nil, nil, nil, "", err
+		}
+		if blocks[i], err = preset.blocks(req.Counts); err != nil {
+			return 0, nil, nil, nil, "", fmt.Errorf("%s: %v", requirementName(req, i), err)
+		}
+		space := demandSpace(demands[i])
+		sizes[i] = spaceSize(space.Add(space, presetSpace(blocks[i])))
+		if sizes[i] < size {
+			size, largest = sizes[i], i
+		}
+	}
+	note := fmt.Sprintf("POP size /%d derived from the %s preset's blocks for %d POPs; the largest is at %s.", size, name, len(reqs), requirementName(reqs[largest], largest))
+	if nibble && size%4 != 0 {
+		aligned := size / 4 * 4
+		note += fmt.Sprintf(" Rounded from /%d to /%d so POP boundaries fall on a nibble.", size, aligned)
+		size = aligned
+	}
+	return size, demands, blocks, sizes, note, nil
+}
+
+// layoutPreset places the blocks in the POP, largest first so each one
+// falls on its own boundary.
+func layoutPreset(pop netip.Prefix, blocks []presetBlock) []POPPool {
+	sorted := append([]presetBlock(nil), blocks...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].prefixLen() < sorted[j].prefixLen() })
+	offset := new(big.Int)
+	pools := make([]POPPool, len(sorted))
+	for i, b := range sorted {
+		length := b.prefixLen()
+		pools[i] = POPPool{
+			Name:       b.name,
+			PrefixSize: b.unit,
+			Prefixes:   []string{netip.PrefixFrom(addrAdd(pop.Addr(), offset), length).String()},
+			Capacity:   calculateAvailableSubnets(length, b.unit),
+			Required:   b.used,
+		}
+		if length == b.unit {
+			pools[i].Capacity = big.NewInt(1)
+		}
+		offset.Add(offset, new(big.Int).Lsh(big.NewInt(1), uint(128-length)))
+	}
+	return pools
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+// What a probe target is expected to do.
+const (
+	expectAlive  = "alive"
+	expectUnused = "unused"
+)
+
+// ProbeTarget is one address to ping and what its answer should be.
+type ProbeTarget struct {
+	Label   string     `json:"label"`
+	Address netip.Addr `json:"address"`
+	Expect  string     `json:"expect"`
+}
+
+// ProbeResult is the outcome of pinging one target.
+type ProbeResult struct {
+	ProbeTarget
+	Replied bool    `json:"replied"`
+	RTTms   float64 `json:"rtt_ms,omitempty"`
+	OK      bool    `json:"ok"`
+}
+
+// probeTargets lists the addresses that should answer once a POP is turned
+// up: its loopback and the gateway of its first LANs, laid out as
+// router-config lays them out.
+func probeTargets(plan IPv6Plan, popNumber, lans int) ([]ProbeTarget, error) {
+	var targets []ProbeTarget
+	for _, pop := range plan.POPAllocations {
+		if popNumber != 0 && pop.POPNumber != popNumber {
+			continue
+		}
+		router, err := buildPOPRouter(pop, interfaceNames{}, 0, lans)
+		if err != nil {
+			return nil, err
+		}
+		for _, iface := range router.Interfaces {
+			targets = append(targets, ProbeTarget{Label: iface.Description, Address: iface.Address.Addr(), Expect: expectAlive})
+		}
+	}
+	return targets, nil
+}
+
+// probeArgument turns a command-line address into a target that should
+// answer, and a prefix into a check that it is unused: nothing answers on
+// its ::1, the address a gateway would take.
+func probeArgument(arg string) (ProbeTarget, error) {
+	if p, err := netip.ParsePrefix(arg); err == nil && p.Addr().Is6() {
+		p = p.Masked()
+		return ProbeTarget{Label: p.String(), Address: p.Addr().Next(), Expect: expectUnused}, nil
+	}
+	a, err := netip.ParseAddr(arg)
+	if err != nil || !a.Is6() {
+		return ProbeTarget{}, failf(ErrInvalidPrefix, "%q is not an IPv6 address or prefix", arg)
+	}
+	return ProbeTarget{Label: a.String(), Address: a, Expect: expectAlive}, nil
+}
+
+// probe sends one ICMPv6 echo request to each target, no faster than rate
+// per second, and waits up to timeout after the last one for replies. It
+// needs a raw socket, so root or CAP_NET_RAW. When ctx is cancelled it stops
+// sending and returns the results of the targets probed so far.
+func probe(ctx context.Context, targets []ProbeTarget, rate float64, timeout time.Duration) ([]ProbeResult, error) {
+	conn, err := net.ListenPacket("ip6:ipv6-icmp", "::")
+	if err != nil {
+		return nil, fmt.Errorf("opening ICMPv6 socket (needs root or CAP_NET_RAW): %v", err)
+	}
+	defer conn.Close()
+
+	id := uint16(os.Getpid())
+	sent := make([]time.Time, len(targets))
+	rtts := make([]time.Duration, len(targets))
+	replied := make([]bool, len(targets))
+	var mu sync.Mutex
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// echo reply: type 129, then code, checksum, identifier, sequence
+			if n < 8 || buf[0] != 129 || binary.BigEndian.Uint16(buf[4:6]) != id {
+				continue
+			}
+			seq := int(binary.BigEndian.Uint16(buf[6:8]))
+			mu.Lock()
+			if seq < len(targets) && !replied[seq] && !sent[seq].IsZero() && sameAddr(from, targets[seq].Address) {
+				replied[seq] = true
+				rtts[seq] = time.Since(sent[seq])
+			}
+			mu.Unlock()
+		}
+	}()
+
+	interval := time.Duration(float64(time.Second) / rate)
+	probed := 0
+send:
+	for i, t := range targets {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				break send
+			case <-time.After(interval):
+			}
+		}
+		msg := make([]byte, 16)
+		msg[0] = 128 // echo request; the kernel fills in the checksum
+		binary.BigEndian.PutUint16(msg[4:6], id)
+		binary.BigEndian.PutUint16(msg[6:8], uint16(i))
+		copy(msg[8:], "v6planr!")
+		mu.Lock()
+		sent[i] = time.Now()
+		mu.Unlock()
+		// an unreachable destination is a result, not a failure
+		conn.WriteTo(msg, &net.IPAddr{IP: net.IP(t.Address.AsSlice()), Zone: t.Address.Zone()})
+		probed++
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(timeout):
+	}
+	conn.Close()
+	<-done
+
+	results := make([]ProbeResult, probed)
+	for i, t := range targets[:probed] {
+		r := ProbeResult{ProbeTarget: t, Replied: replied[i]}
+		if r.Replied {
+			r.RTTms = float64(rtts[i].Microseconds()) / 1000
+		}
+		r.OK = r.Replied == (t.Expect == expectAlive)
+		results[i] = r
+	}
+	return results, nil
+}
+
+func sameAddr(from net.Addr, want netip.Addr) bool {
+	ip, ok := from.(*net.IPAddr)
+	if !ok {
+		return false
+	}
+	got, ok := netip.AddrFromSlice(ip.IP)
+	return ok && got.Unmap() == want.WithZone("")
+}
+
+// runProbe implements the probe command.
+func runProbe(args []string) {
+	fs := flag.NewFlagSet("probe", flag.ExitOnError)
+	planPath := fs.String("plan", "", "Plan JSON file; probe each POP's loopback and LAN gateways")
+	popNumber := fs.Int("pop", 0, "Only probe this POP (default all)")
+	lans := fs.Int("lans", 1, "LAN gateways to probe per POP")
+	rate := fs.Float64("rate", 10, "Probes per second")
+	timeout := fs.Duration("timeout", time.Second, "How long to wait for replies after the last probe")
+	deadline := fs.Duration("deadline", 0, "Stop the sweep after this long and report the targets probed so far (0 for no limit)")
+	jsonOut := fs.Bool("j", false, "JSON output format")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner probe [-plan plan.json] [-pop N] [-rate 10] [-timeout 1s] [-j] [address|prefix ...]")
+		fmt.Println("Addresses are expected to answer. A prefix is checked to be unused: nothing may answer on its ::1.")
+		fmt.Println("Needs root or CAP_NET_RAW to send ICMPv6 echo requests.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *planPath == "" && fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *rate <= 0 {
+		fmt.Println("Error: -rate must be positive")
+		os.Exit(1)
+	}
+
+	var targets []ProbeTarget
+	if *planPath != "" {
+		plan, err := loadPlan(*planPath)
+		if err != nil {
+			fmt.Printf("Error loading plan: %v\n", err)
+			os.Exit(1)
+		}
+		targets, err = probeTargets(plan, *popNumber, *lans)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	for _, arg := range fs.Args() {
+		t, err := probeArgument(arg)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		targets = append(targets, t)
+	}
+	if len(targets) > 1<<16 {
+		fmt.Printf("Error: %d targets; probe at most 65536 at a time\n", len(targets))
+		os.Exit(1)
+	}
+
+	ctx, cancel := commandContext(*deadline)
+	defer cancel()
+	results, err := probe(ctx, targets, *rate, *timeout)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+	if *jsonOut {
+		jsonData, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		for _, r := range results {
+			status := "no reply"
+			if r.Replied {
+				status = fmt.Sprintf("reply in %.2f ms", r.RTTms)
+			}
+			mark := "ok  "
+			if !r.OK {
+				mark = "FAIL"
+			}
+			fmt.Printf("%s  %-39s %-22s expected %-6s  %s\n", mark, r.Address, status, r.Expect, r.Label)
+		}
+		fmt.Printf("%d probed, %d as expected, %d not\n", len(results), len(results)-failed, failed)
+		if len(results) < len(targets) {
+			fmt.Printf("Stopped after %d of %d targets (%v)\n", len(results), len(targets), ctx.Err())
+		}
+	}
+	if failed > 0 || len(results) < len(targets) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net"
+)
+
+// rebasePrefix moves cidr from under oldBase to the same position under
+// newBase. Both bases must have the same length and cidr must lie in oldBase.
+func rebasePrefix(cidr string, oldBase, newBase *net.IPNet) (string, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	if !oldBase.Contains(ip) {
+		return "", failf(ErrOutsideBase, "%s is outside %s", cidr, oldBase)
+	}
+	ones, _ := ipNet.Mask.Size()
+	moved := make(net.IP, net.IPv6len)
+	for i := range moved {
+		moved[i] = newBase.IP[i]&newBase.Mask[i] | ipNet.IP[i]&^newBase.Mask[i]
+	}
+	return (&net.IPNet{IP: moved, Mask: net.CIDRMask(ones, 128)}).String(), nil
+}
+
+// rebasePlan returns a copy of plan with every prefix moved under newBase,
+// which must be the same length as the plan's base. Everything else, from
+// POP numbering to level names, is kept so the two plans line up.
+func rebasePlan(plan IPv6Plan, newBase string) (IPv6Plan, error) {
+	_, oldNet, err := net.ParseCIDR(plan.BaseSubnet)
+	if err != nil {
+		return plan, err
+	}
+	_, newNet, err := net.ParseCIDR(newBase)
+	if err != nil {
+		return plan, err
+	}
+	oldOnes, _ := oldNet.Mask.Size()
+	newOnes, _ := newNet.Mask.Size()
+	if oldOnes != newOnes {
+		return plan, failf(ErrInvalidPrefix, "%s and %s differ in length", plan.BaseSubnet, newBase)
+	}
+	oldNet.IP = oldNet.IP.To16()
+	newNet.IP = newNet.IP.To16()
+
+	rebased := plan
+	rebased.BaseSubnet = newNet.String()
+	rebased.BaseClass = baseClass(newNet)
+	rebased.Integrity = nil
+	rebased.POPAllocations = make([]POPAlloc, len(plan.POPAllocations))
+	for i, pop := range plan.POPAllocations {
+		pop.POPSubnet, err = rebasePrefix(pop.POPSubnet, oldNet, newNet)
+		if err != nil {
+			return plan, err
+		}
+		subnets := make([]SubnetDetail, len(pop.Subnets))
+		for j, subnet := range pop.Subnets {
+			subnet.CIDR, err = rebasePrefix(subnet.CIDR, oldNet, newNet)
+			if err != nil {
+				return plan, err
+			}
+			subnets[j] = subnet
+		}
+		pop.Subnets = subnets
+		pools := make([]POPPool, len(pop.Pools))
+		for j, pool := range pop.Pools {
+			prefixes := make([]string, len(pool.Prefixes))
+			for k, prefix := range pool.Prefixes {
+				if prefixes[k], err = rebasePrefix(prefix, oldNet, newNet); err != nil {
+					return plan, err
+				}
+			}
+			pool.Prefixes = prefixes
+			pools[j] = pool
+		}
+		if pop.Pools != nil {
+			pop.Pools = pools
+		}
+		if pop.OOB != nil {
+			if pop.OOB, err = rebaseOOB(*pop.OOB, oldNet, newNet); err != nil {
+				return plan, err
+			}
+		}
+		rebased.POPAllocations[i] = pop
+	}
+	if plan.OOB != nil {
+		oob := *plan.OOB
+		if oob.Aggregate, err = rebasePrefix(oob.Aggregate, oldNet, newNet); err != nil {
+			return plan, err
+		}
+		rebased.OOB = &oob
+	}
+	if plan.ReservedIDs != nil {
+		rebased.ReservedIDs = make([]ReservedPOPID, len(plan.ReservedIDs))
+		for i, r := range plan.ReservedIDs {
+			if r.Prefix, err = rebasePrefix(r.Prefix, oldNet, newNet); err != nil {
+				return plan, err
+			}
+			rebased.ReservedIDs[i] = r
+		}
+	}
+	rebased.Delegations = make([]DelegatedBlock, len(plan.Delegations))
+	for i, block := range plan.Delegations {
+		block.Prefix, err = rebasePrefix(block.Prefix, oldNet, newNet)
+		if err != nil {
+			return plan, err
+		}
+		rebased.Delegations[i] = block
+	}
+	return rebased, nil
+}
+
+// rebaseOOB moves a POP's management block, levels and networks.
+func rebaseOOB(oob POPOOB, oldBase, newBase *net.IPNet) (*POPOOB, error) {
+	var err error
+	if oob.Prefix, err = rebasePrefix(oob.Prefix, oldBase, newBase); err != nil {
+		return nil, err
+	}
+	subnets := make([]SubnetDetail, len(oob.Subnets))
+	for i, subnet := range oob.Subnets {
+		if subnet.CIDR, err = rebasePrefix(subnet.CIDR, oldBase, newBase); err != nil {
+			return nil, err
+		}
+		subnets[i] = subnet
+	}
+	networks := make([]OOBNetwork, len(oob.Networks))
+	for i, network := range oob.Networks {
+		if network.Prefix, err = rebasePrefix(network.Prefix, oldBase, newBase); err != nil {
+			return nil, err
+		}
+		networks[i] = network
+	}
+	oob.Subnets, oob.Networks = subnets, networks
+	return &oob, nil
+}
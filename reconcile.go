@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Kinds of reconciliation findings.
+const (
+	findingClaimedTwice = "claimed-twice"
+	findingConflict     = "conflict"
+	findingUnrecorded   = "unrecorded"
+)
+
+var reconcileChecks = []struct{ kind, name string }{
+	{findingInvalid, "Entries are IPv6 prefixes"},
+	{findingClaimedTwice, "No prefix is claimed by more than one IPAM source"},
+	{findingConflict, "Sources agree on each prefix's POP and description"},
+	{findingUnrecorded, "Announced and configured prefixes are recorded in an IPAM source"},
+}
+
+// ReconcileReport compares the prefixes several sources hold: IPAM exports,
+// which claim prefixes, and RIBs and router configurations, which show
+// what is in use.
+type ReconcileReport struct {
+	Sources  []string       `json:"sources"`
+	Prefixes int            `json:"prefixes"`
+	Findings []AuditFinding `json:"findings"`
+}
+
+// sourcedEntry is a prefix with the file it was read from.
+type sourcedEntry struct {
+	file string
+	auditEntry
+}
+
+// loadConfigPrefixes reads the IPv6 prefixes configured in a router
+// configuration, whatever its syntax: every address written with a prefix
+// length, as interface addresses are, gives the prefix it is in.
+// Link-local addresses and default routes are skipped.
+func loadConfigPrefixes(path string) ([]auditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	linkLocal := netip.MustParsePrefix("fe80::/10")
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		for _, token := range ipv6Token.FindAllString(scanner.Text(), -1) {
+			p, err := netip.ParsePrefix(token)
+			if err != nil || !p.Addr().Is6() || p.Addr().Is4In6() || p.Bits() == 0 || linkLocal.Contains(p.Addr()) {
+				continue
+			}
+			entries = append(entries, auditEntry{Prefix: p.Masked(), Source: fmt.Sprintf("%s:%d", path, line)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return entries, nil
+}
+
+// reconcile reports prefixes claimed by more than one of the IPAM sources,
+// claims that disagree on a prefix's POP or description, and observed
+// prefixes that no claim covers or lies under. POP references are
+// compared by number when a plan is given, so "3" and a POP's name agree.
+func reconcile(claims, observed []sourcedEntry, plan *IPv6Plan) ReconcileReport {
+	report := ReconcileReport{Findings: []AuditFinding{}}
+	add := func(kind string, p netip.Prefix, sources []string, format string, args ...interface{}) {
+		report.Findings = append(report.Findings, AuditFinding{
+			Kind:   kind,
+			Prefix: p.String(),
+			Source: strings.Join(sources, "; "),
+			Detail: fmt.Sprintf(format, args...),
+		})
+	}
+	popKey := func(ref string) string {
+		ref = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(ref), "POP"))
+		if plan != nil {
+			for _, pop := range plan.POPAllocations {
+				if matchesPOP(pop, ref) {
+					return fmt.Sprint(pop.POPNumber)
+				}
+			}
+		}
+		return strings.ToLower(ref)
+	}
+
+	byPrefix := make(map[netip.Prefix][]sourcedEntry)
+	var order []netip.Prefix
+	for _, c := range claims {
+		if byPrefix[c.Prefix] == nil {
+			order = append(order, c.Prefix)
+		}
+		byPrefix[c.Prefix] = append(byPrefix[c.Prefix], c)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if c := order[i].Addr().Compare(order[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return order[i].Bits() < order[j].Bits()
+	})
+
+	for _, p := range order {
+		entries := byPrefix[p]
+		var files, sources []string
+		pops := make(map[string][]string)
+		descriptions := make(map[string][]string)
+		for _, e := range entries {
+			if !containsString(files, e.file) {
+				files = append(files, e.file)
+			}
+			sources = append(sources, e.Source)
+			if e.POP != "" {
+				key := popKey(e.POP)
+				pops[key] = append(pops[key], fmt.Sprintf("%s in %s", e.POP, e.Source))
+			}
+			if e.Description != "" {
+				key := strings.ToLower(e.Description)
+				descriptions[key] = append(descriptions[key], e.Source)
+			}
+		}
+		if len(files) > 1 {
+			add(findingClaimedTwice, p, sources, "claimed by %s", strings.Join(files, " and "))
+		}
+		if len(pops) > 1 {
+			var listed []string
+			for _, where := range pops {
+				listed = append(listed, where...)
+			}
+			sort.Strings(listed)
+			add(findingConflict, p, sources, "listed for different POPs: %s", strings.Join(listed, ", "))
+		}
+		if len(descriptions) > 1 {
+			add(findingConflict, p, sources, "described differently in %d sources", len(descriptions))
+		}
+	}
+
+	// A claim covers an observed prefix when one lies inside the other: an
+	// aggregate route over assignments is as expected as an interface in an
+	// assigned block. Sorted claims with a running maximum of their last
+	// addresses answer both with binary searches.
+	maxLast := make([]netip.Addr, len(order))
+	for i, p := range order {
+		maxLast[i] = lastAddress(p)
+		if i > 0 && maxLast[i-1].Compare(maxLast[i]) > 0 {
+			maxLast[i] = maxLast[i-1]
+		}
+	}
+	covered := func(p netip.Prefix) bool {
+		first := sort.Search(len(order), func(i int) bool { return order[i].Addr().Compare(p.Addr()) >= 0 })
+		if first < len(order) && order[first].Addr().Compare(lastAddress(p)) <= 0 {
+			return true
+		}
+		return first > 0 && maxLast[first-1].Compare(p.Addr()) >= 0
+	}
+	seen := make(map[netip.Prefix]bool)
+	for _, o := range observed {
+		if seen[o.Prefix] {
+			continue
+		}
+		seen[o.Prefix] = true
+		if !covered(o.Prefix) {
+			add(findingUnrecorded, o.Prefix, []string{o.Source}, "in use but in no IPAM source")
+		}
+	}
+	report.Prefixes = len(order) + len(seen)
+	return report
+}
+
+// reconcileSuite turns a report into one check per kind of finding.
+func reconcileSuite(report ReconcileReport) checkSuite {
+	suite := checkSuite{Name: "reconcile " + strings.Join(report.Sources, ", ")}
+	for _, check := range reconcileChecks {
+		result := checkResult{Name: check.name}
+		for _, f := range report.Findings {
+			if f.Kind == check.kind {
+				result.Failures = append(result.Failures, fmt.Sprintf("%s (%s): %s", f.Prefix, f.Source, f.Detail))
+			}
+		}
+		suite.Checks = append(suite.Checks, result)
+	}
+	return suite
+}
+
+// runReconcile implements the reconcile command.
+func runReconcile(args []string) {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	ribPaths := fs.String("rib", "", "Comma-separated RIB exports (MRT TABLE_DUMP_V2 or flat JSON) of announced prefixes")
+	configPaths := fs.String("configs", "", "Comma-separated router configurations whose interface prefixes are in use")
+	planPath := fs.String("plan", "", "Plan JSON file, to match POP names and numbers")
+	jsonOut := fs.Bool("j", false, "JSON output format")
+	format := fs.String("format", reportText, "Report format when not -j: text, junit or tap")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner reconcile [-plan plan.json] [-rib rib.json,...] [-configs r1.conf,...] [-j | -format junit|tap] ipam.csv ...")
+		fmt.Println("Each IPAM CSV line is prefix[,pop[,description]], as for audit.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := parseReportFormat(*format); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	ribs, configs := splitList(*ribPaths), splitList(*configPaths)
+	if fs.NArg()+len(ribs)+len(configs) < 2 || fs.NArg() == 0 {
+		fmt.Println("Error: reconcile needs at least one IPAM CSV and two sources in all")
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var plan *IPv6Plan
+	if *planPath != "" {
+		p, err := loadPlan(*planPath)
+		if err != nil {
+			fmt.Printf("Error loading plan: %v\n", err)
+			os.Exit(1)
+		}
+		plan = &p
+	}
+
+	var claims, observed []sourcedEntry
+	var invalid []AuditFinding
+	var sources []string
+	for _, path := range fs.Args() {
+		entries, bad, err := loadAuditCSV(path)
+		if err != nil {
+			fmt.Printf("Error loading prefixes: %v\n", err)
+			os.Exit(1)
+		}
+		for _, e := range entries {
+			claims = append(claims, sourcedEntry{path, e})
+		}
+		invalid = append(invalid, bad...)
+		sources = append(sources, path)
+	}
+	for _, path := range ribs {
+		ctx, cancel := commandContext(0)
+		routes, err := loadRIB(ctx, path)
+		cancel()
+		if err != nil {
+			fmt.Printf("Error loading RIB: %v\n", err)
+			os.Exit(1)
+		}
+		for _, e := range routes {
+			observed = append(observed, sourcedEntry{path, e})
+		}
+		sources = append(sources, path)
+	}
+	for _, path := range configs {
+		entries, err := loadConfigPrefixes(path)
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+		for _, e := range entries {
+			observed = append(observed, sourcedEntry{path, e})
+		}
+		sources = append(sources, path)
+	}
+
+	report := reconcile(claims, observed, plan)
+	report.Sources = sources
+	report.Findings = append(invalid, report.Findings...)
+
+	switch {
+	case *jsonOut:
+		jsonData, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	case *format != reportText:
+		if err := writeChecks(os.Stdout, *format, "reconcile", []checkSuite{reconcileSuite(report)}); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Printf("Reconciled %d sources: %d prefixes, %d findings\n", len(report.Sources), report.Prefixes, len(report.Findings))
+		for _, f := range report.Findings {
+			fmt.Printf("  %-13s %-40s %s\n      %s\n", f.Kind, f.Prefix, f.Detail, f.Source)
+		}
+	}
+	if len(report.Findings) > 0 {
+		os.Exit(1)
+	}
+}
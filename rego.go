@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// defaultRegoQuery follows the conftest convention: a policy package
+// collects the messages of every broken rule in a deny set.
+const defaultRegoQuery = "data.ipv6plan.deny"
+
+// evaluateRego evaluates plan against the Rego policies at policyPath (a
+// .rego file or a directory of them) with the opa binary, and returns the
+// denial messages. A set or array result lists denials; a boolean result is
+// a pass or fail; an undefined result means nothing was denied. opa is
+// stopped when ctx is cancelled.
+func evaluateRego(ctx context.Context, plan IPv6Plan, policyPath, query string) ([]string, error) {
+	input, err := json.Marshal(plan)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "opa", "eval", "--format", "json", "--stdin-input", "--data", policyPath, query)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String() + stdout.String()); msg != "" {
+			return nil, fmt.Errorf("opa eval: %v: %s", err, msg)
+		}
+		return nil, fmt.Errorf("opa eval: %v (is opa installed?)", err)
+	}
+
+	var out struct {
+		Result []struct {
+			Expressions []struct {
+				Value interface{} `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("opa eval: unexpected output: %v", err)
+	}
+
+	var denials []string
+	for _, result := range out.Result {
+		for _, expr := range result.Expressions {
+			switch v := expr.Value.(type) {
+			case bool:
+				if !v {
+					denials = append(denials, query+" is false")
+				}
+			case []interface{}:
+				for _, msg := range v {
+					denials = append(denials, regoMessage(msg))
+				}
+			case map[string]interface{}:
+				// a partial object rule: the keys name what was denied
+				for key := range v {
+					denials = append(denials, key)
+				}
+				sort.Strings(denials)
+			default:
+				denials = append(denials, regoMessage(v))
+			}
+		}
+	}
+	return denials, nil
+}
+
+func regoMessage(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// renderExtensions are the file extensions render writes each format as.
+var renderExtensions = map[string]string{
+	"text":      ".txt",
+	"json":      ".json",
+	"html":      ".html",
+	"state-csv": ".csv",
+	"go":        ".go",
+	"python":    ".py",
+	"c-header":  ".h",
+	"jinja":     ".vars.json",
+}
+
+// RenderedPlan is one plan of a render run: where it came from, the files
+// written for it, or why it could not be rendered.
+type RenderedPlan struct {
+	Source     string            `json:"source"`
+	BaseSubnet string            `json:"base_subnet,omitempty"`
+	POPs       int               `json:"pops"`
+	Files      map[string]string `json:"files,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// findPlanFiles lists the .json files under dir, skipping skip, which is
+// where the output goes.
+func findPlanFiles(dir, skip string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if abs, _ := filepath.Abs(path); abs == skip {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	sort.Strings(paths)
+	return paths, err
+}
+
+// renderPlan writes one plan in every format under outDir, at the path
+// name (the plan's path relative to its directory, without .json) with
+// each format's extension.
+func renderPlan(path, name, outDir string, formats []string, opts exportOptions) RenderedPlan {
+	result := RenderedPlan{Source: path}
+	plan, err := loadPlan(path)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.BaseSubnet, result.POPs = plan.BaseSubnet, len(plan.POPAllocations)
+	result.Files = make(map[string]string)
+	for _, format := range formats {
+		var buf bytes.Buffer
+		if err := newExporter(format, opts).Export(&buf, plan); err != nil {
+			result.Error = fmt.Sprintf("%s: %s: %v", path, format, err)
+			return result
+		}
+		file := filepath.Join(outDir, name+renderExtensions[format])
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err == nil {
+			err = os.WriteFile(file, buf.Bytes(), 0644)
+		}
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Files[format] = filepath.ToSlash(name + renderExtensions[format])
+	}
+	return result
+}
+
+// writeRenderIndex writes the summary page linking every rendered file.
+func writeRenderIndex(w io.Writer, plans []RenderedPlan, formats []string) error {
+	const tpl = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <title>IPv6 plans</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; }
+        table { border-collapse: collapse; }
+        th, td { border: 1px solid #ddd; padding: 6px; text-align: left; }
+        th { background-color: #f2f2f2; }
+        .error { color: #b00; }
+    </style>
+</head>
+<body>
+    <h1>IPv6 plans</h1>
+    <p>{{len .Plans}} plans{{if .Failed}}, {{.Failed}} could not be rendered{{end}}.</p>
+    <table>
+        <thead><tr><th scope="col">Plan</th><th scope="col">Base</th><th scope="col">POPs</th>{{range .Formats}}<th scope="col">{{.}}</th>{{end}}</tr></thead>
+        <tbody>
+        {{range .Plans}}<tr><th scope="row">{{.Source}}</th>{{if .Error}}<td class="error" colspan="{{$.Columns}}">{{.Error}}</td>{{else}}<td>{{.BaseSubnet}}</td><td>{{.POPs}}</td>{{$files := .Files}}{{range $.Formats}}<td><a href="{{index $files .}}">{{index $files .}}</a></td>{{end}}{{end}}</tr>
+        {{end}}
+        </tbody>
+    </table>
+</body>
+</html>
+`
+	failed := 0
+	for _, p := range plans {
+		if p.Error != "" {
+			failed++
+		}
+	}
+	t := template.Must(template.New("index").Parse(tpl))
+	return t.Execute(w, struct {
+		Plans   []RenderedPlan
+		Formats []string
+		Failed  int
+		Columns int
+	}{plans, formats, failed, len(formats) + 2})
+}
+
+// runRender implements the render command.
+func runRender(args []string) {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	outDir := fs.String("o", "", "Directory to write the rendered plans and index.html to")
+	formatList := fs.String("formats", "text,json,html,state-csv", "Comma-separated output formats: "+strings.Join(exportFormats(), ", "))
+	lang := fs.String("lang", "en", "Language of text and HTML headings: en, es, de or ja")
+	parallel := fs.Int("parallel", runtime.NumCPU(), "Plans rendered at once")
+	jsonOut := fs.Bool("j", false, "Print the summary as JSON")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner render -o out-dir [-formats text,json,html,state-csv] [-lang en] [-parallel n] [-j] plans-dir ...")
+		fmt.Println("Every .json file under the directories is rendered, keeping its relative path.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *outDir == "" || fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	formats := splitList(*formatList)
+	for _, format := range formats {
+		if _, ok := exporters[format]; !ok {
+			fmt.Printf("Error: unknown format %q (expected %s)\n", format, strings.Join(exportFormats(), ", "))
+			os.Exit(2)
+		}
+	}
+	if len(formats) == 0 || *parallel < 1 {
+		fmt.Println("Error: -formats cannot be empty and -parallel must be at least 1")
+		os.Exit(2)
+	}
+	m, err := catalog(*lang)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	opts := exportOptions{Messages: m, Lang: strings.ToLower(*lang), Enumerate: defaultJinjaEnumerate}
+
+	absOut, _ := filepath.Abs(*outDir)
+	var jobs []struct{ path, name string }
+	names := make(map[string]string)
+	for _, dir := range fs.Args() {
+		paths, err := findPlanFiles(dir, absOut)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, path := range paths {
+			rel, _ := filepath.Rel(dir, path)
+			name := strings.TrimSuffix(rel, filepath.Ext(rel))
+			if other, dup := names[name]; dup {
+				// Two directories holding the same file name would write
+				// the same output files
+				fmt.Printf("Error: %s and %s would both be rendered as %s\n", other, path, name)
+				os.Exit(1)
+			}
+			names[name] = path
+			jobs = append(jobs, struct{ path, name string }{path, name})
+		}
+	}
+	if len(jobs) == 0 {
+		fmt.Printf("Error: no .json files in %s\n", strings.Join(fs.Args(), ", "))
+		os.Exit(1)
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	results := make([]RenderedPlan, len(jobs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < *parallel && w < len(jobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = renderPlan(jobs[i].path, jobs[i].name, *outDir, formats, opts)
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var index bytes.Buffer
+	if err := writeRenderIndex(&index, results, formats); err != nil {
+		fmt.Printf("Error generating index: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(filepath.Join(*outDir, "index.html"), index.Bytes(), 0644); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	if *jsonOut {
+		jsonData, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		fmt.Printf("Rendered %d of %d plans into %s (%s)\n", len(results)-failed, len(results), *outDir, strings.Join(formats, ", "))
+		for _, r := range results {
+			if r.Error != "" {
+				fmt.Printf("  %s\n", r.Error)
+			}
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// POPRequirement is the expected demand at one POP, and where it is.
+type POPRequirement struct {
+	Name      string   `json:"name,omitempty"`
+	Sites     int      `json:"sites,omitempty"`
+	VLANs     int      `json:"vlans,omitempty"`
+	Customers int      `json:"customers,omitempty"`
+	Links     int      `json:"links,omitempty"`
+	City      string   `json:"city,omitempty"`
+	Country   string   `json:"country,omitempty"`
+	LOCODE    string   `json:"locode,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	// PoolCustomers counts customers per -split pool, from CSV columns
+	// such as wholesale_customers
+	PoolCustomers map[string]int `json:"pool_customers,omitempty"`
+	// Counts holds the columns a -preset reads, such as subscribers
+	Counts map[string]int `json:"counts,omitempty"`
+}
+
+// hasDemand reports whether any requirement counts something, as opposed
+// to a file that only names and locates the POPs.
+func hasDemand(reqs []POPRequirement) bool {
+	for _, req := range reqs {
+		for _, k := range demandKinds {
+			if k.count(req) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LevelDemand compares what a POP needs at one level with what it gets.
+type LevelDemand struct {
+	Kind       string   `json:"kind"`
+	PrefixSize int      `json:"prefix_size"`
+	Required   int      `json:"required"`
+	Available  *big.Int `json:"available"`
+}
+
+// demandKinds maps each requirement column to the level roles that serve it
+// and to its count in a requirement.
+var demandKinds = []struct {
+	kind  string
+	roles []string
+	count func(POPRequirement) int
+}{
+	{"sites", []string{roleSite, roleBusiness}, func(r POPRequirement) int { return r.Sites }},
+	{"customers", []string{roleResidential, roleBusiness}, func(r POPRequirement) int { return r.Customers }},
+	{"vlans", []string{roleLAN}, func(r POPRequirement) int { return r.VLANs }},
+	{"links", []string{roleP2P}, func(r POPRequirement) int { return r.Links }},
+}
+
+// demandLevel returns the most general level whose role serves kind.
+func demandLevel(roles map[int]string, allowed []string) (int, bool) {
+	levels := make([]int, 0, len(roles))
+	for level := range roles {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+	for _, level := range levels {
+		for _, role := range allowed {
+			if roles[level] == role {
+				return level, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// popDemands lists what one POP needs at each level. Available is left for
+// the caller to fill in once the POP size is known.
+func popDemands(req POPRequirement, roles map[int]string) ([]LevelDemand, error) {
+	var demands []LevelDemand
+	for _, k := range demandKinds {
+		n := k.count(req)
+		if n < 0 {
+			return nil, fmt.Errorf("%s: %s cannot be negative", req.Name, k.kind)
+		}
+		if n == 0 {
+			continue
+		}
+		level, ok := demandLevel(roles, k.roles)
+		if !ok {
+			return nil, fmt.Errorf("requirements list %s, but no level has the %s role (set -roles)", k.kind, strings.Join(k.roles, " or "))
+		}
+		demands = append(demands, LevelDemand{Kind: k.kind, PrefixSize: level, Required: n})
+	}
+	return demands, nil
+}
+
+// requiredSize is the longest POP prefix that holds every demand. Demands
+// are counted as separate space, which overestimates a little when one kind
+// nests inside another (VLANs inside sites) but never underestimates.
+func requiredSize(demands []LevelDemand) int {
+	return spaceSize(demandSpace(demands))
+}
+
+// demandSpace is the number of addresses the demands take together.
+func demandSpace(demands []LevelDemand) *big.Int {
+	space := new(big.Int)
+	for _, d := range demands {
+		space.Add(space, new(big.Int).Lsh(big.NewInt(int64(d.Required)), uint(128-d.PrefixSize)))
+	}
+	return space
+}
+
+// spaceSize is the longest prefix holding space addresses.
+func spaceSize(space *big.Int) int {
+	if space.Sign() == 0 {
+		return 128
+	}
+	bits := space.BitLen()
+	if new(big.Int).Lsh(big.NewInt(1), uint(bits-1)).Cmp(space) == 0 {
+		bits--
+	}
+	return 128 - bits
+}
+
+// sizeFromRequirements derives the POP size from the POP with the largest
+// demand, and returns every POP's demands and own required size.
+func sizeFromRequirements(reqs []POPRequirement, roles map[int]string, nibble bool) (int, [][]LevelDemand, []int, string, error) {
+	size, largest := 128, 0
+	all := make([][]LevelDemand, len(reqs))
+	sizes := make([]int, len(reqs))
+	for i, req := range reqs {
+		demands, err := popDemands(req, roles)
+		if err != nil {
+			return 0, nil, nil, "", err
+		}
+		all[i] = demands
+		sizes[i] = requiredSize(demands)
+		if sizes[i] < size {
+			size, largest = sizes[i], i
+		}
+	}
+	note := fmt.Sprintf("POP size /%d derived from the requirements of %d POPs; the largest demand is at %s.", size, len(reqs), requirementName(reqs[largest], largest))
+	if nibble && size%4 != 0 {
+		aligned := size / 4 * 4
+		note += fmt.Sprintf(" Rounded from /%d to /%d so POP boundaries fall on a nibble.", size, aligned)
+		size = aligned
+	}
+	return size, all, sizes, note, nil
+}
+
+func requirementName(req POPRequirement, i int) string {
+	if req.Name != "" {
+		return req.Name
+	}
+	return fmt.Sprintf("POP %d", i+1)
+}
+
+// loadRequirements reads a .json array of requirements or a CSV file with a
+// header row naming the columns (name, sites, vlans, customers, links, and
+// a <pool>_customers column per -split pool, and the counts -preset reads).
+func loadRequirements(path string) ([]POPRequirement, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var reqs []POPRequirement
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&reqs); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	} else {
+		reqs, err = parseRequirementsCSV(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("%s lists no POPs", path)
+	}
+	for i := range reqs {
+		if err := checkLocation(&reqs[i], i); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return reqs, nil
+}
+
+func parseRequirementsCSV(data []byte) ([]POPRequirement, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var reqs []POPRequirement
+	header := records[0]
+	for line, record := range records[1:] {
+		var req POPRequirement
+		for i, column := range header {
+			value := strings.TrimSpace(record[i])
+			column = strings.ToLower(strings.TrimSpace(column))
+			switch column {
+			case "name", "pop":
+				req.Name = value
+				continue
+			case "city":
+				req.City = value
+				continue
+			case "country":
+				req.Country = strings.ToUpper(value)
+				continue
+			case "locode":
+				req.LOCODE = value
+				continue
+			case "latitude", "lat", "longitude", "lon", "lng":
+				if value == "" {
+					continue
+				}
+				f, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s %q is not a number", line+2, column, value)
+				}
+				if column[:2] == "la" {
+					req.Latitude = &f
+				} else {
+					req.Longitude = &f
+				}
+				continue
+			}
+			n := 0
+			if value != "" {
+				n, err = strconv.Atoi(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s %q is not a number", line+2, column, value)
+				}
+			}
+			switch column {
+			case "sites":
+				req.Sites = n
+			case "vlans":
+				req.VLANs = n
+			case "customers":
+				req.Customers = n
+			case "links":
+				req.Links = n
+			default:
+				if isPresetColumn(column) {
+					if req.Counts == nil {
+						req.Counts = make(map[string]int)
+					}
+					req.Counts[column] = n
+					continue
+				}
+				pool := strings.TrimSuffix(column, "_customers")
+				if pool == column || pool == "" {
+					return nil, fmt.Errorf("unknown column %q (expected name, sites, vlans, customers, links, city, country, locode, latitude, longitude or pool_customers)", column)
+				}
+				if req.PoolCustomers == nil {
+					req.PoolCustomers = make(map[string]int)
+				}
+				req.PoolCustomers[pool] = n
+			}
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// DemandSummary describes a POP's demand against its capacity, e.g.
+// "40 sites of 256 /48s, 2 links of 2^63 /127s (needs /42)".
+func (pop POPAlloc) DemandSummary() string {
+	parts := make([]string, len(pop.Demand))
+	for i, d := range pop.Demand {
+		parts[i] = fmt.Sprintf("%d %s of %s /%d", d.Required, d.Kind, d.Available, d.PrefixSize)
+	}
+	return fmt.Sprintf("%s (needs /%d)", strings.Join(parts, ", "), pop.RequiredSize)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"strings"
+)
+
+// ReservedPOPID is a POP ID kept out of automatic assignment, such as the
+// all-zero ID or a memorable hex code, listed in the plan so it is not
+// handed out later by mistake.
+type ReservedPOPID struct {
+	ID     string   `json:"id"`
+	Prefix string   `json:"prefix"`
+	Count  *big.Int `json:"count"`
+}
+
+// maxReservedRange caps a reserved range, so skipping it while numbering
+// POPs stays quick.
+const maxReservedRange = 1 << 16
+
+// idRange is an inclusive range of POP ID values.
+type idRange struct {
+	lo, hi *big.Int
+}
+
+// parseReservedIDs reads reservations for a POP ID field of fieldBits bits.
+// Each entry is "zero", "ones" (every bit of the field set), a hex value
+// such as "ff" or "0x0a3", or a range of them such as "10-1f".
+func parseReservedIDs(specs []string, fieldBits int) ([]idRange, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(fieldBits))
+	parseID := func(s string) (*big.Int, error) {
+		s = strings.ToLower(strings.TrimSpace(s))
+		switch s {
+		case "zero":
+			return new(big.Int), nil
+		case "ones":
+			return new(big.Int).Sub(limit, big.NewInt(1)), nil
+		}
+		v, ok := new(big.Int).SetString(strings.TrimPrefix(s, "0x"), 16)
+		if !ok || v.Sign() < 0 {
+			return nil, failf(ErrInvalidPrefix, "reserved POP ID %q is not a hex number, zero or ones", s)
+		}
+		if v.Cmp(limit) >= 0 {
+			return nil, failf(ErrInvalidPrefix, "reserved POP ID %q does not fit in the %d-bit POP ID field", s, fieldBits)
+		}
+		return v, nil
+	}
+
+	var ranges []idRange
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(spec, "-")
+		lo, err := parseID(from)
+		if err != nil {
+			return nil, err
+		}
+		hi := lo
+		if isRange {
+			if hi, err = parseID(to); err != nil {
+				return nil, err
+			}
+			if hi.Cmp(lo) < 0 {
+				return nil, failf(ErrInvalidPrefix, "reserved POP ID range %q runs backwards", spec)
+			}
+			if n := new(big.Int).Sub(hi, lo); n.Cmp(big.NewInt(maxReservedRange)) >= 0 {
+				return nil, failf(ErrInvalidPrefix, "reserved POP ID range %q covers more than %d IDs", spec, maxReservedRange)
+			}
+		}
+		ranges = append(ranges, idRange{lo: lo, hi: hi})
+	}
+	return ranges, nil
+}
+
+func reservedID(ranges []idRange, v *big.Int) bool {
+	return holdingRange(ranges, v) != nil
+}
+
+// holdingRange returns the range v falls in, or nil.
+func holdingRange(ranges []idRange, v *big.Int) *idRange {
+	for i, r := range ranges {
+		if v.Cmp(r.lo) >= 0 && v.Cmp(r.hi) <= 0 {
+			return &ranges[i]
+		}
+	}
+	return nil
+}
+
+// popFieldValue is the POP ID given to POP index i when b leading bits of
+// a fieldBits-bit field number the POPs. The index is written bit-reversed,
+// as generateIPv6Plan sets POP bits, which spreads POPs across the field.
+func popFieldValue(i, b, fieldBits int) *big.Int {
+	v := new(big.Int)
+	for bit := 0; bit < b; bit++ {
+		if (i>>bit)&1 == 1 {
+			v.SetBit(v, fieldBits-1-bit, 1)
+		}
+	}
+	return v
+}
+
+// reservePOPIDs picks the POP indexes that avoid the reserved IDs and the
+// IDs already taken by POP codes or delegated blocks, widening the POP numbering by a bit at a
+// time when they crowd it. It returns the indexes, the number of bits they
+// use and the reservations to list in the plan. Without reservations the
+// indexes are simply 0..count-1.
+func reservePOPIDs(specs []string, taken []idRange, base netip.Prefix, popSize, popCount, bitsNeeded int) ([]int, int, []ReservedPOPID, error) {
+	fieldBits := popSize - base.Bits()
+	if (len(specs) == 0 && len(taken) == 0) || fieldBits < 1 {
+		indexes := make([]int, popCount)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, bitsNeeded, nil, nil
+	}
+	if bitsNeeded > fieldBits {
+		return nil, 0, nil, failf(ErrPrefixTooSmall, "%d POPs need %d POP ID bits, but the /%d base fits only %d /%d blocks", popCount, bitsNeeded, base.Bits(), uint64(1)<<uint(fieldBits), popSize)
+	}
+	ranges, err := parseReservedIDs(specs, fieldBits)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	skip := append(ranges[:len(ranges):len(ranges)], taken...)
+
+	var indexes []int
+	bits := bitsNeeded
+	for ; bits <= fieldBits && bits < 63; bits++ {
+		indexes = indexes[:0]
+		for i := 0; i < 1<<bits && len(indexes) < popCount; i++ {
+			if !reservedID(skip, popFieldValue(i, bits, fieldBits)) {
+				indexes = append(indexes, i)
+			}
+		}
+		if len(indexes) == popCount {
+			break
+		}
+	}
+	if len(indexes) < popCount {
+		return nil, 0, nil, failf(ErrOverlap, "after the reserved, coded and delegated POP IDs, /%d POP blocks leave room for %d more POPs, not %d", popSize, len(indexes), popCount)
+	}
+
+	listed := make([]ReservedPOPID, len(ranges))
+	for i, r := range ranges {
+		offset := new(big.Int).Lsh(r.lo, uint(128-popSize))
+		id := formatPOPID(r.lo, fieldBits)
+		if r.hi.Cmp(r.lo) != 0 {
+			id += "-" + formatPOPID(r.hi, fieldBits)
+		}
+		listed[i] = ReservedPOPID{
+			ID:     id,
+			Prefix: netip.PrefixFrom(addrAdd(base.Addr(), offset), popSize).String(),
+			Count:  new(big.Int).Add(new(big.Int).Sub(r.hi, r.lo), big.NewInt(1)),
+		}
+	}
+	return indexes, bits, listed, nil
+}
+
+// popIDs is where each POP of a plan sits in the POP ID field.
+type popIDs struct {
+	codes    map[int]*big.Int // POP IDs fixed by a code, the base plan or a LOCODE
+	chosen   map[int]bool     // POPs whose code was given with -pop-codes
+	hashed   bool             // IDs were derived with -pop-numbering locode
+	indexes  []int            // the other POPs' IDs, in order
+	bits     int              // POP ID bits the indexes are spread over
+	reserved []ReservedPOPID
+	notes    []string
+}
+
+// assignPOPIDs fixes the POP ID of every POP with a code, an ID issued in
+// the base plan or, with -pop-numbering locode, a derived one, and numbers
+// the rest around them, the delegated blocks and the reserved IDs.
+func assignPOPIDs(opts PlanOptions, base netip.Prefix, popSize, popCount int, delegations []DelegatedBlock, delegatedIDs []idRange) (popIDs, error) {
+	var ids popIDs
+	ones := base.Bits()
+	codes, err := resolvePOPCodes(opts.POPCodes, opts.Requirements, popCount, ones, popSize, opts.ReservedIDs)
+	if err != nil {
+		return ids, err
+	}
+	ids.chosen = make(map[int]bool)
+	for i, code := range codes {
+		ids.chosen[i] = true
+		if org := delegatedOwner(delegations, base, popSize, code); org != "" {
+			return ids, failf(ErrOverlap, "POP %d has code %s, inside the block delegated to %s", i+1, formatPOPID(code, popSize-ones), org)
+		}
+	}
+
+	// POPs issued in the base plan keep their IDs
+	pinned, err := pinnedPOPIDs(opts.BasePlan, opts.Requirements, popCount, base, popSize, opts.SubnetLevels, opts.ReservedIDs)
+	if err != nil {
+		return ids, err
+	}
+	for i, v := range pinned {
+		if code, coded := codes[i]; coded && code.Cmp(v) != 0 {
+			return ids, failf(ErrOverlap, "POP %d has code %s, but the base plan issued it POP ID %s", i+1, formatPOPID(code, popSize-ones), formatPOPID(v, popSize-ones))
+		}
+	}
+	for i, code := range codes {
+		if _, kept := pinned[i]; kept {
+			continue
+		}
+		for j, v := range pinned {
+			if code.Cmp(v) == 0 {
+				return ids, failf(ErrOverlap, "POP %d has code %s, which the base plan issued to POP %d", i+1, formatPOPID(code, popSize-ones), j+1)
+			}
+		}
+	}
+	for i, v := range pinned {
+		if org := delegatedOwner(delegations, base, popSize, v); org != "" {
+			return ids, failf(ErrOverlap, "POP %d was issued POP ID %s in the base plan, inside the block now delegated to %s", i+1, formatPOPID(v, popSize-ones), org)
+		}
+	}
+	if len(pinned) > 0 {
+		if codes == nil {
+			codes = make(map[int]*big.Int)
+		}
+		for i, v := range pinned {
+			codes[i] = v
+		}
+		ids.notes = append(ids.notes, fmt.Sprintf("%d POPs keep the prefixes issued in the base plan; the other %d are numbered around them.", len(pinned), popCount-len(pinned)))
+	}
+
+	switch opts.POPNumbering {
+	case "", numberByIndex:
+	case numberByLOCODE:
+		hashed, err := locodePOPIDs(opts.Requirements, codes, opts.ReservedIDs, delegatedIDs, popSize-ones)
+		if err != nil {
+			return ids, err
+		}
+		if codes == nil {
+			codes = make(map[int]*big.Int)
+		}
+		for i, v := range hashed {
+			codes[i] = v
+		}
+		ids.hashed = true
+		ids.notes = append(ids.notes, fmt.Sprintf("POP IDs are derived from each POP's UN/LOCODE or name, so a POP keeps its prefix as long as the base stays /%d and POPs stay /%d.", ones, popSize))
+	default:
+		return ids, fmt.Errorf("unknown POP numbering %q (expected %s or %s)", opts.POPNumbering, numberByIndex, numberByLOCODE)
+	}
+	ids.codes = codes
+
+	taken := append([]idRange(nil), delegatedIDs...)
+	for _, v := range codes {
+		taken = append(taken, idRange{lo: v, hi: v})
+	}
+	if capacity := maxPOPCount(ones, popSize); len(taken)+len(opts.ReservedIDs) > 0 && big.NewInt(int64(popCount)).Cmp(capacity) > 0 {
+		return ids, failf(ErrPrefixTooSmall, "%d POPs requested but the /%d base fits only %s /%d blocks", popCount, ones, capacity, popSize)
+	}
+	autoBits := popBits(popCount - len(codes))
+	ids.indexes, ids.bits, ids.reserved, err = reservePOPIDs(opts.ReservedIDs, taken, base, popSize, popCount-len(codes), autoBits)
+	if err != nil {
+		return ids, err
+	}
+	if len(opts.ReservedIDs) > 0 && ids.bits > autoBits {
+		ids.notes = append(ids.notes, fmt.Sprintf("POPs are numbered with %d POP ID bits instead of %d to leave the reserved POP IDs unassigned.", ids.bits, autoBits))
+	}
+	return ids, nil
+}
+
+// formatPOPID writes v in hex, padded to the width of the POP ID field.
+func formatPOPID(v *big.Int, fieldBits int) string {
+	return fmt.Sprintf("0x%0*x", (fieldBits+3)/4, v)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// ReverseDelegation lists the ip6.arpa zones that together cover one prefix.
+// ip6.arpa labels are nibbles, so a prefix that is not a multiple of 4 bits
+// long has to be delegated as several zones at the next nibble boundary.
+type ReverseDelegation struct {
+	Label  string   `json:"label,omitempty"`
+	Prefix string   `json:"prefix"`
+	Zones  []string `json:"zones"`
+}
+
+// reverseZones returns the ip6.arpa zones that cover p.
+func reverseZones(p netip.Prefix) []string {
+	p = p.Masked()
+	nibbles := (p.Bits() + 3) / 4
+	extra := nibbles*4 - p.Bits()
+	a := p.Addr().As16()
+
+	zones := make([]string, 0, 1<<uint(extra))
+	for i := 0; i < 1<<uint(extra); i++ {
+		b := a
+		for bit := 0; bit < extra; bit++ {
+			setBit(&b, p.Bits()+bit, (i>>(extra-1-bit))&1 == 1)
+		}
+		labels := make([]string, 0, nibbles+1)
+		for n := nibbles - 1; n >= 0; n-- {
+			v := b[n/2]
+			if n%2 == 0 {
+				v >>= 4
+			}
+			labels = append(labels, fmt.Sprintf("%x", v&0xf))
+		}
+		labels = append(labels, "ip6.arpa")
+		zones = append(zones, strings.Join(labels, "."))
+	}
+	return zones
+}
+
+func reverseDelegation(label, cidr string) (ReverseDelegation, error) {
+	p, err := netip.ParsePrefix(cidr)
+	if err != nil || !p.Addr().Is6() {
+		return ReverseDelegation{}, failf(ErrInvalidPrefix, "%q is not an IPv6 prefix", cidr)
+	}
+	return ReverseDelegation{Label: label, Prefix: p.Masked().String(), Zones: reverseZones(p)}, nil
+}
+
+// planDelegations lists the base, every POP and the first prefix of each
+// level in every POP.
+func planDelegations(plan IPv6Plan) ([]ReverseDelegation, error) {
+	var out []ReverseDelegation
+	add := func(label, cidr string) error {
+		d, err := reverseDelegation(label, cidr)
+		if err == nil {
+			out = append(out, d)
+		}
+		return err
+	}
+	if err := add("Base", plan.BaseSubnet); err != nil {
+		return nil, err
+	}
+	for _, pop := range plan.POPAllocations {
+		if err := add(fmt.Sprintf("POP %d", pop.POPNumber), pop.POPSubnet); err != nil {
+			return nil, err
+		}
+		for i, subnet := range pop.Subnets {
+			if err := add(fmt.Sprintf("POP %d %s, first", pop.POPNumber, pop.LevelNames[i]), subnet.CIDR); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+// runReverseZones implements the reverse-zones command.
+func runReverseZones(args []string) {
+	fs := flag.NewFlagSet("reverse-zones", flag.ExitOnError)
+	planPath := fs.String("plan", "", "List the zones for the base, POPs and levels of this plan JSON file")
+	jsonOut := fs.Bool("j", false, "JSON output format")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner reverse-zones [-j] (-plan plan.json | prefix ...)")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var delegations []ReverseDelegation
+	var plan IPv6Plan
+	if *planPath != "" {
+		var err error
+		plan, err = loadPlan(*planPath)
+		if err == nil {
+			delegations, err = planDelegations(plan)
+		}
+		if err != nil {
+			fmt.Printf("Error loading plan: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	for _, arg := range fs.Args() {
+		d, err := reverseDelegation("", arg)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		delegations = append(delegations, d)
+	}
+	if len(delegations) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if *jsonOut {
+		jsonData, err := json.MarshalIndent(delegations, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+
+	if *planPath != "" {
+		fmt.Println("Prefix lengths:")
+		for _, size := range append([]int{prefixLenOf(plan.BaseSubnet), plan.PreferredSize}, plan.SubnetLevels...) {
+			if size%4 == 0 {
+				fmt.Printf("  /%d: nibble-aligned, one zone per prefix\n", size)
+			} else {
+				fmt.Printf("  /%d: not nibble-aligned, %d /%d zones per prefix\n", size, 1<<uint(4-size%4), size+4-size%4)
+			}
+		}
+		fmt.Println()
+	}
+	for _, d := range delegations {
+		if d.Label != "" {
+			fmt.Printf("%s: %s\n", d.Label, d.Prefix)
+		} else {
+			fmt.Println(d.Prefix)
+		}
+		for _, zone := range d.Zones {
+			fmt.Printf("  %s\n", zone)
+		}
+	}
+}
+
+func prefixLenOf(cidr string) int {
+	p, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return 0
+	}
+	return p.Bits()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// MRT record types (RFC 6396) read by loadRIB. Only the IPv6 unicast RIB
+// entries of TABLE_DUMP_V2 carry prefixes the plan cares about; everything
+// else (peer index tables, IPv4, BGP4MP updates) is skipped.
+const (
+	mrtTableDumpV2           = 13
+	mrtRIBIPv6Unicast        = 4
+	mrtRIBIPv6UnicastAddPath = 10
+)
+
+// loadRIB reads the announced prefixes of a RIB export. The file is either
+// an MRT TABLE_DUMP_V2 dump (optionally .gz or .bz2), or flat JSON: an array
+// of prefixes, an array of objects with a "prefix" key, or an object holding
+// such an array under "routes" or "prefixes". Reading a full-table dump
+// stops when ctx is cancelled.
+func loadRIB(ctx context.Context, path string) ([]auditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	case strings.HasSuffix(path, ".bz2"):
+		r = bzip2.NewReader(f)
+	}
+	br := bufio.NewReader(r)
+
+	var entries []auditEntry
+	first, err := firstNonSpace(br)
+	if err == nil && (first == '[' || first == '{') {
+		entries, err = parseRIBJSON(br, path)
+	} else {
+		entries, err = parseMRT(ctx, br, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return entries, nil
+}
+
+func firstNonSpace(br *bufio.Reader) (byte, error) {
+	for n := 1; ; n++ {
+		b, err := br.Peek(n)
+		if err != nil {
+			return 0, err
+		}
+		switch c := b[n-1]; c {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return c, nil
+		}
+	}
+}
+
+// parseRIBJSON reads the flat JSON forms accepted by loadRIB. Route objects
+// may name the origin with "origin_as" or "origin", which is kept for the
+// report.
+func parseRIBJSON(r io.Reader, path string) ([]auditEntry, error) {
+	var doc interface{}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if obj, ok := doc.(map[string]interface{}); ok {
+		switch {
+		case obj["routes"] != nil:
+			doc = obj["routes"]
+		case obj["prefixes"] != nil:
+			doc = obj["prefixes"]
+		default:
+			return nil, fmt.Errorf(`expected a "routes" or "prefixes" array`)
+		}
+	}
+	routes, ok := doc.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array of routes")
+	}
+
+	var entries []auditEntry
+	for i, route := range routes {
+		source := fmt.Sprintf("%s#%d", path, i+1)
+		var value string
+		switch v := route.(type) {
+		case string:
+			value = v
+		case map[string]interface{}:
+			value, _ = v["prefix"].(string)
+			for _, key := range []string{"origin_as", "origin"} {
+				if origin, ok := v[key]; ok && origin != nil {
+					source += fmt.Sprintf(" (AS%v)", origin)
+					break
+				}
+			}
+		}
+		p, err := netip.ParsePrefix(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %q is not a prefix", i+1, value)
+		}
+		if p.Addr().Is6() {
+			entries = append(entries, auditEntry{Prefix: p.Masked(), Source: source})
+		}
+	}
+	return entries, nil
+}
+
+// parseMRT reads the IPv6 unicast prefixes of a TABLE_DUMP_V2 dump. Each RIB
+// record holds one prefix followed by per-peer entries, which are not
+// needed here.
+func parseMRT(ctx context.Context, r io.Reader, path string) ([]auditEntry, error) {
+	var entries []auditEntry
+	header := make([]byte, 12)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return entries, nil
+			}
+			return nil, fmt.Errorf("truncated MRT header")
+		}
+		typ := binary.BigEndian.Uint16(header[4:6])
+		subtype := binary.BigEndian.Uint16(header[6:8])
+		body := make([]byte, binary.BigEndian.Uint32(header[8:12]))
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, fmt.Errorf("truncated MRT record")
+		}
+		if typ != mrtTableDumpV2 || (subtype != mrtRIBIPv6Unicast && subtype != mrtRIBIPv6UnicastAddPath) {
+			continue
+		}
+		if len(body) < 5 {
+			return nil, fmt.Errorf("short RIB record")
+		}
+		seq := binary.BigEndian.Uint32(body[0:4])
+		bits := int(body[4])
+		n := (bits + 7) / 8
+		if bits > 128 || len(body) < 5+n {
+			return nil, fmt.Errorf("bad prefix in RIB record %d", seq)
+		}
+		var addr [16]byte
+		copy(addr[:], body[5:5+n])
+		p := netip.PrefixFrom(netip.AddrFrom16(addr), bits).Masked()
+		entries = append(entries, auditEntry{Prefix: p, Source: fmt.Sprintf("%s#%d", path, seq)})
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// RouterInterface is one address to configure on a POP's router.
+type RouterInterface struct {
+	Name        string
+	Description string
+	Role        string
+	Address     netip.Prefix
+}
+
+// POPRouter is the turn-up addressing of one POP.
+type POPRouter struct {
+	POP        int
+	Prefix     string
+	PrefixLen  int
+	Interfaces []RouterInterface
+}
+
+// interfaceNames holds the naming templates for one platform. Templates see
+// .POP (POP number), .Index (0-based) and .Number (1-based).
+type interfaceNames struct {
+	loopback, p2p, lan string
+}
+
+var platformInterfaceNames = map[string]interfaceNames{
+	"iosxe": {loopback: "Loopback0", p2p: "TenGigabitEthernet0/1/{{.Index}}", lan: "GigabitEthernet0/0/{{.Index}}"},
+	"junos": {loopback: "lo0", p2p: "xe-0/0/{{.Index}}", lan: "ge-0/1/{{.Index}}"},
+	"eos":   {loopback: "Loopback0", p2p: "Ethernet{{.Number}}", lan: "Vlan{{.Number}}"},
+	"frr":   {loopback: "lo", p2p: "eth{{.Number}}", lan: "br{{.Index}}"},
+	// openconfig is written as JSON by openConfigDocument, not a template
+	"openconfig": {loopback: "Loopback0", p2p: "Ethernet{{.Number}}", lan: "Vlan{{.Number}}"},
+}
+
+// genericInterfaceNames name interfaces by role where no platform is given.
+var genericInterfaceNames = interfaceNames{loopback: "lo", p2p: "p2p{{.Number}}", lan: "lan{{.Number}}"}
+
+var platformTemplates = map[string]string{
+	"iosxe": `! POP {{.POP}} ({{.Prefix}})
+ipv6 unicast-routing
+!
+{{- range .Interfaces}}
+interface {{.Name}}
+ description {{.Description}}
+ ipv6 address {{.Address}}
+ no shutdown
+!
+{{- end}}
+`,
+	"junos": `/* POP {{.POP}} ({{.Prefix}}) */
+{{- range .Interfaces}}
+set interfaces {{.Name}} unit 0 description "{{.Description}}"
+set interfaces {{.Name}} unit 0 family inet6 address {{.Address}}
+{{- end}}
+`,
+	"eos": `! POP {{.POP}} ({{.Prefix}})
+ipv6 unicast-routing
+!
+{{- range .Interfaces}}
+interface {{.Name}}
+   description {{.Description}}
+{{- if eq .Role "p2p"}}
+   no switchport
+{{- end}}
+   ipv6 address {{.Address}}
+!
+{{- end}}
+`,
+	// FRR also gets the POP aggregate as a blackhole route, so it can be
+	// announced while more-specifics come and go, and prefix-lists with
+	// route-maps that export only the aggregate and accept the POP's own
+	// more-specifics internally.
+	"frr": `! POP {{.POP}} ({{.Prefix}})
+frr defaults traditional
+!
+{{- range .Interfaces}}
+interface {{.Name}}
+ description {{.Description}}
+ ipv6 address {{.Address}}
+exit
+!
+{{- end}}
+ipv6 route {{.Prefix}} blackhole
+!
+ipv6 prefix-list POP{{.POP}}-AGGREGATE seq 5 permit {{.Prefix}}
+ipv6 prefix-list POP{{.POP}}-MORE-SPECIFICS seq 5 permit {{.Prefix}} ge {{inc .PrefixLen}} le 128
+!
+route-map POP{{.POP}}-EXPORT permit 10
+ match ipv6 address prefix-list POP{{.POP}}-AGGREGATE
+exit
+route-map POP{{.POP}}-EXPORT deny 20
+exit
+!
+route-map POP{{.POP}}-INTERNAL permit 10
+ match ipv6 address prefix-list POP{{.POP}}-MORE-SPECIFICS
+exit
+route-map POP{{.POP}}-INTERNAL deny 20
+exit
+!
+`,
+}
+
+var routerTemplateFuncs = template.FuncMap{
+	"inc": func(n int) int { return n + 1 },
+}
+
+// roleLevel finds the level carrying role, falling back to the usual size
+// for it when no level has the role assigned.
+func roleLevel(pop POPAlloc, role string, fallback int) (int, bool) {
+	sizes := make(map[int]bool)
+	for _, subnet := range pop.Subnets {
+		size := prefixLenOf(subnet.CIDR)
+		if subnet.Role == role {
+			return size, true
+		}
+		sizes[size] = true
+	}
+	return fallback, sizes[fallback]
+}
+
+// addrAdd returns a + n.
+func addrAdd(a netip.Addr, n *big.Int) netip.Addr {
+	b := a.As16()
+	sum := new(big.Int).Add(new(big.Int).SetBytes(b[:]), n)
+	sum.FillBytes(b[:])
+	return netip.AddrFrom16(b)
+}
+
+// nthPrefix returns the i-th /size counted from start.
+func nthPrefix(start netip.Addr, size, i int) netip.Prefix {
+	step := new(big.Int).Lsh(big.NewInt(int64(i)), uint(128-size))
+	return netip.PrefixFrom(addrAdd(start, step), size)
+}
+
+// buildPOPRouter lays out the turn-up addressing of one POP. LAN gateways
+// take ::1 of the first LAN prefixes at the start of the POP. Infrastructure
+// comes from the top of the POP so it never collides with them: the
+// loopback is ::1 in the last /64, and point-to-point links are
+// the first prefixes of the p2p size in the /64 below it (or, for /64
+// links, the /64s counting down from there).
+func buildPOPRouter(pop POPAlloc, names interfaceNames, links, lans int) (POPRouter, error) {
+	prefix, err := netip.ParsePrefix(pop.POPSubnet)
+	if err != nil {
+		return POPRouter{}, err
+	}
+	router := POPRouter{POP: pop.POPNumber, Prefix: prefix.String(), PrefixLen: prefix.Bits()}
+	name := func(tmpl string, i int) (string, error) {
+		t, err := template.New("name").Parse(tmpl)
+		if err != nil {
+			return "", err
+		}
+		var b bytes.Buffer
+		err = t.Execute(&b, struct{ POP, Index, Number int }{pop.POPNumber, i, i + 1})
+		return b.String(), err
+	}
+	add := func(tmpl, role, description string, i int, addr netip.Prefix) error {
+		n, err := name(tmpl, i)
+		if err == nil {
+			router.Interfaces = append(router.Interfaces, RouterInterface{Name: n, Description: description, Role: role, Address: addr})
+		}
+		return err
+	}
+
+	if prefix.Bits() > 62 {
+		return router, failf(ErrPrefixTooSmall, "POP %d: a /%d POP is too small for separate LAN and infrastructure /64s", pop.POPNumber, prefix.Bits())
+	}
+	top := lastAddress(prefix)
+	loopbackBlock := netip.PrefixFrom(top, 64).Masked().Addr()
+	linkBlock := nthPrefix(loopbackBlock, 64, -1).Addr()
+
+	// /64s taken from the top of the POP for the loopback and the links
+	infra := 1
+	if _, ok := roleLevel(pop, roleLoopback, 128); ok {
+		if err := add(names.loopback, roleLoopback, fmt.Sprintf("POP %d loopback", pop.POPNumber), 0, netip.PrefixFrom(addrAdd(loopbackBlock, big.NewInt(1)), 128)); err != nil {
+			return router, err
+		}
+	}
+
+	if size, ok := roleLevel(pop, roleP2P, 127); ok && links > 0 {
+		if size < 64 {
+			return router, failf(ErrInvalidLevel, "POP %d: p2p links are /%d; use /127 or /64 [RFC 6164]", pop.POPNumber, size)
+		}
+		if size == 64 {
+			infra += links
+		} else if size-64 < 62 && int64(links) > int64(1)<<uint(size-64) {
+			return router, failf(ErrPrefixTooSmall, "POP %d: %d /%d links do not fit in one /64", pop.POPNumber, links, size)
+		} else {
+			infra++
+		}
+		for i := 0; i < links; i++ {
+			// /127 links use both addresses (RFC 6164); on /64 links the
+			// router takes ::1
+			link := nthPrefix(linkBlock, size, i)
+			addr := link.Addr()
+			if size == 64 {
+				link = nthPrefix(linkBlock, size, -i)
+				addr = addrAdd(link.Addr(), big.NewInt(1))
+			}
+			if err := add(names.p2p, roleP2P, fmt.Sprintf("POP %d p2p link %d", pop.POPNumber, i+1), i, netip.PrefixFrom(addr, size)); err != nil {
+				return router, err
+			}
+		}
+	}
+
+	if size, ok := roleLevel(pop, roleLAN, 64); ok && lans > 0 {
+		needed := big.NewInt(1)
+		if size <= 64 {
+			needed.Lsh(big.NewInt(int64(lans)), uint(64-size))
+		}
+		needed.Add(needed, big.NewInt(int64(infra)))
+		if max := calculateAvailableSubnets(prefix.Bits(), 64); needed.Cmp(max) > 0 {
+			return router, failf(ErrPrefixTooSmall, "POP %d: %d LANs do not fit beside the infrastructure /64s", pop.POPNumber, lans)
+		}
+		for i := 0; i < lans; i++ {
+			lan := nthPrefix(prefix.Addr(), size, i)
+			gateway := addrAdd(lan.Addr(), big.NewInt(1))
+			if err := add(names.lan, roleLAN, fmt.Sprintf("POP %d LAN %d", pop.POPNumber, i+1), i, netip.PrefixFrom(gateway, size)); err != nil {
+				return router, err
+			}
+		}
+	}
+	return router, nil
+}
+
+// runRouterConfig implements the router-config command.
+func runRouterConfig(args []string) {
+	fs := flag.NewFlagSet("router-config", flag.ExitOnError)
+	planPath := fs.String("plan", "", "Plan JSON file to take the POPs from")
+	platform := fs.String("platform", "iosxe", "Configuration syntax: "+strings.Join(platformNames(), ", "))
+	popNumber := fs.Int("pop", 0, "Only this POP (default: every POP)")
+	links := fs.Int("links", 2, "Point-to-point links per POP")
+	lans := fs.Int("lans", 1, "LAN gateways per POP")
+	loopbackName := fs.String("loopback-name", "", "Loopback interface name template (default depends on -platform)")
+	p2pName := fs.String("p2p-name", "", "Link interface name template, e.g. \"Ethernet{{.Number}}\"")
+	lanName := fs.String("lan-name", "", "LAN interface name template, e.g. \"Vlan{{.Number}}\"")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner router-config -plan plan.json [-platform iosxe|junos|eos|frr|openconfig] [-pop n] [-links n] [-lans n]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *planPath == "" || fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	names, ok := platformInterfaceNames[*platform]
+	if !ok {
+		fmt.Printf("Error: unknown platform %q (expected one of %s)\n", *platform, strings.Join(platformNames(), ", "))
+		os.Exit(1)
+	}
+	if *loopbackName != "" {
+		names.loopback = *loopbackName
+	}
+	if *p2pName != "" {
+		names.p2p = *p2pName
+	}
+	if *lanName != "" {
+		names.lan = *lanName
+	}
+	if *links < 0 || *lans < 0 {
+		fmt.Println("Error: -links and -lans cannot be negative")
+		os.Exit(1)
+	}
+
+	plan, err := loadPlan(*planPath)
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+	tmpl := template.Must(template.New(*platform).Funcs(routerTemplateFuncs).Parse(platformTemplates[*platform]))
+
+	var documents []interface{}
+	found := false
+	for _, pop := range plan.POPAllocations {
+		if *popNumber != 0 && pop.POPNumber != *popNumber {
+			continue
+		}
+		found = true
+		router, err := buildPOPRouter(pop, names, *links, *lans)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *platform == "openconfig" {
+			documents = append(documents, openConfigDocument(router))
+			continue
+		}
+		if err := tmpl.Execute(os.Stdout, router); err != nil {
+			fmt.Printf("Error generating configuration: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if !found {
+		fmt.Printf("Error: POP %d is not in %s\n", *popNumber, *planPath)
+		os.Exit(1)
+	}
+
+	if *platform == "openconfig" {
+		// One POP is one device: emit its tree as is. Several POPs
+		// become an array of trees in POP order.
+		var out interface{} = documents
+		if *popNumber != 0 {
+			out = documents[0]
+		}
+		jsonData, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	}
+}
+
+func platformNames() []string {
+	names := make([]string, 0, len(platformInterfaceNames))
+	for name := range platformInterfaceNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
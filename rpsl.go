@@ -0,0 +1,235 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// rpslContacts are the handles every inet6num object carries.
+type rpslContacts struct {
+	org, mntBy, adminC, techC, country, netname, source string
+}
+
+// inet6numObject is an RPSL inet6num object for the RIPE database.
+type inet6numObject struct {
+	prefix         string
+	netname        string
+	descr          string
+	country        string
+	status         string
+	assignmentSize int
+}
+
+// customerRoles are the roles whose prefixes go to customers and so are
+// registered.
+var customerRoles = map[string]bool{roleSite: true, roleBusiness: true, roleResidential: true}
+
+// rpslNetname joins parts into a netname, keeping to the letters, digits,
+// "-" and "_" the RIPE database accepts.
+func rpslNetname(parts ...string) string {
+	name := strings.ToUpper(strings.Join(parts, "-"))
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			return r
+		}
+		return '-'
+	}, name)
+}
+
+// inet6numObjects lists the objects registering a plan's customer-facing
+// space: an AGGREGATED-BY-LIR object per POP for the first level with a
+// customer role, an ASSIGNED object per delegated block, and an ASSIGNED
+// object per assigned prefix. A POP's location gives the country, and
+// c.country stands in when it has none.
+func inet6numObjects(plan IPv6Plan, assigned []auditEntry, c rpslContacts) ([]inet6numObject, error) {
+	_, pops, err := auditBlocks(plan)
+	if err != nil {
+		return nil, err
+	}
+	country := func(pop *POPAlloc, what string) (string, error) {
+		if pop != nil && pop.Location != nil && pop.Location.Country != "" {
+			return pop.Location.Country, nil
+		}
+		if c.country == "" {
+			return "", fmt.Errorf("%s has no country; give one with -country", what)
+		}
+		return c.country, nil
+	}
+
+	var objects []inet6numObject
+	for i := range pops {
+		pop := &pops[i].alloc
+		for j, subnet := range pop.Subnets {
+			if !customerRoles[subnet.Role] {
+				continue
+			}
+			cc, err := country(pop, popName(*pop))
+			if err != nil {
+				return nil, err
+			}
+			label := fmt.Sprint(pop.POPNumber)
+			if pop.Name != "" {
+				label = pop.Name
+			}
+			objects = append(objects, inet6numObject{
+				prefix:         pop.POPSubnet,
+				netname:        rpslNetname(c.netname, label),
+				descr:          fmt.Sprintf("%s %s customers", popName(*pop), subnet.Role),
+				country:        cc,
+				status:         "AGGREGATED-BY-LIR",
+				assignmentSize: plan.SubnetLevels[j],
+			})
+			break
+		}
+	}
+
+	for _, block := range plan.Delegations {
+		cc, err := country(nil, "the block delegated to "+block.Organization)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, inet6numObject{
+			prefix:  block.Prefix,
+			netname: rpslNetname(c.netname, block.Organization),
+			descr:   "Delegated to " + block.Organization,
+			country: cc,
+			status:  "ASSIGNED",
+		})
+	}
+
+	count := make(map[int]int)
+	index := newPOPIndex(pops)
+	for _, e := range assigned {
+		pop, _ := index.locate(e.Prefix)
+		if pop == nil {
+			return nil, failf(ErrOutsideBase, "%s (%s) is not inside a POP block", e.Prefix, e.Source)
+		}
+		if e.POP != "" && !matchesPOP(pop.alloc, e.POP) {
+			return nil, failf(ErrOutsideBase, "%s (%s) is listed for POP %s but is inside %s", e.Prefix, e.Source, e.POP, popName(pop.alloc))
+		}
+		cc, err := country(&pop.alloc, popName(pop.alloc))
+		if err != nil {
+			return nil, err
+		}
+		count[pop.alloc.POPNumber]++
+		label := fmt.Sprint(pop.alloc.POPNumber)
+		if pop.alloc.Name != "" {
+			label = pop.alloc.Name
+		}
+		descr := e.Description
+		if descr == "" {
+			descr = "Customer of " + popName(pop.alloc)
+		}
+		objects = append(objects, inet6numObject{
+			prefix:  e.Prefix.String(),
+			netname: rpslNetname(c.netname, label, fmt.Sprint(count[pop.alloc.POPNumber])),
+			descr:   descr,
+			country: cc,
+			status:  "ASSIGNED",
+		})
+	}
+	return objects, nil
+}
+
+// writeRPSL writes the objects in RPSL, separated by blank lines as the
+// RIPE database's update methods expect.
+func writeRPSL(w io.Writer, objects []inet6numObject, c rpslContacts) error {
+	for i, o := range objects {
+		attrs := [][2]string{
+			{"inet6num", o.prefix},
+			{"netname", o.netname},
+			{"descr", o.descr},
+			{"country", o.country},
+		}
+		if c.org != "" {
+			attrs = append(attrs, [2]string{"org", c.org})
+		}
+		attrs = append(attrs,
+			[2]string{"admin-c", c.adminC},
+			[2]string{"tech-c", c.techC},
+			[2]string{"status", o.status})
+		if o.assignmentSize > 0 {
+			attrs = append(attrs, [2]string{"assignment-size", fmt.Sprint(o.assignmentSize)})
+		}
+		attrs = append(attrs,
+			[2]string{"mnt-by", c.mntBy},
+			[2]string{"source", c.source})
+
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		for _, a := range attrs {
+			if _, err := fmt.Fprintf(w, "%-15s %s\n", a[0]+":", a[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func runInet6num(args []string) {
+	fs := flag.NewFlagSet("inet6num", flag.ExitOnError)
+	planPath := fs.String("plan", "", "Plan JSON file to register")
+	var c rpslContacts
+	fs.StringVar(&c.mntBy, "mnt", "", "Maintainer of the objects (mnt-by)")
+	fs.StringVar(&c.adminC, "admin-c", "", "Administrative contact handle")
+	fs.StringVar(&c.techC, "tech-c", "", "Technical contact handle (default: -admin-c)")
+	fs.StringVar(&c.org, "org", "", "Organisation handle, e.g. ORG-EXA1-RIPE")
+	fs.StringVar(&c.country, "country", "", "Country code for POPs without a location")
+	fs.StringVar(&c.netname, "netname", "", "Netname prefix (default: the maintainer without -MNT)")
+	fs.StringVar(&c.source, "source", "RIPE", "Database the objects are for")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner inet6num -plan plan.json -mnt EXAMPLE-MNT -admin-c AB123-RIPE [-org ORG-EXA1-RIPE] [assigned.csv ...]")
+		fmt.Println("Each CSV line is prefix[,pop[,description]], as for audit.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *planPath == "" || c.mntBy == "" || c.adminC == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if c.techC == "" {
+		c.techC = c.adminC
+	}
+	if c.netname == "" {
+		c.netname = strings.TrimSuffix(strings.ToUpper(c.mntBy), "-MNT")
+	}
+	c.country = strings.ToUpper(c.country)
+
+	plan, err := loadPlan(*planPath)
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+	var assigned []auditEntry
+	for _, path := range fs.Args() {
+		entries, invalid, err := loadAuditCSV(path)
+		if err == nil && len(invalid) > 0 {
+			err = fmt.Errorf("%s: %s is not an IPv6 prefix", invalid[0].Source, invalid[0].Prefix)
+		}
+		if err != nil {
+			fmt.Printf("Error loading assignments: %v\n", err)
+			os.Exit(1)
+		}
+		assigned = append(assigned, entries...)
+	}
+
+	objects, err := inet6numObjects(plan, assigned, c)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(objects) == 0 {
+		fmt.Println("Error: nothing to register: no level has a customer role (site, business or residential), no blocks are delegated and no assignments were given")
+		os.Exit(1)
+	}
+	if err := writeRPSL(os.Stdout, objects, c); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Rule scopes: what prefix lengths a rule constrains.
+const (
+	ruleScopeLevel = "level"
+	ruleScopePOP   = "pop"
+	ruleScopeBase  = "base"
+)
+
+// Rule severities. Errors stop plan generation; warnings are noted in the
+// plan like policy findings.
+const (
+	ruleError   = "error"
+	ruleWarning = "warning"
+)
+
+// Rule is one organizational constraint on prefix lengths, for example
+// "customer assignments are /48 on nibble boundaries":
+//
+//	{"name": "customer-48", "roles": ["site", "business", "residential"],
+//	 "prefix_length": 48, "nibble": true}
+//
+// A level rule applies to the levels with one of Roles or listed in Levels,
+// or to every level when both are empty. MinLength and MaxLength bound the
+// prefix length, so "min_length": 44 rejects anything shorter than a /44.
+// Message, if set, is added to every violation, to point at the standard
+// the rule enforces.
+type Rule struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description,omitempty"`
+	Scope        string   `json:"scope,omitempty"`
+	Roles        []string `json:"roles,omitempty"`
+	Levels       []int    `json:"levels,omitempty"`
+	PrefixLength int      `json:"prefix_length,omitempty"`
+	MinLength    int      `json:"min_length,omitempty"`
+	MaxLength    int      `json:"max_length,omitempty"`
+	Nibble       bool     `json:"nibble,omitempty"`
+	Severity     string   `json:"severity,omitempty"`
+	Message      string   `json:"message,omitempty"`
+}
+
+// ruleViolation is a rule broken by a plan.
+type ruleViolation struct {
+	rule    Rule
+	message string
+}
+
+func (v ruleViolation) String() string {
+	label := v.rule.Name
+	if v.rule.Description != "" {
+		label += " (" + v.rule.Description + ")"
+	}
+	if v.rule.Message != "" {
+		return fmt.Sprintf("Rule %s: %s; %s", label, v.message, v.rule.Message)
+	}
+	return fmt.Sprintf("Rule %s: %s", label, v.message)
+}
+
+// loadRules reads a rules file: {"rules": [...]}.
+func loadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Rules []Rule `json:"rules"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := checkRules(doc.Rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return doc.Rules, nil
+}
+
+// checkRules rejects rules that could never be evaluated.
+func checkRules(rules []Rule) error {
+	for i, r := range rules {
+		if r.Name == "" {
+			return fmt.Errorf("rule %d has no name", i+1)
+		}
+		switch r.Scope {
+		case "", ruleScopeLevel, ruleScopePOP, ruleScopeBase:
+		default:
+			return fmt.Errorf("rule %s: unknown scope %q (expected %s, %s or %s)", r.Name, r.Scope, ruleScopeLevel, ruleScopePOP, ruleScopeBase)
+		}
+		switch r.Severity {
+		case "", ruleError, ruleWarning:
+		default:
+			return fmt.Errorf("rule %s: unknown severity %q (expected %s or %s)", r.Name, r.Severity, ruleError, ruleWarning)
+		}
+		for _, role := range r.Roles {
+			if !containsString(levelRoles, role) {
+				return fmt.Errorf("rule %s: unknown role %q (expected one of %s)", r.Name, role, strings.Join(levelRoles, ", "))
+			}
+		}
+		if (len(r.Roles) > 0 || len(r.Levels) > 0) && r.Scope != "" && r.Scope != ruleScopeLevel {
+			return fmt.Errorf("rule %s: roles and levels only apply to level rules", r.Name)
+		}
+		if r.PrefixLength == 0 && r.MinLength == 0 && r.MaxLength == 0 && !r.Nibble {
+			return fmt.Errorf("rule %s sets no constraint (prefix_length, min_length, max_length or nibble)", r.Name)
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleTargets lists the prefix lengths rule r constrains in a plan, in
+// order, and how to name each one in a violation.
+func ruleTargets(r Rule, baseSize, popSize int, levels []int, roles map[int]string) ([]int, func(int) string) {
+	switch r.Scope {
+	case ruleScopeBase:
+		return []int{baseSize}, func(size int) string { return fmt.Sprintf("the base /%d", size) }
+	case ruleScopePOP:
+		return []int{popSize}, func(size int) string { return fmt.Sprintf("the POP size /%d", size) }
+	}
+	var targets []int
+	for _, level := range levels {
+		if (len(r.Roles) == 0 && len(r.Levels) == 0) || containsInt(r.Levels, level) || containsString(r.Roles, roles[level]) {
+			targets = append(targets, level)
+		}
+	}
+	sort.Ints(targets)
+	return targets, func(size int) string {
+		if role := roles[size]; role != "" {
+			return fmt.Sprintf("%s level /%d", role, size)
+		}
+		return fmt.Sprintf("level /%d", size)
+	}
+}
+
+// evaluateRules checks the base, POP and level prefix lengths of a plan
+// against rules.
+func evaluateRules(rules []Rule, baseSize, popSize int, levels []int, roles map[int]string) []ruleViolation {
+	var violations []ruleViolation
+	for _, r := range rules {
+		targets, what := ruleTargets(r, baseSize, popSize, levels, roles)
+		for _, size := range targets {
+			add := func(format string, args ...interface{}) {
+				violations = append(violations, ruleViolation{r, what(size) + " " + fmt.Sprintf(format, args...)})
+			}
+			switch {
+			case r.PrefixLength != 0 && size != r.PrefixLength:
+				add("must be a /%d", r.PrefixLength)
+			case r.MinLength != 0 && size < r.MinLength:
+				add("is shorter than /%d", r.MinLength)
+			case r.MaxLength != 0 && size > r.MaxLength:
+				add("is longer than /%d", r.MaxLength)
+			}
+			if r.Nibble && size%4 != 0 {
+				add("is not on a nibble boundary")
+			}
+		}
+	}
+	return violations
+}
+
+// applyRules checks a plan's levels against its assignment policy and its
+// organizational rules. It returns the warnings to record in the plan, or
+// an error listing every rule broken at error severity.
+func applyRules(opts PlanOptions, baseSize, popSize int) ([]string, error) {
+	policyWarnings, err := checkPolicy(opts.Policy, opts.Roles, opts.SubnetLevels)
+	if err != nil {
+		return nil, err
+	}
+	var warnings []string
+	for _, warning := range policyWarnings {
+		warnings = append(warnings, "Warning: "+warning)
+	}
+	if err := checkRules(opts.Rules); err != nil {
+		return nil, err
+	}
+	var broken strings.Builder
+	for _, v := range evaluateRules(opts.Rules, baseSize, popSize, opts.SubnetLevels, opts.Roles) {
+		if v.rule.Severity == ruleWarning {
+			warnings = append(warnings, "Warning: "+v.String())
+		} else {
+			fmt.Fprintf(&broken, "\n  - %s", v)
+		}
+	}
+	if broken.Len() > 0 {
+		return nil, errors.New("the plan breaks these rules:" + broken.String())
+	}
+	return warnings, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+)
+
+// currentSchemaVersion is the plan document format written by this build.
+// Bump it whenever a layout change would make older documents decode
+// incorrectly, and register a migration from the previous version in
+// planMigrations so they keep loading. Purely additive optional fields do not
+// need a bump.
+const currentSchemaVersion = 2
+
+// planMigrations maps a schema version to the function that upgrades a raw
+// document from that version to the next one. Documents written before
+// versioning was introduced carry no schema_version and are treated as 1.
+var planMigrations = map[int]func(doc map[string]interface{}) error{
+	1: migrateV1ToV2,
+}
+
+// migrateV1ToV2 handles documents from before schema_version existed, which
+// kept an empty name for every level that was skipped, so level_names[i] did
+// not always describe subnets[i]. It drops those names to realign them.
+func migrateV1ToV2(doc map[string]interface{}) error {
+	pops, _ := doc["pop_allocations"].([]interface{})
+	for _, p := range pops {
+		pop, ok := p.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("malformed pop_allocations entry")
+		}
+		names, _ := pop["level_names"].([]interface{})
+		aligned := []interface{}{}
+		for _, name := range names {
+			if s, ok := name.(string); ok && s != "" {
+				aligned = append(aligned, s)
+			}
+		}
+		pop["level_names"] = aligned
+	}
+	return nil
+}
+
+// migratePlanDocument decodes a plan document and runs every migration needed
+// to bring it to currentSchemaVersion. It returns the upgraded document and
+// the version it was stored at.
+func migratePlanDocument(data []byte) (map[string]interface{}, int, error) {
+	// Counts below /64 exceed float64 precision, so numbers are kept as
+	// written rather than decoded into interface{}'s default float64.
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, 0, fmt.Errorf("invalid plan document: %v", err)
+	}
+
+	version := 1
+	if raw, ok := doc["schema_version"]; ok {
+		n, _ := raw.(json.Number)
+		v, err := strconv.Atoi(string(n))
+		if err != nil || v < 1 {
+			return nil, 0, failf(ErrUnsupportedSchema, "invalid schema_version %v", raw)
+		}
+		version = v
+	}
+	if version > currentSchemaVersion {
+		return nil, 0, failf(ErrUnsupportedSchema, "schema version %d is newer than supported version %d", version, currentSchemaVersion)
+	}
+
+	from := version
+	for version < currentSchemaVersion {
+		migrate, ok := planMigrations[version]
+		if !ok {
+			return nil, 0, failf(ErrUnsupportedSchema, "no migration from schema version %d", version)
+		}
+		if err := migrate(doc); err != nil {
+			return nil, 0, fmt.Errorf("migrating from schema version %d: %v", version, err)
+		}
+		version++
+		doc["schema_version"] = version
+	}
+
+	return doc, from, nil
+}
+
+// decodePlan upgrades a plan document to the current schema and decodes it.
+func decodePlan(data []byte) (IPv6Plan, int, error) {
+	var plan IPv6Plan
+	doc, from, err := migratePlanDocument(data)
+	if err != nil {
+		return plan, 0, err
+	}
+	upgraded, err := json.Marshal(doc)
+	if err != nil {
+		return plan, 0, err
+	}
+	if err := json.Unmarshal(upgraded, &plan); err != nil {
+		return plan, 0, fmt.Errorf("invalid plan document: %v", err)
+	}
+	// Plans written before max_pop_count existed get it from their base
+	// and POP size
+	for p := &plan; p != nil; p = p.ULAPlan {
+		if base, err := netip.ParsePrefix(p.BaseSubnet); err == nil && p.MaxPOPCount == nil {
+			p.MaxPOPCount = maxPOPCount(base.Bits(), p.PreferredSize)
+		}
+	}
+	return plan, from, nil
+}
+
+// loadPlan reads a plan document from disk, upgrading it in memory if it was
+// written by an older release.
+func loadPlan(path string) (IPv6Plan, error) {
+	data, err := readPlanFile(path)
+	if err != nil {
+		return IPv6Plan{}, err
+	}
+	plan, _, err := decodePlan(data)
+	if err != nil {
+		return IPv6Plan{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return plan, nil
+}
+
+// writePlan stores plan as indented JSON at path.
+func writePlan(path string, plan IPv6Plan, perm os.FileMode) error {
+	jsonData, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(jsonData, '\n'), perm)
+}
+
+// runUpgrade implements the upgrade command, rewriting each named plan
+// document in place at the current schema version.
+func runUpgrade(args []string) {
+	fs := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Print the changes as a diff without rewriting any file")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner upgrade [-dry-run] plan.json [plan.json ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		if err := upgradeFile(path, *dryRun); err != nil {
+			fmt.Printf("Error upgrading %v\n", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func upgradeFile(path string, dryRun bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if isAgeEncrypted(data) {
+		// Rewriting it would either leave it in the clear or need its
+		// recipients; plans are migrated when read anyway.
+		return fmt.Errorf("%s: plan is encrypted; decrypt it with age, upgrade and re-encrypt", path)
+	}
+	plan, from, err := decodePlan(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if from == currentSchemaVersion {
+		fmt.Printf("%s: already at schema version %d\n", path, currentSchemaVersion)
+		return nil
+	}
+	if plan.Integrity != nil {
+		// The old checksum covers the old layout and can no longer match.
+		plan.Integrity = nil
+		fmt.Printf("%s: dropped embedded checksum/signature, re-export to seal the upgraded plan\n", path)
+	}
+	if dryRun {
+		jsonData, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		fmt.Print(unifiedDiff(path, path+" (upgraded)", string(data), string(jsonData)+"\n"))
+		fmt.Printf("%s: would upgrade from schema version %d to %d\n", path, from, currentSchemaVersion)
+		return nil
+	}
+	if err := writePlan(path, plan, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	fmt.Printf("%s: upgraded from schema version %d to %d\n", path, from, currentSchemaVersion)
+	return nil
+}
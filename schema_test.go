@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestDecodePlanDerivesMaxPOPCount(t *testing.T) {
+	for _, tc := range []struct {
+		doc  string
+		want string
+	}{
+		{`{"schema_version": 1, "base_subnet": "2001:db8::/32", "pop_count": 3, "preferred_size": 40, "pop_allocations": []}`, "256"},
+		{`{"base_subnet": "2001:db8::/32", "pop_count": 1, "preferred_size": 32, "pop_allocations": []}`, "1"},
+		{`{"schema_version": 2, "base_subnet": "2001:db8::/32", "pop_count": 3, "preferred_size": 40, "max_pop_count": 7, "pop_allocations": []}`, "7"},
+	} {
+		plan, _, err := decodePlan([]byte(tc.doc))
+		if err != nil {
+			t.Fatalf("decodePlan(%s): %v", tc.doc, err)
+		}
+		if plan.MaxPOPCount == nil || plan.MaxPOPCount.String() != tc.want {
+			t.Errorf("decodePlan(%s): max_pop_count %v, want %s", tc.doc, plan.MaxPOPCount, tc.want)
+		}
+	}
+}
+
+func TestMigrateV1RealignsLevelNames(t *testing.T) {
+	doc := `{"base_subnet": "2001:db8::/32", "pop_count": 1, "preferred_size": 40, "pop_allocations": [{"pop_number": 1, "pop_subnet": "2001:db8::/40", "level_names": ["", "/48", "", "/64"]}]}`
+	plan, from, err := decodePlan([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != 1 || plan.SchemaVersion != currentSchemaVersion {
+		t.Errorf("decoded from version %d to %d, want 1 to %d", from, plan.SchemaVersion, currentSchemaVersion)
+	}
+	if names := plan.POPAllocations[0].LevelNames; len(names) != 2 || names[0] != "/48" || names[1] != "/64" {
+		t.Errorf("level_names %q, want [/48 /64]", names)
+	}
+}
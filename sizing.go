@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// autoPOPSize returns the largest POP prefix (shortest length) that still
+// gives every POP its own block inside a base of baseSize bits, plus any
+// growth bits, together with a sentence explaining the choice for the plan
+// output.
+func autoPOPSize(baseSize, popCount, popBits, growthBits int, nibble bool) (int, string) {
+	size := baseSize + popBits + growthBits
+	note := fmt.Sprintf("POP size /%d chosen automatically: %d POPs need %d bit(s) after the /%d base",
+		size, popCount, popBits, baseSize)
+	if growthBits > 0 {
+		note += fmt.Sprintf(", plus %d growth bit(s)", growthBits)
+	}
+	note += fmt.Sprintf(", room for %d POPs.", int64(1)<<uint(popBits+growthBits))
+
+	if nibble && size%4 != 0 {
+		aligned := (size + 3) / 4 * 4
+		note += fmt.Sprintf(" Rounded from /%d to /%d so POP boundaries fall on a nibble (one hex digit), leaving room for %d POPs.",
+			size, aligned, int64(1)<<uint(aligned-baseSize))
+		size = aligned
+	}
+	return size, note
+}
+
+// popSizing is the POP size a plan uses and the per-POP demand it was
+// derived from.
+type popSizing struct {
+	size     int
+	note     string
+	demands  [][]LevelDemand
+	required []int
+	blocks   [][]presetBlock
+}
+
+// sizePOPs chooses the POP size: from a preset or the requirements when
+// they count demand, from the POP count with -auto-size, and otherwise the
+// size asked for.
+func sizePOPs(opts PlanOptions, baseSize, popCount, popBits int) (popSizing, error) {
+	sizing := popSizing{size: opts.PreferredSize}
+	var err error
+	switch {
+	case opts.Preset != "":
+		if len(opts.Split) > 0 {
+			return sizing, errors.New("-preset and -split cannot be combined")
+		}
+		sizing.size, sizing.demands, sizing.blocks, sizing.required, sizing.note, err = sizeFromPreset(opts.Preset, opts.Requirements, opts.Roles, opts.NibbleAlign)
+	case hasDemand(opts.Requirements):
+		sizing.size, sizing.demands, sizing.required, sizing.note, err = sizeFromRequirements(opts.Requirements, opts.Roles, opts.NibbleAlign)
+	case opts.AutoSize:
+		sizing.size, sizing.note = autoPOPSize(baseSize, popCount, popBits, opts.GrowthBits, opts.NibbleAlign)
+	}
+	return sizing, err
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// POP orders accepted by -sort. Plans are generated in index order, and every
+// output walks the POPs and their levels in slice order, so the same
+// parameters always produce the same document.
+const (
+	sortByIndex  = "index"
+	sortByPrefix = "prefix"
+	sortByName   = "name"
+)
+
+// popName is the label a POP is shown and sorted under.
+func popName(pop POPAlloc) string {
+	if pop.Name != "" {
+		return fmt.Sprintf("POP %d (%s)", pop.POPNumber, pop.Name)
+	}
+	return fmt.Sprintf("POP %d", pop.POPNumber)
+}
+
+// Label exposes popName to templates.
+func (pop POPAlloc) Label() string {
+	return popName(pop)
+}
+
+// sortPOPs reorders the POPs of plan, and of its ULA plan in step with them.
+// Ties keep index order, so the result is the same on every run.
+func sortPOPs(plan *IPv6Plan, order string) error {
+	var less func(a, b POPAlloc) bool
+	switch order {
+	case "", sortByIndex:
+		less = func(a, b POPAlloc) bool { return a.POPNumber < b.POPNumber }
+	case sortByPrefix:
+		less = func(a, b POPAlloc) bool {
+			_, x, errX := net.ParseCIDR(a.POPSubnet)
+			_, y, errY := net.ParseCIDR(b.POPSubnet)
+			if errX != nil || errY != nil {
+				return a.POPSubnet < b.POPSubnet
+			}
+			if c := bytes.Compare(x.IP.To16(), y.IP.To16()); c != 0 {
+				return c < 0
+			}
+			return prefixLen(x) < prefixLen(y)
+		}
+	case sortByName:
+		less = func(a, b POPAlloc) bool {
+			if a.Name != "" || b.Name != "" {
+				return naturalLess(a.Name, b.Name)
+			}
+			return naturalLess(popName(a), popName(b))
+		}
+	default:
+		return fmt.Errorf("unknown sort order %q (expected %s, %s or %s)", order, sortByIndex, sortByPrefix, sortByName)
+	}
+
+	pops := plan.POPAllocations
+	perm := make([]int, len(pops))
+	for i := range perm {
+		perm[i] = i
+	}
+	sort.SliceStable(perm, func(i, j int) bool {
+		a, b := pops[perm[i]], pops[perm[j]]
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return a.POPNumber < b.POPNumber
+	})
+
+	plan.POPAllocations = permutePOPs(pops, perm)
+	if plan.ULAPlan != nil && len(plan.ULAPlan.POPAllocations) == len(pops) {
+		ula := *plan.ULAPlan
+		ula.POPAllocations = permutePOPs(ula.POPAllocations, perm)
+		plan.ULAPlan = &ula
+	}
+	return nil
+}
+
+func permutePOPs(pops []POPAlloc, perm []int) []POPAlloc {
+	sorted := make([]POPAlloc, len(pops))
+	for i, p := range perm {
+		sorted[i] = pops[p]
+	}
+	return sorted
+}
+
+// naturalLess compares strings with runs of digits compared by value, so
+// "POP 2" sorts before "POP 10".
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digitRun(a), digitRun(b)
+		if da > 0 && db > 0 {
+			na, nb := trimZeros(a[:da]), trimZeros(b[:db])
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[da:], b[db:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func digitRun(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+func trimZeros(s string) string {
+	for len(s) > 1 && s[0] == '0' {
+		s = s[1:]
+	}
+	return s
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// PoolShare is the part of each POP given to one pool, such as a wholesale
+// partner or the retail customers, as a percentage of the POP's prefixes at
+// the split level.
+type PoolShare struct {
+	Name    string  `json:"name"`
+	Percent float64 `json:"percent"`
+}
+
+// POPPool is one pool of a split POP, or one block of a -preset: the
+// prefixes it holds at its level and, when the requirements count its
+// customers, its demand.
+type POPPool struct {
+	Name       string   `json:"name"`
+	Percent    float64  `json:"percent,omitempty"`
+	PrefixSize int      `json:"prefix_size"`
+	Prefixes   []string `json:"prefixes"`
+	Capacity   *big.Int `json:"capacity"`
+	Required   int      `json:"required,omitempty"`
+}
+
+// parseSplit reads "wholesale=25,retail=75" into pool shares, in the order
+// given, which is the order the pools are laid out in each POP.
+func parseSplit(s string) ([]PoolShare, error) {
+	var shares []PoolShare
+	total := 0.0
+	seen := make(map[string]bool)
+	for _, item := range splitList(s) {
+		name, value, ok := strings.Cut(item, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid entry %q (expected pool=percent)", item)
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return nil, fmt.Errorf("%s: %q is not a percentage above 0 and up to 100", name, value)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s is listed twice", name)
+		}
+		seen[name] = true
+		total += percent
+		shares = append(shares, PoolShare{Name: name, Percent: percent})
+	}
+	if total > 100+1e-9 {
+		return nil, fmt.Errorf("the shares add up to %g%%, more than 100%%", total)
+	}
+	return shares, nil
+}
+
+// formatSplit is the inverse of parseSplit.
+func formatSplit(shares []PoolShare) string {
+	items := make([]string, len(shares))
+	for i, s := range shares {
+		items[i] = s.Name + "=" + strconv.FormatFloat(s.Percent, 'f', -1, 64)
+	}
+	return strings.Join(items, ",")
+}
+
+// splitLevelFor is the level the pools divide: the one given, or else the
+// most general level handed to customers.
+func splitLevelFor(level int, roles map[int]string, levels []int) (int, error) {
+	if level == 0 {
+		var ok bool
+		level, ok = demandLevel(roles, []string{roleResidential, roleBusiness, roleSite})
+		if !ok {
+			return 0, fmt.Errorf("no level has a customer role (site, business or residential) to split; set -roles or -split-level")
+		}
+	}
+	if !containsInt(levels, level) {
+		return 0, failf(ErrInvalidLevel, "the split level /%d is not one of the subnet levels", level)
+	}
+	return level, nil
+}
+
+// checkSplit returns the level the -split pools divide, or 0 without
+// -split, and checks every pool the requirements count customers in is
+// one of the pools.
+func checkSplit(opts PlanOptions, popSize int) (int, error) {
+	level := 0
+	if len(opts.Split) > 0 {
+		var err error
+		level, err = splitLevelFor(opts.SplitLevel, opts.Roles, opts.SubnetLevels)
+		if err == nil && level <= popSize {
+			err = failf(ErrInvalidLevel, "the split level /%d is not longer than the /%d POPs", level, popSize)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	for i, req := range opts.Requirements {
+		for pool := range req.PoolCustomers {
+			found := false
+			for _, share := range opts.Split {
+				found = found || share.Name == pool
+			}
+			if !found {
+				return 0, fmt.Errorf("%s counts %s customers, but -split has no %s pool", requirementName(req, i), pool, pool)
+			}
+		}
+	}
+	return level, nil
+}
+
+// splitPOP lays the pools out one after another from the start of the POP,
+// each taking its share of the POP's prefixes at the split level, rounded
+// down. A pool that rounds down to nothing is an error. Shares below 100%
+// leave the rest of the POP unsplit.
+func splitPOP(pop netip.Prefix, level int, shares []PoolShare, demand map[string]int) ([]POPPool, error) {
+	total := calculateAvailableSubnets(pop.Bits(), level)
+	start := new(big.Int)
+	pools := make([]POPPool, len(shares))
+	for i, share := range shares {
+		// Basis points keep the rounding exact for any prefix count
+		bp := big.NewInt(int64(share.Percent*100 + 0.5))
+		count := new(big.Int).Mul(total, bp)
+		count.Quo(count, big.NewInt(10000))
+		if count.Sign() == 0 {
+			return nil, failf(ErrPrefixTooSmall, "%g%% of the %s /%ds in a /%d POP is less than one prefix", share.Percent, total, level, pop.Bits())
+		}
+		pools[i] = POPPool{
+			Name:       share.Name,
+			Percent:    share.Percent,
+			PrefixSize: level,
+			Capacity:   count,
+			Required:   demand[share.Name],
+		}
+		for _, p := range rangePrefixes(pop.Addr(), start, count, level) {
+			pools[i].Prefixes = append(pools[i].Prefixes, p.String())
+		}
+		start.Add(start, count)
+	}
+	return pools, nil
+}
+
+// rangePrefixes covers count /size prefixes, starting at the index'th one
+// after base, with the fewest aligned prefixes.
+func rangePrefixes(base netip.Addr, index, count *big.Int, size int) []netip.Prefix {
+	var prefixes []netip.Prefix
+	pos := new(big.Int).Set(index)
+	left := new(big.Int).Set(count)
+	for left.Sign() > 0 {
+		// The largest block aligned at pos that does not overrun the range
+		bits := 0
+		for bits < size && pos.Bit(bits) == 0 && new(big.Int).Lsh(big.NewInt(1), uint(bits+1)).Cmp(left) <= 0 {
+			bits++
+		}
+		offset := new(big.Int).Lsh(pos, uint(128-size))
+		prefixes = append(prefixes, netip.PrefixFrom(addrAdd(base, offset), size-bits))
+		block := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+		pos.Add(pos, block)
+		left.Sub(left, block)
+	}
+	return prefixes
+}
+
+// Unsplit is what the pools of a POP leave over at the split level.
+func (pop POPAlloc) Unsplit() *big.Int {
+	if len(pop.Pools) == 0 || pop.Pools[0].Percent == 0 {
+		return new(big.Int)
+	}
+	prefix, err := netip.ParsePrefix(pop.POPSubnet)
+	if err != nil {
+		return new(big.Int)
+	}
+	left := calculateAvailableSubnets(prefix.Bits(), pop.Pools[0].PrefixSize)
+	for _, pool := range pop.Pools {
+		left.Sub(left, pool.Capacity)
+	}
+	return left
+}
+
+// Summary describes a pool's use, e.g. "48 of 64 /56s used (75.0%)".
+func (pool POPPool) Summary() string {
+	if pool.Required == 0 && pool.Percent == 0 {
+		return fmt.Sprintf("%s /%ds", pool.Capacity, pool.PrefixSize)
+	}
+	if pool.Required == 0 {
+		return fmt.Sprintf("%s /%ds (%g%%)", pool.Capacity, pool.PrefixSize, pool.Percent)
+	}
+	return fmt.Sprintf("%d of %s /%ds used (%.1f%%)", pool.Required, pool.Capacity, pool.PrefixSize, percent(big.NewInt(int64(pool.Required)), pool.Capacity))
+}
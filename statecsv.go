@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stateCSVColumns are the columns of the state-csv format: one row per
+// POP. pop_number, pop_subnet and code identify the POP and its prefix and
+// are checked on import; the rest describe it and may be edited. The plan
+// holds no allocations: those are the assignments CSV allocate appends to,
+// which is edited in a spreadsheet as it is.
+var stateCSVColumns = []string{"pop_number", "pop_subnet", "code", "name", "city", "country", "locode", "latitude", "longitude"}
+
+// writeStateCSV writes a plan's POPs in the state-csv format, for bulk
+// edits in a spreadsheet.
+func writeStateCSV(w io.Writer, plan IPv6Plan) error {
+	cw := csv.NewWriter(w)
+	cw.Write(stateCSVColumns)
+	coord := func(f *float64) string {
+		if f == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*f, 'f', -1, 64)
+	}
+	for _, pop := range plan.POPAllocations {
+		loc := pop.Location
+		if loc == nil {
+			loc = &POPLocation{}
+		}
+		cw.Write([]string{strconv.Itoa(pop.POPNumber), pop.POPSubnet, pop.Code, pop.Name, loc.City, loc.Country, loc.LOCODE, coord(loc.Latitude), coord(loc.Longitude)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// applyStateCSV applies a state-csv file edited in a spreadsheet to plan
+// and returns how many POPs changed. Only names and locations change:
+// a row whose prefix or code differs from the plan's is an error, as
+// moving a POP needs regenerating the plan. Columns may be reordered or
+// left out, and POPs without a row keep their details.
+func applyStateCSV(plan IPv6Plan, data []byte) (IPv6Plan, int, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return plan, 0, err
+	}
+	if len(records) == 0 {
+		return plan, 0, fmt.Errorf("the file is empty")
+	}
+	col := make(map[string]int)
+	for i, name := range records[0] {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !containsString(stateCSVColumns, name) {
+			return plan, 0, fmt.Errorf("unknown column %q (expected %s)", name, strings.Join(stateCSVColumns, ", "))
+		}
+		col[name] = i
+	}
+	if _, ok := col["pop_number"]; !ok {
+		return plan, 0, fmt.Errorf("the pop_number column is missing")
+	}
+
+	pops := append([]POPAlloc(nil), plan.POPAllocations...)
+	byNumber := make(map[int]int)
+	for i, pop := range pops {
+		byNumber[pop.POPNumber] = i
+	}
+	seen := make(map[int]int)
+	changed := 0
+	for n, record := range records[1:] {
+		line := n + 2
+		field := func(name string) (string, bool) {
+			i, ok := col[name]
+			if !ok || i >= len(record) {
+				return "", ok
+			}
+			return strings.TrimSpace(record[i]), true
+		}
+		numberStr, _ := field("pop_number")
+		if numberStr == "" {
+			continue
+		}
+		number, err := strconv.Atoi(numberStr)
+		i, ok := byNumber[number]
+		if err != nil || !ok {
+			return plan, 0, fmt.Errorf("line %d: the plan has no POP %s; adding POPs needs regenerating the plan", line, numberStr)
+		}
+		if prev, dup := seen[number]; dup {
+			return plan, 0, fmt.Errorf("line %d: POP %d is already on line %d", line, number, prev)
+		}
+		seen[number] = line
+		pop := pops[i]
+
+		if subnet, ok := field("pop_subnet"); ok {
+			got, err := netip.ParsePrefix(subnet)
+			want, _ := netip.ParsePrefix(pop.POPSubnet)
+			if err != nil || got.Masked() != want.Masked() {
+				return plan, 0, fmt.Errorf("line %d: POP %d is %s, not %q; prefixes cannot be changed by import", line, number, pop.POPSubnet, subnet)
+			}
+		}
+		if code, ok := field("code"); ok && !strings.EqualFold(code, pop.Code) {
+			return plan, 0, fmt.Errorf("line %d: POP %d has code %q, not %q; a code fixes the POP's prefix and cannot be changed by import", line, number, pop.Code, code)
+		}
+
+		req := POPRequirement{Name: pop.Name}
+		if loc := pop.Location; loc != nil {
+			req.City, req.Country, req.LOCODE, req.Latitude, req.Longitude = loc.City, loc.Country, loc.LOCODE, loc.Latitude, loc.Longitude
+		}
+		for name, target := range map[string]*string{"name": &req.Name, "city": &req.City, "country": &req.Country, "locode": &req.LOCODE} {
+			if value, ok := field(name); ok {
+				*target = value
+			}
+		}
+		for name, target := range map[string]**float64{"latitude": &req.Latitude, "longitude": &req.Longitude} {
+			value, ok := field(name)
+			switch {
+			case !ok:
+			case value == "":
+				*target = nil
+			default:
+				f, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return plan, 0, fmt.Errorf("line %d: %s %q is not a number", line, name, value)
+				}
+				*target = &f
+			}
+		}
+		if err := checkLocation(&req, number-1); err != nil {
+			return plan, 0, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		before := fmt.Sprint(pop.Name, pop.Location)
+		pop.Name, pop.Location = req.Name, req.Location()
+		if fmt.Sprint(pop.Name, pop.Location) != before {
+			changed++
+		}
+		pops[i] = pop
+	}
+
+	// Regenerating with -base-plan matches POPs by name, so names stay
+	// unique
+	named := make(map[string]int)
+	for _, pop := range pops {
+		if pop.Name == "" {
+			continue
+		}
+		key := strings.ToLower(pop.Name)
+		if other, dup := named[key]; dup {
+			return plan, 0, fmt.Errorf("POPs %d and %d are both named %s", other, pop.POPNumber, pop.Name)
+		}
+		named[key] = pop.POPNumber
+	}
+	plan.POPAllocations = pops
+	return plan, changed, nil
+}
+
+// runExport implements the export command, writing a saved plan in any
+// output format.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "text", "Output format: "+strings.Join(exportFormats(), ", "))
+	lang := fs.String("lang", "en", "Language of text and HTML headings: en, es, de or ja")
+	pkg := fs.String("package", "ipv6plan", "Package name of -format go")
+	enumerate := fs.Int("enumerate", defaultJinjaEnumerate, "Prefixes of each level -format jinja lists inside each parent prefix")
+	nested := fs.Bool("nested", false, "Nest -format jinja prefixes in maps per POP and parent prefix instead of flat dotted keys")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner export [-format " + strings.Join(exportFormats(), "|") + "] [-lang en] [-package name] [-enumerate n] [-nested] plan.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if _, ok := exporters[*format]; !ok {
+		fmt.Printf("Error: unknown format %q (expected %s)\n", *format, strings.Join(exportFormats(), ", "))
+		os.Exit(2)
+	}
+	if *enumerate < 1 {
+		fmt.Println("Error: -enumerate must be at least 1")
+		os.Exit(2)
+	}
+	if !goIdentifier.MatchString(*pkg) {
+		fmt.Printf("Error: %q is not a Go package name\n", *pkg)
+		os.Exit(2)
+	}
+	m, err := catalog(*lang)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	plan, err := loadPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+	exporter := newExporter(*format, exportOptions{Messages: m, Lang: strings.ToLower(*lang), Package: *pkg, Enumerate: *enumerate, Nested: *nested})
+	if err := exporter.Export(os.Stdout, plan); err != nil {
+		fmt.Printf("Error generating %s output: %v\n", *format, err)
+		os.Exit(1)
+	}
+}
+
+// exportFormats lists the exporters' format names.
+func exportFormats() []string {
+	var names []string
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runImport implements the import command, applying a state-csv file to a
+// saved plan and writing the updated plan JSON.
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "state-csv", "Input format: state-csv")
+	dryRun := fs.Bool("dry-run", false, "Print the changes to the plan as a diff instead of the updated plan")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner import [-format state-csv] [-dry-run] plan.json edited.csv > updated.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *format != "state-csv" {
+		fmt.Printf("Error: unknown format %q (expected state-csv)\n", *format)
+		os.Exit(2)
+	}
+	plan, err := loadPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(fs.Arg(1))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	var before bytes.Buffer
+	if err := writeJSON(&before, plan); err != nil {
+		fmt.Printf("Error generating JSON: %v\n", err)
+		os.Exit(1)
+	}
+	plan, changed, err := applyStateCSV(plan, data)
+	if err != nil {
+		fmt.Printf("Error importing %s: %v\n", fs.Arg(1), err)
+		os.Exit(1)
+	}
+	if changed > 0 && plan.Integrity != nil {
+		// The checksum covers the old names and can no longer match
+		plan.Integrity = nil
+		fmt.Fprintln(os.Stderr, "Dropped the embedded checksum/signature; re-export to seal the updated plan")
+	}
+	if *dryRun {
+		var after bytes.Buffer
+		if err := writeJSON(&after, plan); err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(unifiedDiff(fs.Arg(0), fs.Arg(0)+" (imported)", before.String(), after.String()))
+		fmt.Fprintf(os.Stderr, "%d POPs would change\n", changed)
+		return
+	}
+	if err := writeJSON(os.Stdout, plan); err != nil {
+		fmt.Printf("Error generating JSON: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "%d POPs changed\n", changed)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// PlanStats summarizes how much of the base subnet a plan uses.
+type PlanStats struct {
+	BaseSubnet     string         `json:"base_subnet"`
+	POPCount       int            `json:"pop_count"`
+	PreferredSize  int            `json:"preferred_size"`
+	MaxPOPCount    *big.Int       `json:"max_pop_count"`
+	DeepestLevel   int            `json:"deepest_level"`
+	Prefixes       []PrefixStats  `json:"prefixes"`
+	AlignmentWaste AlignmentWaste `json:"alignment_waste"`
+}
+
+// PrefixStats counts the prefixes of one size in the base subnet, split into
+// those inside allocated POPs and those still free.
+type PrefixStats struct {
+	PrefixSize       int      `json:"prefix_size"`
+	Total            *big.Int `json:"total"`
+	Allocated        *big.Int `json:"allocated"`
+	Free             *big.Int `json:"free"`
+	AllocatedPercent float64  `json:"allocated_percent"`
+}
+
+// AlignmentWaste is the space lost to rounding. POPIDBits is the width of the
+// POP ID field the POP count needs; a count that is not a power of two
+// leaves UnusedPOPSlots of it empty. NonNibbleLevels are the prefix lengths
+// that do not fall on a 4-bit boundary and so cannot be delegated in
+// ip6.arpa as whole zones.
+type AlignmentWaste struct {
+	POPIDBits       int      `json:"pop_id_bits"`
+	UnusedPOPSlots  *big.Int `json:"unused_pop_slots"`
+	UnusedPercent   float64  `json:"unused_percent"`
+	NonNibbleLevels []int    `json:"non_nibble_levels,omitempty"`
+}
+
+func planStats(plan IPv6Plan) (PlanStats, error) {
+	_, base, err := net.ParseCIDR(plan.BaseSubnet)
+	if err != nil {
+		return PlanStats{}, fmt.Errorf("invalid base subnet %q", plan.BaseSubnet)
+	}
+	ones := prefixLen(base)
+
+	stats := PlanStats{
+		BaseSubnet:    plan.BaseSubnet,
+		POPCount:      plan.POPCount,
+		PreferredSize: plan.PreferredSize,
+		MaxPOPCount:   plan.MaxPOPCount,
+	}
+
+	sizes := map[int]bool{}
+	for _, size := range []int{48, 64} {
+		if size >= ones {
+			sizes[size] = true
+		}
+	}
+	for _, level := range plan.SubnetLevels {
+		if level > stats.DeepestLevel {
+			stats.DeepestLevel = level
+		}
+		sizes[level] = true
+	}
+	var ordered []int
+	for size := range sizes {
+		if size >= plan.PreferredSize {
+			ordered = append(ordered, size)
+		}
+	}
+	sort.Ints(ordered)
+
+	for _, size := range ordered {
+		p := PrefixStats{
+			PrefixSize: size,
+			Total:      new(big.Int).Lsh(big.NewInt(1), uint(size-ones)),
+			Allocated:  new(big.Int).Lsh(big.NewInt(int64(plan.POPCount)), uint(size-plan.PreferredSize)),
+		}
+		p.Free = new(big.Int).Sub(p.Total, p.Allocated)
+		p.AllocatedPercent = percent(p.Allocated, p.Total)
+		stats.Prefixes = append(stats.Prefixes, p)
+	}
+
+	bits := popBits(plan.POPCount)
+	slots := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	stats.AlignmentWaste = AlignmentWaste{
+		POPIDBits:      bits,
+		UnusedPOPSlots: new(big.Int).Sub(slots, big.NewInt(int64(plan.POPCount))),
+	}
+	stats.AlignmentWaste.UnusedPercent = percent(stats.AlignmentWaste.UnusedPOPSlots, slots)
+	for _, size := range append([]int{ones, plan.PreferredSize}, plan.SubnetLevels...) {
+		if size%4 != 0 && !containsInt(stats.AlignmentWaste.NonNibbleLevels, size) {
+			stats.AlignmentWaste.NonNibbleLevels = append(stats.AlignmentWaste.NonNibbleLevels, size)
+		}
+	}
+	return stats, nil
+}
+
+// percent returns part/whole as a percentage, rounded to two decimals.
+func percent(part, whole *big.Int) float64 {
+	if whole.Sign() == 0 {
+		return 0
+	}
+	r := new(big.Rat).SetFrac(new(big.Int).Mul(part, big.NewInt(10000)), whole)
+	f, _ := r.Float64()
+	return float64(int64(f+0.5)) / 100
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// runStats implements the stats command.
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	jsonOut := fs.Bool("j", false, "JSON output format")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner stats [-j] plan.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	plan, err := loadPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+	stats, err := planStats(plan)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOut {
+		jsonData, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+	outputStats(stats)
+}
+
+func outputStats(stats PlanStats) {
+	fmt.Printf("Plan statistics for %s\n", stats.BaseSubnet)
+	fmt.Printf("POPs: %d of %s (/%d each)\n", stats.POPCount, stats.MaxPOPCount, stats.PreferredSize)
+	fmt.Printf("Deepest level: /%d\n", stats.DeepestLevel)
+
+	fmt.Println("\nPrefixes:")
+	for _, p := range stats.Prefixes {
+		fmt.Printf("  /%d: %s allocated, %s free of %s (%.2f%% allocated)\n", p.PrefixSize, p.Allocated, p.Free, p.Total, p.AllocatedPercent)
+	}
+
+	w := stats.AlignmentWaste
+	fmt.Println("\nAlignment waste:")
+	fmt.Printf("  POP ID field: %d bits, %s unused POP slots (%.2f%%)\n", w.POPIDBits, w.UnusedPOPSlots, w.UnusedPercent)
+	if len(w.NonNibbleLevels) > 0 {
+		parts := make([]string, len(w.NonNibbleLevels))
+		for i, size := range w.NonNibbleLevels {
+			parts[i] = fmt.Sprintf("/%d", size)
+		}
+		fmt.Printf("  Not nibble-aligned: %s\n", strings.Join(parts, " "))
+	}
+}
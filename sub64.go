@@ -0,0 +1,33 @@
+package main
+
+import "fmt"
+
+// sub64Levels returns the prefix lengths in the plan that are longer than /64,
+// the POP size included.
+func sub64Levels(preferredSize int, levels []int) []int {
+	var found []int
+	if preferredSize > 64 {
+		found = append(found, preferredSize)
+	}
+	for _, level := range levels {
+		if level > 64 {
+			found = append(found, level)
+		}
+	}
+	return found
+}
+
+// sub64Advisory explains what a prefix longer than /64 means for the hosts
+// and links numbered from it.
+func sub64Advisory(size int) string {
+	switch {
+	case size == 128:
+		return "/128 holds a single address: fine for loopbacks and service VIPs, not usable as a link prefix."
+	case size == 127:
+		return "/127 is for point-to-point links only (RFC 6164); disable the Subnet-Router anycast address on both ends."
+	case size == 126:
+		return "/126 on point-to-point links is legacy practice; RFC 6164 recommends /127 instead."
+	default:
+		return fmt.Sprintf("/%d is longer than /64: SLAAC (RFC 4862) and temporary addresses will not work, so hosts need DHCPv6 or static addressing, and some devices refuse non-/64 on-link prefixes (RFC 7421).", size)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// LevelSuggestion is a proposed -l hierarchy for a POP size, with the
+// reason for each level.
+type LevelSuggestion struct {
+	BaseSize int              `json:"base_size"`
+	POPSize  int              `json:"pop_size"`
+	EndUnit  int              `json:"end_unit"`
+	Levels   []SuggestedLevel `json:"levels"`
+	Notes    []string         `json:"notes,omitempty"`
+}
+
+// SuggestedLevel is one level of a suggestion. PerParent counts its
+// prefixes inside one prefix of the level above, or inside the POP.
+type SuggestedLevel struct {
+	PrefixSize int      `json:"prefix_size"`
+	Role       string   `json:"role,omitempty"`
+	PerParent  *big.Int `json:"per_parent"`
+	Rationale  string   `json:"rationale"`
+}
+
+// wellKnownLevels are the assignment sizes operators recognize, with the
+// role and reason the suggestion gives for each.
+var wellKnownLevels = []struct {
+	size      int
+	role      string
+	rationale string
+}{
+	{48, roleSite, "one /48 per site or business customer (RFC 6177, RIPE-690)"},
+	{56, roleResidential, "one /56 per residential customer or small site (RIPE-690)"},
+	{64, roleLAN, "one /64 per LAN, the size SLAAC needs (RFC 7421)"},
+}
+
+// suggestLevels proposes nibble-aligned levels between a POP and the end
+// unit: the well-known assignment sizes in that range, the end unit itself,
+// and an aggregation level when the POP is more than two hex digits above
+// the first of them.
+func suggestLevels(baseSize, popSize, endUnit int) (LevelSuggestion, error) {
+	if endUnit%4 != 0 || endUnit > 64 {
+		return LevelSuggestion{}, failf(ErrInvalidLevel, "end unit /%d is not a nibble-aligned length up to /64 (use /48 or /64)", endUnit)
+	}
+	if popSize <= baseSize {
+		return LevelSuggestion{}, failf(ErrPrefixTooSmall, "POP size /%d is not more specific than the /%d base", popSize, baseSize)
+	}
+	if endUnit <= popSize {
+		return LevelSuggestion{}, failf(ErrInvalidLevel, "end unit /%d is not more specific than the POP size /%d", endUnit, popSize)
+	}
+
+	s := LevelSuggestion{BaseSize: baseSize, POPSize: popSize, EndUnit: endUnit}
+	for _, known := range wellKnownLevels {
+		if known.size > popSize && known.size <= endUnit {
+			s.Levels = append(s.Levels, SuggestedLevel{PrefixSize: known.size, Role: known.role, Rationale: known.rationale})
+		}
+	}
+	if n := len(s.Levels); n == 0 || s.Levels[n-1].PrefixSize != endUnit {
+		s.Levels = append(s.Levels, SuggestedLevel{PrefixSize: endUnit, Rationale: fmt.Sprintf("the requested end unit, /%d", endUnit)})
+	}
+
+	if first := s.Levels[0].PrefixSize; first-popSize > 8 {
+		agg := (popSize + (first-popSize)/2 + 3) / 4 * 4
+		s.Levels = append(s.Levels, SuggestedLevel{
+			PrefixSize: agg,
+			Rationale: fmt.Sprintf("aggregation inside the POP (a region, city or router), so the %s /%ds per POP are grouped and summarized",
+				new(big.Int).Lsh(big.NewInt(1), uint(first-popSize)), first),
+		})
+		sort.Slice(s.Levels, func(i, j int) bool { return s.Levels[i].PrefixSize < s.Levels[j].PrefixSize })
+	}
+
+	parent := popSize
+	for i := range s.Levels {
+		s.Levels[i].PerParent = new(big.Int).Lsh(big.NewInt(1), uint(s.Levels[i].PrefixSize-parent))
+		parent = s.Levels[i].PrefixSize
+	}
+	if popSize%4 != 0 {
+		aligned := popSize / 4 * 4
+		if aligned <= baseSize {
+			aligned += 4
+		}
+		s.Notes = append(s.Notes, fmt.Sprintf("The /%d POP size is not on a nibble boundary, so one hex digit mixes POP bits with /%d bits. A /%d POP keeps every boundary on a digit.",
+			popSize, s.Levels[0].PrefixSize, aligned))
+	}
+	return s, nil
+}
+
+// Flags renders the suggestion as -l and -roles arguments.
+func (s LevelSuggestion) Flags() string {
+	levels := make([]int, len(s.Levels))
+	var roles []string
+	for i, level := range s.Levels {
+		levels[i] = level.PrefixSize
+		if level.Role != "" {
+			roles = append(roles, fmt.Sprintf("%d=%s", level.PrefixSize, level.Role))
+		}
+	}
+	flags := "-l " + formatLevels(levels)
+	if len(roles) > 0 {
+		flags += " -roles " + strings.Join(roles, ",")
+	}
+	return flags
+}
+
+// runSuggestLevels prints a suggestion for the plan options' base and POP
+// size, applying -auto-size the way plan generation would.
+func runSuggestLevels(opts PlanOptions, endUnitStr string, jsonOut bool) {
+	endUnit, err := parsePrefixLength(endUnitStr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	_, ipNet, err := net.ParseCIDR(opts.Subnet)
+	if err != nil {
+		fmt.Printf("Error parsing subnet: %v\n", err)
+		os.Exit(1)
+	}
+	baseSize, _ := ipNet.Mask.Size()
+	popSize := opts.PreferredSize
+	if opts.AutoSize {
+		popSize, _ = autoPOPSize(baseSize, opts.POPCount, popBits(opts.POPCount), opts.GrowthBits, opts.NibbleAlign)
+	}
+
+	s, err := suggestLevels(baseSize, popSize, endUnit)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOut {
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("Suggested levels for /%d POPs in a /%d base, down to /%d:\n", popSize, baseSize, endUnit)
+	parent := "POP"
+	countWidth := 0
+	for _, level := range s.Levels {
+		if n := len(level.PerParent.String()); n > countWidth {
+			countWidth = n
+		}
+	}
+	for _, level := range s.Levels {
+		fmt.Printf("  /%-3d %*s per %-4s %s\n", level.PrefixSize, countWidth, level.PerParent, parent, level.Rationale)
+		parent = fmt.Sprintf("/%d", level.PrefixSize)
+	}
+	for _, note := range s.Notes {
+		fmt.Printf("\nNote: %s\n", note)
+	}
+	fmt.Printf("\nUse: %s\n", s.Flags())
+}
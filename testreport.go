@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Report formats for check results, so CI pipelines can show plan checks
+// as test results.
+const (
+	reportText  = "text"
+	reportJUnit = "junit"
+	reportTAP   = "tap"
+)
+
+// checkResult is one named check and the problems it found; no problems
+// means it passed.
+type checkResult struct {
+	Name     string
+	Failures []string
+}
+
+// checkSuite groups the checks run against one input.
+type checkSuite struct {
+	Name   string
+	Checks []checkResult
+}
+
+func parseReportFormat(format string) error {
+	switch format {
+	case reportText, reportJUnit, reportTAP:
+		return nil
+	}
+	return fmt.Errorf("unknown format %q (expected %s, %s or %s)", format, reportText, reportJUnit, reportTAP)
+}
+
+// failedChecks counts the checks of suites that found problems.
+func failedChecks(suites []checkSuite) int {
+	n := 0
+	for _, s := range suites {
+		for _, c := range s.Checks {
+			if len(c.Failures) > 0 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// writeChecks writes suites as plain text, JUnit XML or TAP version 13.
+func writeChecks(w io.Writer, format, command string, suites []checkSuite) error {
+	switch format {
+	case reportJUnit:
+		return writeJUnit(w, command, suites)
+	case reportTAP:
+		writeTAP(w, suites)
+	default:
+		for _, s := range suites {
+			fmt.Fprintf(w, "%s:\n", s.Name)
+			for _, c := range s.Checks {
+				if len(c.Failures) == 0 {
+					fmt.Fprintf(w, "  ok    %s\n", c.Name)
+					continue
+				}
+				fmt.Fprintf(w, "  FAIL  %s\n", c.Name)
+				for _, f := range c.Failures {
+					fmt.Fprintf(w, "          %s\n", f)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func writeTAP(w io.Writer, suites []checkSuite) {
+	total := 0
+	for _, s := range suites {
+		total += len(s.Checks)
+	}
+	fmt.Fprintln(w, "TAP version 13")
+	fmt.Fprintf(w, "1..%d\n", total)
+	n := 0
+	for _, s := range suites {
+		for _, c := range s.Checks {
+			n++
+			status := "ok"
+			if len(c.Failures) > 0 {
+				status = "not ok"
+			}
+			fmt.Fprintf(w, "%s %d - %s: %s\n", status, n, s.Name, c.Name)
+			if len(c.Failures) > 0 {
+				fmt.Fprintln(w, "  ---")
+				fmt.Fprintln(w, "  problems:")
+				for _, f := range c.Failures {
+					fmt.Fprintf(w, "    - %q\n", f)
+				}
+				fmt.Fprintln(w, "  ...")
+			}
+		}
+	}
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnit(w io.Writer, command string, suites []checkSuite) error {
+	doc := junitSuites{Name: "ipv6planner " + command}
+	for _, s := range suites {
+		js := junitSuite{Name: s.Name, Tests: len(s.Checks)}
+		for _, c := range s.Checks {
+			jc := junitCase{ClassName: "ipv6planner." + command, Name: c.Name}
+			if len(c.Failures) > 0 {
+				js.Failures++
+				message := fmt.Sprintf("%d problems", len(c.Failures))
+				if len(c.Failures) == 1 {
+					message = "1 problem"
+				}
+				jc.Failure = &junitFailure{
+					Message: message,
+					Text:    strings.Join(c.Failures, "\n"),
+				}
+			}
+			js.Cases = append(js.Cases, jc)
+		}
+		doc.Tests += js.Tests
+		doc.Failures += js.Failures
+		doc.Suites = append(doc.Suites, js)
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(w, xml.Header)
+	fmt.Fprintln(w, string(out))
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// documentationPrefixes are the blocks reserved for documentation
+// (RFC 3849 and RFC 9637) that a twin plan can be placed in.
+var documentationPrefixes = []string{"2001:db8::/32", "3fff::/20"}
+
+// twinBase is the prefix of base's length at the start of the
+// documentation block doc. The bits between the block's length and the
+// base's are part of the real prefix, so they are not carried over; the
+// plan's own numbering lies below the base and is kept by rebasing.
+// "auto" picks 2001:db8::/32 when the base fits in it and 3fff::/20
+// otherwise.
+func twinBase(base, doc string) (string, error) {
+	_, baseNet, err := net.ParseCIDR(base)
+	if err != nil {
+		return "", failf(ErrInvalidPrefix, "invalid base subnet %q", base)
+	}
+	ones, _ := baseNet.Mask.Size()
+	if doc == "auto" {
+		doc = documentationPrefixes[1]
+		if ones >= 32 {
+			doc = documentationPrefixes[0]
+		}
+	}
+	_, docNet, err := net.ParseCIDR(doc)
+	if err != nil || !containsString(documentationPrefixes, docNet.String()) {
+		return "", failf(ErrInvalidPrefix, "%q is not a documentation prefix (expected auto, %s)", doc, strings.Join(documentationPrefixes, " or "))
+	}
+	docOnes, _ := docNet.Mask.Size()
+	if ones < docOnes {
+		return "", failf(ErrPrefixTooSmall, "a /%d base does not fit in %s", ones, docNet)
+	}
+	return (&net.IPNet{IP: docNet.IP, Mask: baseNet.Mask}).String(), nil
+}
+
+// twinPlan returns plan moved into a documentation block, with its
+// structure, POP numbering and names unchanged, for lab environments and
+// documents that must not show the real prefixes. The ULA plan and the
+// parent base of a downstream plan are dropped, as they would show
+// internal numbering.
+func twinPlan(plan IPv6Plan, doc string) (IPv6Plan, error) {
+	base, err := twinBase(plan.BaseSubnet, doc)
+	if err != nil {
+		return plan, err
+	}
+	twin, err := rebasePlan(plan, base)
+	if err != nil {
+		return plan, err
+	}
+	twin.Notes = nil
+	for _, note := range plan.Notes {
+		twin.Notes = append(twin.Notes, strings.ReplaceAll(note, plan.BaseSubnet, twin.BaseSubnet))
+	}
+	if plan.ULAPlan != nil {
+		twin.ULAPlan = nil
+		twin.Notes = append(twin.Notes, "The ULA plan is left out of the documentation twin.")
+	}
+	twin.DelegatedFrom = nil
+	twin.Notes = append(twin.Notes, fmt.Sprintf("Documentation twin in %s: the prefixes are moved; structure, numbering and names are unchanged.", twin.BaseSubnet))
+	return twin, nil
+}
+
+// ipv6Token matches text that may be an IPv6 address or prefix; the
+// candidates are then parsed, so times and MAC addresses are left alone.
+var ipv6Token = regexp.MustCompile(`[0-9A-Fa-f]*:[0-9A-Fa-f]*:[0-9A-Fa-f:.]*(/[0-9]{1,3})?`)
+
+// anonymizeText rewrites every address and prefix inside from to the same
+// position inside to, which has the same length, and leaves the rest of
+// the text as it is.
+func anonymizeText(text string, from, to netip.Prefix) string {
+	return ipv6Token.ReplaceAllStringFunc(text, func(token string) string {
+		addrPart, length, hasLength := strings.Cut(token, "/")
+		addr, err := netip.ParseAddr(addrPart)
+		if err != nil || !addr.Is6() || addr.Zone() != "" || !from.Contains(addr) {
+			return token
+		}
+		a, t := addr.As16(), to.Addr().As16()
+		for i := range a {
+			bits := from.Bits() - 8*i
+			switch {
+			case bits >= 8:
+				a[i] = t[i]
+			case bits > 0:
+				mask := byte(0xff) << uint(8-bits)
+				a[i] = t[i]&mask | a[i]&^mask
+			}
+		}
+		moved := netip.AddrFrom16(a).String()
+		if hasLength {
+			moved += "/" + length
+		}
+		return moved
+	})
+}
+
+func runAnonymize(args []string) {
+	fs := flag.NewFlagSet("anonymize", flag.ExitOnError)
+	to := fs.String("to", "auto", "Documentation prefix to move the real one to: auto, 2001:db8::/32 or 3fff::/20")
+	base := fs.String("base", "", "Real prefix to rewrite in documents other than plan JSON")
+	planPath := fs.String("plan", "", "Take the real prefix from this plan JSON file")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner anonymize [-to auto|2001:db8::/32|3fff::/20] [-base prefix | -plan plan.json] file")
+		fmt.Println("A plan JSON file is rewritten as its documentation twin; any other document (text, Markdown, HTML, CSV) has the addresses and prefixes inside the real prefix rewritten.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	data, err := readPlanFile(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) == nil && fields["pop_allocations"] != nil {
+		plan, _, err := decodePlan(data)
+		if err == nil {
+			plan, err = twinPlan(plan, *to)
+		}
+		if err == nil {
+			err = writeJSON(os.Stdout, plan)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *planPath != "" {
+		plan, err := loadPlan(*planPath)
+		if err != nil {
+			fmt.Printf("Error loading plan: %v\n", err)
+			os.Exit(1)
+		}
+		*base = plan.BaseSubnet
+	}
+	if *base == "" {
+		fmt.Println("Error: give the real prefix with -base or -plan to anonymize a document other than plan JSON")
+		os.Exit(2)
+	}
+	twin, err := twinBase(*base, *to)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	from, _ := netip.ParsePrefix(*base)
+	fmt.Print(anonymizeText(string(data), from.Masked(), netip.MustParsePrefix(twin)))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+)
+
+// randomULAPrefix builds an RFC 4193 fd00::/8 /48 with a random 40-bit
+// Global ID.
+func randomULAPrefix() (string, error) {
+	ip := make(net.IP, net.IPv6len)
+	ip[0] = 0xfd
+	if _, err := rand.Read(ip[1:6]); err != nil {
+		return "", err
+	}
+	return (&net.IPNet{IP: ip, Mask: net.CIDRMask(48, 128)}).String(), nil
+}
+
+// ulaBase derives a ULA base of the given length from a ULA /48. Bases
+// longer than /48 sit at the start of the /48; shorter ones have to drop
+// Global ID bits, which RFC 4193 does not provide for, so a note explains
+// the trade-off.
+func ulaBase(ulaPrefix string, length int) (string, string, error) {
+	ip, _, err := net.ParseCIDR(ulaPrefix)
+	if err != nil {
+		return "", "", failf(ErrInvalidPrefix, "invalid ULA prefix: %v", err)
+	}
+	ip = ip.To16()
+	if ip == nil || ip[0] != 0xfd {
+		return "", "", failf(ErrInvalidPrefix, "%s is not a locally assigned ULA prefix (fd00::/8)", ulaPrefix)
+	}
+	if length < 8 {
+		return "", "", failf(ErrPrefixTooSmall, "a /%d base cannot be mirrored inside fd00::/8", length)
+	}
+
+	base := &net.IPNet{IP: ip.Mask(net.CIDRMask(length, 128)), Mask: net.CIDRMask(length, 128)}
+	note := ""
+	if length < 48 {
+		note = fmt.Sprintf("The ULA plan mirrors a /%d base, which spans %d RFC 4193 Global IDs; only the first %d of the 40 random Global ID bits are kept, so collisions with other ULA users are more likely.",
+			length, int64(1)<<uint(48-length), length-8)
+	}
+	return base.String(), note, nil
+}
+
+// attachULAPlan generates the ULA twin of plan and stores it in plan.ULAPlan.
+func attachULAPlan(plan *IPv6Plan, ulaPrefix string) error {
+	_, ipNet, err := net.ParseCIDR(plan.BaseSubnet)
+	if err != nil {
+		return err
+	}
+	ones, _ := ipNet.Mask.Size()
+
+	generated := false
+	if ulaPrefix == "" {
+		if ulaPrefix, err = randomULAPrefix(); err != nil {
+			return err
+		}
+		generated = true
+	}
+	base, note, err := ulaBase(ulaPrefix, ones)
+	if err != nil {
+		return err
+	}
+
+	ula, err := rebasePlan(*plan, base)
+	if err != nil {
+		return err
+	}
+	ula.Notes = nil
+	// Downstream organizations get global blocks, not a share of the ULA
+	ula.Delegations = nil
+	ula.DelegatedFrom = nil
+	if generated {
+		ula.Notes = append(ula.Notes, fmt.Sprintf("Random ULA prefix %s generated; pass -ula-prefix %s to keep it on later runs.", ulaPrefix, ulaPrefix))
+	}
+	if note != "" {
+		ula.Notes = append(ula.Notes, note)
+	}
+	plan.ULAPlan = &ula
+	return nil
+}
+
+// ULAPOP returns the ULA counterpart of the i-th POP, for templates.
+func (p IPv6Plan) ULAPOP(i int) string {
+	if p.ULAPlan == nil || i >= len(p.ULAPlan.POPAllocations) {
+		return ""
+	}
+	return p.ULAPlan.POPAllocations[i].POPSubnet
+}
+
+// ULASubnet returns the ULA counterpart of subnet j of the i-th POP.
+func (p IPv6Plan) ULASubnet(i, j int) string {
+	if p.ULAPlan == nil || i >= len(p.ULAPlan.POPAllocations) || j >= len(p.ULAPlan.POPAllocations[i].Subnets) {
+		return ""
+	}
+	return p.ULAPlan.POPAllocations[i].Subnets[j].CIDR
+}
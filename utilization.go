@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Utilization splits a pool of prefixes into allocated, reserved and free,
+// for the bars of the HTML report.
+type Utilization struct {
+	Label     string
+	Allocated *big.Int
+	Reserved  *big.Int
+	Total     *big.Int
+}
+
+// Heat thresholds, as a percentage of the pool allocated.
+const (
+	heatWarm = 50
+	heatHot  = 80
+)
+
+// POPSlotUtilization is the use of the POP ID field: the POPs allocated, the
+// slots held back by -growth-bits, and the rest.
+func (plan IPv6Plan) POPSlotUtilization() Utilization {
+	total := plan.MaxPOPCount
+	if total == nil {
+		total = new(big.Int)
+	}
+	reserved := new(big.Int)
+	if plan.GrowthBits > 0 {
+		reserved.Sub(total, new(big.Int).Rsh(total, uint(plan.GrowthBits)))
+	}
+	return Utilization{
+		Label:     fmt.Sprintf("POP slots (/%d)", plan.PreferredSize),
+		Allocated: big.NewInt(int64(plan.POPCount)),
+		Reserved:  reserved,
+		Total:     total,
+	}
+}
+
+// Utilization compares the POP's demand at each level, and each pool's,
+// with what the level or pool holds. POPs planned without requirements have
+// no usage data and so no bars.
+func (pop POPAlloc) Utilization() []Utilization {
+	var u []Utilization
+	for _, d := range pop.Demand {
+		u = append(u, Utilization{
+			Label:     fmt.Sprintf("/%d %s", d.PrefixSize, d.Kind),
+			Allocated: big.NewInt(int64(d.Required)),
+			Reserved:  new(big.Int),
+			Total:     d.Available,
+		})
+	}
+	for _, pool := range pop.Pools {
+		if pool.Required == 0 {
+			continue
+		}
+		u = append(u, Utilization{
+			Label:     fmt.Sprintf("/%d %s pool", pool.PrefixSize, pool.Name),
+			Allocated: big.NewInt(int64(pool.Required)),
+			Reserved:  new(big.Int),
+			Total:     pool.Capacity,
+		})
+	}
+	return u
+}
+
+// Free is what is neither allocated nor reserved.
+func (u Utilization) Free() *big.Int {
+	free := new(big.Int).Sub(u.Total, u.Allocated)
+	return free.Sub(free, u.Reserved)
+}
+
+func (u Utilization) AllocatedPercent() float64 { return percent(u.Allocated, u.Total) }
+func (u Utilization) ReservedPercent() float64  { return percent(u.Reserved, u.Total) }
+func (u Utilization) FreePercent() float64      { return percent(u.Free(), u.Total) }
+
+// Heat is the CSS class for how full the pool is.
+func (u Utilization) Heat() string {
+	used := u.AllocatedPercent()
+	switch {
+	case used >= heatHot:
+		return "heat-hot"
+	case used >= heatWarm:
+		return "heat-warm"
+	}
+	return "heat-cool"
+}
+
+// Hottest is the heat of the fullest level of the POP, or "" without usage
+// data.
+func (pop POPAlloc) Hottest() string {
+	hottest := ""
+	for _, u := range pop.Utilization() {
+		switch h := u.Heat(); {
+		case h == "heat-hot", hottest == "":
+			hottest = h
+		case h == "heat-warm" && hottest == "heat-cool":
+			hottest = h
+		}
+	}
+	return hottest
+}
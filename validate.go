@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"os"
+)
+
+// validatePlan runs the consistency and policy checks on a saved plan.
+func validatePlan(ctx context.Context, plan IPv6Plan, policy string, rules []Rule, rego, regoQuery string) ([]checkResult, error) {
+	base, pops, err := auditBlocks(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	inBase := checkResult{Name: "POPs are inside the base subnet"}
+	overlap := checkResult{Name: "POPs do not overlap"}
+	nesting := checkResult{Name: "Levels nest inside their POP"}
+	demand := checkResult{Name: "Demand fits each POP"}
+	for _, pair := range newPOPIndex(pops).overlaps() {
+		pop, other := pair[0], pair[1]
+		overlap.Failures = append(overlap.Failures, fmt.Sprintf("%s %s overlaps %s %s", popName(pop.alloc), pop.alloc.POPSubnet, popName(other.alloc), other.alloc.POPSubnet))
+	}
+	for _, pop := range pops {
+		if !inside(pop.prefix, base) {
+			inBase.Failures = append(inBase.Failures, fmt.Sprintf("%s %s is outside %s", popName(pop.alloc), pop.prefix, base))
+		}
+		parent := pop.prefix
+		for _, subnet := range pop.alloc.Subnets {
+			p, err := netip.ParsePrefix(subnet.CIDR)
+			if err != nil || !inside(p, parent) || p.Bits() == parent.Bits() {
+				nesting.Failures = append(nesting.Failures, fmt.Sprintf("%s: %s is not inside %s", popName(pop.alloc), subnet.CIDR, parent))
+				break
+			}
+			parent = p
+		}
+		for _, d := range pop.alloc.Demand {
+			if d.Available != nil && d.Available.Cmp(big.NewInt(int64(d.Required))) < 0 {
+				demand.Failures = append(demand.Failures, fmt.Sprintf("%s needs %d %s but has room for %s /%d", popName(pop.alloc), d.Required, d.Kind, d.Available, d.PrefixSize))
+			}
+		}
+	}
+
+	opts, err := optionsFromPlan(plan)
+	if err != nil {
+		return nil, err
+	}
+	policyCheck := checkResult{Name: fmt.Sprintf("Assignment policy (%s)", policyOrDefault(policy))}
+	warnings, err := checkPolicy(policy, opts.Roles, plan.SubnetLevels)
+	if err != nil {
+		return nil, err
+	}
+	policyCheck.Failures = warnings
+
+	addressing := checkResult{Name: "Addressing methods suit their levels"}
+	problems, _ := checkAddressing(opts.Addressing, plan.SubnetLevels)
+	for _, p := range problems {
+		addressing.Failures = append(addressing.Failures, p.problem)
+	}
+
+	checks := []checkResult{inBase, overlap, nesting, demand, policyCheck, addressing}
+	violations := evaluateRules(rules, base.Bits(), plan.PreferredSize, plan.SubnetLevels, opts.Roles)
+	for _, r := range rules {
+		check := checkResult{Name: "Rule " + r.Name}
+		for _, v := range violations {
+			if v.rule.Name == r.Name {
+				check.Failures = append(check.Failures, v.String())
+			}
+		}
+		checks = append(checks, check)
+	}
+
+	if rego != "" {
+		denials, err := evaluateRego(ctx, plan, rego, regoQuery)
+		if err != nil {
+			denials = []string{err.Error()}
+		}
+		checks = append(checks, checkResult{Name: "Rego policy " + regoQuery, Failures: denials})
+	}
+	return checks, nil
+}
+
+func policyOrDefault(policy string) string {
+	if policy == "" {
+		return "bcp"
+	}
+	return policy
+}
+
+// runValidate implements the validate command.
+func runValidate(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	policy := fs.String("policy", "bcp", "Assignment policy profile: bcp, generous or none")
+	format := fs.String("format", reportText, "Report format: text, junit or tap")
+	rulesPath := fs.String("rules", "", "JSON file of organizational rules to check")
+	rego := fs.String("rego", "", "Rego policy file or directory to evaluate the plan against with opa")
+	regoQuery := fs.String("rego-query", defaultRegoQuery, "Rego query whose result lists denials")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner validate [-policy bcp] [-rules rules.json] [-rego policy.rego] [-format text|junit|tap] plan.json ...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := parseReportFormat(*format); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	if _, ok := policyProfiles[*policy]; !ok {
+		fmt.Printf("Error: unknown policy profile %q (expected bcp, generous or none)\n", *policy)
+		os.Exit(2)
+	}
+
+	var rules []Rule
+	if *rulesPath != "" {
+		var err error
+		rules, err = loadRules(*rulesPath)
+		if err != nil {
+			fmt.Printf("Error loading rules: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, cancel := commandContext(0)
+	defer cancel()
+	var suites []checkSuite
+	for _, path := range fs.Args() {
+		suite := checkSuite{Name: path}
+		plan, err := loadPlan(path)
+		if err == nil {
+			suite.Checks, err = validatePlan(ctx, plan, *policy, rules, *rego, *regoQuery)
+		}
+		if err != nil {
+			suite.Checks = []checkResult{{Name: "Plan loads", Failures: []string{err.Error()}}}
+		}
+		suites = append(suites, suite)
+	}
+
+	if err := writeChecks(os.Stdout, *format, "validate", suites); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if failedChecks(suites) > 0 {
+		os.Exit(1)
+	}
+}
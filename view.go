@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// viewHit is one block of a plan an address or prefix falls in.
+type viewHit struct {
+	What   string
+	Prefix string
+	POP    int
+}
+
+// viewPage is what the viewer's templates render.
+type viewPage struct {
+	Plan    *IPv6Plan
+	POP     *POPAlloc
+	Query   string
+	Hits    []viewHit
+	Matches []POPAlloc
+	Error   string
+}
+
+// lookupPlan lists the blocks of plan holding p, from the base down to the
+// level prefixes of its POP, so NOC staff can tell what an address is.
+func lookupPlan(plan IPv6Plan, p netip.Prefix) ([]viewHit, error) {
+	base, pops, err := auditBlocks(plan)
+	if err != nil {
+		return nil, err
+	}
+	p = p.Masked()
+	if !inside(p, base) {
+		return nil, fmt.Errorf("%s is outside the plan's base %s", p, base)
+	}
+	hits := []viewHit{{What: "Base", Prefix: base.String()}}
+	for _, block := range plan.Delegations {
+		if d, err := netip.ParsePrefix(block.Prefix); err == nil && inside(p, d) {
+			hits = append(hits, viewHit{What: "Delegated to " + block.Organization, Prefix: block.Prefix})
+		}
+	}
+	if plan.OOB != nil {
+		if aggregate, err := netip.ParsePrefix(plan.OOB.Aggregate); err == nil && inside(p, aggregate) {
+			hits = append(hits, viewHit{What: "Out-of-band management aggregate", Prefix: plan.OOB.Aggregate})
+		}
+	}
+	for _, pop := range plan.POPAllocations {
+		if pop.OOB == nil {
+			continue
+		}
+		if block, err := netip.ParsePrefix(pop.OOB.Prefix); err == nil && inside(p, block) {
+			hits = append(hits, viewHit{What: "Management block of " + popName(pop), Prefix: pop.OOB.Prefix, POP: pop.POPNumber})
+			for _, network := range pop.OOB.Networks {
+				if n, err := netip.ParsePrefix(network.Prefix); err == nil && inside(p, n) {
+					hits = append(hits, viewHit{What: network.Name + " network", Prefix: network.Prefix, POP: pop.POPNumber})
+				}
+			}
+		}
+	}
+
+	within, _ := newPOPIndex(pops).locate(p)
+	if within == nil {
+		if len(hits) == 1 {
+			hits = append(hits, viewHit{What: "Not allocated to a POP"})
+		}
+		return hits, nil
+	}
+	pop := within.alloc
+	hits = append(hits, viewHit{What: popName(pop), Prefix: pop.POPSubnet, POP: pop.POPNumber})
+	for _, pool := range pop.Pools {
+		for _, prefix := range pool.Prefixes {
+			if block, err := netip.ParsePrefix(prefix); err == nil && inside(p, block) {
+				hits = append(hits, viewHit{What: pool.Name + " pool", Prefix: prefix, POP: pop.POPNumber})
+			}
+		}
+	}
+	for i, subnet := range pop.Subnets {
+		level := prefixLenOf(subnet.CIDR)
+		if level > p.Bits() || level <= within.prefix.Bits() {
+			continue
+		}
+		block := netip.PrefixFrom(p.Addr(), level).Masked()
+		n := new(big.Int).Rsh(addrDiff(within.prefix.Addr(), block.Addr()), uint(128-level))
+		what := fmt.Sprintf("Level %d /%d number %s", i+1, level, n)
+		if subnet.Role != "" {
+			what += " (" + subnet.Role + ")"
+		}
+		hits = append(hits, viewHit{What: what, Prefix: block.String(), POP: pop.POPNumber})
+	}
+	return hits, nil
+}
+
+// searchPlan returns the POPs whose name, code, location, prefix or pool
+// and management network names contain query, ignoring case.
+func searchPlan(plan IPv6Plan, query string) []POPAlloc {
+	query = strings.ToLower(strings.TrimSpace(query))
+	var matches []POPAlloc
+	for _, pop := range plan.POPAllocations {
+		fields := []string{pop.Label(), pop.Code, pop.POPSubnet}
+		if loc := pop.Location; loc != nil {
+			fields = append(fields, loc.City, loc.Country, loc.LOCODE)
+		}
+		for _, pool := range pop.Pools {
+			fields = append(fields, pool.Name)
+		}
+		if pop.OOB != nil {
+			for _, network := range pop.OOB.Networks {
+				fields = append(fields, network.Name)
+			}
+		}
+		for _, field := range fields {
+			if field != "" && strings.Contains(strings.ToLower(field), query) {
+				matches = append(matches, pop)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+const viewTemplate = `
+{{define "top"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{.Plan.BaseSubnet}} address plan</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; }
+        nav { margin-bottom: 20px; }
+        nav form { display: inline; margin-right: 20px; }
+        table { border-collapse: collapse; margin-bottom: 20px; }
+        th, td { border: 1px solid #ddd; padding: 6px 10px; text-align: left; }
+        th { background-color: #f2f2f2; }
+        summary { cursor: pointer; padding: 2px 0; }
+        details ul { margin: 4px 0 8px; }
+        .error { color: #b00020; }
+        code { font-size: 1.05em; }
+    </style>
+</head>
+<body>
+<nav>
+    <a href="/">{{.Plan.BaseSubnet}}</a> |
+    <form action="/lookup"><input name="q" placeholder="Address or prefix" aria-label="Address or prefix to look up"> <button>Look up</button></form>
+    <form action="/search"><input name="q" placeholder="POP, city, code or pool" aria-label="Search POPs"> <button>Search</button></form>
+    <a href="/report">Full report</a> | <a href="/plan.json">Plan JSON</a>
+</nav>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{end}}
+
+{{define "bottom"}}</body>
+</html>
+{{end}}
+
+{{define "index"}}{{template "top" .}}
+<h1>{{.Plan.BaseSubnet}}</h1>
+<p>{{.Plan.POPCount}} POPs of /{{.Plan.PreferredSize}}, room for {{.Plan.MaxPOPCount}}. Levels: {{range $i, $l := .Plan.SubnetLevels}}{{if $i}}, {{end}}/{{$l}}{{end}}.</p>
+{{range .Plan.POPAllocations}}<details>
+    <summary><a href="/pop/{{.POPNumber}}">{{.Label}}</a> <code>{{.POPSubnet}}</code>{{if .Code}} {{.Code}}{{end}}{{with .Location}} {{.City}} {{.Country}}{{end}}</summary>
+    <ul>
+        {{range .Subnets}}<li><code>{{.CIDR}}</code> {{.Count}} prefixes{{if .Role}}, {{.Role}}{{end}}</li>
+        {{end}}{{range .Pools}}<li>{{.Name}} pool: {{range .Prefixes}}<code>{{.}}</code> {{end}}</li>
+        {{end}}{{with .OOB}}<li>Management <code>{{.Prefix}}</code></li>{{end}}
+    </ul>
+</details>
+{{end}}{{with .Plan.Delegations}}<h2>Delegated blocks</h2>
+<table>
+    <tr><th>Organization</th><th>Prefix</th></tr>
+    {{range .}}<tr><td>{{.Organization}}</td><td><code>{{.Prefix}}</code></td></tr>
+    {{end}}</table>
+{{end}}{{with .Plan.Notes}}<h2>Notes</h2>
+<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>
+{{end}}{{template "bottom"}}{{end}}
+
+{{define "pop"}}{{template "top" .}}
+{{with .POP}}<h1>{{.Label}} <code>{{.POPSubnet}}</code></h1>
+{{if .Code}}<p>Code: {{.Code}}</p>{{end}}
+{{with .Location}}<p>Location: {{.City}} {{.Country}} {{.LOCODE}}</p>{{end}}
+<table>
+    <tr><th>Level</th><th>First prefix</th><th>Count</th><th>Role</th><th>Addressing</th></tr>
+    {{range $i, $s := .Subnets}}<tr><td>{{index $.POP.LevelNames $i}}</td><td><code>{{$s.CIDR}}</code></td><td>{{$s.Count}}</td><td>{{$s.Role}}</td><td>{{$s.Addressing}}</td></tr>
+    {{end}}</table>
+{{with .Pools}}<h2>Pools</h2>
+<table>
+    <tr><th>Pool</th><th>Prefixes</th><th>Capacity</th></tr>
+    {{range .}}<tr><td>{{.Name}}</td><td>{{range .Prefixes}}<code>{{.}}</code> {{end}}</td><td>{{.Capacity}} /{{.PrefixSize}}s</td></tr>
+    {{end}}</table>
+{{end}}{{with .OOB}}<h2>Out-of-band management <code>{{.Prefix}}</code></h2>
+<table>
+    <tr><th>Network</th><th>Prefix</th></tr>
+    {{range .Networks}}<tr><td>{{.Name}}</td><td><code>{{.Prefix}}</code></td></tr>
+    {{end}}</table>
+{{end}}{{end}}{{template "bottom"}}{{end}}
+
+{{define "lookup"}}{{template "top" .}}
+<h1>{{.Query}}</h1>
+{{with .Hits}}<table>
+    <tr><th>Block</th><th>Prefix</th></tr>
+    {{range .}}<tr><td>{{if .POP}}<a href="/pop/{{.POP}}">{{.What}}</a>{{else}}{{.What}}{{end}}</td><td><code>{{.Prefix}}</code></td></tr>
+    {{end}}</table>
+{{end}}{{template "bottom"}}{{end}}
+
+{{define "search"}}{{template "top" .}}
+<h1>POPs matching "{{.Query}}"</h1>
+{{with .Matches}}<ul>
+    {{range .}}<li><a href="/pop/{{.POPNumber}}">{{.Label}}</a> <code>{{.POPSubnet}}</code>{{if .Code}} {{.Code}}{{end}}{{with .Location}} {{.City}} {{.Country}}{{end}}</li>
+    {{end}}</ul>
+{{else}}<p>No POP matches.</p>
+{{end}}{{template "bottom"}}{{end}}
+`
+
+// viewHandler serves a plan read-only: every page is built from the plan
+// loaded at start, and only GET and HEAD requests are answered.
+func viewHandler(plan IPv6Plan, planJSON []byte, m messages, lang string) http.Handler {
+	tmpl := template.Must(template.New("view").Parse(viewTemplate))
+	render := func(w http.ResponseWriter, name string, page viewPage, status int) {
+		page.Plan = &plan
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		tmpl.ExecuteTemplate(w, name, page)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			render(w, "index", viewPage{Error: "No such page: " + r.URL.Path}, http.StatusNotFound)
+			return
+		}
+		render(w, "index", viewPage{}, http.StatusOK)
+	})
+	mux.HandleFunc("/pop/", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/pop/"))
+		for i := range plan.POPAllocations {
+			if err == nil && plan.POPAllocations[i].POPNumber == n {
+				render(w, "pop", viewPage{POP: &plan.POPAllocations[i]}, http.StatusOK)
+				return
+			}
+		}
+		render(w, "index", viewPage{Error: "No such POP: " + strings.TrimPrefix(r.URL.Path, "/pop/")}, http.StatusNotFound)
+	})
+	mux.HandleFunc("/lookup", func(w http.ResponseWriter, r *http.Request) {
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		p, err := netip.ParsePrefix(query)
+		if err != nil {
+			var addr netip.Addr
+			if addr, err = netip.ParseAddr(query); err == nil {
+				p = netip.PrefixFrom(addr, 128)
+			}
+		}
+		if err != nil || !p.Addr().Is6() {
+			render(w, "lookup", viewPage{Query: query, Error: fmt.Sprintf("%q is not an IPv6 address or prefix", query)}, http.StatusBadRequest)
+			return
+		}
+		hits, err := lookupPlan(plan, p)
+		page := viewPage{Query: query, Hits: hits}
+		if err != nil {
+			page.Error = err.Error()
+		}
+		render(w, "lookup", page, http.StatusOK)
+	})
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if _, err := netip.ParseAddr(query); err == nil || strings.Contains(query, "/") {
+			http.Redirect(w, r, "/lookup?q="+template.URLQueryEscaper(query), http.StatusSeeOther)
+			return
+		}
+		render(w, "search", viewPage{Query: query, Matches: searchPlan(plan, query)}, http.StatusOK)
+	})
+	mux.HandleFunc("/report", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		writeHTML(w, plan, m, lang, htmlTheme{})
+	})
+	mux.HandleFunc("/plan.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(planJSON)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "the viewer is read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// runView implements the view command.
+func runView(args []string) {
+	fs := flag.NewFlagSet("view", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8080", "Address to serve the viewer on; the default is reachable from this host only")
+	lang := fs.String("lang", "en", "Language of the full report: en, es, de or ja")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner view [-listen 127.0.0.1:8080] [-lang en] plan.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	m, err := catalog(*lang)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	plan, err := loadPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error loading plan: %v\n", err)
+		os.Exit(1)
+	}
+	// The plan as loaded, decrypted and migrated, is what the viewer offers
+	// for download
+	planJSON, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		fmt.Printf("Error generating JSON: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Viewing %s read-only at http://%s/ (Ctrl-C to stop)\n", fs.Arg(0), *listen)
+	if err := http.ListenAndServe(*listen, viewHandler(plan, planJSON, m, strings.ToLower(*lang))); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"time"
+)
+
+// Kinds of watch events.
+const (
+	watchAppeared = "appeared"
+	watchResolved = "resolved"
+)
+
+// WatchEvent is a change in the undocumented prefixes watch sees: one that
+// appeared on the network, or one that was documented or withdrawn.
+type WatchEvent struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Prefix string    `json:"prefix"`
+	Source string    `json:"source,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// watchSources are the files watch reads on every round.
+type watchSources struct {
+	plan     string
+	assigned []string
+	ribs     []string
+	configs  []string
+}
+
+// collect reads every source again and returns the prefixes in use that
+// are not documented: covered by no line of the assignment files or, when
+// there are none, by no POP block of the plan. Unreadable assignment lines
+// are left to audit to report.
+func (s watchSources) collect(ctx context.Context) (map[netip.Prefix]AuditFinding, error) {
+	plan, err := loadPlan(s.plan)
+	if err != nil {
+		return nil, fmt.Errorf("loading plan: %v", err)
+	}
+	var claims, observed []sourcedEntry
+	for _, path := range s.assigned {
+		entries, _, err := loadAuditCSV(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			claims = append(claims, sourcedEntry{path, e})
+		}
+	}
+	if len(s.assigned) == 0 {
+		_, pops, err := auditBlocks(plan)
+		if err != nil {
+			return nil, err
+		}
+		for _, pop := range pops {
+			claims = append(claims, sourcedEntry{s.plan, auditEntry{Prefix: pop.prefix, Source: popName(pop.alloc)}})
+		}
+	}
+	for _, path := range s.ribs {
+		routes, err := loadRIB(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range routes {
+			observed = append(observed, sourcedEntry{path, e})
+		}
+	}
+	for _, path := range s.configs {
+		entries, err := loadConfigPrefixes(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			observed = append(observed, sourcedEntry{path, e})
+		}
+	}
+
+	undocumented := make(map[netip.Prefix]AuditFinding)
+	for _, f := range reconcile(claims, observed, &plan).Findings {
+		if f.Kind == findingUnrecorded {
+			undocumented[netip.MustParsePrefix(f.Prefix)] = f
+		}
+	}
+	return undocumented, nil
+}
+
+// watchChanges compares two rounds' undocumented prefixes, in address
+// order.
+func watchChanges(before, after map[netip.Prefix]AuditFinding, now time.Time) []WatchEvent {
+	var events []WatchEvent
+	for p, f := range after {
+		if _, ok := before[p]; !ok {
+			events = append(events, WatchEvent{Time: now, Event: watchAppeared, Prefix: f.Prefix, Source: f.Source, Detail: f.Detail})
+		}
+	}
+	for p, f := range before {
+		if _, ok := after[p]; !ok {
+			events = append(events, WatchEvent{Time: now, Event: watchResolved, Prefix: f.Prefix, Source: f.Source})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		a, b := netip.MustParsePrefix(events[i].Prefix), netip.MustParsePrefix(events[j].Prefix)
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c < 0
+		}
+		return a.Bits() < b.Bits()
+	})
+	return events
+}
+
+// watchMetrics describes the latest round as gauges: how many prefixes are
+// undocumented, each of them, and when the sources were last read.
+func watchMetrics(undocumented map[netip.Prefix]AuditFinding, last time.Time) []*metricFamily {
+	count := &metricFamily{name: "ipv6planner_watch_undocumented_prefixes", help: "Prefixes in use that no assignment documents."}
+	each := &metricFamily{name: "ipv6planner_watch_undocumented_prefix", help: "1 for each prefix in use that no assignment documents."}
+	read := &metricFamily{name: "ipv6planner_watch_last_success_timestamp_seconds", help: "When watch last read every source."}
+	count.add(big.NewInt(int64(len(undocumented))))
+	for _, f := range undocumented {
+		// Only the prefix: a source's line number shifts as the file changes
+		each.add(big.NewInt(1), "prefix", f.Prefix)
+	}
+	sort.Slice(each.samples, func(i, j int) bool { return each.samples[i].labels[0][1] < each.samples[j].labels[0][1] })
+	read.add(big.NewInt(last.Unix()))
+	return []*metricFamily{count, each, read}
+}
+
+// postWatchEvents sends events to a webhook as a JSON object with an events
+// array.
+func postWatchEvents(url string, events []WatchEvent) error {
+	body, err := json.Marshal(struct {
+		Events []WatchEvent `json:"events"`
+	}{events})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// runWatch implements the watch command: the audit sources are read again
+// every interval, and prefixes that appear in the RIB or router
+// configurations without being documented are reported as events.
+func runWatch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	planPath := fs.String("plan", "", "Plan JSON file; its POP blocks are the documented space when no assignments CSV is given")
+	ribPaths := fs.String("rib", "", "Comma-separated RIB exports (MRT TABLE_DUMP_V2 or flat JSON) of announced prefixes")
+	configPaths := fs.String("configs", "", "Comma-separated router configurations whose interface prefixes are in use")
+	interval := fs.Duration("interval", 5*time.Minute, "How often to read the sources again")
+	once := fs.Bool("once", false, "Read the sources once, report every undocumented prefix and exit")
+	webhook := fs.String("webhook", "", "POST each round's events as JSON to this URL")
+	metricsPath := fs.String("metrics", "", "Write undocumented prefix gauges to this file for the node exporter's textfile collector")
+	jsonOut := fs.Bool("j", false, "Print events as JSON lines")
+	fs.Usage = func() {
+		fmt.Println("Usage: ipv6planner watch -plan plan.json [-rib rib.json,...] [-configs r1.conf,...] [-interval 5m] [-once] [-webhook url] [-metrics file.prom] [-j] [assigned.csv ...]")
+		fmt.Println("Each CSV line is prefix[,pop[,description]], as for audit.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	sources := watchSources{plan: *planPath, assigned: fs.Args(), ribs: splitList(*ribPaths), configs: splitList(*configPaths)}
+	if sources.plan == "" || len(sources.ribs)+len(sources.configs) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *interval < time.Second {
+		fmt.Println("Error: -interval must be at least 1s")
+		os.Exit(2)
+	}
+
+	ctx, stop := commandContext(0)
+	defer stop()
+	// The first round's prefixes are all new, so they are reported too
+	known := map[netip.Prefix]AuditFinding{}
+	var pending []WatchEvent
+	for {
+		undocumented, err := sources.collect(ctx)
+		now := time.Now().UTC()
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			// A source caught mid-rewrite is read again next round; nothing
+			// is resolved by failing to read it
+			fmt.Fprintf(os.Stderr, "%s Error: %v\n", now.Format(time.RFC3339), err)
+			if *once {
+				os.Exit(1)
+			}
+		default:
+			events := watchChanges(known, undocumented, now)
+			known = undocumented
+			for _, e := range events {
+				if *jsonOut {
+					line, _ := json.Marshal(e)
+					fmt.Println(string(line))
+				} else {
+					fmt.Printf("%s %-9s %-40s %s\n", e.Time.Format(time.RFC3339), e.Event, e.Prefix, e.Source)
+				}
+			}
+			if *metricsPath != "" {
+				if err := writeMetricsFile(*metricsPath, watchMetrics(undocumented, now)); err != nil {
+					fmt.Fprintf(os.Stderr, "%s Error writing %s: %v\n", now.Format(time.RFC3339), *metricsPath, err)
+				}
+			}
+			if *webhook != "" {
+				// Undelivered events go out with the next round's
+				pending = append(pending, events...)
+				if len(pending) > 0 {
+					if err := postWatchEvents(*webhook, pending); err != nil {
+						fmt.Fprintf(os.Stderr, "%s Error: %v\n", now.Format(time.RFC3339), err)
+					} else {
+						pending = nil
+					}
+				}
+			}
+		}
+		if *once {
+			if len(known) > 0 {
+				os.Exit(1)
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*interval):
+		}
+	}
+}